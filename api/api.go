@@ -0,0 +1,170 @@
+// Package api holds what the versioned JSON APIs of the chain and wallet
+// servers share: the router, the error objects, the request validation and
+// the check of the OpenAPI documents against the routes.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	PREFIX = "/api/v1"
+	// requests with larger bodies are refused
+	MAX_BODY_SIZE = 1 << 20
+)
+
+// Error codes, the status code tells the class of error, the code the
+// precise reason
+const (
+	CODE_BAD_REQUEST        = "bad_request"
+	CODE_VALIDATION         = "validation_failed"
+	CODE_NOT_FOUND          = "not_found"
+	CODE_METHOD_NOT_ALLOWED = "method_not_allowed"
+	CODE_UNAUTHORIZED       = "unauthorized"
+	CODE_CONFLICT           = "conflict"
+	CODE_REJECTED           = "rejected"
+	CODE_BAD_GATEWAY        = "bad_gateway"
+	CODE_UNAVAILABLE        = "unavailable"
+	CODE_INTERNAL           = "internal_error"
+)
+
+// Error is the body of every failed request: {"error": {...}}
+type Error struct {
+	Status  int               `json:"-"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+func NewError(status int, code string, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return NewError(http.StatusBadRequest, CODE_BAD_REQUEST, message)
+}
+
+func NotFound(message string) *Error {
+	return NewError(http.StatusNotFound, CODE_NOT_FOUND, message)
+}
+
+func Conflict(message string) *Error {
+	return NewError(http.StatusConflict, CODE_CONFLICT, message)
+}
+
+// Rejected reports a well formed request refused by the chain rules, an
+// invalid signature or insufficient funds for instance
+func Rejected(message string) *Error {
+	return NewError(http.StatusUnprocessableEntity, CODE_REJECTED, message)
+}
+
+func Unauthorized() *Error {
+	return NewError(http.StatusUnauthorized, CODE_UNAUTHORIZED, "authorization required")
+}
+
+// BadGateway reports a failure of the server the request was forwarded to
+func BadGateway(err error) *Error {
+	return NewError(http.StatusBadGateway, CODE_BAD_GATEWAY, err.Error())
+}
+
+func Unavailable(message string) *Error {
+	return NewError(http.StatusServiceUnavailable, CODE_UNAVAILABLE, message)
+}
+
+// Validation collects the invalid fields of a request with the reason
+type Validation map[string]string
+
+// Check records message for field unless ok. Only the first problem of a
+// field is kept.
+func (v Validation) Check(ok bool, field string, message string) {
+	if _, found := v[field]; !ok && !found {
+		v[field] = message
+	}
+}
+
+// Err returns the validation error, nil when every field is valid
+func (v Validation) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	fields := make([]string, 0, len(v))
+	for f := range v {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CODE_VALIDATION,
+		Message: "invalid " + strings.Join(fields, ", "),
+		Details: v,
+	}
+}
+
+// DecodeJSON reads the JSON body of req into v
+func DecodeJSON(w http.ResponseWriter, req *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, MAX_BODY_SIZE))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if err == io.EOF {
+			return BadRequest("empty body")
+		}
+		return BadRequest("invalid JSON body: " + err.Error())
+	}
+	return nil
+}
+
+// NotModified sets the entity tag of the response and answers 304 Not
+// Modified when the request already holds it in If-None-Match, the handler
+// stops there when it returns true. tag must change with the content of the
+// response.
+func NotModified(w http.ResponseWriter, req *http.Request, tag string) bool {
+	etag := `"` + tag + `"`
+	w.Header().Set("ETag", etag)
+	for _, match := range strings.Split(req.Header.Get("If-None-Match"), ",") {
+		// If-None-Match compares weakly
+		match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+		if match == etag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	m, err := json.Marshal(v)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(m)
+}
+
+// WriteError answers with err when it is an *Error, with an internal error
+// hiding the details otherwise
+func WriteError(w http.ResponseWriter, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		log.Printf("ERROR: %v", err)
+		e = NewError(http.StatusInternalServerError, CODE_INTERNAL, "internal error")
+	}
+	m, _ := json.Marshal(struct {
+		Error *Error `json:"error"`
+	}{e})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	w.Write(m)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestRouter() *Router {
+	r := NewRouter(PREFIX)
+	r.Handle(http.MethodGet, "/blocks/{height}", "Block by height", func(w http.ResponseWriter, req *http.Request) error {
+		if Param(req, "height") == "0" {
+			return NotFound("no block 0")
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{"height": Param(req, "height")})
+		return nil
+	})
+	r.Handle(http.MethodGet, "/blocks/hash/{hash}", "Block by hash", func(w http.ResponseWriter, req *http.Request) error {
+		WriteJSON(w, http.StatusOK, map[string]string{"hash": Param(req, "hash")})
+		return nil
+	})
+	r.Handle(http.MethodPost, "/transactions", "Submit", func(w http.ResponseWriter, req *http.Request) error {
+		var body struct {
+			Amount *float64 `json:"amount"`
+		}
+		if err := DecodeJSON(w, req, &body); err != nil {
+			return err
+		}
+		v := make(Validation)
+		v.Check(body.Amount != nil, "amount", "required")
+		v.Check(body.Amount == nil || *body.Amount > 0, "amount", "must be positive")
+		return v.Err()
+	})
+	r.Handle(http.MethodDelete, "/transactions", "Clear", func(w http.ResponseWriter, req *http.Request) error {
+		return errors.New("database on fire")
+	}, func(h HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) error {
+			if req.Header.Get("Authorization") == "" {
+				return Unauthorized()
+			}
+			return h(w, req)
+		}
+	})
+	return r
+}
+
+func serve(r *Router, method string, path string, body string) (*httptest.ResponseRecorder, *Error) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var e struct {
+		Error *Error `json:"error"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &e)
+	return w, e.Error
+}
+
+func TestRouter(t *testing.T) {
+	r := newTestRouter()
+	cases := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"GET", "/api/v1/blocks/12", "", 200, ""},
+		{"GET", "/api/v1/blocks/hash/ab", "", 200, ""},
+		{"GET", "/api/v1/blocks/0", "", 404, CODE_NOT_FOUND},
+		{"GET", "/api/v1/blocks", "", 404, CODE_NOT_FOUND},
+		{"PUT", "/api/v1/transactions", "", 405, CODE_METHOD_NOT_ALLOWED},
+		{"POST", "/api/v1/transactions", "", 400, CODE_BAD_REQUEST},
+		{"POST", "/api/v1/transactions", `{"amount": 1, "fee": 2}`, 400, CODE_BAD_REQUEST},
+		{"POST", "/api/v1/transactions", `{"amount": -1}`, 400, CODE_VALIDATION},
+		{"DELETE", "/api/v1/transactions", "", 401, CODE_UNAUTHORIZED},
+	}
+	for _, c := range cases {
+		w, e := serve(r, c.method, c.path, c.body)
+		if w.Code != c.status || (c.code != "" && (e == nil || e.Code != c.code)) {
+			t.Errorf("%s %s: %d %s, expected %d %s", c.method, c.path, w.Code, w.Body, c.status, c.code)
+		}
+	}
+	if w, _ := serve(r, "GET", "/api/v1/blocks/hash/ab", ""); !strings.Contains(w.Body.String(), `"hash":"ab"`) {
+		t.Errorf("literal segments must win over parameters: %s", w.Body)
+	}
+	if w, _ := serve(r, "PUT", "/api/v1/transactions", ""); w.Header().Get("Allow") != "DELETE, POST" {
+		t.Errorf("Allow: %q", w.Header().Get("Allow"))
+	}
+	if _, e := serve(r, "POST", "/api/v1/transactions", `{}`); e == nil || e.Details["amount"] != "required" {
+		t.Errorf("validation details: %+v", e)
+	}
+
+	req := httptest.NewRequest("DELETE", "/api/v1/transactions", nil)
+	req.Header.Set("Authorization", "Bearer x")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 500 || strings.Contains(w.Body.String(), "fire") {
+		t.Errorf("internal errors must not leak: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	conditional := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/tip", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		if !NotModified(w, req, "ab") {
+			WriteJSON(w, http.StatusOK, "tip")
+		}
+		return w
+	}
+	if w := conditional(""); w.Code != 200 || w.Header().Get("ETag") != `"ab"` {
+		t.Errorf("unconditional: %d, ETag %q", w.Code, w.Header().Get("ETag"))
+	}
+	for _, match := range []string{`"ab"`, `"cd", W/"ab"`, "*"} {
+		if w := conditional(match); w.Code != 304 || w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: %d", match, w.Code)
+		}
+	}
+	if w := conditional(`"cd"`); w.Code != 200 {
+		t.Errorf("changed content: %d", w.Code)
+	}
+}
+
+func TestCheckOpenAPI(t *testing.T) {
+	r := newTestRouter()
+	doc := `{
+		"openapi": "3.0.3",
+		"servers": [{"url": "/api/v1"}],
+		"paths": {
+			"/blocks/{height}": {"get": {"parameters": [{"name": "height", "in": "path", "required": true}], "responses": {"200": {}}}},
+			"/blocks/hash/{hash}": {"get": {"parameters": [{"name": "hash", "in": "path", "required": true}], "responses": {"200": {}}}},
+			"/transactions": {"post": {"responses": {"400": {}}}, "delete": {"responses": {"401": {}}}}
+		}
+	}`
+	if err := CheckOpenAPI([]byte(doc), r); err != nil {
+		t.Fatal(err)
+	}
+	broken := strings.Replace(doc, `"name": "hash"`, `"name": "id"`, 1)
+	broken = strings.Replace(broken, `"delete"`, `"put"`, 1)
+	err := CheckOpenAPI([]byte(broken), r)
+	for _, problem := range []string{
+		"DELETE /transactions is not documented",
+		"PUT /transactions is documented but not served",
+		"GET /blocks/hash/{hash} does not document the path parameter hash",
+	} {
+		if err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("missing %q in %v", problem, err)
+		}
+	}
+}
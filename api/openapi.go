@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var httpMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+type openAPIOperation struct {
+	Summary    string `json:"summary"`
+	Parameters []struct {
+		Name     string `json:"name"`
+		In       string `json:"in"`
+		Required bool   `json:"required"`
+	} `json:"parameters"`
+	Responses map[string]json.RawMessage `json:"responses"`
+}
+
+// CheckOpenAPI verifies that the OpenAPI document doc describes the routes
+// of r exactly: its server URL is the prefix of the router, every route is
+// documented under its method with its path parameters and responses, and
+// every documented operation is served. The servers test their document
+// with it, so that it cannot drift from the handlers.
+func CheckOpenAPI(doc []byte, r *Router) error {
+	var d struct {
+		OpenAPI string `json:"openapi"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return err
+	}
+	var problems []string
+	if !strings.HasPrefix(d.OpenAPI, "3.") {
+		problems = append(problems, fmt.Sprintf("openapi version %q, expected 3.x", d.OpenAPI))
+	}
+	if len(d.Servers) != 1 || d.Servers[0].URL != r.Prefix() {
+		problems = append(problems, fmt.Sprintf("servers must be the single URL %s", r.Prefix()))
+	}
+
+	documented := make(map[string]*openAPIOperation)
+	for path, item := range d.Paths {
+		for _, method := range httpMethods {
+			raw, ok := item[strings.ToLower(method)]
+			if !ok {
+				continue
+			}
+			var op openAPIOperation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				problems = append(problems, fmt.Sprintf("%s %s: %v", method, path, err))
+				continue
+			}
+			documented[method+" "+path] = &op
+		}
+	}
+	served := make(map[string]bool)
+	for _, route := range r.Routes() {
+		key := route.Method + " " + route.Pattern
+		served[key] = true
+		op, ok := documented[key]
+		if !ok {
+			problems = append(problems, key+" is not documented")
+			continue
+		}
+		if len(op.Responses) == 0 {
+			problems = append(problems, key+" documents no response")
+		}
+		params := make(map[string]bool)
+		for _, p := range op.Parameters {
+			if p.In == "path" && p.Required {
+				params[p.Name] = true
+			}
+		}
+		for _, segment := range strings.Split(route.Pattern, "/") {
+			name := strings.Trim(segment, "{}")
+			if name == segment {
+				continue
+			}
+			if !params[name] {
+				problems = append(problems, fmt.Sprintf("%s does not document the path parameter %s", key, name))
+			}
+			delete(params, name)
+		}
+		for name := range params {
+			problems = append(problems, fmt.Sprintf("%s documents the unknown path parameter %s", key, name))
+		}
+	}
+	for key := range documented {
+		if !served[key] {
+			problems = append(problems, key+" is documented but not served")
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ServeDocument returns the handler of the OpenAPI document doc
+func ServeDocument(doc []byte) HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+		return nil
+	}
+}
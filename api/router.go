@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// HandlerFunc serves a request, an error is written as the error object
+// of the response
+type HandlerFunc func(w http.ResponseWriter, req *http.Request) error
+
+// Middleware wraps the handler of a route, to authorize it for instance
+type Middleware func(HandlerFunc) HandlerFunc
+
+// Route is an operation of the API. Pattern is relative to the prefix of
+// the router, segments like {height} are path parameters.
+type Route struct {
+	Method  string
+	Pattern string
+	Summary string
+	handler HandlerFunc
+}
+
+// Router dispatches the requests under its prefix to the routes by method
+// and path: unknown paths get a 404, known paths with another method a 405
+type Router struct {
+	prefix string
+	routes []*Route
+}
+
+func NewRouter(prefix string) *Router {
+	return &Router{prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+func (r *Router) Prefix() string {
+	return r.prefix
+}
+
+func (r *Router) Handle(method string, pattern string, summary string, h HandlerFunc, middlewares ...Middleware) {
+	for _, m := range middlewares {
+		h = m(h)
+	}
+	r.routes = append(r.routes, &Route{Method: method, Pattern: pattern, Summary: summary, handler: h})
+}
+
+// Routes returns the routes sorted by pattern and method
+func (r *Router) Routes() []Route {
+	routes := make([]Route, 0, len(r.routes))
+	for _, route := range r.routes {
+		routes = append(routes, *route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+type paramsKey struct{}
+
+// Param returns the value of the path parameter name
+func Param(req *http.Request, name string) string {
+	params, _ := req.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, r.prefix)
+	var found *Route
+	var params map[string]string
+	var allowed []string
+	best := -1
+	for _, route := range r.routes {
+		p, literals, ok := match(route.Pattern, path)
+		if !ok {
+			continue
+		}
+		if route.Method != req.Method {
+			allowed = append(allowed, route.Method)
+			continue
+		}
+		// /blocks/hash/{hash} wins over /blocks/{height}/{field}
+		if literals > best {
+			found, params, best = route, p, literals
+		}
+	}
+	var err error
+	switch {
+	case found != nil:
+		req = req.WithContext(context.WithValue(req.Context(), paramsKey{}, params))
+		err = found.handler(w, req)
+	case len(allowed) > 0:
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		err = NewError(http.StatusMethodNotAllowed, CODE_METHOD_NOT_ALLOWED,
+			fmt.Sprintf("%s is not allowed on %s", req.Method, req.URL.Path))
+	default:
+		err = NotFound("no route for " + req.URL.Path)
+	}
+	if err != nil {
+		log.Printf("ERROR: [%s]%s: %v", req.Method, req.URL.Path, err)
+		WriteError(w, err)
+	}
+}
+
+// match tells whether path matches pattern, with the path parameters and
+// the number of literal segments matched
+func match(pattern string, path string) (map[string]string, int, bool) {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	ss := strings.Split(strings.Trim(path, "/"), "/")
+	if len(ps) != len(ss) {
+		return nil, 0, false
+	}
+	params := make(map[string]string)
+	literals := 0
+	for i, p := range ps {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			if ss[i] == "" {
+				return nil, 0, false
+			}
+			params[p[1:len(p)-1]] = ss[i]
+			continue
+		}
+		if p != ss[i] {
+			return nil, 0, false
+		}
+		literals++
+	}
+	return params, literals, true
+}
@@ -1,21 +1,22 @@
 package blockchain
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 )
 
 type Block struct {
 	timestamp    int64
-	nonce        int
+	nonce        uint32
+	extraNonce   uint32
 	previousHash [32]byte
 	transactions []*Transaction
 }
 
-func NewBlock(nonce int, previousHash [32]byte, transactions []*Transaction) *Block {
+func NewBlock(nonce uint32, previousHash [32]byte, transactions []*Transaction) *Block {
 	b := new(Block)
 	b.timestamp = time.Now().UnixNano()
 	b.nonce = nonce
@@ -24,21 +25,68 @@ func NewBlock(nonce int, previousHash [32]byte, transactions []*Transaction) *Bl
 	return b
 }
 
+// NewBlockFromHeader assembles a block received from a peer. The
+// transactions must match the merkle root of the header.
+func NewBlockFromHeader(h *Header, transactions []*Transaction) (*Block, error) {
+	if MerkleRoot(transactions) != h.MerkleRoot {
+		return nil, errors.New("transactions do not match the merkle root")
+	}
+	return &Block{
+		timestamp:    h.Timestamp,
+		nonce:        h.Nonce,
+		extraNonce:   h.ExtraNonce,
+		previousHash: h.PreviousHash,
+		transactions: transactions,
+	}, nil
+}
+
 func (b *Block) PreviousHash() [32]byte {
 	return b.previousHash
 }
 
-func (b *Block) Nonce() int {
+func (b *Block) Timestamp() int64 {
+	return b.timestamp
+}
+
+func (b *Block) Nonce() uint32 {
 	return b.nonce
 }
 
+func (b *Block) ExtraNonce() uint32 {
+	return b.extraNonce
+}
+
+// SetNonces records the proof of work found by a miner
+func (b *Block) SetNonces(nonce uint32, extraNonce uint32) {
+	b.nonce = nonce
+	b.extraNonce = extraNonce
+}
+
+// WithNonces returns a copy of the block carrying the given proof of work
+func (b *Block) WithNonces(nonce uint32, extraNonce uint32) *Block {
+	c := *b
+	c.nonce, c.extraNonce = nonce, extraNonce
+	return &c
+}
+
 func (b *Block) Transactions() []*Transaction {
 	return b.transactions
 }
 
+func (b *Block) Header() *Header {
+	return &Header{
+		Timestamp:    b.timestamp,
+		PreviousHash: b.previousHash,
+		MerkleRoot:   MerkleRoot(b.transactions),
+		Nonce:        b.nonce,
+		ExtraNonce:   b.extraNonce,
+	}
+}
+
 func (b *Block) String() string {
 	output := fmt.Sprintf("timestamp       %d\n", b.timestamp)
 	output += fmt.Sprintf("nonce           %d\n", b.nonce)
+	output += fmt.Sprintf("extra_nonce     %d\n", b.extraNonce)
 	output += fmt.Sprintf("previous_hash   %x\n", b.previousHash)
 	for _, t := range b.transactions {
 		output += fmt.Sprintf("%s", t)
@@ -46,20 +94,22 @@ func (b *Block) String() string {
 	return output
 }
 
+// Hash is the hash of the block header, the proof of work is checked against it
 func (b *Block) Hash() [32]byte {
-	m, _ := json.Marshal(b)
-	return sha256.Sum256([]byte(m))
+	return b.Header().Hash()
 }
 
 func (b *Block) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Timestamp    int64          `json:"timestamp"`
-		Nonce        int            `json:"nonce"`
+		Nonce        uint32         `json:"nonce"`
+		ExtraNonce   uint32         `json:"extra_nonce"`
 		PreviousHash string         `json:"previous_hash"`
 		Transactions []*Transaction `json:"transactions"`
 	}{
-		Timestamp: b.timestamp,
-		Nonce:     b.nonce,
+		Timestamp:  b.timestamp,
+		Nonce:      b.nonce,
+		ExtraNonce: b.extraNonce,
 		// Note: storing previosHash([32]byte) value as hex string. When decoding, must do reverse
 		PreviousHash: fmt.Sprintf("%x", b.previousHash),
 		Transactions: b.transactions,
@@ -70,12 +120,14 @@ func (b *Block) UnmarshalJSON(data []byte) error {
 	var previousHash string
 	v := &struct {
 		Timestamp    *int64          `json:"timestamp"`
-		Nonce        *int            `json:"nonce"`
+		Nonce        *uint32         `json:"nonce"`
+		ExtraNonce   *uint32         `json:"extra_nonce"`
 		PreviousHash *string         `json:"previous_hash"`
 		Transactions *[]*Transaction `json:"transactions"`
 	}{
 		Timestamp:    &b.timestamp,
 		Nonce:        &b.nonce,
+		ExtraNonce:   &b.extraNonce,
 		PreviousHash: &previousHash,
 		Transactions: &b.transactions,
 	}
@@ -83,7 +135,10 @@ func (b *Block) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	// After unmarshaling, convert previousHash from hex representationt to a string
-	ph, _ := hex.DecodeString(*v.PreviousHash)
+	ph, err := hex.DecodeString(*v.PreviousHash)
+	if err != nil || len(ph) != 32 {
+		return fmt.Errorf("invalid previous_hash %q", *v.PreviousHash)
+	}
 	// Update previosHash value with its true [32]byte value
 	copy(b.previousHash[:], ph[:32])
 	return nil
@@ -1,197 +1,428 @@
 package blockchain
 
 import (
-	"bytes"
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"moviecoin/params"
 	"moviecoin/utils"
-	"net/http"
 	"strings"
 	"sync"
 	"time"
 )
 
-// @TODO - temp values that need to be regrouped
-// MINING_* stuff will be set by the blockchain network dynamically
-// blockchain network will need to go through a discovery mechanism to
-// discover new nodes and add them automatically to a cache
+// Network dependent values (difficulty, reward, mining interval...) live in
+// the params package; see params.Network
 const (
-	// @TODO - group 1
-	MINING_DIFFICULTY = 3
-	MINING_SENDER     = "MOVIECOIN BLOCKCHAIN"
-	MINING_REWARD     = 1.0
-	MINING_TIMER_SEC  = 30 // default mining time lapse
-	// @TODO - group 2
+	MINING_SENDER = "MOVIECOIN BLOCKCHAIN"
+	// @TODO - the master node should communicate this value
 	BLOCKCHAIN_NEIGHBOR_SYNC_TIME_SEC = 20
 )
 
+// Relay spreads the blocks and transactions accepted locally to the other
+// nodes, see netsync.Manager
+type Relay interface {
+	RelayBlock(b *Block)
+	RelayTransaction(tr *TransactionRequest)
+}
+
+// ValidationObserver is told how long the checks of a block took, err is
+// nil when the block was accepted. It is called with the chain locked and
+// must not use it.
+type ValidationObserver func(d time.Duration, err error)
+
+var (
+	ErrStaleBlock    = errors.New("block does not extend the chain tip")
+	ErrInvalidProof  = errors.New("block does not meet the proof of work")
+	ErrUnknownParent = errors.New("block does not connect to the chain")
+	ErrShorterChain  = errors.New("chain is not longer than ours")
+	ErrInvalidReward = errors.New("block pays more than one mining reward or more than the reward")
+	ErrInvalidFunds  = errors.New("block spends coins its senders do not have")
+)
+
+// Blockchain is safe for concurrent use: every access to the chain and the
+// transaction pool holds mux, writers exclusively. Handlers needing several
+// consistent reads take a Snapshot.
 type Blockchain struct {
-	transactionPool   []*Transaction
+	transactionPool []*Transaction
+	// chain is only appended to in place, a reorg builds a new slice, so
+	// that snapshots can share it. Blocks never change once in the chain.
 	chain             []*Block
 	blockchainAddress string
-	port              uint16
-	mux               sync.Mutex
-	neighbors         []string
-	muxNeighbors      sync.Mutex
+	network           *params.Network
+	mux               sync.RWMutex
+	// changed is closed, then replaced, every time the chain tip or the
+	// transaction pool changes. Miners use it to drop outdated work.
+	changed  chan struct{}
+	events   *EventBus
+	relay    Relay
+	observer ValidationObserver
 }
 
-func NewBlockchain(blockchainAddress string, port uint16) *Blockchain {
+func NewBlockchain(blockchainAddress string, network *params.Network) *Blockchain {
 	bc := new(Blockchain)
 	bc.blockchainAddress = blockchainAddress
+	bc.network = network
+	bc.changed = make(chan struct{})
+	bc.events = NewEventBus()
 	//create genesis block
-	bc.CreateBlock(0, new(Block).Hash()) //<- hash of all zeros block
-	bc.port = port
+	bc.chain = append(bc.chain, NewGenesisBlock(network))
 	return bc
 }
 
-func (bc *Blockchain) CreateBlock(nonce int, previousHash [32]byte) *Block {
-	b := NewBlock(nonce, previousHash, bc.transactionPool)
+// NewGenesisBlock builds the first block of a network. Its timestamp is fixed
+// by the network parameters so that every node agrees on the genesis hash.
+func NewGenesisBlock(network *params.Network) *Block {
+	b := NewBlock(0, new(Block).Hash(), nil) //<- hash of all zeros block
+	b.timestamp = network.GenesisTimestamp
+	return b
+}
+
+// NewBlockTemplate prepares an unsolved block extending the chain tip with the
+// pending transactions and the mining reward paid to payoutAddress. The
+// returned channel is closed as soon as the template is outdated, that is
+// when the tip changes or new transactions arrive.
+func (bc *Blockchain) NewBlockTemplate(payoutAddress string) (*Block, <-chan struct{}) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.blockTemplate(payoutAddress), bc.changed
+}
+
+// NewHeightTemplate is NewBlockTemplate returning the height the block will
+// have, read with the tip it extends
+func (bc *Blockchain) NewHeightTemplate(payoutAddress string) (*Block, int) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.blockTemplate(payoutAddress), len(bc.chain)
+}
+
+// blockTemplate must be called with bc.mux held
+func (bc *Blockchain) blockTemplate(payoutAddress string) *Block {
+	transactions := bc.copyTransactionPool()
+	// add a reward transaction for the miner
+	transactions = append(transactions, NewTransaction(MINING_SENDER, payoutAddress, bc.network.Reward))
+	return NewBlock(0, bc.lastBlock().Hash(), transactions)
+}
+
+// AddBlock appends a solved block on top of the chain. The transactions
+// included in the block leave the transaction pool.
+func (bc *Blockchain) AddBlock(b *Block) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	start := time.Now()
+	var err error
+	if b.previousHash != bc.lastBlock().Hash() {
+		err = ErrStaleBlock
+	} else if !ValidProof(b.Header(), bc.network.Difficulty) {
+		err = ErrInvalidProof
+	} else {
+		err = checkTransactions(bc.chain, b, bc.network.Reward)
+	}
+	bc.observe(start, err)
+	if err != nil {
+		return err
+	}
 	bc.chain = append(bc.chain, b)
-	// when a new block is created, the transaction pool is reset!
-	bc.transactionPool = []*Transaction{}
-	// When a new block is mined, tell all other nodes to delete transaction pools
-	for _, n := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/transactions", n)
-		// new http client connection to talk to each node separately
-		client := &http.Client{}
-		// send out a delete request to delete transaction pool
-		req, _ := http.NewRequest("DELETE", endpoint, nil)
-		resp, _ := client.Do(req)
-		log.Printf("%v", resp)
+	bc.transactionPool = payable(bc.chain, removeTransactions(bc.transactionPool, b.transactions))
+	bc.notifyChanged()
+	bc.events.Publish(&Event{Type: EVENT_BLOCK, Height: len(bc.chain) - 1, Block: b})
+	return nil
+}
+
+// AnnounceBlock hands a block accepted locally (mined or submitted) to the
+// relay, which announces it to the peers
+func (bc *Blockchain) AnnounceBlock(b *Block) {
+	if r := bc.Relay(); r != nil {
+		r.RelayBlock(b)
 	}
-	return b
 }
 
-func (bc *Blockchain) Chain() []*Block {
-	return bc.chain
-}
-
-func (bc *Blockchain) Run() {
-
-	bc.MulticastPresence()
-	bc.ListenNeighbors()
-	bc.StartNotifyNeighbors()
-	bc.StartSyncNeighbors()
-	bc.ResolveConflicts()
-	bc.StartMining()
-}
-
-// Periodically notify other nodes of us being alive
-func (bc *Blockchain) StartNotifyNeighbors() {
-	bc.NotifyNeighbors()
-	_ = time.AfterFunc(time.Second*BLOCKCHAIN_NEIGHBOR_SYNC_TIME_SEC, bc.StartNotifyNeighbors)
-}
-
-// keep looking for new nodes at BLOCKCHAIN_NEIGHBOR_SYNC_TIME_SEC intervals
-// Note: the master node should communicate this interval value instead of hard coding it
-func (bc *Blockchain) StartSyncNeighbors() {
-	bc.SyncNeighbors() //let's discover mining hosts only once
-	_ = time.AfterFunc(time.Second*BLOCKCHAIN_NEIGHBOR_SYNC_TIME_SEC, bc.StartSyncNeighbors)
-}
-
-//Resolve mining conflicts
-func (bc *Blockchain) ResolveConflicts() bool {
-	var longestChain []*Block = nil
-	maxLength := len(bc.chain)
-	// go through neighbors and ask for the chains
-	for _, n := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/chain", n)
-		resp, _ := http.Get(endpoint)
-		if resp.StatusCode == 200 {
-			var bcResp Blockchain
-			decoder := json.NewDecoder(resp.Body)
-			// unmarshal the neighbor's blockchain
-			_ = decoder.Decode(&bcResp)
-			// get their's blockchain
-			chain := bcResp.Chain()
-			// if their chain is longer - use their chain instead
-			if len(chain) > maxLength && bc.ValidChain(chain) {
-				maxLength = len(chain)
-				longestChain = chain
+// SetRelay plugs the peer to peer network in
+func (bc *Blockchain) SetRelay(r Relay) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.relay = r
+}
+
+// SetValidationObserver times the checks of the blocks offered to the chain
+func (bc *Blockchain) SetValidationObserver(o ValidationObserver) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.observer = o
+}
+
+func (bc *Blockchain) observe(start time.Time, err error) {
+	if bc.observer != nil {
+		bc.observer(time.Since(start), err)
+	}
+}
+
+func (bc *Blockchain) Relay() Relay {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.relay
+}
+
+// HasBlock tells whether the block with the given hash is in the chain
+func (bc *Blockchain) HasBlock(hash [32]byte) bool {
+	return bc.BlockByHash(hash) != nil
+}
+
+// BlockByHash returns the block of the chain with the given hash, nil when
+// there is none. Recent blocks are the most requested, the search starts
+// from the tip.
+func (bc *Blockchain) BlockByHash(hash [32]byte) *Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if h := bc.heightOf(hash); h >= 0 {
+		return bc.chain[h]
+	}
+	return nil
+}
+
+// HeightOf returns the height of the block with the given hash, -1 when it is
+// not in the chain
+func (bc *Blockchain) HeightOf(hash [32]byte) int {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.heightOf(hash)
+}
+
+func (bc *Blockchain) heightOf(hash [32]byte) int {
+	for i := len(bc.chain) - 1; i >= 0; i-- {
+		if bc.chain[i].Hash() == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// Locator describes the chain to a peer with few hashes: the ten most recent
+// blocks, then blocks further and further apart, down to the genesis block.
+// The peer answers from the most recent block both chains have in common.
+func (bc *Blockchain) Locator() [][32]byte {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	var locator [][32]byte
+	step := 1
+	for i := len(bc.chain) - 1; i > 0; i -= step {
+		locator = append(locator, bc.chain[i].Hash())
+		if len(locator) >= 10 {
+			step *= 2
+		}
+	}
+	return append(locator, bc.chain[0].Hash())
+}
+
+// HeadersAfter returns up to max headers following the first locator hash
+// found in the chain, or following the genesis block when none is. The
+// headers stop after the stop hash, if present.
+func (bc *Blockchain) HeadersAfter(locator [][32]byte, stop [32]byte, max int) []*Header {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	start := 0
+	for _, hash := range locator {
+		if h := bc.heightOf(hash); h >= 0 {
+			start = h
+			break
+		}
+	}
+	headers := make([]*Header, 0)
+	for i := start + 1; i < len(bc.chain) && len(headers) < max; i++ {
+		headers = append(headers, bc.chain[i].Header())
+		if bc.chain[i].Hash() == stop {
+			break
+		}
+	}
+	return headers
+}
+
+// ReplaceFrom swaps the blocks above the height ancestor for blocks, provided
+// the resulting chain is longer. The transactions of the blocks dropped go
+// back to the pool unless blocks include them.
+func (bc *Blockchain) ReplaceFrom(ancestor int, blocks []*Block) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if ancestor < 0 || ancestor >= len(bc.chain) {
+		return ErrUnknownParent
+	}
+	if ancestor+len(blocks) <= len(bc.chain)-1 {
+		return ErrShorterChain
+	}
+	prev := bc.chain[ancestor].Hash()
+	chain := bc.chain[: ancestor+1 : ancestor+1]
+	for _, b := range blocks {
+		start := time.Now()
+		var err error
+		if b.previousHash != prev {
+			err = ErrUnknownParent
+		} else if !ValidProof(b.Header(), bc.network.Difficulty) {
+			err = ErrInvalidProof
+		} else {
+			err = checkTransactions(chain, b, bc.network.Reward)
+		}
+		bc.observe(start, err)
+		if err != nil {
+			return err
+		}
+		chain = append(chain, b)
+		prev = b.Hash()
+	}
+	pool := bc.transactionPool
+	for _, dropped := range bc.chain[ancestor+1:] {
+		for _, t := range dropped.transactions {
+			if t.sender != MINING_SENDER {
+				pool = append(pool, t)
 			}
 		}
 	}
+	for _, b := range blocks {
+		pool = removeTransactions(pool, b.transactions)
+	}
+	pool = payable(chain, pool)
+	dropped := bc.chain[ancestor+1:]
+	events := []*Event{{Type: EVENT_REORG, Height: ancestor, Dropped: dropped}}
+	for i, b := range blocks {
+		events = append(events, &Event{Type: EVENT_BLOCK, Height: ancestor + 1 + i, Block: b})
+	}
+	// the transactions of the dropped blocks waiting again
+	events = append(events, transactionEvents(EVENT_TX, pool, bc.transactionPool)...)
+	bc.chain = chain
+	bc.transactionPool = pool
+	bc.notifyChanged()
+	bc.events.Publish(events...)
+	return nil
+}
 
-	if longestChain != nil {
-		bc.chain = longestChain
-		log.Printf("Conflict resolved: adopt a new blockchain")
-		return true
+// transactionEvents returns events of type for the transactions of pool not
+// in previous
+func transactionEvents(typ string, pool []*Transaction, previous []*Transaction) []*Event {
+	var events []*Event
+	for _, t := range removeTransactions(pool, previous) {
+		events = append(events, &Event{Type: typ, Transaction: t})
 	}
-	log.Printf("Conflict resolved: keep my blockchain")
-	return false
+	return events
+}
+
+// Changed returns a channel closed on the next change of the chain tip or of
+// the transaction pool
+func (bc *Blockchain) Changed() <-chan struct{} {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.changed
+}
+
+// Events returns the bus publishing the changes of the chain and of the pool
+func (bc *Blockchain) Events() *EventBus {
+	return bc.events
 }
 
-func (bc *Blockchain) NotifyNeighbors() {
-	utils.NotifyNeighbors(utils.GetHost(), bc.port)
+// notifyChanged wakes up everyone waiting on Changed. Callers must hold bc.mux
+func (bc *Blockchain) notifyChanged() {
+	close(bc.changed)
+	bc.changed = make(chan struct{})
 }
 
-func (bc *Blockchain) SetNeighbors() {
-	// I am a blockchain running on a host with port x
-	// discover and set all other nodes
-	bc.neighbors = utils.FindNeighbors()
-	log.Printf("%v", bc.neighbors)
+// removeTransactions returns pool without the transactions of included. Each
+// included transaction removes a single matching entry from the pool.
+func removeTransactions(pool []*Transaction, included []*Transaction) []*Transaction {
+	remaining := make([]*Transaction, 0, len(pool))
+	removed := make([]bool, len(included))
+	for _, t := range pool {
+		found := false
+		for i, it := range included {
+			if !removed[i] && *it == *t {
+				removed[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			remaining = append(remaining, t)
+		}
+	}
+	return remaining
 }
 
-func (bc *Blockchain) ListenNeighbors() {
-	log.Println("Listening for other neighbors...")
-	utils.ListenNeighbors()
+// Chain returns the blocks of the chain, which must not be modified
+func (bc *Blockchain) Chain() []*Block {
+	return bc.Snapshot().Blocks()
 }
 
-func (bc *Blockchain) AnouncePresence() {
-	utils.NotifyNeighbors(utils.GetHost(), bc.port)
+// GenesisHash identifies the chain, nodes with another genesis block are
+// on another network
+func (bc *Blockchain) GenesisHash() [32]byte {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.chain[0].Hash()
 }
 
-func (bc *Blockchain) MulticastPresence() {
-	bc.muxNeighbors.Lock()
-	defer bc.muxNeighbors.Unlock()
-	bc.AnouncePresence()
+func (bc *Blockchain) Network() *params.Network {
+	return bc.network
 }
 
-func (bc *Blockchain) SyncNeighbors() {
-	bc.muxNeighbors.Lock()
-	defer bc.muxNeighbors.Unlock()
-	bc.SetNeighbors()
+// MinerAddress is the address credited with the rewards of blocks mined locally
+func (bc *Blockchain) MinerAddress() string {
+	return bc.blockchainAddress
 }
 
 func (bc *Blockchain) TransactionPool() []*Transaction {
-	return bc.transactionPool
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return append(make([]*Transaction, 0, len(bc.transactionPool)), bc.transactionPool...)
 }
 
 func (bc *Blockchain) ClearTransactionPool() {
-	bc.transactionPool = bc.transactionPool[:0]
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	evicted := bc.transactionPool
+	bc.transactionPool = nil
+	bc.notifyChanged()
+	bc.events.Publish(transactionEvents(EVENT_EVICTION, evicted, nil)...)
 }
 
 func (bc *Blockchain) MarshalJSON() ([]byte, error) {
-	return json.Marshal(struct {
-		Blocks []*Block `json:"chain"`
-	}{
-		Blocks: bc.chain,
-	})
+	return bc.Snapshot().MarshalJSON()
 }
 
 func (bc *Blockchain) UnmarshalJSON(data []byte) error {
-	v := &struct {
-		Blocks *[]*Block `json:"chain"`
-	}{
-		Blocks: &bc.chain,
+	// decoding into bc.chain would overwrite the blocks of the snapshots
+	var v struct {
+		Blocks []*Block `json:"chain"`
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.chain = v.Blocks
 	return nil
 }
 
+// Height is the number of blocks on top of the genesis block
+func (bc *Blockchain) Height() int {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return len(bc.chain) - 1
+}
+
 func (bc *Blockchain) LastBlock() *Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.lastBlock()
+}
+
+// lastBlock is LastBlock for callers holding bc.mux
+func (bc *Blockchain) lastBlock() *Block {
 	return bc.chain[len(bc.chain)-1]
 }
 
 func (bc *Blockchain) String() string {
 	var output string
-	for i, block := range bc.chain {
+	for i, block := range bc.Chain() {
 		output += fmt.Sprintf("%s Chain %d %s\n", strings.Repeat("=", 25), i,
 			strings.Repeat("=", 25))
 		output += fmt.Sprintf("%v", block)
@@ -200,52 +431,72 @@ func (bc *Blockchain) String() string {
 	return output
 }
 
-// New transaction
+// CreateTransaction adds a signed transaction submitted to the node and
+// relays it to the peers. Mining rewards are refused: only the miners create
+// them, in their blocks.
 func (bc *Blockchain) CreateTransaction(sender string, receiver string, amount float32,
 	senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
+	if sender == MINING_SENDER {
+		log.Println("ERROR: mining rewards are only created by miners")
+		return false
+	}
 	isTransacted := bc.AddTransaction(sender, receiver, amount, senderPublicKey, s)
 
 	if isTransacted {
-		for _, n := range bc.neighbors {
+		if r := bc.Relay(); r != nil {
 			publicKeyStr := fmt.Sprintf("%064x%064x", senderPublicKey.X.Bytes(),
 				senderPublicKey.Y.Bytes())
 			signatureStr := s.String()
-			bt := &TransactionRequest{
-				&sender, &receiver, &publicKeyStr, &amount, &signatureStr}
-			m, _ := json.Marshal(bt)
-			buf := bytes.NewBuffer(m)
-			endpoint := fmt.Sprintf("http://%s/transactions", n)
-			client := &http.Client{}
-			req, _ := http.NewRequest("PUT", endpoint, buf)
-			resp, _ := client.Do(req)
-			log.Printf("%v", resp)
+			r.RelayTransaction(&TransactionRequest{
+				&sender, &receiver, &publicKeyStr, &amount, &signatureStr})
 		}
 	}
 
 	return isTransacted
 }
 
+// AddTransaction adds a signed transaction to the pool, provided the sender
+// can pay it on top of the transactions already waiting. Mining rewards are
+// only created by the block templates.
 func (bc *Blockchain) AddTransaction(sender string, receiver string, amount float32,
 	senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
 	t := NewTransaction(sender, receiver, amount)
 
 	if sender == MINING_SENDER {
-		bc.transactionPool = append(bc.transactionPool, t)
-		return true
+		log.Println("ERROR: mining rewards are only created by miners")
+		return false
 	}
-
-	if bc.VerifyTransactionSignature(senderPublicKey, s, t) {
-		if bc.CalculateTotalAmount(sender) < amount {
-			log.Println("ERROR: Insufficient funds")
-			return false
-		}
-		bc.transactionPool = append(bc.transactionPool, t)
-		return true
-	} else {
+	if !(amount > 0) {
+		log.Println("ERROR: Invalid amount")
+		return false
+	}
+	if !bc.VerifyTransactionSignature(senderPublicKey, s, t) {
 		log.Println("ERROR: Invalid transaction")
+		return false
 	}
-	return false
+	// the balance must not change between the check and the addition
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bs := newBalances(bc.chain)
+	for _, pending := range bc.transactionPool {
+		bs.apply(pending)
+	}
+	if !bs.apply(t) {
+		log.Println("ERROR: Insufficient funds")
+		return false
+	}
+	bc.transactionPool = append(bc.transactionPool, t)
+	bc.notifyChanged()
+	bc.events.Publish(&Event{Type: EVENT_TX, Transaction: t})
+	return true
+}
 
+func (bc *Blockchain) addToPool(t *Transaction) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.transactionPool = append(bc.transactionPool, t)
+	bc.notifyChanged()
+	bc.events.Publish(&Event{Type: EVENT_TX, Transaction: t})
 }
 
 func (bc *Blockchain) VerifyTransactionSignature(
@@ -256,6 +507,13 @@ func (bc *Blockchain) VerifyTransactionSignature(
 }
 
 func (bc *Blockchain) CopyTransactionPool() []*Transaction {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.copyTransactionPool()
+}
+
+// copyTransactionPool is CopyTransactionPool for callers holding bc.mux
+func (bc *Blockchain) copyTransactionPool() []*Transaction {
 	transactions := make([]*Transaction, 0)
 	for _, t := range bc.transactionPool {
 		transactions = append(transactions,
@@ -266,63 +524,18 @@ func (bc *Blockchain) CopyTransactionPool() []*Transaction {
 	return transactions
 }
 
-func (bc *Blockchain) ValidProof(nonce int, previousHash [32]byte, transactions []*Transaction, difficulty int) bool {
-	zeros := strings.Repeat("0", difficulty)
-	guessBlock := Block{0, nonce, previousHash, transactions}
-	guessHashStr := fmt.Sprintf("%x", guessBlock.Hash())
-	return guessHashStr[:difficulty] == zeros
-}
-
-func (bc *Blockchain) ProofOfWork() int {
-	transactions := bc.CopyTransactionPool()
-	previousHash := bc.LastBlock().Hash()
-	nonce := 0
-	for !bc.ValidProof(nonce, previousHash, transactions, MINING_DIFFICULTY) {
-		nonce += 1
-	}
-	return nonce
-}
-
-func (bc *Blockchain) Mining() bool {
-	bc.mux.Lock()
-	defer bc.mux.Unlock()
-	// Transaction pool must contain transactions in order to mine
-	if len(bc.transactionPool) > 0 {
-		// add a reward transaction to the pool
-		bc.AddTransaction(MINING_SENDER, bc.blockchainAddress, MINING_REWARD, nil, nil)
-		nonce := bc.ProofOfWork()
-		previousHash := bc.LastBlock().Hash()
-		// POW done, mint a new block
-		bc.CreateBlock(nonce, previousHash)
-		log.Println("Mining is done. New block created.")
-		// run consensus across all mining nodes
-		for _, n := range bc.neighbors {
-			endpoint := fmt.Sprintf("http://%s/consensus", n)
-			client := &http.Client{}
-			req, _ := http.NewRequest("PUT", endpoint, nil)
-			resp, _ := client.Do(req)
-			log.Printf("%v", resp)
-		}
-		return true
-	}
-	log.Println(":( Nothing to mine ... Taking a nap (zzz.zz.z)")
-	return false
-}
-
-func (bc *Blockchain) StartMining() {
-	bc.Mining()
-	// Mininig at MINING_TIMER_SEC interval
-	_ = time.AfterFunc(time.Second*MINING_TIMER_SEC, bc.StartMining)
+func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
+	return bc.Snapshot().Balance(blockchainAddress)
 }
 
-func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
+func calculateTotalAmount(chain []*Block, blockchainAddress string) float32 {
 	var totalAmount float32 = 0.0
 	if blockchainAddress == MINING_SENDER {
 		//for now, let's assume it's infinite supply of coins
 		totalAmount = float32(math.MaxFloat32)
 		return totalAmount
 	}
-	for _, b := range bc.chain {
+	for _, b := range chain {
 		for _, t := range b.transactions {
 			amount := t.amount
 			// credit the receiver
@@ -338,7 +551,63 @@ func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
 	return totalAmount
 }
 
+// balances follows the balances of the addresses as transactions are applied
+// on top of a chain
+type balances struct {
+	chain []*Block
+	delta map[string]float32
+}
+
+func newBalances(chain []*Block) *balances {
+	return &balances{chain: chain, delta: make(map[string]float32)}
+}
+
+// apply credits and debits t, unless its sender cannot pay it
+func (bs *balances) apply(t *Transaction) bool {
+	if t.sender != MINING_SENDER && calculateTotalAmount(bs.chain, t.sender)+bs.delta[t.sender] < t.amount {
+		return false
+	}
+	bs.delta[t.sender] -= t.amount
+	bs.delta[t.receiver] += t.amount
+	return true
+}
+
+// checkTransactions checks that b pays at most one mining reward, of at most
+// reward, and that its senders can pay it on top of chain
+func checkTransactions(chain []*Block, b *Block, reward float32) error {
+	bs := newBalances(chain)
+	rewards := 0
+	for _, t := range b.transactions {
+		if t.sender == MINING_SENDER {
+			if rewards++; rewards > 1 || t.amount > reward {
+				return ErrInvalidReward
+			}
+		}
+		if !(t.amount > 0) || !bs.apply(t) {
+			return ErrInvalidFunds
+		}
+	}
+	return nil
+}
+
+// payable returns the transactions of pool which their senders can still pay
+// on top of chain, in order. The others can never be mined.
+func payable(chain []*Block, pool []*Transaction) []*Transaction {
+	bs := newBalances(chain)
+	kept := make([]*Transaction, 0, len(pool))
+	for _, t := range pool {
+		if t.sender != MINING_SENDER && bs.apply(t) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
 func (bc *Blockchain) ValidChain(chain []*Block) bool {
+	// chains from other networks start from a different genesis block
+	if len(chain) == 0 || chain[0].Hash() != bc.GenesisHash() {
+		return false
+	}
 	preBlock := chain[0]
 	currentIndex := 1
 	for currentIndex < len(chain) {
@@ -348,7 +617,10 @@ func (bc *Blockchain) ValidChain(chain []*Block) bool {
 		}
 		// Note: mining difficulty may vary across different blocks in a blockchain.
 		// @TODO add logic to handle validating POW with a variable mining difficulty factor
-		if !bc.ValidProof(b.Nonce(), b.PreviousHash(), b.Transactions(), MINING_DIFFICULTY) {
+		if !ValidProof(b.Header(), bc.network.Difficulty) {
+			return false
+		}
+		if checkTransactions(chain[:currentIndex], b, bc.network.Reward) != nil {
 			return false
 		}
 		preBlock = b
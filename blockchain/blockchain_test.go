@@ -0,0 +1,445 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"moviecoin/params"
+	"moviecoin/utils"
+	"sync"
+	"testing"
+	"time"
+)
+
+const minerAddress = "miner"
+
+// solve brute forces the (trivial) regtest proof of work of b
+func solve(b *Block, difficulty int) {
+	for nonce := uint32(0); ; nonce++ {
+		b.SetNonces(nonce, 0)
+		if ValidProof(b.Header(), difficulty) {
+			return
+		}
+	}
+}
+
+func mine(t *testing.T, bc *Blockchain) *Block {
+	b, _ := bc.NewBlockTemplate(minerAddress)
+	solve(b, bc.Network().Difficulty)
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// sign signs the transaction with a new key, the chain does not tie the
+// addresses to the keys
+func sign(tx *Transaction) (*ecdsa.PublicKey, *utils.Signature) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	m, _ := json.Marshal(tx)
+	h := sha256.Sum256(m)
+	r, s, _ := ecdsa.Sign(rand.Reader, key, h[:])
+	return &key.PublicKey, &utils.Signature{R: r, S: s}
+}
+
+func pay(t *testing.T, bc *Blockchain, sender string, recipient string, amount float32) {
+	publicKey, signature := sign(NewTransaction(sender, recipient, amount))
+	if !bc.AddTransaction(sender, recipient, amount, publicKey, signature) {
+		t.Fatalf("%s cannot pay %v to %s", sender, amount, recipient)
+	}
+}
+
+func TestGenesisIsDeterministic(t *testing.T) {
+	a := NewBlockchain(minerAddress, params.Regtest)
+	b := NewBlockchain("someone else", params.Regtest)
+	if a.Chain()[0].Hash() != b.Chain()[0].Hash() {
+		t.Fatal("nodes on the same network must share the genesis block")
+	}
+	genesis := make(map[[32]byte]string)
+	for _, name := range params.Names() {
+		network, _ := params.Lookup(name)
+		hash := NewGenesisBlock(network).Hash()
+		if other, ok := genesis[hash]; ok {
+			t.Errorf("%s and %s share the genesis block", name, other)
+		}
+		genesis[hash] = name
+	}
+}
+
+func TestAddBlock(t *testing.T) {
+	bc := NewBlockchain(minerAddress, params.Regtest)
+	mine(t, bc)
+	pay(t, bc, minerAddress, "alice", 0.5)
+	for i := 0; i < 4; i++ {
+		mine(t, bc)
+	}
+	if len(bc.Chain()) != 6 {
+		t.Fatalf("chain length %d, expected 6", len(bc.Chain()))
+	}
+	if len(bc.TransactionPool()) != 0 {
+		t.Fatal("mined transactions must leave the pool")
+	}
+	if !bc.ValidChain(bc.Chain()) {
+		t.Fatal("mined chain does not validate")
+	}
+	if got, want := bc.CalculateTotalAmount(minerAddress), 5*params.Regtest.Reward-0.5; got != want {
+		t.Fatalf("miner balance %v, expected %v", got, want)
+	}
+	if got := bc.CalculateTotalAmount("alice"); got != 0.5 {
+		t.Fatalf("alice balance %v, expected 0.5", got)
+	}
+}
+
+func TestAddBlockRejects(t *testing.T) {
+	bc := NewBlockchain(minerAddress, params.Regtest)
+	var observed []error
+	bc.SetValidationObserver(func(d time.Duration, err error) {
+		observed = append(observed, err)
+	})
+	stale, _ := bc.NewBlockTemplate(minerAddress)
+	solve(stale, bc.Network().Difficulty)
+	mine(t, bc)
+	if err := bc.AddBlock(stale); err != ErrStaleBlock {
+		t.Fatalf("stale block: got %v, expected %v", err, ErrStaleBlock)
+	}
+
+	b, _ := bc.NewBlockTemplate(minerAddress)
+	solve(b, bc.Network().Difficulty)
+	// any change to the transactions invalidates the proof of work
+	b.transactions[0].amount = 1000
+	for ValidProof(b.Header(), bc.Network().Difficulty) {
+		b.transactions[0].amount++
+	}
+	if err := bc.AddBlock(b); err != ErrInvalidProof {
+		t.Fatalf("tampered block: got %v, expected %v", err, ErrInvalidProof)
+	}
+
+	reward := params.Regtest.Reward
+	cases := map[string]struct {
+		transactions []*Transaction
+		err          error
+	}{
+		"two rewards": {[]*Transaction{NewTransaction(MINING_SENDER, minerAddress, reward),
+			NewTransaction(MINING_SENDER, minerAddress, reward)}, ErrInvalidReward},
+		"big reward": {[]*Transaction{NewTransaction(MINING_SENDER, minerAddress, 2*reward)}, ErrInvalidReward},
+		"overspent": {[]*Transaction{NewTransaction(minerAddress, "alice", 2*reward),
+			NewTransaction(MINING_SENDER, minerAddress, reward)}, ErrInvalidFunds},
+		"negative": {[]*Transaction{NewTransaction("alice", minerAddress, -1)}, ErrInvalidFunds},
+		"unfunded": {[]*Transaction{NewTransaction("alice", "bob", 1)}, ErrInvalidFunds},
+	}
+	for name, c := range cases {
+		b := NewBlock(0, bc.LastBlock().Hash(), c.transactions)
+		solve(b, bc.Network().Difficulty)
+		if err := bc.AddBlock(b); err != c.err {
+			t.Errorf("%s: got %v, expected %v", name, err, c.err)
+		}
+		if bc.ValidChain(append(bc.Chain(), b)) {
+			t.Errorf("%s: chain validates", name)
+		}
+	}
+	if bc.Height() != 1 {
+		t.Fatalf("height %d, invalid blocks added", bc.Height())
+	}
+	if fmt.Sprint(observed[:3]) != fmt.Sprint([]error{nil, ErrStaleBlock, ErrInvalidProof}) {
+		t.Errorf("observed %v", observed)
+	}
+}
+
+func TestTemplateInvalidation(t *testing.T) {
+	bc := NewBlockchain(minerAddress, params.Regtest)
+	mine(t, bc)
+	_, changed := bc.NewBlockTemplate(minerAddress)
+	select {
+	case <-changed:
+		t.Fatal("template outdated before any change")
+	default:
+	}
+	pay(t, bc, minerAddress, "alice", 1)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("a new transaction must outdate the template")
+	}
+}
+
+type countingRelay struct{ transactions int }
+
+func (r *countingRelay) RelayBlock(b *Block) {}
+
+func (r *countingRelay) RelayTransaction(tr *TransactionRequest) {
+	r.transactions++
+}
+
+// TestCreateTransactionRefusesRewards checks that a client cannot mint coins,
+// nor have the node relay a reward its peers would punish it for
+func TestCreateTransactionRefusesRewards(t *testing.T) {
+	bc := NewBlockchain(minerAddress, params.Regtest)
+	relay := &countingRelay{}
+	bc.SetRelay(relay)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if bc.CreateTransaction(MINING_SENDER, "alice", 1000, &key.PublicKey, &utils.Signature{R: big.NewInt(1), S: big.NewInt(1)}) {
+		t.Error("reward accepted")
+	}
+	if len(bc.TransactionPool()) != 0 || relay.transactions != 0 {
+		t.Errorf("%d transactions in the pool, %d relayed", len(bc.TransactionPool()), relay.transactions)
+	}
+}
+
+func TestValidChainRejectsForeignGenesis(t *testing.T) {
+	regtest := NewBlockchain(minerAddress, params.Regtest)
+	testnet := NewBlockchain(minerAddress, params.Testnet)
+	if regtest.ValidChain(testnet.Chain()) {
+		t.Fatal("a chain from another network must not validate")
+	}
+}
+
+func TestMeetsDifficulty(t *testing.T) {
+	hash := [32]byte{0x00, 0x0f, 0xff}
+	for difficulty, want := range []bool{true, true, true, true, false} {
+		if got := MeetsDifficulty(hash, difficulty); got != want {
+			t.Errorf("difficulty %d: got %v, expected %v", difficulty, got, want)
+		}
+	}
+}
+
+func TestLocatorAndHeaders(t *testing.T) {
+	bc := NewBlockchain(minerAddress, params.Regtest)
+	for i := 0; i < 30; i++ {
+		mine(t, bc)
+	}
+	locator := bc.Locator()
+	if locator[0] != bc.LastBlock().Hash() || locator[len(locator)-1] != bc.Chain()[0].Hash() {
+		t.Fatal("locator must run from the tip down to the genesis block")
+	}
+	if len(locator) >= 30 {
+		t.Errorf("locator of %d hashes for 30 blocks, expected fewer", len(locator))
+	}
+
+	chain := bc.Chain()
+	headers := bc.HeadersAfter([][32]byte{{0xff}, chain[25].Hash()}, [32]byte{}, 100)
+	if len(headers) != 5 || headers[0].Hash() != chain[26].Hash() {
+		t.Errorf("headers must follow the first known locator hash, got %d", len(headers))
+	}
+	if headers := bc.HeadersAfter(nil, chain[3].Hash(), 100); len(headers) != 3 {
+		t.Errorf("headers must end at the stop hash, got %d", len(headers))
+	}
+	if headers := bc.HeadersAfter(nil, [32]byte{}, 7); len(headers) != 7 {
+		t.Errorf("headers must be limited, got %d", len(headers))
+	}
+}
+
+func TestReplaceFrom(t *testing.T) {
+	ours := NewBlockchain(minerAddress, params.Regtest)
+	theirs := NewBlockchain("someone else", params.Regtest)
+	mine(t, ours)
+	mine(t, theirs)
+	// a payment in our last block, which their chain does not include
+	pay(t, ours, minerAddress, "alice", 0.5)
+	mine(t, ours)
+	for i := 0; i < 2; i++ {
+		mine(t, theirs)
+	}
+
+	if err := theirs.ReplaceFrom(0, ours.Chain()[1:]); err != ErrShorterChain {
+		t.Errorf("shorter chain: got %v, expected %v", err, ErrShorterChain)
+	}
+	forged := append([]*Block(nil), theirs.Chain()[1:]...)
+	forged[0], forged[1] = forged[1], forged[0]
+	if err := ours.ReplaceFrom(0, forged); err != ErrUnknownParent {
+		t.Errorf("unlinked blocks: got %v, expected %v", err, ErrUnknownParent)
+	}
+
+	if err := ours.ReplaceFrom(0, theirs.Chain()[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if ours.LastBlock().Hash() != theirs.LastBlock().Hash() || ours.Height() != 3 {
+		t.Fatal("chain not replaced")
+	}
+	pool := ours.TransactionPool()
+	if len(pool) != 1 || pool[0].Receiver() != "alice" {
+		t.Errorf("transactions of the dropped blocks must return to the pool, got %v", pool)
+	}
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	bc := NewBlockchain(minerAddress, params.Regtest)
+	mine(t, bc)
+	pay(t, bc, minerAddress, "alice", 0.5)
+	s := bc.Snapshot()
+	tip := s.LastBlock().Hash()
+
+	mine(t, bc)
+	other := NewBlockchain("someone else", params.Regtest)
+	for i := 0; i < 3; i++ {
+		b, _ := other.NewBlockTemplate("someone else")
+		solve(b, other.Network().Difficulty)
+		other.AddBlock(b)
+	}
+	if err := bc.ReplaceFrom(0, other.Chain()[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if s.Height() != 1 || s.LastBlock().Hash() != tip || len(s.TransactionPool()) != 1 {
+		t.Fatal("snapshot changed with the chain")
+	}
+	if s.Balance(minerAddress) != params.Regtest.Reward || bc.CalculateTotalAmount(minerAddress) != 0 {
+		t.Errorf("balance %v in the snapshot, %v in the chain", s.Balance(minerAddress), bc.CalculateTotalAmount(minerAddress))
+	}
+	if s.Block(2) != nil || s.Block(1).Hash() != tip {
+		t.Error("blocks by height")
+	}
+}
+
+// TestConcurrentAccess is meant for the race detector: blocks, transactions
+// and reorgs arrive while readers take snapshots, which must stay consistent
+func TestConcurrentAccess(t *testing.T) {
+	bc := NewBlockchain(minerAddress, params.Regtest)
+	var writers, readers sync.WaitGroup
+	done := make(chan struct{})
+	writers.Add(4)
+	go func() {
+		defer writers.Done()
+		for i := 0; i < 20; i++ {
+			b, _ := bc.NewBlockTemplate(minerAddress)
+			solve(b, bc.Network().Difficulty)
+			bc.AddBlock(b)
+		}
+	}()
+	go func() {
+		defer writers.Done()
+		for i := 0; i < 50; i++ {
+			publicKey, signature := sign(NewTransaction(minerAddress, "alice", 0.1))
+			bc.AddTransaction(minerAddress, "alice", 0.1, publicKey, signature)
+			if i%10 == 0 {
+				bc.ClearTransactionPool()
+			}
+		}
+	}()
+	go func() {
+		defer writers.Done()
+		// forks from a snapshot, replacing the chain when still longer
+		for i := 0; i < 10; i++ {
+			s := bc.Snapshot()
+			prev := s.LastBlock().Hash()
+			var blocks []*Block
+			for j := 0; j < 2; j++ {
+				b := NewBlock(0, prev, []*Transaction{NewTransaction(MINING_SENDER, "bob", 1)})
+				solve(b, bc.Network().Difficulty)
+				blocks = append(blocks, b)
+				prev = b.Hash()
+			}
+			bc.ReplaceFrom(s.Height(), blocks)
+		}
+	}()
+	go func() {
+		defer writers.Done()
+		m, _ := bc.MarshalJSON()
+		for i := 0; i < 10; i++ {
+			var copy Blockchain
+			if err := copy.UnmarshalJSON(m); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s := bc.Snapshot()
+				blocks := s.Blocks()
+				if s.Height() != len(blocks)-1 || s.LastBlock() != blocks[len(blocks)-1] {
+					t.Error("inconsistent snapshot")
+				}
+				for h := 1; h < len(blocks); h++ {
+					if blocks[h].PreviousHash() != blocks[h-1].Hash() {
+						t.Errorf("snapshot block %d does not follow its parent", h)
+					}
+				}
+				s.Balance(minerAddress)
+				s.MarshalJSON()
+				bc.Locator()
+				bc.LastBlock()
+				bc.TransactionPool()
+				bc.HasBlock(blocks[len(blocks)-1].Hash())
+			}
+		}()
+	}
+	writers.Wait()
+	close(done)
+	readers.Wait()
+	if !bc.ValidChain(bc.Chain()) {
+		t.Error("chain corrupted")
+	}
+}
+
+// received drains the events published so far
+func received(s *Subscription) []string {
+	var types []string
+	for {
+		select {
+		case e, ok := <-s.Events():
+			if !ok {
+				return append(types, "closed")
+			}
+			types = append(types, e.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ours := NewBlockchain(minerAddress, params.Regtest)
+	theirs := NewBlockchain("someone else", params.Regtest)
+	all := ours.Events().Subscribe(nil, nil)
+	alice := ours.Events().Subscribe(nil, []string{"alice"})
+	blocks := ours.Events().Subscribe([]string{EVENT_BLOCK}, []string{"alice"})
+	defer all.Close()
+	defer alice.Close()
+	defer blocks.Close()
+
+	mine(t, ours)
+	pay(t, ours, minerAddress, "alice", 0.5)
+	mine(t, ours)
+	for i := 0; i < 3; i++ {
+		mine(t, theirs)
+	}
+	if err := ours.ReplaceFrom(0, theirs.Chain()[1:]); err != nil {
+		t.Fatal(err)
+	}
+	ours.ClearTransactionPool()
+
+	expect := func(name string, s *Subscription, want ...string) {
+		if got := received(s); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: got %v, expected %v", name, got, want)
+		}
+	}
+	expect("all", all, EVENT_BLOCK, EVENT_TX, EVENT_BLOCK, EVENT_REORG,
+		EVENT_BLOCK, EVENT_BLOCK, EVENT_BLOCK, EVENT_TX, EVENT_EVICTION)
+	// the payment enters the pool, is mined, dropped by the reorg, waits
+	// again and is evicted
+	expect("alice", alice, EVENT_TX, EVENT_BLOCK, EVENT_REORG, EVENT_TX, EVENT_EVICTION)
+	expect("blocks of alice", blocks, EVENT_BLOCK)
+
+	all.Close()
+	expect("closed", all, "closed")
+	slow := ours.Events().Subscribe(nil, nil)
+	for i := 0; i <= SUBSCRIPTION_BUFFER; i++ {
+		ours.addToPool(NewTransaction("bob", "carol", 1))
+	}
+	if ours.Events().Subscribers() != 2 {
+		t.Error("a subscriber falling behind must be unsubscribed")
+	}
+	if got := received(slow); len(got) != SUBSCRIPTION_BUFFER+1 || got[SUBSCRIPTION_BUFFER] != "closed" {
+		t.Errorf("slow subscriber received %d events", len(got))
+	}
+}
@@ -0,0 +1,155 @@
+package blockchain
+
+import "sync"
+
+// Types of the events published on the EventBus of the chain
+const (
+	EVENT_BLOCK    = "block"
+	EVENT_TX       = "tx"
+	EVENT_REORG    = "reorg"
+	EVENT_EVICTION = "eviction"
+)
+
+// SUBSCRIPTION_BUFFER is the number of events a subscriber may fall behind
+// before the bus gives up on it
+const SUBSCRIPTION_BUFFER = 256
+
+// Event is a change of the chain or of the transaction pool:
+//   - block: Block was added to the chain at Height
+//   - tx: Transaction entered the pool
+//   - reorg: the Dropped blocks above Height left the chain, the blocks of
+//     the new branch follow as block events
+//   - eviction: Transaction left the pool without being included in a block
+type Event struct {
+	Type        string
+	Height      int
+	Block       *Block
+	Transaction *Transaction
+	Dropped     []*Block
+}
+
+// Involves tells whether the event moves coins of address
+func (e *Event) Involves(address string) bool {
+	involves := func(t *Transaction) bool {
+		return t.sender == address || t.receiver == address
+	}
+	if e.Transaction != nil && involves(e.Transaction) {
+		return true
+	}
+	blocks := e.Dropped
+	if e.Block != nil {
+		blocks = append([]*Block{e.Block}, blocks...)
+	}
+	for _, b := range blocks {
+		for _, t := range b.transactions {
+			if involves(t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// EventBus hands the events of a chain out to its subscribers. Publishing
+// never blocks: a subscriber whose buffer is full is unsubscribed, its
+// channel closed, and has to subscribe again.
+type EventBus struct {
+	mux  sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives the events of the types and addresses it was made
+// for, all of them when none were given
+type Subscription struct {
+	bus       *EventBus
+	c         chan *Event
+	types     map[string]bool
+	addresses map[string]bool
+}
+
+// Subscribe registers a subscriber to the events of the given types which
+// involve one of addresses. Empty lists do not filter.
+func (eb *EventBus) Subscribe(types []string, addresses []string) *Subscription {
+	s := &Subscription{
+		bus:       eb,
+		c:         make(chan *Event, SUBSCRIPTION_BUFFER),
+		types:     make(map[string]bool),
+		addresses: make(map[string]bool),
+	}
+	for _, t := range types {
+		s.types[t] = true
+	}
+	for _, a := range addresses {
+		s.addresses[a] = true
+	}
+	eb.mux.Lock()
+	defer eb.mux.Unlock()
+	eb.subs[s] = struct{}{}
+	return s
+}
+
+// Events returns the channel of the events, closed once the subscription ends
+func (s *Subscription) Events() <-chan *Event {
+	return s.c
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.bus.mux.Lock()
+	defer s.bus.mux.Unlock()
+	s.bus.remove(s)
+}
+
+// remove closes a subscription still registered. Callers must hold eb.mux
+func (eb *EventBus) remove(s *Subscription) {
+	if _, ok := eb.subs[s]; ok {
+		delete(eb.subs, s)
+		close(s.c)
+	}
+}
+
+func (s *Subscription) wants(e *Event) bool {
+	if len(s.types) > 0 && !s.types[e.Type] {
+		return false
+	}
+	if len(s.addresses) == 0 {
+		return true
+	}
+	for address := range s.addresses {
+		if e.Involves(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish sends the events to the subscribers wanting them, in order
+func (eb *EventBus) Publish(events ...*Event) {
+	eb.mux.Lock()
+	defer eb.mux.Unlock()
+subscribers:
+	for s := range eb.subs {
+		for _, e := range events {
+			if !s.wants(e) {
+				continue
+			}
+			select {
+			case s.c <- e:
+			default:
+				eb.remove(s)
+				continue subscribers
+			}
+		}
+	}
+}
+
+// Subscribers returns the number of subscriptions
+func (eb *EventBus) Subscribers() int {
+	eb.mux.Lock()
+	defer eb.mux.Unlock()
+	return len(eb.subs)
+}
@@ -0,0 +1,104 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+const HEADER_SIZE = 80
+
+// Header is the part of a block covered by the proof of work. It commits to
+// the transactions through their merkle root, so miners only have to hash a
+// fixed 80 bytes buffer for every nonce they try.
+type Header struct {
+	Timestamp    int64
+	PreviousHash [32]byte
+	MerkleRoot   [32]byte
+	Nonce        uint32
+	ExtraNonce   uint32
+}
+
+// Bytes serializes the header in its canonical (big endian) form:
+// timestamp(8) | previous_hash(32) | merkle_root(32) | extra_nonce(4) | nonce(4)
+// The nonce comes last so that miners can rewrite it in place.
+func (h *Header) Bytes() []byte {
+	buf := make([]byte, HEADER_SIZE)
+	binary.BigEndian.PutUint64(buf[0:8], uint64(h.Timestamp))
+	copy(buf[8:40], h.PreviousHash[:])
+	copy(buf[40:72], h.MerkleRoot[:])
+	binary.BigEndian.PutUint32(buf[72:76], h.ExtraNonce)
+	binary.BigEndian.PutUint32(buf[76:80], h.Nonce)
+	return buf
+}
+
+// HeaderFromBytes decodes a header serialized by Bytes
+func HeaderFromBytes(buf []byte) (*Header, error) {
+	if len(buf) != HEADER_SIZE {
+		return nil, fmt.Errorf("header of %d bytes, expected %d", len(buf), HEADER_SIZE)
+	}
+	h := new(Header)
+	h.Timestamp = int64(binary.BigEndian.Uint64(buf[0:8]))
+	copy(h.PreviousHash[:], buf[8:40])
+	copy(h.MerkleRoot[:], buf[40:72])
+	h.ExtraNonce = binary.BigEndian.Uint32(buf[72:76])
+	h.Nonce = binary.BigEndian.Uint32(buf[76:80])
+	return h, nil
+}
+
+func (h *Header) Hash() [32]byte {
+	return sha256.Sum256(h.Bytes())
+}
+
+// MeetsDifficulty tells whether hash starts with difficulty hex zeros
+func MeetsDifficulty(hash [32]byte, difficulty int) bool {
+	if difficulty > 2*len(hash) {
+		return false
+	}
+	for i := 0; i < difficulty/2; i++ {
+		if hash[i] != 0 {
+			return false
+		}
+	}
+	if difficulty%2 == 1 && hash[difficulty/2]>>4 != 0 {
+		return false
+	}
+	return true
+}
+
+// ValidProof checks the proof of work of a header
+func ValidProof(h *Header, difficulty int) bool {
+	return MeetsDifficulty(h.Hash(), difficulty)
+}
+
+func (t *Transaction) Hash() [32]byte {
+	m, _ := json.Marshal(t)
+	return sha256.Sum256(m)
+}
+
+// MerkleRoot hashes the transactions pairwise up to a single root. An odd
+// node at any level is paired with itself. No transactions give a zero root.
+func MerkleRoot(transactions []*Transaction) [32]byte {
+	if len(transactions) == 0 {
+		return [32]byte{}
+	}
+	level := make([][32]byte, 0, len(transactions))
+	for _, t := range transactions {
+		level = append(level, t.Hash())
+	}
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		next := make([][32]byte, 0, len(level)/2)
+		for i := 0; i < len(level); i += 2 {
+			var pair [64]byte
+			copy(pair[:32], level[i][:])
+			copy(pair[32:], level[i+1][:])
+			next = append(next, sha256.Sum256(pair[:]))
+		}
+		level = next
+	}
+	return level[0]
+}
@@ -0,0 +1,61 @@
+package blockchain
+
+import "encoding/json"
+
+// Snapshot is a consistent read-only view of the chain and the transaction
+// pool at one point in time, unaffected by the blocks and transactions
+// arriving meanwhile. Taking one is cheap: it shares the blocks of the chain.
+type Snapshot struct {
+	blocks []*Block
+	pool   []*Transaction
+}
+
+func (bc *Blockchain) Snapshot() *Snapshot {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	n := len(bc.chain)
+	return &Snapshot{
+		// capped, appending to the snapshot cannot write into the chain
+		blocks: bc.chain[:n:n],
+		pool:   append([]*Transaction(nil), bc.transactionPool...),
+	}
+}
+
+// Height is the number of blocks on top of the genesis block
+func (s *Snapshot) Height() int {
+	return len(s.blocks) - 1
+}
+
+// Blocks returns the blocks from the genesis one, which must not be modified
+func (s *Snapshot) Blocks() []*Block {
+	return s.blocks
+}
+
+// Block returns the block at height, nil when there is none
+func (s *Snapshot) Block(height int) *Block {
+	if height < 0 || height >= len(s.blocks) {
+		return nil
+	}
+	return s.blocks[height]
+}
+
+func (s *Snapshot) LastBlock() *Block {
+	return s.blocks[len(s.blocks)-1]
+}
+
+func (s *Snapshot) TransactionPool() []*Transaction {
+	return s.pool
+}
+
+// Balance is the amount owned by address in the chain
+func (s *Snapshot) Balance(address string) float32 {
+	return calculateTotalAmount(s.blocks, address)
+}
+
+func (s *Snapshot) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Blocks []*Block `json:"chain"`
+	}{
+		Blocks: s.blocks,
+	})
+}
@@ -1,8 +1,14 @@
 package blockchain
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"moviecoin/utils"
 	"strings"
 )
 
@@ -24,6 +30,18 @@ func NewTransaction(sender string, recipient string, value float32) *Transaction
 	return &Transaction{sender, recipient, value}
 }
 
+func (t *Transaction) Sender() string {
+	return t.sender
+}
+
+func (t *Transaction) Receiver() string {
+	return t.receiver
+}
+
+func (t *Transaction) Amount() float32 {
+	return t.amount
+}
+
 func (t *Transaction) String() string {
 	output := fmt.Sprintf("%s\n", strings.Repeat("-", 40))
 	output += fmt.Sprintf(" sender_address     %s\n", t.sender)
@@ -70,3 +88,27 @@ func (tr *TransactionRequest) Validate() bool {
 	}
 	return true
 }
+
+// Hash identifies a signed transaction request. Signatures are randomized,
+// so two payments of the same amount between the same wallets differ.
+func (tr *TransactionRequest) Hash() [32]byte {
+	m, _ := json.Marshal(tr)
+	return sha256.Sum256(m)
+}
+
+// Keys decodes the public key and the signature of a complete request. Unlike
+// utils.PublicKeyFromString it never panics on malformed input, so it is the
+// one to use on requests received from other nodes.
+func (tr *TransactionRequest) Keys() (*ecdsa.PublicKey, *utils.Signature, error) {
+	if len(*tr.SenderPublicKey) != 128 || len(*tr.Signature) != 128 {
+		return nil, nil, errors.New("malformed public key or signature")
+	}
+	if _, err := hex.DecodeString(*tr.SenderPublicKey + *tr.Signature); err != nil {
+		return nil, nil, errors.New("malformed public key or signature")
+	}
+	publicKey := utils.PublicKeyFromString(*tr.SenderPublicKey)
+	if !elliptic.P256().IsOnCurve(publicKey.X, publicKey.Y) {
+		return nil, nil, errors.New("public key is not on the curve")
+	}
+	return publicKey, utils.SignatureFromString(*tr.Signature), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log"
+	"moviecoin/miner"
+	"moviecoin/utils"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AdminAuth guards the administration endpoints. Requests must carry the
+// configured token as "Authorization: Bearer <token>"; when no token is
+// configured only loopback clients are let in.
+func (bcs *BlockchainServer) AdminAuth(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !bcs.isAdmin(req) {
+			log.Printf("ERROR: unauthorized admin request [%s]%s from %s", req.Method, req.URL.Path, req.RemoteAddr)
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, string(utils.JsonStatus("unauthorized")))
+			return
+		}
+		handler(w, req)
+	}
+}
+
+func (bcs *BlockchainServer) isAdmin(req *http.Request) bool {
+	token := bcs.config.Admin.Token
+	if token == "" {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			return false
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+	given := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// MiningSchedule is the schedule set by the configuration
+func (bcs *BlockchainServer) MiningSchedule() miner.Schedule {
+	return miner.Schedule{Mode: bcs.config.Mining.Mode, Interval: bcs.config.MiningInterval()}
+}
+
+// StartMining starts the miner, optionally with the schedule given in the
+// body: {"mode": "interval"|"continuous", "interval_sec": 30}
+func (bcs *BlockchainServer) StartMining(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		schedule := bcs.MiningSchedule()
+		var body struct {
+			Mode        *string `json:"mode"`
+			IntervalSec *int    `json:"interval_sec"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil && err != io.EOF {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		if body.Mode != nil {
+			schedule.Mode = *body.Mode
+		}
+		if body.IntervalSec != nil {
+			schedule.Interval = time.Duration(*body.IntervalSec) * time.Second
+		}
+		w.Header().Add("Content-Type", "application/json")
+		if bcs.network.GenerateOnDemand {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, string(utils.JsonStatus(bcs.network.Name+" only generates blocks on demand")))
+			return
+		}
+		if err := bcs.controller.Start(schedule); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus(err.Error())))
+			return
+		}
+		m, _ := json.Marshal(bcs.controller.Status())
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (bcs *BlockchainServer) StopMining(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		bcs.controller.Stop()
+		m, _ := json.Marshal(bcs.controller.Status())
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (bcs *BlockchainServer) MiningStatus(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(bcs.controller.Status())
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
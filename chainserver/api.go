@@ -0,0 +1,420 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"moviecoin/api"
+	"moviecoin/blockchain"
+	"moviecoin/miner"
+	"moviecoin/p2p"
+	"moviecoin/wallet"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openAPIDocument describes the routes of APIRouter, server_test checks it
+// against them
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// Pages of blocks
+const (
+	DEFAULT_BLOCKS_LIMIT = 20
+	MAX_BLOCKS_LIMIT     = 100
+)
+
+// APIRouter serves the versioned JSON API under /api/v1. The legacy routes
+// stay as they are for the existing clients.
+func (bcs *BlockchainServer) APIRouter() *api.Router {
+	r := api.NewRouter(api.PREFIX)
+	r.Handle(http.MethodGet, "/openapi.json", "OpenAPI document of the API", api.ServeDocument(openAPIDocument))
+	r.Handle(http.MethodGet, "/tip", "Last block of the chain", bcs.apiTip)
+	r.Handle(http.MethodGet, "/blocks", "Page of blocks of the chain", bcs.apiBlocks)
+	r.Handle(http.MethodPost, "/blocks", "Submit the solution of a mining template", bcs.apiSubmitBlock)
+	r.Handle(http.MethodGet, "/blocks/{height}", "Block at a height", bcs.apiBlock)
+	r.Handle(http.MethodGet, "/blocks/hash/{hash}", "Block with a hash", bcs.apiBlockByHash)
+	r.Handle(http.MethodGet, "/blocks/{height}/transactions", "Transactions of the block at a height", bcs.apiBlockTransactions)
+	r.Handle(http.MethodGet, "/transactions", "Transactions waiting in the pool", bcs.apiTransactions)
+	r.Handle(http.MethodPost, "/transactions", "Submit a signed transaction", bcs.apiCreateTransaction)
+	r.Handle(http.MethodDelete, "/transactions", "Empty the transaction pool", bcs.apiClearTransactions, bcs.apiAdmin)
+	r.Handle(http.MethodGet, "/transactions/{txid}", "Transaction in the pool or in the chain", bcs.apiTransaction)
+	r.Handle(http.MethodGet, "/addresses/{address}/balance", "Balance of an address", bcs.apiBalance)
+	r.Handle(http.MethodGet, "/mining/template", "Block template for an external miner", bcs.apiMiningTemplate)
+	r.Handle(http.MethodPost, "/generate", "Mine blocks immediately (regtest)", bcs.apiGenerate, bcs.apiAdmin)
+	r.Handle(http.MethodGet, "/peers", "Connected peers, known addresses and bans", bcs.apiPeers, bcs.apiAdmin)
+	return r
+}
+
+// apiAdmin is AdminAuth for the routes of the API
+func (bcs *BlockchainServer) apiAdmin(h api.HandlerFunc) api.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		if !bcs.isAdmin(req) {
+			return api.Unauthorized()
+		}
+		return h(w, req)
+	}
+}
+
+type blockResponse struct {
+	Height int               `json:"height"`
+	Hash   string            `json:"hash"`
+	Block  *blockchain.Block `json:"block"`
+}
+
+func newBlockResponse(height int, b *blockchain.Block) *blockResponse {
+	return &blockResponse{Height: height, Hash: fmt.Sprintf("%x", b.Hash()), Block: b}
+}
+
+// blocksResponse is a page of blocks in increasing heights
+type blocksResponse struct {
+	Height int              `json:"height"`
+	Blocks []*blockResponse `json:"blocks"`
+	// NextCursor resumes after the last block of the page, it is omitted
+	// once the page reaches the tip
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// blockCursor identifies a block by its height and the beginning of its
+// hash, so that a cursor left on a branch dropped by a reorganization is
+// refused instead of silently skipping or repeating blocks
+func blockCursor(height int, b *blockchain.Block) string {
+	hash := b.Hash()
+	return fmt.Sprintf("%d.%x", height, hash[:8])
+}
+
+// parseCursor returns the height following the block of cursor
+func parseCursor(s *blockchain.Snapshot, cursor string) (int, error) {
+	h, _, ok := strings.Cut(cursor, ".")
+	height, err := strconv.Atoi(h)
+	if !ok || err != nil || height < 0 {
+		return 0, api.Validation{"cursor": "malformed cursor"}.Err()
+	}
+	if b := s.Block(height); b == nil || blockCursor(height, b) != cursor {
+		return 0, api.Conflict("the chain was reorganized since the cursor was issued, restart from a height")
+	}
+	return height + 1, nil
+}
+
+// apiBlocks serves the blocks from a height, or following a cursor, up to a
+// limit. The ETag is the one of the tip: the page only changes with it.
+func (bcs *BlockchainServer) apiBlocks(w http.ResponseWriter, req *http.Request) error {
+	q := req.URL.Query()
+	from, limit := 0, DEFAULT_BLOCKS_LIMIT
+	v := api.Validation{}
+	if s := q.Get("from"); s != "" {
+		n, err := strconv.Atoi(s)
+		v.Check(err == nil && n >= 0, "from", "must be a non-negative integer")
+		from = n
+	}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		v.Check(err == nil && n >= 1 && n <= MAX_BLOCKS_LIMIT, "limit", fmt.Sprintf("must be an integer in [1, %d]", MAX_BLOCKS_LIMIT))
+		limit = n
+	}
+	v.Check(q.Get("from") == "" || q.Get("cursor") == "", "cursor", "excludes from")
+	if err := v.Err(); err != nil {
+		return err
+	}
+	s := bcs.GetBlockchain().Snapshot()
+	if cursor := q.Get("cursor"); cursor != "" {
+		n, err := parseCursor(s, cursor)
+		if err != nil {
+			return err
+		}
+		from = n
+	}
+	if api.NotModified(w, req, fmt.Sprintf("%x-%d-%d", s.LastBlock().Hash(), from, limit)) {
+		return nil
+	}
+	resp := &blocksResponse{Height: s.Height(), Blocks: make([]*blockResponse, 0, limit)}
+	for height := from; height <= s.Height() && len(resp.Blocks) < limit; height++ {
+		resp.Blocks = append(resp.Blocks, newBlockResponse(height, s.Block(height)))
+	}
+	if last := from + len(resp.Blocks) - 1; len(resp.Blocks) > 0 && last < s.Height() {
+		resp.NextCursor = blockCursor(last, s.Block(last))
+	}
+	api.WriteJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+// heightParam returns the block at the height of the path
+func heightParam(s *blockchain.Snapshot, req *http.Request) (int, *blockchain.Block, error) {
+	height, err := strconv.Atoi(api.Param(req, "height"))
+	if err != nil || height < 0 {
+		return 0, nil, api.BadRequest("height must be a non-negative integer")
+	}
+	b := s.Block(height)
+	if b == nil {
+		return 0, nil, api.NotFound(fmt.Sprintf("no block at height %d", height))
+	}
+	return height, b, nil
+}
+
+// apiBlock tags the block with its hash, which changes when a
+// reorganization replaces the block at a height
+func (bcs *BlockchainServer) apiBlock(w http.ResponseWriter, req *http.Request) error {
+	height, b, err := heightParam(bcs.GetBlockchain().Snapshot(), req)
+	if err != nil {
+		return err
+	}
+	if api.NotModified(w, req, fmt.Sprintf("%x", b.Hash())) {
+		return nil
+	}
+	api.WriteJSON(w, http.StatusOK, newBlockResponse(height, b))
+	return nil
+}
+
+func (bcs *BlockchainServer) apiBlockByHash(w http.ResponseWriter, req *http.Request) error {
+	hash, ok := parseHash(api.Param(req, "hash"))
+	if !ok {
+		return api.BadRequest("hash must be 64 hex digits")
+	}
+	s := bcs.GetBlockchain().Snapshot()
+	height := findBlock(s, hash)
+	if height < 0 {
+		return api.NotFound(fmt.Sprintf("no block %x in the chain", hash))
+	}
+	if api.NotModified(w, req, fmt.Sprintf("%x", hash)) {
+		return nil
+	}
+	api.WriteJSON(w, http.StatusOK, newBlockResponse(height, s.Block(height)))
+	return nil
+}
+
+type transactionResponse struct {
+	TxID             string  `json:"txid"`
+	SenderAddress    string  `json:"sender_address"`
+	RecipientAddress string  `json:"recipient_address"`
+	Amount           float32 `json:"amount"`
+}
+
+func (bcs *BlockchainServer) apiBlockTransactions(w http.ResponseWriter, req *http.Request) error {
+	height, b, err := heightParam(bcs.GetBlockchain().Snapshot(), req)
+	if err != nil {
+		return err
+	}
+	hash := fmt.Sprintf("%x", b.Hash())
+	if api.NotModified(w, req, hash) {
+		return nil
+	}
+	transactions := make([]*transactionResponse, 0, len(b.Transactions()))
+	for _, t := range b.Transactions() {
+		transactions = append(transactions, &transactionResponse{
+			TxID:             fmt.Sprintf("%x", t.Hash()),
+			SenderAddress:    t.Sender(),
+			RecipientAddress: t.Receiver(),
+			Amount:           t.Amount(),
+		})
+	}
+	api.WriteJSON(w, http.StatusOK, struct {
+		Height       int                    `json:"height"`
+		Hash         string                 `json:"hash"`
+		Count        int                    `json:"count"`
+		Transactions []*transactionResponse `json:"transactions"`
+	}{height, hash, len(transactions), transactions})
+	return nil
+}
+
+// apiTip is the cheap way to poll the chain: clients send the ETag back and
+// get a 304 until a block is added
+func (bcs *BlockchainServer) apiTip(w http.ResponseWriter, req *http.Request) error {
+	s := bcs.GetBlockchain().Snapshot()
+	b := s.LastBlock()
+	hash := fmt.Sprintf("%x", b.Hash())
+	if api.NotModified(w, req, hash) {
+		return nil
+	}
+	api.WriteJSON(w, http.StatusOK, struct {
+		Height       int    `json:"height"`
+		Hash         string `json:"hash"`
+		PreviousHash string `json:"previous_hash"`
+		Timestamp    int64  `json:"timestamp"`
+	}{s.Height(), hash, fmt.Sprintf("%x", b.PreviousHash()), b.Timestamp()})
+	return nil
+}
+
+func (bcs *BlockchainServer) apiTransactions(w http.ResponseWriter, req *http.Request) error {
+	transactions := bcs.GetBlockchain().TransactionPool()
+	api.WriteJSON(w, http.StatusOK, struct {
+		Count        int                       `json:"count"`
+		Transactions []*blockchain.Transaction `json:"transactions"`
+	}{len(transactions), transactions})
+	return nil
+}
+
+// apiTransaction tells whether a transaction is pending or confirmed, the
+// txid being the hash answered when it was submitted
+func (bcs *BlockchainServer) apiTransaction(w http.ResponseWriter, req *http.Request) error {
+	b, err := hex.DecodeString(api.Param(req, "txid"))
+	if err != nil || len(b) != 32 {
+		return api.BadRequest("txid must be 64 hex digits")
+	}
+	var txid [32]byte
+	copy(txid[:], b)
+	rt := transactionStatus(bcs.GetBlockchain().Snapshot(), txid)
+	if rt == nil {
+		return api.NotFound("transaction not found")
+	}
+	api.WriteJSON(w, http.StatusOK, rt)
+	return nil
+}
+
+func (bcs *BlockchainServer) apiCreateTransaction(w http.ResponseWriter, req *http.Request) error {
+	var t blockchain.TransactionRequest
+	if err := api.DecodeJSON(w, req, &t); err != nil {
+		return err
+	}
+	if err := bcs.acceptTransaction(&t); err != nil {
+		return err
+	}
+	api.WriteJSON(w, http.StatusCreated, struct {
+		Hash string `json:"hash"`
+	}{fmt.Sprintf("%x", t.Hash())})
+	return nil
+}
+
+// acceptTransaction checks a signed transaction field by field before
+// handing it to the chain, so that clients learn what is wrong with it. The
+// errors are *api.Error.
+func (bcs *BlockchainServer) acceptTransaction(t *blockchain.TransactionRequest) error {
+	v := api.Validation{}
+	v.Check(t.SenderAddress != nil, "sender_address", "required")
+	v.Check(t.ReceiverAddress != nil, "receiver_address", "required")
+	v.Check(t.SenderPublicKey != nil, "sender_public_key", "required")
+	v.Check(t.Signature != nil, "signature", "required")
+	v.Check(t.Amount != nil, "amount", "required")
+	if err := v.Err(); err != nil {
+		return err
+	}
+	v.Check(*t.Amount > 0, "amount", "must be positive")
+	v.Check(*t.SenderAddress != blockchain.MINING_SENDER, "sender_address", "reserved for the mining rewards")
+	v.Check(wallet.ValidateAddress(*t.SenderAddress, bcs.network) == nil, "sender_address", "invalid address")
+	v.Check(wallet.ValidateAddress(*t.ReceiverAddress, bcs.network) == nil, "receiver_address", "invalid address")
+	publicKey, signature, err := t.Keys()
+	if err != nil {
+		v.Check(false, "sender_public_key", err.Error())
+	} else {
+		v.Check(wallet.Address(publicKey, bcs.network) == *t.SenderAddress, "sender_public_key",
+			"does not match the sender address")
+	}
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	bc := bcs.GetBlockchain()
+	tx := blockchain.NewTransaction(*t.SenderAddress, *t.ReceiverAddress, *t.Amount)
+	if !bc.VerifyTransactionSignature(publicKey, signature, tx) {
+		return api.Rejected("invalid signature")
+	}
+	// the balance is checked again under the lock of the chain
+	if !bc.CreateTransaction(*t.SenderAddress, *t.ReceiverAddress, *t.Amount, publicKey, signature) {
+		return api.Rejected("insufficient funds")
+	}
+	return nil
+}
+
+func (bcs *BlockchainServer) apiClearTransactions(w http.ResponseWriter, req *http.Request) error {
+	bcs.GetBlockchain().ClearTransactionPool()
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (bcs *BlockchainServer) apiBalance(w http.ResponseWriter, req *http.Request) error {
+	address := api.Param(req, "address")
+	if err := wallet.ValidateAddress(address, bcs.network); err != nil {
+		return api.BadRequest(err.Error())
+	}
+	api.WriteJSON(w, http.StatusOK, struct {
+		Address string  `json:"address"`
+		Balance float32 `json:"balance"`
+	}{address, bcs.GetBlockchain().Snapshot().Balance(address)})
+	return nil
+}
+
+func (bcs *BlockchainServer) apiMiningTemplate(w http.ResponseWriter, req *http.Request) error {
+	bc := bcs.GetBlockchain()
+	payoutAddress := req.URL.Query().Get("address")
+	if payoutAddress == "" {
+		payoutAddress = bc.MinerAddress()
+	} else if err := wallet.ValidateAddress(payoutAddress, bcs.network); err != nil {
+		return api.Validation{"address": err.Error()}.Err()
+	}
+	if payoutAddress == "" {
+		return api.Validation{"address": "required, the node has no payout address"}.Err()
+	}
+	api.WriteJSON(w, http.StatusOK, bcs.templates.NewTemplate(bc, payoutAddress))
+	return nil
+}
+
+func (bcs *BlockchainServer) apiSubmitBlock(w http.ResponseWriter, req *http.Request) error {
+	var ws miner.WorkSubmission
+	if err := api.DecodeJSON(w, req, &ws); err != nil {
+		return err
+	}
+	v := api.Validation{}
+	v.Check(ws.TemplateID != nil, "template_id", "required")
+	v.Check(ws.Nonce != nil, "nonce", "required")
+	v.Check(ws.ExtraNonce != nil, "extra_nonce", "required")
+	if err := v.Err(); err != nil {
+		return err
+	}
+	bc := bcs.GetBlockchain()
+	b, err := bcs.templates.Submit(bc, &ws)
+	if errors.Is(err, miner.ErrUnknownTemplate) {
+		return api.Conflict(err.Error())
+	} else if err != nil {
+		return api.Rejected(err.Error())
+	}
+	log.Printf("Block %x submitted by an external miner", b.Hash())
+	bc.AnnounceBlock(b)
+	api.WriteJSON(w, http.StatusCreated, struct {
+		Hash string `json:"hash"`
+	}{fmt.Sprintf("%x", b.Hash())})
+	return nil
+}
+
+func (bcs *BlockchainServer) apiGenerate(w http.ResponseWriter, req *http.Request) error {
+	if !bcs.network.GenerateOnDemand {
+		return api.Conflict(bcs.network.Name + " does not generate blocks on demand")
+	}
+	count := 1
+	if s := req.URL.Query().Get("blocks"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return api.Validation{"blocks": "must be a positive integer"}.Err()
+		}
+		count = n
+	}
+	blocks, err := bcs.miner.Generate(bcs.GetBlockchain(), count)
+	if errors.Is(err, miner.ErrNoPayoutAddress) {
+		return api.Conflict(err.Error())
+	} else if err != nil {
+		return err
+	}
+	hashes := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		hashes = append(hashes, fmt.Sprintf("%x", b.Hash()))
+	}
+	api.WriteJSON(w, http.StatusCreated, struct {
+		Blocks []string `json:"blocks"`
+	}{hashes})
+	return nil
+}
+
+func (bcs *BlockchainServer) apiPeers(w http.ResponseWriter, req *http.Request) error {
+	if bcs.p2p == nil {
+		return api.Unavailable("peer to peer networking is not running")
+	}
+	api.WriteJSON(w, http.StatusOK, struct {
+		Peers     []p2p.PeerInfo       `json:"peers"`
+		Addresses []string             `json:"addresses"`
+		Bans      map[string]time.Time `json:"bans"`
+	}{bcs.p2p.PeerInfo(), bcs.addresses(), bcs.p2p.Bans()})
+	return nil
+}
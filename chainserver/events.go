@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"moviecoin/blockchain"
+	"moviecoin/wallet"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	EVENTS_PATH    = "/events"
+	EVENTS_WS_PATH = "/events/ws"
+	// SSE_KEEPALIVE keeps idle event streams from being closed by proxies
+	SSE_KEEPALIVE = 30 * time.Second
+)
+
+// streamEvent is a blockchain.Event as streamed to the clients. The fields
+// set depend on the type, see blockchain.Event.
+type streamEvent struct {
+	Type         string            `json:"type"`
+	Height       *int              `json:"height,omitempty"`
+	Hash         string            `json:"hash,omitempty"`
+	Transactions []*rpcTransaction `json:"transactions,omitempty"`
+	Transaction  *rpcTransaction   `json:"transaction,omitempty"`
+	Dropped      []string          `json:"dropped,omitempty"`
+}
+
+func newStreamEvent(e *blockchain.Event) *streamEvent {
+	se := &streamEvent{Type: e.Type}
+	switch e.Type {
+	case blockchain.EVENT_BLOCK:
+		se.Height = &e.Height
+		se.Hash = fmt.Sprintf("%x", e.Block.Hash())
+		se.Transactions = make([]*rpcTransaction, 0, len(e.Block.Transactions()))
+		for _, t := range e.Block.Transactions() {
+			se.Transactions = append(se.Transactions, newRPCTransaction(t))
+		}
+	case blockchain.EVENT_REORG:
+		se.Height = &e.Height
+		for _, b := range e.Dropped {
+			se.Dropped = append(se.Dropped, fmt.Sprintf("%x", b.Hash()))
+		}
+	default:
+		se.Transaction = newRPCTransaction(e.Transaction)
+	}
+	return se
+}
+
+// subscribe subscribes to the events selected by the query of the request:
+// types and address, both repeatable or comma separated
+func (bcs *BlockchainServer) subscribe(query url.Values) (*blockchain.Subscription, error) {
+	list := func(name string) []string {
+		var values []string
+		for _, v := range query[name] {
+			for _, s := range strings.Split(v, ",") {
+				if s != "" {
+					values = append(values, s)
+				}
+			}
+		}
+		return values
+	}
+	types, addresses := list("types"), list("address")
+	for _, t := range types {
+		switch t {
+		case blockchain.EVENT_BLOCK, blockchain.EVENT_TX, blockchain.EVENT_REORG, blockchain.EVENT_EVICTION:
+		default:
+			return nil, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	for _, a := range addresses {
+		if err := wallet.ValidateAddress(a, bcs.network); err != nil {
+			return nil, err
+		}
+	}
+	return bcs.GetBlockchain().Events().Subscribe(types, addresses), nil
+}
+
+// Events streams the events of the chain as Server-Sent Events, named after
+// their type. The stream ends when the client falls too far behind, clients
+// reconnect then, EventSource does it on its own.
+func (bcs *BlockchainServer) Events(w http.ResponseWriter, req *http.Request) {
+	url := strings.Split(req.RequestURI, " ")
+	log.Printf("[%s]%s", req.Method, url[0])
+	switch req.Method {
+	case http.MethodGet:
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			log.Println("ERROR: event stream needs a flushing ResponseWriter")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sub, err := bcs.subscribe(req.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer sub.Close()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		keepalive := time.NewTicker(SSE_KEEPALIVE)
+		defer keepalive.Stop()
+		for {
+			select {
+			case e, ok := <-sub.Events():
+				if !ok {
+					log.Printf("WARN: event stream of %s fell behind", req.RemoteAddr)
+					return
+				}
+				m, _ := json.Marshal(newStreamEvent(e))
+				if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, m); err != nil {
+					return
+				}
+			case <-keepalive.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+			case <-req.Context().Done():
+				return
+			}
+			flusher.Flush()
+		}
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// EventsWebSocket streams the events of the chain over WebSocket, a JSON text
+// message per event. It takes the query of Events and accepts any origin:
+// the events are public.
+func (bcs *BlockchainServer) EventsWebSocket() http.Handler {
+	return websocket.Server{Handler: func(conn *websocket.Conn) {
+		defer conn.Close()
+		req := conn.Request()
+		sub, err := bcs.subscribe(req.URL.Query())
+		if err != nil {
+			websocket.JSON.Send(conn, map[string]string{"error": err.Error()})
+			return
+		}
+		defer sub.Close()
+		// the messages of the client are ignored, reading tells when it leaves
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			var discard []byte
+			for websocket.Message.Receive(conn, &discard) == nil {
+			}
+		}()
+		for {
+			select {
+			case e, ok := <-sub.Events():
+				if !ok {
+					log.Printf("WARN: event stream of %s fell behind", req.RemoteAddr)
+					return
+				}
+				if err := websocket.JSON.Send(conn, newStreamEvent(e)); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	}}
+}
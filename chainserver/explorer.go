@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"moviecoin/blockchain"
+	"moviecoin/wallet"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EXPLORER_PATH = "/explorer/"
+	// EXPLORER_BLOCKS is the number of blocks of the home page
+	EXPLORER_BLOCKS = 20
+	// EXPLORER_HISTORY is the number of transactions of an address page
+	EXPLORER_HISTORY = 100
+	// EXPLORER_STATS_WINDOW is the number of last blocks averaged by the
+	// network statistics
+	EXPLORER_STATS_WINDOW = 100
+)
+
+// explorerFiles holds the templates of the pages and the static assets
+//
+//go:embed explorer
+var explorerFiles embed.FS
+
+var explorerFuncs = template.FuncMap{
+	"short": func(hash string) string {
+		if len(hash) <= 16 {
+			return hash
+		}
+		return hash[:16] + "…"
+	},
+	"time": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"hashrate": func(rate float64) string {
+		units := []string{"H/s", "kH/s", "MH/s", "GH/s", "TH/s"}
+		i := 0
+		for ; rate >= 1000 && i < len(units)-1; i++ {
+			rate /= 1000
+		}
+		return fmt.Sprintf("%.2f %s", rate, units[i])
+	},
+}
+
+// explorer serves the block explorer: server rendered pages of the chain,
+// the transaction pool and the network
+type explorer struct {
+	bcs   *BlockchainServer
+	pages map[string]*template.Template
+	mux   *http.ServeMux
+}
+
+type explorerBlock struct {
+	Height        int
+	Hash          string
+	PreviousHash  string
+	MerkleRoot    string
+	Time          time.Time
+	Nonce         uint32
+	ExtraNonce    uint32
+	Confirmations int
+	Amount        float32
+	Count         int
+	// Transactions are only listed by the block page
+	Transactions []*explorerTransaction
+}
+
+type explorerTransaction struct {
+	TxID      string
+	Sender    string
+	Recipient string
+	Amount    float32
+	// Reward is the payment of the miner of a block
+	Reward bool
+	// Height is -1 while the transaction is in the pool
+	Height        int
+	BlockHash     string
+	Time          time.Time
+	Confirmations int
+	// Received tells, on an address page, whether the address is paid
+	Received bool
+}
+
+type explorerStats struct {
+	Network    string
+	Difficulty int
+	Reward     float32
+	Height     int
+	TipTime    time.Time
+	// BlockTime is averaged over the last EXPLORER_STATS_WINDOW blocks
+	BlockTime      time.Duration
+	PoolSize       int
+	PoolAmount     float32
+	Peers          int
+	BestPeerHeight int
+	HashRate       float64
+	Mining         bool
+	BlocksFound    int
+	// GenerateOnDemand networks only mine when asked to
+	GenerateOnDemand bool
+}
+
+type explorerAddress struct {
+	Address   string
+	Balance   float32
+	Pending   []*explorerTransaction
+	History   []*explorerTransaction
+	Truncated bool
+}
+
+// Explorer serves the block explorer under EXPLORER_PATH
+func (bcs *BlockchainServer) Explorer() http.Handler {
+	e := &explorer{bcs: bcs, pages: make(map[string]*template.Template), mux: http.NewServeMux()}
+	for _, name := range []string{"index", "block", "transaction", "address", "mempool", "stats", "error"} {
+		e.pages[name] = template.Must(template.New(name).Funcs(explorerFuncs).ParseFS(explorerFiles,
+			"explorer/layout.html", "explorer/"+name+".html"))
+	}
+	static, _ := fs.Sub(explorerFiles, "explorer/static")
+
+	e.mux.HandleFunc("GET "+EXPLORER_PATH+"{$}", e.index)
+	e.mux.HandleFunc("GET "+EXPLORER_PATH+"block/{id}", e.block)
+	e.mux.HandleFunc("GET "+EXPLORER_PATH+"tx/{txid}", e.transaction)
+	e.mux.HandleFunc("GET "+EXPLORER_PATH+"address/{address}", e.address)
+	e.mux.HandleFunc("GET "+EXPLORER_PATH+"mempool", e.mempool)
+	e.mux.HandleFunc("GET "+EXPLORER_PATH+"stats", e.stats)
+	e.mux.HandleFunc("GET "+EXPLORER_PATH+"search", e.search)
+	e.mux.Handle("GET "+EXPLORER_PATH+"static/", http.StripPrefix(EXPLORER_PATH+"static/", http.FileServer(http.FS(static))))
+	e.mux.HandleFunc(EXPLORER_PATH, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			e.error(w, http.StatusMethodNotAllowed, req.Method+" is not allowed")
+			return
+		}
+		e.error(w, http.StatusNotFound, "No page at "+req.URL.Path)
+	})
+	return e
+}
+
+func (e *explorer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	url := strings.Split(req.RequestURI, " ")
+	log.Printf("[%s]%s", req.Method, url[0])
+	e.mux.ServeHTTP(w, req)
+}
+
+// render writes a page, the template being executed before anything is
+// written so that a failure answers a 500
+func (e *explorer) render(w http.ResponseWriter, status int, name string, data interface{}) {
+	var buf bytes.Buffer
+	page := struct {
+		Network string
+		Data    interface{}
+	}{e.bcs.network.Name, data}
+	if err := e.pages[name].ExecuteTemplate(&buf, "layout", &page); err != nil {
+		log.Printf("ERROR: explorer %s page: %v", name, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+func (e *explorer) error(w http.ResponseWriter, status int, message string) {
+	e.render(w, status, "error", struct {
+		Status  int
+		Message string
+	}{status, message})
+}
+
+func newExplorerTransaction(t *blockchain.Transaction) *explorerTransaction {
+	return &explorerTransaction{
+		TxID:      fmt.Sprintf("%x", t.Hash()),
+		Sender:    t.Sender(),
+		Recipient: t.Receiver(),
+		Amount:    t.Amount(),
+		Reward:    t.Sender() == blockchain.MINING_SENDER,
+		Height:    -1,
+	}
+}
+
+// newExplorerBlock describes the block at height, with its transactions when
+// full is set
+func newExplorerBlock(s *blockchain.Snapshot, height int, full bool) *explorerBlock {
+	b := s.Block(height)
+	header := b.Header()
+	eb := &explorerBlock{
+		Height:        height,
+		Hash:          fmt.Sprintf("%x", b.Hash()),
+		PreviousHash:  fmt.Sprintf("%x", header.PreviousHash),
+		MerkleRoot:    fmt.Sprintf("%x", header.MerkleRoot),
+		Time:          time.Unix(0, header.Timestamp),
+		Nonce:         header.Nonce,
+		ExtraNonce:    header.ExtraNonce,
+		Confirmations: s.Height() - height + 1,
+	}
+	for _, t := range b.Transactions() {
+		eb.Amount += t.Amount()
+		eb.Count++
+		if full {
+			et := newExplorerTransaction(t)
+			et.Height, et.BlockHash, et.Time, et.Confirmations = height, eb.Hash, eb.Time, eb.Confirmations
+			eb.Transactions = append(eb.Transactions, et)
+		}
+	}
+	return eb
+}
+
+func (e *explorer) newStats(s *blockchain.Snapshot) *explorerStats {
+	network := e.bcs.network
+	stats := &explorerStats{
+		Network:          network.Name,
+		Difficulty:       network.Difficulty,
+		Reward:           network.Reward,
+		Height:           s.Height(),
+		TipTime:          time.Unix(0, s.LastBlock().Timestamp()),
+		HashRate:         e.bcs.miner.HashRate(),
+		GenerateOnDemand: network.GenerateOnDemand,
+	}
+	// the genesis block is not timed by mining
+	if first := s.Height() - EXPLORER_STATS_WINDOW; s.Height() > 1 {
+		if first < 1 {
+			first = 1
+		}
+		elapsed := s.LastBlock().Timestamp() - s.Block(first).Timestamp()
+		stats.BlockTime = time.Duration(elapsed / int64(s.Height()-first))
+	}
+	for _, t := range s.TransactionPool() {
+		stats.PoolSize++
+		stats.PoolAmount += t.Amount()
+	}
+	if e.bcs.p2p != nil {
+		for _, p := range e.bcs.p2p.PeerInfo() {
+			stats.Peers++
+			if int(p.BestHeight) > stats.BestPeerHeight {
+				stats.BestPeerHeight = int(p.BestHeight)
+			}
+		}
+	}
+	if e.bcs.controller != nil {
+		status := e.bcs.controller.Status()
+		stats.Mining, stats.BlocksFound = status.Running, status.BlocksFound
+	}
+	return stats
+}
+
+func (e *explorer) index(w http.ResponseWriter, req *http.Request) {
+	s := e.bcs.GetBlockchain().Snapshot()
+	blocks := make([]*explorerBlock, 0, EXPLORER_BLOCKS)
+	for height := s.Height(); height >= 0 && len(blocks) < EXPLORER_BLOCKS; height-- {
+		blocks = append(blocks, newExplorerBlock(s, height, false))
+	}
+	e.render(w, http.StatusOK, "index", struct {
+		Stats  *explorerStats
+		Blocks []*explorerBlock
+	}{e.newStats(s), blocks})
+}
+
+// parseHash decodes a hex encoded block hash or txid
+func parseHash(s string) ([32]byte, bool) {
+	var hash [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(hash) {
+		return hash, false
+	}
+	copy(hash[:], b)
+	return hash, true
+}
+
+// block shows the block at a height or with a hash
+func (e *explorer) block(w http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+	s := e.bcs.GetBlockchain().Snapshot()
+	height, err := strconv.Atoi(id)
+	if err != nil {
+		hash, ok := parseHash(id)
+		if !ok {
+			e.error(w, http.StatusBadRequest, "A block is a height or a hash of 64 hex digits")
+			return
+		}
+		height = findBlock(s, hash)
+	}
+	if height < 0 || s.Block(height) == nil {
+		e.error(w, http.StatusNotFound, fmt.Sprintf("Block %s is not in the chain", id))
+		return
+	}
+	// -1 when there is no previous or next block
+	next := height + 1
+	if next > s.Height() {
+		next = -1
+	}
+	e.render(w, http.StatusOK, "block", struct {
+		Block          *explorerBlock
+		Previous, Next int
+	}{newExplorerBlock(s, height, true), height - 1, next})
+}
+
+func (e *explorer) transaction(w http.ResponseWriter, req *http.Request) {
+	txid, ok := parseHash(req.PathValue("txid"))
+	if !ok {
+		e.error(w, http.StatusBadRequest, "A txid is 64 hex digits")
+		return
+	}
+	s := e.bcs.GetBlockchain().Snapshot()
+	t, height := findTransaction(s, txid)
+	if t == nil {
+		e.error(w, http.StatusNotFound, fmt.Sprintf("Transaction %x is neither in the pool nor in the chain", txid))
+		return
+	}
+	et := newExplorerTransaction(t)
+	if height >= 0 {
+		b := newExplorerBlock(s, height, false)
+		et.Height, et.BlockHash, et.Time, et.Confirmations = height, b.Hash, b.Time, b.Confirmations
+	}
+	e.render(w, http.StatusOK, "transaction", et)
+}
+
+// address shows the balance of an address, its pending transactions and its
+// last EXPLORER_HISTORY confirmed ones
+func (e *explorer) address(w http.ResponseWriter, req *http.Request) {
+	address := req.PathValue("address")
+	if err := wallet.ValidateAddress(address, e.bcs.network); err != nil {
+		e.error(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", address, err))
+		return
+	}
+	s := e.bcs.GetBlockchain().Snapshot()
+	ea := &explorerAddress{Address: address, Balance: s.Balance(address)}
+	involves := func(t *blockchain.Transaction) bool {
+		return t.Sender() == address || t.Receiver() == address
+	}
+	for _, t := range s.TransactionPool() {
+		if involves(t) {
+			et := newExplorerTransaction(t)
+			et.Received = t.Receiver() == address
+			ea.Pending = append(ea.Pending, et)
+		}
+	}
+history:
+	for height := s.Height(); height >= 0; height-- {
+		b := s.Block(height)
+		for i := len(b.Transactions()) - 1; i >= 0; i-- {
+			t := b.Transactions()[i]
+			if !involves(t) {
+				continue
+			}
+			if len(ea.History) == EXPLORER_HISTORY {
+				ea.Truncated = true
+				break history
+			}
+			et := newExplorerTransaction(t)
+			et.Height, et.Time, et.Received = height, time.Unix(0, b.Timestamp()), t.Receiver() == address
+			ea.History = append(ea.History, et)
+		}
+	}
+	e.render(w, http.StatusOK, "address", ea)
+}
+
+func (e *explorer) mempool(w http.ResponseWriter, req *http.Request) {
+	s := e.bcs.GetBlockchain().Snapshot()
+	var amount float32
+	transactions := make([]*explorerTransaction, 0, len(s.TransactionPool()))
+	for _, t := range s.TransactionPool() {
+		amount += t.Amount()
+		transactions = append(transactions, newExplorerTransaction(t))
+	}
+	e.render(w, http.StatusOK, "mempool", struct {
+		Amount       float32
+		Transactions []*explorerTransaction
+	}{amount, transactions})
+}
+
+func (e *explorer) stats(w http.ResponseWriter, req *http.Request) {
+	e.render(w, http.StatusOK, "stats", e.newStats(e.bcs.GetBlockchain().Snapshot()))
+}
+
+// search redirects to the page of a height, a block hash, a txid or an
+// address
+func (e *explorer) search(w http.ResponseWriter, req *http.Request) {
+	q := strings.TrimSpace(req.URL.Query().Get("q"))
+	target := ""
+	s := e.bcs.GetBlockchain().Snapshot()
+	if q == "" {
+		target = EXPLORER_PATH
+	} else if height, err := strconv.Atoi(q); err == nil {
+		if s.Block(height) != nil {
+			target = EXPLORER_PATH + "block/" + q
+		}
+	} else if hash, ok := parseHash(q); ok {
+		if findBlock(s, hash) >= 0 {
+			target = EXPLORER_PATH + "block/" + strings.ToLower(q)
+		} else if t, _ := findTransaction(s, hash); t != nil {
+			target = EXPLORER_PATH + "tx/" + strings.ToLower(q)
+		}
+	} else if wallet.ValidateAddress(q, e.bcs.network) == nil {
+		target = EXPLORER_PATH + "address/" + q
+	}
+	if target == "" {
+		e.error(w, http.StatusNotFound, fmt.Sprintf("Nothing matches %q: search a height, a block hash, a txid or an address", q))
+		return
+	}
+	http.Redirect(w, req, target, http.StatusFound)
+}
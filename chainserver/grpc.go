@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"moviecoin/api"
+	"moviecoin/blockchain"
+	"moviecoin/nodepb"
+	"moviecoin/wallet"
+	"net"
+	"sort"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// MAX_HEADERS is the largest number of headers returned by GetHeaders
+const MAX_HEADERS = 2000
+
+// nodeService implements the gRPC API on the chain of the server
+type nodeService struct {
+	nodepb.UnimplementedNodeServer
+	bcs *BlockchainServer
+}
+
+// GRPCServer returns the gRPC server of the node API
+func (bcs *BlockchainServer) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	nodepb.RegisterNodeServer(s, &nodeService{bcs: bcs})
+	return s
+}
+
+// StartGRPC serves the gRPC API on chain.grpc_port, when set
+func (bcs *BlockchainServer) StartGRPC() error {
+	port := bcs.config.Chain.GRPCPort
+	if port == 0 {
+		return nil
+	}
+	var opts []grpc.ServerOption
+	if tls := bcs.config.Chain.TLS; tls.Enabled() {
+		creds, err := credentials.NewServerTLSFromFile(tls.CertFile, tls.KeyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	l, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", port))
+	if err != nil {
+		return err
+	}
+	s := bcs.GRPCServer(opts...)
+	go func() {
+		if err := s.Serve(l); err != nil {
+			log.Printf("ERROR: gRPC: %v", err)
+		}
+	}()
+	log.Printf("gRPC API listening on port %d", port)
+	return nil
+}
+
+func pbTransaction(t *blockchain.Transaction) *nodepb.Transaction {
+	txid := t.Hash()
+	return &nodepb.Transaction{
+		Txid:             txid[:],
+		SenderAddress:    t.Sender(),
+		RecipientAddress: t.Receiver(),
+		Amount:           t.Amount(),
+	}
+}
+
+func pbHeader(h *blockchain.Header) *nodepb.Header {
+	return &nodepb.Header{
+		Timestamp:    h.Timestamp,
+		PreviousHash: h.PreviousHash[:],
+		MerkleRoot:   h.MerkleRoot[:],
+		Nonce:        h.Nonce,
+		ExtraNonce:   h.ExtraNonce,
+	}
+}
+
+func pbBlock(s *blockchain.Snapshot, height int) *nodepb.Block {
+	b := s.Block(height)
+	hash := b.Hash()
+	pb := &nodepb.Block{
+		Hash:         hash[:],
+		Height:       int64(height),
+		Header:       pbHeader(b.Header()),
+		Transactions: make([]*nodepb.Transaction, 0, len(b.Transactions())),
+	}
+	for _, t := range b.Transactions() {
+		pb.Transactions = append(pb.Transactions, pbTransaction(t))
+	}
+	return pb
+}
+
+func hashArgument(name string, b []byte) ([32]byte, error) {
+	var hash [32]byte
+	if len(b) != len(hash) {
+		return hash, status.Errorf(codes.InvalidArgument, "%s must be %d bytes", name, len(hash))
+	}
+	copy(hash[:], b)
+	return hash, nil
+}
+
+func (n *nodeService) GetBlockCount(ctx context.Context, req *nodepb.GetBlockCountRequest) (*nodepb.GetBlockCountResponse, error) {
+	return &nodepb.GetBlockCountResponse{Height: int64(n.bcs.GetBlockchain().Height())}, nil
+}
+
+func (n *nodeService) GetBlock(ctx context.Context, req *nodepb.GetBlockRequest) (*nodepb.Block, error) {
+	s := n.bcs.GetBlockchain().Snapshot()
+	switch b := req.Block.(type) {
+	case *nodepb.GetBlockRequest_Height:
+		if b.Height > int64(s.Height()) || s.Block(int(b.Height)) == nil {
+			return nil, status.Errorf(codes.NotFound, "no block at height %d", b.Height)
+		}
+		return pbBlock(s, int(b.Height)), nil
+	case *nodepb.GetBlockRequest_Hash:
+		hash, err := hashArgument("hash", b.Hash)
+		if err != nil {
+			return nil, err
+		}
+		height := findBlock(s, hash)
+		if height < 0 {
+			return nil, status.Error(codes.NotFound, "block not found")
+		}
+		return pbBlock(s, height), nil
+	}
+	return nil, status.Error(codes.InvalidArgument, "height or hash required")
+}
+
+func (n *nodeService) GetHeaders(ctx context.Context, req *nodepb.GetHeadersRequest) (*nodepb.GetHeadersResponse, error) {
+	s := n.bcs.GetBlockchain().Snapshot()
+	if req.FromHeight < 0 {
+		return nil, status.Error(codes.InvalidArgument, "from_height must not be negative")
+	}
+	count := int64(req.Count)
+	if count == 0 || count > MAX_HEADERS {
+		count = MAX_HEADERS
+	}
+	headers := []*nodepb.Header{}
+	for h := req.FromHeight; h < req.FromHeight+count && h <= int64(s.Height()); h++ {
+		headers = append(headers, pbHeader(s.Block(int(h)).Header()))
+	}
+	return &nodepb.GetHeadersResponse{Headers: headers}, nil
+}
+
+func (n *nodeService) GetTransaction(ctx context.Context, req *nodepb.GetTransactionRequest) (*nodepb.TransactionInfo, error) {
+	txid, err := hashArgument("txid", req.Txid)
+	if err != nil {
+		return nil, err
+	}
+	s := n.bcs.GetBlockchain().Snapshot()
+	t, height := findTransaction(s, txid)
+	if t == nil {
+		return nil, status.Error(codes.NotFound, "transaction not found")
+	}
+	info := &nodepb.TransactionInfo{Transaction: pbTransaction(t)}
+	if height >= 0 {
+		hash := s.Block(height).Hash()
+		h := int64(height)
+		info.BlockHash, info.Height, info.Confirmations = hash[:], &h, int64(s.Height()-height+1)
+	}
+	return info, nil
+}
+
+func (n *nodeService) SendTransaction(ctx context.Context, req *nodepb.SendTransactionRequest) (*nodepb.SendTransactionResponse, error) {
+	st := req.Transaction
+	if st == nil {
+		return nil, status.Error(codes.InvalidArgument, "transaction required")
+	}
+	if len(st.SenderPublicKey) != 64 || len(st.Signature) != 64 {
+		return nil, status.Error(codes.InvalidArgument, "sender_public_key and signature must be 64 bytes")
+	}
+	publicKey, signature := fmt.Sprintf("%x", st.SenderPublicKey), fmt.Sprintf("%x", st.Signature)
+	err := n.bcs.acceptTransaction(&blockchain.TransactionRequest{
+		SenderAddress:   &st.SenderAddress,
+		ReceiverAddress: &st.RecipientAddress,
+		SenderPublicKey: &publicKey,
+		Amount:          &st.Amount,
+		Signature:       &signature,
+	})
+	var e *api.Error
+	if errors.As(err, &e) {
+		if e.Code == api.CODE_REJECTED {
+			return nil, status.Error(codes.FailedPrecondition, e.Message)
+		}
+		return nil, status.Error(codes.InvalidArgument, validationMessage(e))
+	} else if err != nil {
+		return nil, err
+	}
+	txid := blockchain.NewTransaction(st.SenderAddress, st.RecipientAddress, st.Amount).Hash()
+	return &nodepb.SendTransactionResponse{Txid: txid[:]}, nil
+}
+
+// validationMessage spells the reasons of a validation error out, gRPC
+// statuses have no room for the details
+func validationMessage(e *api.Error) string {
+	fields := make([]string, 0, len(e.Details))
+	for field := range e.Details {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	message := e.Message
+	for _, field := range fields {
+		message += fmt.Sprintf("; %s: %s", field, e.Details[field])
+	}
+	return message
+}
+
+func (n *nodeService) GetBalance(ctx context.Context, req *nodepb.GetBalanceRequest) (*nodepb.Balance, error) {
+	if err := wallet.ValidateAddress(req.Address, n.bcs.network); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	s := n.bcs.GetBlockchain().Snapshot()
+	return &nodepb.Balance{Address: req.Address, Amount: s.Balance(req.Address), Height: int64(s.Height())}, nil
+}
+
+func (n *nodeService) GetMempool(ctx context.Context, req *nodepb.GetMempoolRequest) (*nodepb.GetMempoolResponse, error) {
+	pool := n.bcs.GetBlockchain().Snapshot().TransactionPool()
+	resp := &nodepb.GetMempoolResponse{Transactions: make([]*nodepb.Transaction, 0, len(pool))}
+	for _, t := range pool {
+		resp.Transactions = append(resp.Transactions, pbTransaction(t))
+	}
+	return resp, nil
+}
+
+// SubscribeBlocks compares the chain with the one last seen at every change
+// and sends the blocks above the last one both have in common
+func (n *nodeService) SubscribeBlocks(req *nodepb.SubscribeBlocksRequest, stream nodepb.Node_SubscribeBlocksServer) error {
+	bc := n.bcs.GetBlockchain()
+	changed := bc.Changed()
+	last := bc.Snapshot()
+	for {
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return nil
+		}
+		changed = bc.Changed()
+		s := bc.Snapshot()
+		fork := s.Height()
+		if last.Height() < fork {
+			fork = last.Height()
+		}
+		for fork > 0 && s.Block(fork).Hash() != last.Block(fork).Hash() {
+			fork--
+		}
+		for height := fork + 1; height <= s.Height(); height++ {
+			if err := stream.Send(pbBlock(s, height)); err != nil {
+				return err
+			}
+		}
+		last = s
+	}
+}
+
+// SubscribeTransactions sends the transactions of the pool which were not
+// in it at the previous change
+func (n *nodeService) SubscribeTransactions(req *nodepb.SubscribeTransactionsRequest, stream nodepb.Node_SubscribeTransactionsServer) error {
+	bc := n.bcs.GetBlockchain()
+	changed := bc.Changed()
+	pending := countTransactions(bc.Snapshot().TransactionPool())
+	for {
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return nil
+		}
+		changed = bc.Changed()
+		pool := bc.Snapshot().TransactionPool()
+		for _, t := range pool {
+			// identical payments are told apart by their number
+			if pending[*t] > 0 {
+				pending[*t]--
+				continue
+			}
+			if err := stream.Send(pbTransaction(t)); err != nil {
+				return err
+			}
+		}
+		pending = countTransactions(pool)
+	}
+}
+
+func countTransactions(transactions []*blockchain.Transaction) map[blockchain.Transaction]int {
+	counts := make(map[blockchain.Transaction]int)
+	for _, t := range transactions {
+		counts[*t]++
+	}
+	return counts
+}
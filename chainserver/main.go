@@ -3,6 +3,8 @@ package main
 import (
 	"flag"
 	"log"
+	"moviecoin/config"
+	"os"
 )
 
 func init() {
@@ -10,8 +12,23 @@ func init() {
 }
 
 func main() {
-	port := flag.Uint("port", 5000, "TCP Port Number for Blockchain Server")
-	flag.Parse()
-	app := NewBlockchainServer(uint16(*port))
+	dump, args := config.ParseCommand(os.Args[1:])
+	cfg, err := config.Load(config.CHAIN_SERVER, "chainserver", args)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dump {
+		os.Stdout.Write(cfg.Dump())
+		return
+	}
+	logFile, err := cfg.Log.SetupLogging()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer logFile.Close()
+	app := NewBlockchainServer(cfg)
 	app.Run()
 }
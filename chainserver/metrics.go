@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"moviecoin/metrics"
+	"moviecoin/netsync"
+	"net/http"
+	"time"
+)
+
+const (
+	METRICS_PATH = "/metrics"
+	HEALTHZ_PATH = "/healthz"
+	READYZ_PATH  = "/readyz"
+	// namespace of the metrics of the chain and wallet servers
+	METRICS_NAMESPACE = "moviecoin"
+)
+
+// newMetrics registers the metrics of the node. The values the node keeps
+// anyway are read when scraped, the block checks are timed by the chain.
+func (bcs *BlockchainServer) newMetrics() *metrics.Registry {
+	r := metrics.NewRegistry(METRICS_NAMESPACE)
+	bcs.httpStats = metrics.NewHTTP(r)
+	r.NewGaugeFunc("chain_height", "Height of the chain tip.", func() float64 {
+		return float64(bcs.GetBlockchain().Height())
+	})
+	r.NewGaugeFunc("mempool_transactions", "Transactions waiting in the pool.", func() float64 {
+		return float64(len(bcs.GetBlockchain().TransactionPool()))
+	})
+	r.NewGaugeFunc("peers", "Connected peers.", func() float64 {
+		if bcs.p2p == nil {
+			return 0
+		}
+		return float64(len(bcs.p2p.Peers()))
+	})
+	r.NewGaugeFunc("miner_hash_rate", "Hashes per second of the running mining job, or of the last one.", func() float64 {
+		return bcs.miner.HashRate()
+	})
+	r.NewGaugeFunc("sync_active", "1 while blocks are downloaded from the peers.", func() float64 {
+		return boolValue(bcs.syncStatus().Syncing)
+	})
+	r.NewGaugeFunc("sync_target_height", "Greatest height announced by the peers.", func() float64 {
+		return float64(bcs.syncStatus().TargetHeight)
+	})
+	r.NewGaugeFunc("synced", "1 when the chain caught up with the peers.", func() float64 {
+		return boolValue(bcs.syncStatus().Synced())
+	})
+	validation := r.NewHistogram("block_validation_seconds", "Time spent checking the blocks offered to the chain.",
+		metrics.DURATION_BUCKETS, "result")
+	bcs.GetBlockchain().SetValidationObserver(func(d time.Duration, err error) {
+		result := "accepted"
+		if err != nil {
+			result = "rejected"
+		}
+		validation.Observe(d.Seconds(), result)
+	})
+	return r
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// syncStatus reports a node without peer to peer network as synced
+func (bcs *BlockchainServer) syncStatus() netsync.Status {
+	if bcs.sync == nil {
+		height := bcs.GetBlockchain().Height()
+		return netsync.Status{Height: height, TargetHeight: height}
+	}
+	return bcs.sync.Status()
+}
+
+type healthResponse struct {
+	Status       string `json:"status"`
+	Height       int    `json:"height"`
+	TargetHeight int    `json:"target_height"`
+	Syncing      bool   `json:"syncing"`
+	Peers        int    `json:"peers"`
+}
+
+// Healthz answers as long as the server runs
+func (bcs *BlockchainServer) Healthz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// Readyz answers 503 until the chain caught up with the peers, so that load
+// balancers keep the clients away from a node serving an old chain
+func (bcs *BlockchainServer) Readyz(w http.ResponseWriter, req *http.Request) {
+	status := bcs.syncStatus()
+	resp := healthResponse{Status: "ok", Height: status.Height, TargetHeight: status.TargetHeight,
+		Syncing: status.Syncing}
+	if bcs.p2p != nil {
+		resp.Peers = len(bcs.p2p.Peers())
+	}
+	code := http.StatusOK
+	if !status.Synced() {
+		resp.Status = "syncing"
+		code = http.StatusServiceUnavailable
+	}
+	m, _ := json.Marshal(resp)
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(m)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"moviecoin/blockchain"
+	"moviecoin/netsync"
+	"moviecoin/p2p"
+	"moviecoin/utils"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Nodes announce themselves on the LAN every DISCOVERY_INTERVAL
+const DISCOVERY_INTERVAL = blockchain.BLOCKCHAIN_NEIGHBOR_SYNC_TIME_SEC * time.Second
+
+// StartP2P listens for peers and keeps the configured ones connected, along
+// with the ones learned from the seeds and the address book. New blocks and
+// transactions are then gossiped to the peers.
+func (bcs *BlockchainServer) StartP2P(bc *blockchain.Blockchain) error {
+	port := bcs.config.P2PPort()
+	manager := netsync.NewManager(bc)
+	bcs.p2p = p2p.NewServer(p2p.Config{
+		Network:        bcs.network,
+		Chain:          bc,
+		Handler:        manager,
+		ListenAddr:     fmt.Sprintf("0.0.0.0:%d", port),
+		ListenPort:     port,
+		MaxInbound:     bcs.config.P2P.MaxInbound,
+		TargetOutbound: bcs.config.P2P.TargetOutbound,
+		BanDuration:    time.Duration(bcs.config.P2P.BanSec) * time.Second,
+		AddressFile:    bcs.config.PeersFile(),
+		NodeKey:        bcs.nodeKey,
+		AllowedNodes:   bcs.config.P2P.AllowedNodes,
+	})
+	// configured peers are redialed whenever they drop, restarted peers
+	// are picked up. Seeds only bootstrap the address book.
+	for _, addr := range bcs.config.P2P.Peers {
+		bcs.p2p.AddAddress(addr, true)
+	}
+	for _, addr := range bcs.config.P2P.Seeds {
+		bcs.p2p.AddAddress(addr, false)
+	}
+	manager.SetServer(bcs.p2p)
+	bcs.sync = manager
+	bc.SetRelay(manager)
+	if err := bcs.p2p.Start(); err != nil {
+		return err
+	}
+	manager.Start()
+	return nil
+}
+
+// StartDiscovery announces the peer to peer address of the node on the LAN
+// and adds the nodes announced by the others to the address book
+func (bcs *BlockchainServer) StartDiscovery() {
+	d := utils.NewDiscovery(bcs.config.MulticastAddress(), bcs.config.Chain.MulticastInterface, bcs.nodeKey,
+		bcs.network.ChainID)
+	log.Println("Listening for other neighbors...")
+	d.Listen(func(a *utils.Announcement) {
+		bcs.p2p.LearnAddress(a.Address)
+	})
+	port := bcs.config.P2PPort()
+	go func() {
+		for {
+			d.Notify(port)
+			time.Sleep(DISCOVERY_INTERVAL)
+		}
+	}()
+}
+
+// Peers lists the connected peers, the known addresses and the bans
+func (bcs *BlockchainServer) Peers(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(struct {
+			Peers     []p2p.PeerInfo       `json:"peers"`
+			Addresses []string             `json:"addresses"`
+			Bans      map[string]time.Time `json:"bans"`
+		}{bcs.p2p.PeerInfo(), bcs.addresses(), bcs.p2p.Bans()})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (bcs *BlockchainServer) addresses() []string {
+	var addrs []string
+	for _, a := range bcs.p2p.Addresses() {
+		addrs = append(addrs, a.Addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// PeerBans bans a host, body {"host": "10.0.0.1", "duration_sec": 3600}
+// with the configured duration by default, or lifts the ban of ?host=
+func (bcs *BlockchainServer) PeerBans(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	switch req.Method {
+	case http.MethodPost:
+		var body struct {
+			Host        string `json:"host"`
+			DurationSec int    `json:"duration_sec"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Host == "" || body.DurationSec < 0 {
+			log.Printf("ERROR: invalid ban request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		d := time.Duration(body.DurationSec) * time.Second
+		if d == 0 {
+			d = time.Duration(bcs.config.P2P.BanSec) * time.Second
+		}
+		if d == 0 {
+			d = p2p.DEFAULT_BAN_DURATION
+		}
+		bcs.p2p.Ban(body.Host, d)
+		io.WriteString(w, string(utils.JsonStatus("success")))
+	case http.MethodDelete:
+		if !bcs.p2p.Unban(req.URL.Query().Get("host")) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.JsonStatus("not banned")))
+			return
+		}
+		io.WriteString(w, string(utils.JsonStatus("success")))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"moviecoin/api"
+	"moviecoin/blockchain"
+	"moviecoin/p2p"
+	"moviecoin/rpc"
+	"moviecoin/wallet"
+	"net/http"
+)
+
+const RPC_PATH = "/rpc"
+
+// Error codes of the methods, the ones of bitcoind for the same failures
+const (
+	RPC_INVALID_ADDRESS_OR_KEY = -5
+	RPC_DESERIALIZATION_ERROR  = -22
+	RPC_VERIFY_ERROR           = -25
+	RPC_VERIFY_REJECTED        = -26
+)
+
+// RPCServer serves JSON-RPC 2.0 on RPC_PATH. Transactions are identified by
+// the hash of their sender, recipient and amount, the one of the merkle tree.
+func (bcs *BlockchainServer) RPCServer() *rpc.Server {
+	s := rpc.NewServer()
+	s.Register("getblockcount", nil, bcs.rpcGetBlockCount)
+	s.Register("getblock", []string{"hash"}, bcs.rpcGetBlock)
+	s.Register("getblockbyheight", []string{"height"}, bcs.rpcGetBlockByHeight)
+	s.Register("gettransaction", []string{"txid"}, bcs.rpcGetTransaction)
+	s.Register("sendrawtransaction", []string{"hex"}, bcs.rpcSendRawTransaction)
+	s.Register("getbalance", []string{"address"}, bcs.rpcGetBalance)
+	s.Register("getmempoolinfo", nil, bcs.rpcGetMempoolInfo)
+	s.Register("getpeerinfo", nil, bcs.rpcGetPeerInfo, bcs.rpcAdmin)
+	return s
+}
+
+// rpcAdmin is AdminAuth for the methods of the RPC server
+func (bcs *BlockchainServer) rpcAdmin(h rpc.Handler) rpc.Handler {
+	return func(req *http.Request, params rpc.Params) (interface{}, error) {
+		if !bcs.isAdmin(req) {
+			return nil, rpc.Unauthorized()
+		}
+		return h(req, params)
+	}
+}
+
+type rpcTransaction struct {
+	TxID            string  `json:"txid"`
+	SenderAddress   string  `json:"sender_address"`
+	ReceiverAddress string  `json:"recipient_address"`
+	Amount          float32 `json:"amount"`
+	// zero while the transaction is in the pool
+	Confirmations int    `json:"confirmations"`
+	BlockHash     string `json:"block_hash,omitempty"`
+	Height        *int   `json:"height,omitempty"`
+}
+
+func newRPCTransaction(t *blockchain.Transaction) *rpcTransaction {
+	return &rpcTransaction{
+		TxID:            fmt.Sprintf("%x", t.Hash()),
+		SenderAddress:   t.Sender(),
+		ReceiverAddress: t.Receiver(),
+		Amount:          t.Amount(),
+	}
+}
+
+type rpcBlock struct {
+	Hash          string            `json:"hash"`
+	Height        int               `json:"height"`
+	Confirmations int               `json:"confirmations"`
+	PreviousHash  string            `json:"previous_hash"`
+	MerkleRoot    string            `json:"merkle_root"`
+	Timestamp     int64             `json:"timestamp"`
+	Nonce         uint32            `json:"nonce"`
+	ExtraNonce    uint32            `json:"extra_nonce"`
+	Transactions  []*rpcTransaction `json:"transactions"`
+}
+
+func newRPCBlock(s *blockchain.Snapshot, height int) *rpcBlock {
+	b := s.Block(height)
+	header := b.Header()
+	rb := &rpcBlock{
+		Hash:          fmt.Sprintf("%x", b.Hash()),
+		Height:        height,
+		Confirmations: s.Height() - height + 1,
+		PreviousHash:  fmt.Sprintf("%x", header.PreviousHash),
+		MerkleRoot:    fmt.Sprintf("%x", header.MerkleRoot),
+		Timestamp:     header.Timestamp,
+		Nonce:         header.Nonce,
+		ExtraNonce:    header.ExtraNonce,
+		Transactions:  make([]*rpcTransaction, 0, len(b.Transactions())),
+	}
+	for _, t := range b.Transactions() {
+		rt := newRPCTransaction(t)
+		rt.Confirmations, rt.BlockHash, rt.Height = rb.Confirmations, rb.Hash, &rb.Height
+		rb.Transactions = append(rb.Transactions, rt)
+	}
+	return rb
+}
+
+// hashParam decodes the hex encoded hash parameter name
+func hashParam(params rpc.Params, name string) ([32]byte, error) {
+	var hash [32]byte
+	var s string
+	if err := params.Required(name, &s); err != nil {
+		return hash, err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(hash) {
+		return hash, rpc.InvalidParams(name + " must be 64 hex digits")
+	}
+	copy(hash[:], b)
+	return hash, nil
+}
+
+func (bcs *BlockchainServer) rpcGetBlockCount(req *http.Request, params rpc.Params) (interface{}, error) {
+	return bcs.GetBlockchain().Height(), nil
+}
+
+func (bcs *BlockchainServer) rpcGetBlock(req *http.Request, params rpc.Params) (interface{}, error) {
+	hash, err := hashParam(params, "hash")
+	if err != nil {
+		return nil, err
+	}
+	s := bcs.GetBlockchain().Snapshot()
+	height := findBlock(s, hash)
+	if height < 0 {
+		return nil, rpc.NewError(RPC_INVALID_ADDRESS_OR_KEY, "block not found")
+	}
+	return newRPCBlock(s, height), nil
+}
+
+func (bcs *BlockchainServer) rpcGetBlockByHeight(req *http.Request, params rpc.Params) (interface{}, error) {
+	var height int
+	if err := params.Required("height", &height); err != nil {
+		return nil, err
+	}
+	s := bcs.GetBlockchain().Snapshot()
+	if s.Block(height) == nil {
+		return nil, rpc.InvalidParams(fmt.Sprintf("height out of range, the chain is %d blocks high", s.Height()))
+	}
+	return newRPCBlock(s, height), nil
+}
+
+func (bcs *BlockchainServer) rpcGetTransaction(req *http.Request, params rpc.Params) (interface{}, error) {
+	txid, err := hashParam(params, "txid")
+	if err != nil {
+		return nil, err
+	}
+	rt := transactionStatus(bcs.GetBlockchain().Snapshot(), txid)
+	if rt == nil {
+		return nil, rpc.NewError(RPC_INVALID_ADDRESS_OR_KEY, "transaction not found")
+	}
+	return rt, nil
+}
+
+// transactionStatus describes the transaction txid with its confirmations,
+// nil when it is neither in the pool nor in the chain
+func transactionStatus(s *blockchain.Snapshot, txid [32]byte) *rpcTransaction {
+	t, height := findTransaction(s, txid)
+	if t == nil {
+		return nil
+	}
+	rt := newRPCTransaction(t)
+	if height >= 0 {
+		rt.Confirmations = s.Height() - height + 1
+		rt.BlockHash = fmt.Sprintf("%x", s.Block(height).Hash())
+		rt.Height = &height
+	}
+	return rt
+}
+
+// findBlock returns the height of the block with the given hash, -1 when it
+// is not in the chain
+func findBlock(s *blockchain.Snapshot, hash [32]byte) int {
+	for height := s.Height(); height >= 0; height-- {
+		if s.Block(height).Hash() == hash {
+			return height
+		}
+	}
+	return -1
+}
+
+// findTransaction looks for a transaction in the pool, then in the chain
+// from the tip. The height is -1 for a transaction of the pool. Identical
+// payments share their id, the most recent one is found.
+func findTransaction(s *blockchain.Snapshot, txid [32]byte) (*blockchain.Transaction, int) {
+	for _, t := range s.TransactionPool() {
+		if t.Hash() == txid {
+			return t, -1
+		}
+	}
+	for height := s.Height(); height >= 0; height-- {
+		for _, t := range s.Block(height).Transactions() {
+			if t.Hash() == txid {
+				return t, height
+			}
+		}
+	}
+	return nil, -1
+}
+
+// rpcSendRawTransaction accepts a signed transaction in the encoding of the
+// peer to peer tx message, hex encoded
+func (bcs *BlockchainServer) rpcSendRawTransaction(req *http.Request, params rpc.Params) (interface{}, error) {
+	var s string
+	if err := params.Required("hex", &s); err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, rpc.NewError(RPC_DESERIALIZATION_ERROR, "transaction is not hex encoded")
+	}
+	var msg p2p.MsgTx
+	if err := msg.Decode(bytes.NewReader(raw)); err != nil {
+		return nil, rpc.NewError(RPC_DESERIALIZATION_ERROR, "transaction decode failed: "+err.Error())
+	}
+	t := msg.Transaction
+	if err := bcs.acceptTransaction(t); err != nil {
+		var e *api.Error
+		if !errors.As(err, &e) {
+			return nil, err
+		}
+		if e.Code == api.CODE_REJECTED {
+			return nil, rpc.NewError(RPC_VERIFY_REJECTED, e.Message)
+		}
+		re := rpc.NewError(RPC_VERIFY_ERROR, e.Message)
+		if len(e.Details) > 0 {
+			re.Data = e.Details
+		}
+		return nil, re
+	}
+	return fmt.Sprintf("%x", blockchain.NewTransaction(*t.SenderAddress, *t.ReceiverAddress, *t.Amount).Hash()), nil
+}
+
+func (bcs *BlockchainServer) rpcGetBalance(req *http.Request, params rpc.Params) (interface{}, error) {
+	var address string
+	if err := params.Required("address", &address); err != nil {
+		return nil, err
+	}
+	if err := wallet.ValidateAddress(address, bcs.network); err != nil {
+		return nil, rpc.NewError(RPC_INVALID_ADDRESS_OR_KEY, err.Error())
+	}
+	return bcs.GetBlockchain().Snapshot().Balance(address), nil
+}
+
+func (bcs *BlockchainServer) rpcGetMempoolInfo(req *http.Request, params rpc.Params) (interface{}, error) {
+	pool := bcs.GetBlockchain().Snapshot().TransactionPool()
+	var amount float32
+	for _, t := range pool {
+		amount += t.Amount()
+	}
+	return struct {
+		Size   int     `json:"size"`
+		Amount float32 `json:"amount"`
+	}{len(pool), amount}, nil
+}
+
+func (bcs *BlockchainServer) rpcGetPeerInfo(req *http.Request, params rpc.Params) (interface{}, error) {
+	peers := []p2p.PeerInfo{}
+	if bcs.p2p != nil {
+		peers = append(peers, bcs.p2p.PeerInfo()...)
+	}
+	return peers, nil
+}
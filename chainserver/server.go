@@ -2,23 +2,46 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"moviecoin/api"
 	"moviecoin/blockchain"
+	"moviecoin/config"
+	"moviecoin/metrics"
+	"moviecoin/miner"
+	"moviecoin/netsync"
+	"moviecoin/p2p"
+	"moviecoin/params"
+	"moviecoin/security"
 	"moviecoin/utils"
 	"moviecoin/wallet"
 	"net/http"
+	"os"
 	"strconv"
 )
 
-var cache map[string]*blockchain.Blockchain = make(map[string]*blockchain.Blockchain)
-
 type BlockchainServer struct {
-	port uint16
+	port       uint16
+	network    *params.Network
+	config     *config.Config
+	miner      *miner.Miner
+	controller *miner.Controller
+	nodeKey    *security.NodeKey
+	templates  *miner.TemplateStore
+	p2p        *p2p.Server
+	sync       *netsync.Manager
+	metrics    *metrics.Registry
+	httpStats  *metrics.HTTP
+	// set up by Run before serving
+	bc *blockchain.Blockchain
 }
 
-func NewBlockchainServer(port uint16) *BlockchainServer {
-	return &BlockchainServer{port}
+func NewBlockchainServer(cfg *config.Config) *BlockchainServer {
+	return &BlockchainServer{port: cfg.Chain.Port, network: cfg.Params(), config: cfg,
+		miner: miner.NewMiner(cfg.Mining.Threads), templates: miner.NewTemplateStore()}
 }
 
 func (bcs *BlockchainServer) Port() uint16 {
@@ -26,24 +49,62 @@ func (bcs *BlockchainServer) Port() uint16 {
 }
 
 func (bcs *BlockchainServer) GetBlockchain() *blockchain.Blockchain {
-	bc, ok := cache["blockchain"]
-	if !ok {
-		minersWallet := wallet.NewWallet()
-		bc = blockchain.NewBlockchain(minersWallet.WalletAddress(), bcs.Port())
-		cache["blockchain"] = bc
-		log.Printf("private_key %v", minersWallet.PrivateKeyStr())
-		log.Printf("publick_key %v", minersWallet.PublicKeyStr())
-		log.Printf("Wallet_address %v", minersWallet.WalletAddress())
+	return bcs.bc
+}
+
+// newBlockchain sets up the chain of the node with its identity
+func (bcs *BlockchainServer) newBlockchain() *blockchain.Blockchain {
+	minerAddress, err := bcs.MinerAddress()
+	if errors.Is(err, errNoMinerWallet) {
+		// the node relays blocks and serves templates paid to their callers
+		log.Printf("WARN: %v, mining is disabled", err)
+	} else if err != nil {
+		log.Fatalf("ERROR: miner wallet: %v", err)
 	}
+	bc := blockchain.NewBlockchain(minerAddress, bcs.network)
+	nodeKey, err := security.LoadOrCreateNodeKey(bcs.config.NodeKeyFile())
+	if err != nil {
+		log.Fatalf("ERROR: node key: %v", err)
+	}
+	bcs.nodeKey = nodeKey
+	log.Printf("Node ID %s", nodeKey.ID())
+	log.Printf("Wallet_address %v", minerAddress)
 	return bc
 }
 
+var errNoMinerWallet = fmt.Errorf("neither mining.address nor %s is set", config.MINER_PASSPHRASE_ENV)
+
+// MinerAddress returns the address credited with the mining rewards: the
+// configured payout address or else the one of the persisted miner wallet.
+// Private keys are never logged.
+func (bcs *BlockchainServer) MinerAddress() (string, error) {
+	if bcs.config.Mining.Address != "" {
+		// already validated against the network by the configuration
+		return bcs.config.Mining.Address, nil
+	}
+	passphrase := os.Getenv(config.MINER_PASSPHRASE_ENV)
+	if passphrase == "" {
+		return "", errNoMinerWallet
+	}
+	path := bcs.config.MinerKeyFile()
+	minersWallet, err := wallet.Load(path, passphrase, bcs.network)
+	if errors.Is(err, fs.ErrNotExist) {
+		minersWallet = wallet.NewWallet(bcs.network)
+		if err := minersWallet.Save(path, passphrase, bcs.network); err != nil {
+			return "", err
+		}
+		log.Printf("New miner wallet saved to %s", path)
+	} else if err != nil {
+		return "", err
+	}
+	return minersWallet.WalletAddress(), nil
+}
+
 func (bcs *BlockchainServer) GetChain(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		w.Header().Add("Content-Type", "application/json")
-		bc := bcs.GetBlockchain()
-		m, _ := bc.MarshalJSON()
+		m, _ := bcs.GetBlockchain().Snapshot().MarshalJSON()
 		io.WriteString(w, string(m[:]))
 	default:
 		log.Printf("ERROR: Invalid HTTP Method")
@@ -80,6 +141,12 @@ func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, req *http.Reque
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
+		if *t.SenderAddress == blockchain.MINING_SENDER {
+			log.Println("ERROR: mining rewards are only created by miners")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
 		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
 		signature := utils.SignatureFromString(*t.Signature)
 		bc := bcs.GetBlockchain()
@@ -110,6 +177,12 @@ func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, req *http.Reque
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
+		if *t.SenderAddress == blockchain.MINING_SENDER {
+			log.Println("ERROR: mining rewards are only created by miners")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
 		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
 		signature := utils.SignatureFromString(*t.Signature)
 		bc := bcs.GetBlockchain()
@@ -126,28 +199,87 @@ func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, req *http.Reque
 		}
 		io.WriteString(w, string(m))
 	case http.MethodDelete:
-		bc := bcs.GetBlockchain()
-		bc.ClearTransactionPool()
-		io.WriteString(w, string(utils.JsonStatus("success")))
+		bcs.AdminAuth(bcs.clearTransactions)(w, req)
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// clearTransactions empties the pool, an admin operation
+func (bcs *BlockchainServer) clearTransactions(w http.ResponseWriter, req *http.Request) {
+	bcs.GetBlockchain().ClearTransactionPool()
+	io.WriteString(w, string(utils.JsonStatus("success")))
+}
+
+// Generate mines the requested number of blocks immediately. Only networks
+// generating blocks on demand (regtest) expose it.
+func (bcs *BlockchainServer) Generate(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		count := 1
+		if v := req.URL.Query().Get("blocks"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				log.Printf("ERROR: invalid block count %q", v)
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JsonStatus("fail")))
+				return
+			}
+			count = n
+		}
+		blocks, err := bcs.miner.Generate(bcs.GetBlockchain(), count)
+		if errors.Is(err, miner.ErrNoPayoutAddress) {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		} else if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		hashes := make([]string, 0, len(blocks))
+		for _, b := range blocks {
+			hashes = append(hashes, fmt.Sprintf("%x", b.Hash()))
+		}
+		m, _ := json.Marshal(struct {
+			Blocks []string `json:"blocks"`
+		}{
+			Blocks: hashes,
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
 	default:
 		log.Println("ERROR: Invalid HTTP Method")
 		w.WriteHeader(http.StatusBadRequest)
 	}
 }
 
-func (bcs *BlockchainServer) Mine(w http.ResponseWriter, req *http.Request) {
+// MiningTemplate hands a block template out to an external miner. The reward
+// goes to the address query parameter, or to this node's miner address.
+func (bcs *BlockchainServer) MiningTemplate(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		bc := bcs.GetBlockchain()
-		isMined := bc.Mining()
-
-		var m []byte
-		if !isMined {
+		payoutAddress := req.URL.Query().Get("address")
+		if payoutAddress == "" {
+			payoutAddress = bc.MinerAddress()
+		} else if err := wallet.ValidateAddress(payoutAddress, bcs.network); err != nil {
+			log.Printf("ERROR: %v", err)
 			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JsonStatus("fail")
-		} else {
-			m = utils.JsonStatus("success")
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
 		}
+		if payoutAddress == "" {
+			log.Printf("ERROR: %v", miner.ErrNoPayoutAddress)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		t := bcs.templates.NewTemplate(bc, payoutAddress)
+		m, _ := t.MarshalJSON()
 		w.Header().Add("Content-Type", "application/json")
 		io.WriteString(w, string(m))
 	default:
@@ -156,15 +288,39 @@ func (bcs *BlockchainServer) Mine(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (bcs *BlockchainServer) StartMine(w http.ResponseWriter, req *http.Request) {
+// SubmitBlock accepts the solution of a template from an external miner, adds
+// the block to the chain and announces it to the neighbors
+func (bcs *BlockchainServer) SubmitBlock(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
-	case http.MethodGet:
+	case http.MethodPost:
+		decoder := json.NewDecoder(req.Body)
+		var ws miner.WorkSubmission
+		err := decoder.Decode(&ws)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		if !ws.Validate() {
+			log.Println("ERROR: missing field(s)")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
 		bc := bcs.GetBlockchain()
-		bc.StartMining()
-
-		m := utils.JsonStatus("success")
+		b, err := bcs.templates.Submit(bc, &ws)
 		w.Header().Add("Content-Type", "application/json")
-		io.WriteString(w, string(m))
+		if err != nil {
+			log.Printf("ERROR: block submission rejected: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus(err.Error())))
+			return
+		}
+		log.Printf("Block %x submitted by an external miner", b.Hash())
+		bc.AnnounceBlock(b)
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, string(utils.JsonStatus("success")))
 	default:
 		log.Println("ERROR: Invalid HTTP Method")
 		w.WriteHeader(http.StatusBadRequest)
@@ -175,7 +331,7 @@ func (bcs *BlockchainServer) Amount(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		blockchainAddress := req.URL.Query().Get("blockchain_address")
-		amount := bcs.GetBlockchain().CalculateTotalAmount(blockchainAddress)
+		amount := bcs.GetBlockchain().Snapshot().Balance(blockchainAddress)
 
 		ar := &blockchain.AmountResponse{Amount: amount}
 		m, _ := ar.MarshalJSON()
@@ -189,32 +345,47 @@ func (bcs *BlockchainServer) Amount(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (bcs *BlockchainServer) Consensus(w http.ResponseWriter, req *http.Request) {
-	switch req.Method {
-	case http.MethodPut:
-		bc := bcs.GetBlockchain()
-		replaced := bc.ResolveConflicts()
-
-		w.Header().Add("Content-Type", "application/json")
-		if replaced {
-			io.WriteString(w, string(utils.JsonStatus("success")))
-		} else {
-			io.WriteString(w, string(utils.JsonStatus("fail")))
+func (bcs *BlockchainServer) Run() {
+	bcs.bc = bcs.newBlockchain()
+	bc := bcs.bc
+	bcs.metrics = bcs.newMetrics()
+	if err := bcs.StartP2P(bc); err != nil {
+		log.Fatalf("ERROR: peer to peer: %v", err)
+	}
+	bcs.StartDiscovery()
+	if err := bcs.StartGRPC(); err != nil {
+		log.Fatalf("ERROR: gRPC: %v", err)
+	}
+	bcs.controller = miner.NewController(bcs.miner, bc, bcs.MiningSchedule())
+	// networks generating blocks on demand (regtest) never mine on their own
+	if bcs.config.Mining.Enabled && !bcs.network.GenerateOnDemand {
+		if err := bcs.controller.Start(bcs.MiningSchedule()); err != nil {
+			log.Fatalf("ERROR: mining: %v", err)
 		}
-	default:
-		log.Printf("ERROR: Invalid HTTP Method")
-		w.WriteHeader(http.StatusBadRequest)
 	}
-}
-
-func (bcs *BlockchainServer) Run() {
-	bcs.GetBlockchain().Run()
 
 	http.HandleFunc("/", bcs.GetChain)
 	http.HandleFunc("/transactions", bcs.Transactions)
-	http.HandleFunc("/mine", bcs.Mine)
-	http.HandleFunc("/mine/start", bcs.StartMine)
+	http.HandleFunc("/admin/mining/start", bcs.AdminAuth(bcs.StartMining))
+	http.HandleFunc("/admin/mining/stop", bcs.AdminAuth(bcs.StopMining))
+	http.HandleFunc("/admin/mining/status", bcs.AdminAuth(bcs.MiningStatus))
+	http.HandleFunc("/peers", bcs.AdminAuth(bcs.Peers))
+	http.HandleFunc("/peers/bans", bcs.AdminAuth(bcs.PeerBans))
 	http.HandleFunc("/amount", bcs.Amount)
-	http.HandleFunc("/consensus", bcs.Consensus)
-	log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(bcs.Port())), nil))
+	http.HandleFunc("/mining/template", bcs.MiningTemplate)
+	http.HandleFunc("/mining/submit", bcs.SubmitBlock)
+	if bcs.network.GenerateOnDemand {
+		http.HandleFunc("/generate", bcs.AdminAuth(bcs.Generate))
+	}
+	http.Handle(api.PREFIX+"/", bcs.APIRouter())
+	http.Handle(RPC_PATH, bcs.RPCServer())
+	http.HandleFunc(EVENTS_PATH, bcs.Events)
+	http.Handle(EVENTS_WS_PATH, bcs.EventsWebSocket())
+	http.Handle(EXPLORER_PATH, bcs.Explorer())
+	http.Handle(METRICS_PATH, bcs.metrics)
+	http.HandleFunc(HEALTHZ_PATH, bcs.Healthz)
+	http.HandleFunc(READYZ_PATH, bcs.Readyz)
+	tls := bcs.config.Chain.TLS
+	log.Fatal(security.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(bcs.Port())), tls.CertFile, tls.KeyFile,
+		bcs.httpStats.Instrument(http.DefaultServeMux)))
 }
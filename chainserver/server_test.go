@@ -0,0 +1,696 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"moviecoin/api"
+	"moviecoin/blockchain"
+	"moviecoin/config"
+	"moviecoin/metrics"
+	"moviecoin/miner"
+	"moviecoin/nodepb"
+	"moviecoin/p2p"
+	"moviecoin/params"
+	"moviecoin/rpc"
+	"moviecoin/wallet"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestServer(minerAddress string) *BlockchainServer {
+	return &BlockchainServer{
+		network:   params.Regtest,
+		miner:     miner.NewMiner(1),
+		templates: miner.NewTemplateStore(),
+		bc:        blockchain.NewBlockchain(minerAddress, params.Regtest),
+	}
+}
+
+func call(handler http.HandlerFunc, method string, target string, body []byte) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(method, target, bytes.NewReader(body)))
+	return w
+}
+
+// TestConcurrentHandlers is meant for the race detector: the handlers
+// mutating the chain and the pool run alongside the ones reading them
+func TestConcurrentHandlers(t *testing.T) {
+	payer := wallet.NewWallet(params.Regtest)
+	bcs := newTestServer(payer.WalletAddress())
+	bcs.config = &config.Config{Admin: config.AdminConfig{Token: "secret"}}
+	if w := call(bcs.Generate, http.MethodPost, "/generate?blocks=5", nil); w.Code != http.StatusOK {
+		t.Fatalf("generate: %d", w.Code)
+	}
+
+	var wg sync.WaitGroup
+	run := func(n int, f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				f(i)
+			}
+		}()
+	}
+	run(3, func(int) { call(bcs.Generate, http.MethodPost, "/generate?blocks=2", nil) })
+	run(20, func(i int) {
+		recipient := fmt.Sprintf("recipient %d", i)
+		tx := wallet.NewTransaction(payer.PrivateKey(), payer.PublicKey(), payer.WalletAddress(), recipient, 0.1)
+		publicKey, signature, amount := payer.PublicKeyStr(), tx.GenerateSignature().String(), float32(0.1)
+		sender := payer.WalletAddress()
+		m, _ := json.Marshal(&blockchain.TransactionRequest{SenderAddress: &sender, ReceiverAddress: &recipient,
+			SenderPublicKey: &publicKey, Amount: &amount, Signature: &signature})
+		if w := call(bcs.Transactions, http.MethodPost, "/transactions", m); w.Code != http.StatusCreated {
+			t.Errorf("transaction %d: %d", i, w.Code)
+		}
+	})
+	run(5, func(int) {
+		req := httptest.NewRequest(http.MethodDelete, "/transactions", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		bcs.Transactions(httptest.NewRecorder(), req)
+	})
+	for i := 0; i < 3; i++ {
+		run(20, func(int) {
+			call(bcs.GetChain, http.MethodGet, "/", nil)
+			call(bcs.Transactions, http.MethodGet, "/transactions", nil)
+			call(bcs.Amount, http.MethodGet, "/amount?blockchain_address="+payer.WalletAddress(), nil)
+			call(bcs.MiningTemplate, http.MethodGet, "/mining/template", nil)
+		})
+	}
+	wg.Wait()
+
+	var chain struct {
+		Chain []json.RawMessage `json:"chain"`
+	}
+	w := call(bcs.GetChain, http.MethodGet, "/", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &chain); err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.Chain) != 12 || !bcs.bc.ValidChain(bcs.bc.Chain()) {
+		t.Errorf("chain of %d blocks after the concurrent requests", len(chain.Chain))
+	}
+}
+
+// TestLegacyTransactions checks that the legacy routes do not let clients
+// mint coins nor empty the pool
+func TestLegacyTransactions(t *testing.T) {
+	payer := wallet.NewWallet(params.Regtest)
+	bcs := newTestServer(payer.WalletAddress())
+	bcs.config = &config.Config{Admin: config.AdminConfig{Token: "secret"}}
+	sender, recipient := blockchain.MINING_SENDER, payer.WalletAddress()
+	publicKey, signature, amount := payer.PublicKeyStr(), strings.Repeat("0", 128), float32(1000)
+	m, _ := json.Marshal(&blockchain.TransactionRequest{SenderAddress: &sender, ReceiverAddress: &recipient,
+		SenderPublicKey: &publicKey, Amount: &amount, Signature: &signature})
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		if w := call(bcs.Transactions, method, "/transactions", m); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d", method, w.Code)
+		}
+	}
+	if len(bcs.bc.TransactionPool()) != 0 {
+		t.Errorf("%d rewards in the pool", len(bcs.bc.TransactionPool()))
+	}
+
+	if _, err := bcs.miner.Generate(bcs.bc, 1); err != nil {
+		t.Fatal(err)
+	}
+	tx := wallet.NewTransaction(payer.PrivateKey(), payer.PublicKey(), recipient, "nobody", 1)
+	bcs.bc.AddTransaction(recipient, "nobody", 1, payer.PublicKey(), tx.GenerateSignature())
+	if w := call(bcs.Transactions, http.MethodDelete, "/transactions", nil); w.Code != http.StatusUnauthorized ||
+		len(bcs.bc.TransactionPool()) != 1 {
+		t.Errorf("unauthorized delete: %d", w.Code)
+	}
+}
+
+func TestNoMinerWallet(t *testing.T) {
+	t.Setenv(config.MINER_PASSPHRASE_ENV, "")
+	bcs := newTestServer("")
+	bcs.config = config.Default()
+	if _, err := bcs.MinerAddress(); !errors.Is(err, errNoMinerWallet) {
+		t.Fatalf("got %v, expected %v", err, errNoMinerWallet)
+	}
+	if w := call(bcs.Generate, http.MethodPost, "/generate", nil); w.Code != http.StatusConflict {
+		t.Errorf("generate: %d", w.Code)
+	}
+	if w := call(bcs.MiningTemplate, http.MethodGet, "/mining/template", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("template: %d", w.Code)
+	}
+	payee := wallet.NewWallet(params.Regtest).WalletAddress()
+	if w := call(bcs.MiningTemplate, http.MethodGet, "/mining/template?address="+payee, nil); w.Code != http.StatusOK {
+		t.Errorf("template paid to %s: %d", payee, w.Code)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	if err := api.CheckOpenAPI(openAPIDocument, newTestServer("miner").APIRouter()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	payer := wallet.NewWallet(params.Regtest)
+	recipient := wallet.NewWallet(params.Regtest).WalletAddress()
+	bcs := newTestServer(payer.WalletAddress())
+	bcs.config = &config.Config{Admin: config.AdminConfig{Token: "secret"}}
+	router := bcs.APIRouter()
+	request := func(method string, target string, body string, admin bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, api.PREFIX+target, strings.NewReader(body))
+		if admin {
+			req.Header.Set("Authorization", "Bearer secret")
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	payment := func(amount float32, signer *wallet.Wallet) string {
+		tx := wallet.NewTransaction(signer.PrivateKey(), signer.PublicKey(), payer.WalletAddress(), recipient, amount)
+		m, _ := json.Marshal(map[string]interface{}{
+			"sender_address":    payer.WalletAddress(),
+			"receiver_address":  recipient,
+			"sender_public_key": signer.PublicKeyStr(),
+			"amount":            amount,
+			"signature":         tx.GenerateSignature().String(),
+		})
+		return string(m)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		admin  bool
+		status int
+		code   string
+	}{
+		{"generate unauthorized", http.MethodPost, "/generate?blocks=2", "", false, http.StatusUnauthorized, api.CODE_UNAUTHORIZED},
+		{"generate", http.MethodPost, "/generate?blocks=2", "", true, http.StatusCreated, ""},
+		{"generate count", http.MethodPost, "/generate?blocks=x", "", true, http.StatusBadRequest, api.CODE_VALIDATION},
+		{"block", http.MethodGet, "/blocks/2", "", false, http.StatusOK, ""},
+		{"block height", http.MethodGet, "/blocks/two", "", false, http.StatusBadRequest, api.CODE_BAD_REQUEST},
+		{"block missing", http.MethodGet, "/blocks/3", "", false, http.StatusNotFound, api.CODE_NOT_FOUND},
+		{"block hash", http.MethodGet, "/blocks/hash/xyz", "", false, http.StatusBadRequest, api.CODE_BAD_REQUEST},
+		{"block hash missing", http.MethodGet, "/blocks/hash/" + strings.Repeat("0", 64), "", false, http.StatusNotFound, api.CODE_NOT_FOUND},
+		{"block transactions missing", http.MethodGet, "/blocks/3/transactions", "", false, http.StatusNotFound, api.CODE_NOT_FOUND},
+		{"blocks limit", http.MethodGet, "/blocks?limit=101", "", false, http.StatusBadRequest, api.CODE_VALIDATION},
+		{"blocks from and cursor", http.MethodGet, "/blocks?from=1&cursor=0.00", "", false, http.StatusBadRequest, api.CODE_VALIDATION},
+		{"blocks cursor", http.MethodGet, "/blocks?cursor=x", "", false, http.StatusBadRequest, api.CODE_VALIDATION},
+		{"blocks stale cursor", http.MethodGet, "/blocks?cursor=1.0000000000000000", "", false, http.StatusConflict, api.CODE_CONFLICT},
+		{"tip", http.MethodGet, "/tip", "", false, http.StatusOK, ""},
+		{"unknown route", http.MethodGet, "/nothing", "", false, http.StatusNotFound, api.CODE_NOT_FOUND},
+		{"method", http.MethodPut, "/transactions", "", false, http.StatusMethodNotAllowed, api.CODE_METHOD_NOT_ALLOWED},
+		{"empty body", http.MethodPost, "/transactions", "", false, http.StatusBadRequest, api.CODE_BAD_REQUEST},
+		{"unknown field", http.MethodPost, "/transactions", `{"sender":"x"}`, false, http.StatusBadRequest, api.CODE_BAD_REQUEST},
+		{"missing fields", http.MethodPost, "/transactions", `{"amount":1}`, false, http.StatusBadRequest, api.CODE_VALIDATION},
+		{"negative amount", http.MethodPost, "/transactions", payment(-1, payer), false, http.StatusBadRequest, api.CODE_VALIDATION},
+		{"foreign key", http.MethodPost, "/transactions", payment(1, wallet.NewWallet(params.Regtest)), false, http.StatusBadRequest, api.CODE_VALIDATION},
+		{"insufficient funds", http.MethodPost, "/transactions", payment(5, payer), false, http.StatusUnprocessableEntity, api.CODE_REJECTED},
+		{"transaction", http.MethodPost, "/transactions", payment(1.5, payer), false, http.StatusCreated, ""},
+		{"transaction id", http.MethodGet, "/transactions/xyz", "", false, http.StatusBadRequest, api.CODE_BAD_REQUEST},
+		{"transaction missing", http.MethodGet, "/transactions/" + strings.Repeat("0", 64), "", false, http.StatusNotFound, api.CODE_NOT_FOUND},
+		{"balance address", http.MethodGet, "/addresses/nobody/balance", "", false, http.StatusBadRequest, api.CODE_BAD_REQUEST},
+		{"template address", http.MethodGet, "/mining/template?address=nobody", "", false, http.StatusBadRequest, api.CODE_VALIDATION},
+		{"unknown template", http.MethodPost, "/blocks", `{"template_id":"x","nonce":1,"extra_nonce":0}`, false, http.StatusConflict, api.CODE_CONFLICT},
+		{"peers", http.MethodGet, "/peers", "", true, http.StatusServiceUnavailable, api.CODE_UNAVAILABLE},
+	}
+	for _, test := range tests {
+		w := request(test.method, test.target, test.body, test.admin)
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, expected %d: %s", test.name, w.Code, test.status, w.Body)
+			continue
+		}
+		if test.code == "" {
+			continue
+		}
+		var e struct {
+			Error api.Error `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || e.Error.Code != test.code {
+			t.Errorf("%s: error %s, expected code %s", test.name, w.Body, test.code)
+		}
+	}
+
+	var balance struct {
+		Balance float32 `json:"balance"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/addresses/"+payer.WalletAddress()+"/balance", "", false).Body.Bytes(), &balance)
+	if balance.Balance != 2 {
+		t.Errorf("balance %v", balance.Balance)
+	}
+	var status rpcTransaction
+	txid := blockchain.NewTransaction(payer.WalletAddress(), recipient, 1.5).Hash()
+	json.Unmarshal(request(http.MethodGet, fmt.Sprintf("/transactions/%x", txid), "", false).Body.Bytes(), &status)
+	if status.Amount != 1.5 || status.Confirmations != 0 || status.Height != nil {
+		t.Errorf("pending transaction %+v", status)
+	}
+	if w := request(http.MethodDelete, "/transactions", "", true); w.Code != http.StatusNoContent || len(bcs.bc.TransactionPool()) != 0 {
+		t.Errorf("pool not emptied: %d", w.Code)
+	}
+}
+
+func TestBlockPages(t *testing.T) {
+	bcs := newTestServer(wallet.NewWallet(params.Regtest).WalletAddress())
+	router := bcs.APIRouter()
+	if w := call(bcs.Generate, http.MethodPost, "/generate?blocks=4", nil); w.Code != http.StatusOK {
+		t.Fatalf("generate: %d", w.Code)
+	}
+	get := func(target string, etag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, api.PREFIX+target, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var heights []int
+	target := "/blocks?from=1&limit=2"
+	for pages := 0; target != ""; pages++ {
+		if pages > 3 {
+			t.Fatalf("pages do not end: %v", heights)
+		}
+		var page blocksResponse
+		if err := json.Unmarshal(get(target, "").Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range page.Blocks {
+			heights = append(heights, b.Height)
+		}
+		target = ""
+		if page.NextCursor != "" {
+			target = "/blocks?limit=2&cursor=" + page.NextCursor
+		}
+	}
+	if fmt.Sprint(heights) != "[1 2 3 4]" {
+		t.Errorf("pages %v", heights)
+	}
+
+	w := get("/tip", "")
+	var tip struct {
+		Height int    `json:"height"`
+		Hash   string `json:"hash"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &tip)
+	if tip.Height != 4 || w.Header().Get("ETag") != `"`+tip.Hash+`"` {
+		t.Fatalf("tip %+v, ETag %s", tip, w.Header().Get("ETag"))
+	}
+	if w := get("/tip", w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Errorf("unchanged tip: %d", w.Code)
+	}
+	page := get("/blocks?from=3", "")
+	call(bcs.Generate, http.MethodPost, "/generate", nil)
+	if w := get("/blocks?from=3", page.Header().Get("ETag")); w.Code != http.StatusOK {
+		t.Errorf("page after a new block: %d", w.Code)
+	}
+
+	var b blockResponse
+	json.Unmarshal(get("/blocks/hash/"+tip.Hash, "").Body.Bytes(), &b)
+	if b.Height != 4 || b.Hash != tip.Hash {
+		t.Errorf("block by hash %d %s", b.Height, b.Hash)
+	}
+	var transactions struct {
+		Hash         string                 `json:"hash"`
+		Count        int                    `json:"count"`
+		Transactions []*transactionResponse `json:"transactions"`
+	}
+	json.Unmarshal(get("/blocks/4/transactions", "").Body.Bytes(), &transactions)
+	if transactions.Hash != tip.Hash || transactions.Count != len(transactions.Transactions) || transactions.Count == 0 {
+		t.Errorf("transactions %+v", transactions)
+	}
+}
+
+func TestRPC(t *testing.T) {
+	payer := wallet.NewWallet(params.Regtest)
+	recipient := wallet.NewWallet(params.Regtest).WalletAddress()
+	bcs := newTestServer(payer.WalletAddress())
+	bcs.config = &config.Config{Admin: config.AdminConfig{Token: "secret"}}
+	server := bcs.RPCServer()
+	if w := call(bcs.Generate, http.MethodPost, "/generate?blocks=3", nil); w.Code != http.StatusOK {
+		t.Fatalf("generate: %d", w.Code)
+	}
+	rpcCall := func(method string, params string, v interface{}) *rpc.Error {
+		t.Helper()
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","method":%q,"params":%s,"id":1}`, method, params)
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodPost, RPC_PATH, strings.NewReader(body)))
+		var resp rpc.Response
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if resp.Error == nil {
+			json.Unmarshal(resp.Result, v)
+		}
+		return resp.Error
+	}
+
+	var count int
+	if err := rpcCall("getblockcount", "[]", &count); err != nil || count != 3 {
+		t.Errorf("getblockcount: %d %v", count, err)
+	}
+	var block rpcBlock
+	if err := rpcCall("getblockbyheight", "[2]", &block); err != nil || block.Height != 2 || block.Confirmations != 2 {
+		t.Fatalf("getblockbyheight: %+v %v", block, err)
+	}
+	var byHash rpcBlock
+	if err := rpcCall("getblock", fmt.Sprintf(`{"hash":%q}`, block.Hash), &byHash); err != nil || byHash.Height != 2 {
+		t.Errorf("getblock: %+v %v", byHash, err)
+	}
+	if err := rpcCall("getblockbyheight", "[4]", nil); err == nil || err.Code != rpc.CODE_INVALID_PARAMS {
+		t.Errorf("getblockbyheight out of range: %v", err)
+	}
+	if err := rpcCall("getblock", fmt.Sprintf("[%q]", strings.Repeat("00", 32)), nil); err == nil || err.Code != RPC_INVALID_ADDRESS_OR_KEY {
+		t.Errorf("getblock of an unknown hash: %v", err)
+	}
+	// the rewards of every block are the same transaction, the latest is found
+	var reward rpcTransaction
+	if err := rpcCall("gettransaction", fmt.Sprintf("[%q]", block.Transactions[0].TxID), &reward); err != nil ||
+		reward.Height == nil || *reward.Height != 3 || reward.Confirmations != 1 {
+		t.Errorf("gettransaction of a reward: %+v %v", reward, err)
+	}
+
+	raw := func(amount float32) string {
+		tx := wallet.NewTransaction(payer.PrivateKey(), payer.PublicKey(), payer.WalletAddress(), recipient, amount)
+		sender, publicKey, signature := payer.WalletAddress(), payer.PublicKeyStr(), tx.GenerateSignature().String()
+		var buf bytes.Buffer
+		(&p2p.MsgTx{Transaction: &blockchain.TransactionRequest{SenderAddress: &sender, ReceiverAddress: &recipient,
+			SenderPublicKey: &publicKey, Amount: &amount, Signature: &signature}}).Encode(&buf)
+		return fmt.Sprintf("[%q]", hex.EncodeToString(buf.Bytes()))
+	}
+	var txid string
+	if err := rpcCall("sendrawtransaction", raw(1.5), &txid); err != nil {
+		t.Fatalf("sendrawtransaction: %v", err)
+	}
+	if err := rpcCall("sendrawtransaction", raw(10), nil); err == nil || err.Code != RPC_VERIFY_REJECTED {
+		t.Errorf("sendrawtransaction without funds: %v", err)
+	}
+	if err := rpcCall("sendrawtransaction", `["0102"]`, nil); err == nil || err.Code != RPC_DESERIALIZATION_ERROR {
+		t.Errorf("sendrawtransaction of garbage: %v", err)
+	}
+	var pending rpcTransaction
+	if err := rpcCall("gettransaction", fmt.Sprintf("[%q]", txid), &pending); err != nil ||
+		pending.Confirmations != 0 || pending.Amount != 1.5 {
+		t.Errorf("gettransaction of a pending transaction: %+v %v", pending, err)
+	}
+	var mempool struct {
+		Size int `json:"size"`
+	}
+	if err := rpcCall("getmempoolinfo", "null", &mempool); err != nil || mempool.Size != 1 {
+		t.Errorf("getmempoolinfo: %+v %v", mempool, err)
+	}
+	var balance float32
+	if err := rpcCall("getbalance", fmt.Sprintf("[%q]", payer.WalletAddress()), &balance); err != nil || balance != 3 {
+		t.Errorf("getbalance: %v %v", balance, err)
+	}
+	if err := rpcCall("getpeerinfo", "[]", nil); err == nil || err.Code != rpc.CODE_UNAUTHORIZED {
+		t.Errorf("getpeerinfo without authorization: %v", err)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	payer := wallet.NewWallet(params.Regtest)
+	recipient := wallet.NewWallet(params.Regtest).WalletAddress()
+	bcs := newTestServer(payer.WalletAddress())
+	listener := bufconn.Listen(1 << 20)
+	server := bcs.GRPCServer()
+	go server.Serve(listener)
+	defer server.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := nodepb.NewNodeClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	blocks, err := client.SubscribeBlocks(ctx, &nodepb.SubscribeBlocksRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions, err := client.SubscribeTransactions(ctx, &nodepb.SubscribeTransactionsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the subscriptions start with the first change they see
+	time.Sleep(100 * time.Millisecond)
+	if _, err := bcs.miner.Generate(bcs.bc, 2); err != nil {
+		t.Fatal(err)
+	}
+	for height := int64(1); height <= 2; height++ {
+		b, err := blocks.Recv()
+		if err != nil || b.Height != height {
+			t.Fatalf("block %d streamed: %v %v", height, b, err)
+		}
+	}
+
+	if count, err := client.GetBlockCount(ctx, &nodepb.GetBlockCountRequest{}); err != nil || count.Height != 2 {
+		t.Errorf("GetBlockCount: %v %v", count, err)
+	}
+	b, err := client.GetBlock(ctx, &nodepb.GetBlockRequest{Block: &nodepb.GetBlockRequest_Height{Height: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byHash, err := client.GetBlock(ctx, &nodepb.GetBlockRequest{Block: &nodepb.GetBlockRequest_Hash{Hash: b.Hash}}); err != nil || byHash.Height != 1 {
+		t.Errorf("GetBlock by hash: %v %v", byHash, err)
+	}
+	if _, err := client.GetBlock(ctx, &nodepb.GetBlockRequest{Block: &nodepb.GetBlockRequest_Height{Height: 3}}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetBlock above the tip: %v", err)
+	}
+	if headers, err := client.GetHeaders(ctx, &nodepb.GetHeadersRequest{FromHeight: 1}); err != nil || len(headers.Headers) != 2 {
+		t.Errorf("GetHeaders: %v %v", headers, err)
+	}
+
+	send := func(amount float32) (*nodepb.SendTransactionResponse, error) {
+		tx := wallet.NewTransaction(payer.PrivateKey(), payer.PublicKey(), payer.WalletAddress(), recipient, amount)
+		publicKey, _ := hex.DecodeString(payer.PublicKeyStr())
+		signature, _ := hex.DecodeString(tx.GenerateSignature().String())
+		return client.SendTransaction(ctx, &nodepb.SendTransactionRequest{Transaction: &nodepb.SignedTransaction{
+			SenderAddress: payer.WalletAddress(), RecipientAddress: recipient, Amount: amount,
+			SenderPublicKey: publicKey, Signature: signature}})
+	}
+	sent, err := send(0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := send(5); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("transaction without funds: %v", err)
+	}
+	if tx, err := transactions.Recv(); err != nil || !bytes.Equal(tx.Txid, sent.Txid) {
+		t.Errorf("transaction streamed: %v %v", tx, err)
+	}
+	if info, err := client.GetTransaction(ctx, &nodepb.GetTransactionRequest{Txid: sent.Txid}); err != nil || info.Height != nil {
+		t.Errorf("GetTransaction of a pending transaction: %v %v", info, err)
+	}
+	if pool, err := client.GetMempool(ctx, &nodepb.GetMempoolRequest{}); err != nil || len(pool.Transactions) != 1 {
+		t.Errorf("GetMempool: %v %v", pool, err)
+	}
+	if balance, err := client.GetBalance(ctx, &nodepb.GetBalanceRequest{Address: payer.WalletAddress()}); err != nil || balance.Amount != 2 {
+		t.Errorf("GetBalance: %v %v", balance, err)
+	}
+	if _, err := client.GetBalance(ctx, &nodepb.GetBalanceRequest{Address: "nobody"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetBalance of an invalid address: %v", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	payer := wallet.NewWallet(params.Regtest)
+	bcs := newTestServer(payer.WalletAddress())
+	funder := wallet.NewWallet(params.Regtest)
+	b, _ := bcs.bc.NewBlockTemplate(funder.WalletAddress())
+	if err := bcs.miner.Solve(context.Background(), b, params.Regtest.Difficulty); err != nil {
+		t.Fatal(err)
+	}
+	if err := bcs.bc.AddBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(EVENTS_PATH, bcs.Events)
+	mux.Handle(EVENTS_WS_PATH, bcs.EventsWebSocket())
+	// the streams go through the instrumentation of Run
+	bcs.newMetrics()
+	server := httptest.NewServer(bcs.httpStats.Instrument(mux))
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + EVENTS_PATH + "?address=nobody"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid address: %v %v", resp, err)
+	}
+	resp, err := http.Get(server.URL + EVENTS_PATH + "?types=block,tx&address=" + payer.WalletAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("content type %q", resp.Header.Get("Content-Type"))
+	}
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+EVENTS_WS_PATH+"?types=block", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	// both subscriptions are registered once the handshakes are over
+	for bcs.bc.Events().Subscribers() != 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a payment of someone else, filtered out of the streams, then a block
+	// paying the reward to payer
+	other := wallet.NewWallet(params.Regtest).WalletAddress()
+	tx := wallet.NewTransaction(funder.PrivateKey(), funder.PublicKey(), funder.WalletAddress(), other, 1)
+	if !bcs.bc.AddTransaction(funder.WalletAddress(), other, 1, funder.PublicKey(), tx.GenerateSignature()) {
+		t.Fatal("payment refused")
+	}
+	if _, err := bcs.miner.Generate(bcs.bc, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	var stream []string
+	for len(stream) < 2 && lines.Scan() {
+		if lines.Text() != "" {
+			stream = append(stream, lines.Text())
+		}
+	}
+	var e streamEvent
+	if len(stream) != 2 || stream[0] != "event: block" ||
+		json.Unmarshal([]byte(strings.TrimPrefix(stream[1], "data: ")), &e) != nil ||
+		e.Height == nil || *e.Height != 2 || len(e.Transactions) != 2 {
+		t.Errorf("server-sent events: %q", stream)
+	}
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := websocket.JSON.Receive(ws, &e); err != nil || e.Type != blockchain.EVENT_BLOCK || e.Hash == "" {
+		t.Errorf("websocket event: %+v %v", e, err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	bcs := newTestServer(wallet.NewWallet(params.Regtest).WalletAddress())
+	registry := bcs.newMetrics()
+	mux := http.NewServeMux()
+	mux.Handle(METRICS_PATH, registry)
+	mux.HandleFunc(HEALTHZ_PATH, bcs.Healthz)
+	mux.HandleFunc(READYZ_PATH, bcs.Readyz)
+	mux.HandleFunc("/generate", bcs.Generate)
+	handler := bcs.httpStats.Instrument(mux)
+	get := func(method string, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	get(http.MethodPost, "/generate?blocks=2")
+	stale, _ := bcs.bc.NewBlockTemplate("miner")
+	get(http.MethodPost, "/generate")
+	bcs.bc.AddBlock(stale)
+	if w := get(http.MethodGet, HEALTHZ_PATH); w.Code != http.StatusOK {
+		t.Errorf("healthz: %d", w.Code)
+	}
+	w := get(http.MethodGet, READYZ_PATH)
+	var health healthResponse
+	json.Unmarshal(w.Body.Bytes(), &health)
+	if w.Code != http.StatusOK || health.Status != "ok" || health.Height != 3 || health.TargetHeight != 3 {
+		t.Errorf("readyz: %d %s", w.Code, w.Body)
+	}
+
+	w = get(http.MethodGet, METRICS_PATH)
+	if w.Header().Get("Content-Type") != metrics.CONTENT_TYPE {
+		t.Errorf("content type %q", w.Header().Get("Content-Type"))
+	}
+	for _, line := range []string{
+		"moviecoin_chain_height 3",
+		"moviecoin_mempool_transactions 0",
+		"moviecoin_peers 0",
+		"moviecoin_synced 1",
+		"moviecoin_sync_active 0",
+		`moviecoin_block_validation_seconds_count{result="accepted"} 3`,
+		`moviecoin_block_validation_seconds_count{result="rejected"} 1`,
+		`moviecoin_http_requests_total{handler="/generate",method="POST",code="200"} 2`,
+		`moviecoin_http_requests_total{handler="/readyz",method="GET",code="200"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("missing %s in\n%s", line, w.Body)
+		}
+	}
+}
+
+func TestExplorer(t *testing.T) {
+	payer := wallet.NewWallet(params.Regtest)
+	recipient := wallet.NewWallet(params.Regtest).WalletAddress()
+	bcs := newTestServer(payer.WalletAddress())
+	if w := call(bcs.Generate, http.MethodPost, "/generate?blocks=2", nil); w.Code != http.StatusOK {
+		t.Fatalf("generate: %d", w.Code)
+	}
+	signature := wallet.NewTransaction(payer.PrivateKey(), payer.PublicKey(), payer.WalletAddress(), recipient, 1.5).GenerateSignature()
+	if !bcs.bc.CreateTransaction(payer.WalletAddress(), recipient, 1.5, payer.PublicKey(), signature) {
+		t.Fatal("payment refused")
+	}
+	s := bcs.bc.Snapshot()
+	blockHash := fmt.Sprintf("%x", s.Block(2).Hash())
+	rewardID := fmt.Sprintf("%x", s.Block(2).Transactions()[0].Hash())
+	paymentID := fmt.Sprintf("%x", blockchain.NewTransaction(payer.WalletAddress(), recipient, 1.5).Hash())
+
+	explorer := bcs.Explorer()
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		explorer.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	pages := []struct {
+		target   string
+		status   int
+		contains string
+	}{
+		{"/explorer/", http.StatusOK, blockHash[:16]},
+		{"/explorer/block/2", http.StatusOK, rewardID[:16]},
+		{"/explorer/block/" + blockHash, http.StatusOK, "Block 2"},
+		{"/explorer/block/3", http.StatusNotFound, "not in the chain"},
+		{"/explorer/block/xyz", http.StatusBadRequest, "64 hex digits"},
+		{"/explorer/tx/" + rewardID, http.StatusOK, "block reward"},
+		{"/explorer/tx/" + paymentID, http.StatusOK, "Pending"},
+		{"/explorer/address/" + payer.WalletAddress(), http.StatusOK, "+1"},
+		{"/explorer/address/" + recipient, http.StatusOK, paymentID[:16]},
+		{"/explorer/address/nobody", http.StatusBadRequest, "Error 400"},
+		{"/explorer/mempool", http.StatusOK, "1 transactions waiting"},
+		{"/explorer/stats", http.StatusOK, "On demand"},
+		{"/explorer/static/explorer.css", http.StatusOK, "font-family"},
+		{"/explorer/nothing", http.StatusNotFound, "No page"},
+		{"/explorer/search?q=nothing", http.StatusNotFound, "Nothing matches"},
+	}
+	for _, page := range pages {
+		w := get(page.target)
+		if w.Code != page.status || !strings.Contains(w.Body.String(), page.contains) {
+			t.Errorf("%s: %d, expected %d with %q", page.target, w.Code, page.status, page.contains)
+		}
+	}
+
+	searches := map[string]string{
+		"2":                   "/explorer/block/2",
+		blockHash:             "/explorer/block/" + blockHash,
+		paymentID:             "/explorer/tx/" + paymentID,
+		payer.WalletAddress(): "/explorer/address/" + payer.WalletAddress(),
+	}
+	for q, location := range searches {
+		if w := get("/explorer/search?q=" + q); w.Code != http.StatusFound || w.Header().Get("Location") != location {
+			t.Errorf("search %s: %d to %s", q, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// Package client is the Go client of the chain server. It calls the
+// versioned JSON API of the nodes (and the admin routes of the legacy API),
+// retries failed calls with exponential backoff and fails over to the next
+// node when one cannot serve a request.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"moviecoin/api"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_TIMEOUT     = 10 * time.Second
+	DEFAULT_RETRIES     = 2
+	DEFAULT_BACKOFF     = 200 * time.Millisecond
+	DEFAULT_MAX_BACKOFF = 5 * time.Second
+)
+
+var ErrNoNodes = errors.New("client: no node to call")
+
+// NodeError is the failure to get an answer from a node: the request could
+// not be sent or the answer could not be read
+type NodeError struct {
+	Node string
+	Err  error
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("node %s: %v", e.Node, e.Err)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status of the error answered by a node, 0 when
+// err is not an answer of a node
+func StatusCode(err error) int {
+	var e *api.Error
+	if errors.As(err, &e) {
+		return e.Status
+	}
+	return 0
+}
+
+// Client calls a list of equivalent nodes, the first one that answers is
+// preferred for the following calls. The admin calls only go to the
+// preferred node. It is safe for concurrent use; its
+// fields must be set before the first call.
+type Client struct {
+	// HTTPClient sends the requests. Its Timeout would cut the event streams,
+	// prefer Timeout.
+	HTTPClient *http.Client
+	// Timeout bounds every attempt, 0 for none
+	Timeout time.Duration
+	// Retries is the number of times all the nodes are tried again after a
+	// failure of all of them
+	Retries int
+	// Backoff is the wait before the first retry, doubled for every next one
+	// up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// AdminToken authenticates the calls of the admin routes
+	AdminToken string
+
+	nodes     []string
+	mux       sync.Mutex
+	preferred int
+}
+
+// NewClient calls the nodes at the given base URLs, http://host:port
+func NewClient(nodes ...string) *Client {
+	c := &Client{
+		HTTPClient: &http.Client{},
+		Timeout:    DEFAULT_TIMEOUT,
+		Retries:    DEFAULT_RETRIES,
+		Backoff:    DEFAULT_BACKOFF,
+		MaxBackoff: DEFAULT_MAX_BACKOFF,
+	}
+	for _, node := range nodes {
+		c.nodes = append(c.nodes, strings.TrimSuffix(node, "/"))
+	}
+	return c
+}
+
+// Nodes returns the base URLs of the nodes, the preferred one first
+func (c *Client) Nodes() []string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return append(append([]string(nil), c.nodes[c.preferred:]...), c.nodes[:c.preferred]...)
+}
+
+func (c *Client) prefer(node string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for i, n := range c.nodes {
+		if n == node {
+			c.preferred = i
+		}
+	}
+}
+
+// request is a call of the API of a node
+type request struct {
+	method string
+	// path from the base URL of the node, with the query
+	path  string
+	body  interface{}
+	admin bool
+	// idempotent requests are retried after any failure, the others only
+	// when the node cannot have processed them
+	idempotent bool
+	// streams are read for as long as ctx lasts, without Timeout
+	stream bool
+}
+
+// call sends req to the nodes until one answers, then decodes its answer
+// into v, unless v is nil. The errors are *api.Error for the errors
+// answered, *NodeError when no node answered and the errors of ctx.
+func (c *Client) call(ctx context.Context, req *request, v interface{}) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return &NodeError{resp.Request.URL.Host, fmt.Errorf("%s %s answer: %v", req.method, req.path, err)}
+	}
+	return nil
+}
+
+// send is call without the decoding of the answer. The body of the response
+// must be closed, the timeout of the attempt runs until then.
+func (c *Client) send(ctx context.Context, req *request) (*http.Response, error) {
+	nodes := c.Nodes()
+	if len(nodes) == 0 {
+		return nil, ErrNoNodes
+	}
+	if req.admin {
+		// the admin routes act on a node, not on the chain
+		nodes = nodes[:1]
+	}
+	var body []byte
+	if req.body != nil {
+		m, err := json.Marshal(req.body)
+		if err != nil {
+			return nil, err
+		}
+		body = m
+	}
+	backoff := c.Backoff
+	var err error
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, jitter(backoff)); err != nil {
+				return nil, err
+			}
+			if backoff *= 2; backoff > c.MaxBackoff {
+				backoff = c.MaxBackoff
+			}
+		}
+		for _, node := range nodes {
+			var resp *http.Response
+			resp, err = c.attempt(ctx, node, req, body)
+			if err == nil {
+				c.prefer(node)
+				return resp, nil
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if !retryable(req, err) {
+				return nil, err
+			}
+		}
+	}
+	return nil, err
+}
+
+// attempt sends req to a node once. The answers with an error status are
+// returned as *api.Error.
+func (c *Client) attempt(ctx context.Context, node string, req *request, body []byte) (*http.Response, error) {
+	cancel := context.CancelFunc(func() {})
+	if c.Timeout > 0 && !req.stream {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, node+req.path, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if req.admin && c.AdminToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.AdminToken)
+	}
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		cancel()
+		return nil, &NodeError{node, err}
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer cancel()
+		defer resp.Body.Close()
+		return nil, decodeError(resp)
+	}
+	resp.Body = &cancelBody{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelBody releases the timeout of an attempt once its answer is read
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// decodeError reads the error answered by a node: the error object of the
+// versioned API or the status message of the legacy routes
+func decodeError(resp *http.Response) *api.Error {
+	m, _ := io.ReadAll(io.LimitReader(resp.Body, api.MAX_BODY_SIZE))
+	var body struct {
+		Error   *api.Error `json:"error"`
+		Message string     `json:"message"`
+	}
+	json.Unmarshal(m, &body)
+	if body.Error != nil {
+		body.Error.Status = resp.StatusCode
+		return body.Error
+	}
+	message := body.Message
+	if message == "" {
+		message = strings.TrimSpace(string(m))
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return api.NewError(resp.StatusCode, statusCode(resp.StatusCode), message)
+}
+
+// statusCode is the error code of the versioned API for a status
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return api.CODE_BAD_REQUEST
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return api.CODE_UNAUTHORIZED
+	case http.StatusNotFound:
+		return api.CODE_NOT_FOUND
+	case http.StatusMethodNotAllowed:
+		return api.CODE_METHOD_NOT_ALLOWED
+	case http.StatusConflict:
+		return api.CODE_CONFLICT
+	case http.StatusUnprocessableEntity:
+		return api.CODE_REJECTED
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return api.CODE_BAD_GATEWAY
+	case http.StatusServiceUnavailable:
+		return api.CODE_UNAVAILABLE
+	}
+	return api.CODE_INTERNAL
+}
+
+// retryable tells whether another node, or the same one later, may serve a
+// request which failed with err. Requests which are not idempotent, a
+// payment for instance, are only sent again when the node did not process
+// them: it could not be reached or it was unavailable.
+func retryable(req *request, err error) bool {
+	var ne *NodeError
+	if errors.As(err, &ne) {
+		var op *net.OpError
+		return req.idempotent || (errors.As(err, &op) && op.Op == "dial")
+	}
+	switch StatusCode(err) {
+	case http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout, http.StatusInternalServerError:
+		return req.idempotent
+	}
+	return false
+}
+
+// jitter spreads the retries of the clients over [d/2, d)
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
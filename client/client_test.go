@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"moviecoin/api"
+	"moviecoin/blockchain"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient calls the nodes without waiting between the retries
+func newTestClient(nodes ...string) *Client {
+	c := NewClient(nodes...)
+	c.Backoff, c.MaxBackoff = time.Millisecond, time.Millisecond
+	return c
+}
+
+func balanceNode(calls *int32, failures int32, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(calls, 1) <= failures {
+			api.WriteError(w, api.NewError(status, statusCode(status), "try again"))
+			return
+		}
+		api.WriteJSON(w, http.StatusOK, map[string]interface{}{"address": "a", "balance": 42})
+	}))
+}
+
+func TestFailover(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	var calls int32
+	up := balanceNode(&calls, 0, 0)
+	defer up.Close()
+
+	c := newTestClient(down.URL, up.URL)
+	for i := 0; i < 2; i++ {
+		if balance, err := c.Balance(context.Background(), "a"); err != nil || balance != 42 {
+			t.Fatalf("balance %v: %v", balance, err)
+		}
+	}
+	if c.Nodes()[0] != up.URL || calls != 2 {
+		t.Errorf("the node answering must be preferred: %v, %d calls", c.Nodes(), calls)
+	}
+
+	c = newTestClient(down.URL)
+	var ne *NodeError
+	if _, err := c.Balance(context.Background(), "a"); !errors.As(err, &ne) || ne.Node != down.URL {
+		t.Errorf("no node answering: %v", err)
+	}
+	if _, err := NewClient().Balance(context.Background(), "a"); err != ErrNoNodes {
+		t.Errorf("no node: %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls int32
+	node := balanceNode(&calls, 2, http.StatusServiceUnavailable)
+	defer node.Close()
+	c := newTestClient(node.URL)
+	if _, err := c.Balance(context.Background(), "a"); err != nil || calls != 3 {
+		t.Errorf("retried %d times: %v", calls-1, err)
+	}
+
+	// a payment is not sent again once a node may have processed it
+	calls = 0
+	node = balanceNode(&calls, 5, http.StatusBadGateway)
+	defer node.Close()
+	c = newTestClient(node.URL)
+	amount := float32(1)
+	_, err := c.SendTransaction(context.Background(), &blockchain.TransactionRequest{Amount: &amount})
+	if StatusCode(err) != http.StatusBadGateway || calls != 1 {
+		t.Errorf("payment sent %d times: %v", calls, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var token string
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case api.PREFIX + "/transactions":
+			api.WriteError(w, api.Rejected("insufficient funds"))
+		case "/admin/mining/status":
+			// the legacy routes answer a status message
+			token = req.Header.Get("Authorization")
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"message":"unauthorized"}`)
+		default:
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer node.Close()
+	c := newTestClient(node.URL)
+	c.AdminToken = "secret"
+
+	var e *api.Error
+	_, err := c.SendTransaction(context.Background(), &blockchain.TransactionRequest{})
+	if !errors.As(err, &e) || e.Status != http.StatusUnprocessableEntity || e.Code != api.CODE_REJECTED ||
+		e.Message != "insufficient funds" {
+		t.Errorf("api error: %v", err)
+	}
+	_, err = c.MiningStatus(context.Background())
+	if !errors.As(err, &e) || e.Code != api.CODE_UNAUTHORIZED || e.Message != "unauthorized" || token != "Bearer secret" {
+		t.Errorf("legacy error: %v, token %q", err, token)
+	}
+
+	c.Timeout, c.Retries = 10*time.Millisecond, 0
+	if _, err := c.Balance(context.Background(), "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timeout: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Balance(ctx, "a"); err != context.Canceled {
+		t.Errorf("canceled: %v", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != EVENTS_PATH || req.URL.Query().Get("types") != "block,reorg" {
+			t.Errorf("events requested with %s", req.URL)
+		}
+		io.WriteString(w, "retry: 3000\n\n: keepalive\n\n"+
+			"event: block\ndata: {\"type\":\"block\",\"height\":3,\"hash\":\"ab\"}\n\n"+
+			"event: reorg\ndata: {\"type\":\"reorg\",\"height\":1,\"dropped\":[\"cd\"]}\n\n")
+	}))
+	defer node.Close()
+	c := newTestClient(node.URL)
+	c.Timeout = time.Nanosecond // streams are not bounded by the timeout
+	stream, err := c.Events(context.Background(), []string{"block", "reorg"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if e, err := stream.Next(); err != nil || e.Type != "block" || *e.Height != 3 || e.Hash != "ab" {
+		t.Errorf("block event: %+v %v", e, err)
+	}
+	if e, err := stream.Next(); err != nil || e.Type != "reorg" || len(e.Dropped) != 1 {
+		t.Errorf("reorg event: %+v %v", e, err)
+	}
+	if _, err := stream.Next(); err != io.EOF {
+		t.Errorf("end of the stream: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const EVENTS_PATH = "/events"
+
+// Event is an event of the chain streamed by a node: block, tx, reorg or
+// eviction. The fields set depend on the type, see blockchain.Event.
+type Event struct {
+	Type         string              `json:"type"`
+	Height       *int                `json:"height,omitempty"`
+	Hash         string              `json:"hash,omitempty"`
+	Transactions []*EventTransaction `json:"transactions,omitempty"`
+	Transaction  *EventTransaction   `json:"transaction,omitempty"`
+	Dropped      []string            `json:"dropped,omitempty"`
+}
+
+type EventTransaction struct {
+	TxID             string  `json:"txid"`
+	SenderAddress    string  `json:"sender_address"`
+	RecipientAddress string  `json:"recipient_address"`
+	Amount           float32 `json:"amount"`
+}
+
+// EventStream reads the Server-Sent Events of a node
+type EventStream struct {
+	body  io.ReadCloser
+	lines *bufio.Scanner
+}
+
+// Events subscribes to the events of the given types moving the coins of
+// addresses, empty lists do not filter. The stream lasts as long as ctx,
+// until Close or until the node ends it.
+func (c *Client) Events(ctx context.Context, types []string, addresses []string) (*EventStream, error) {
+	q := url.Values{}
+	if len(types) > 0 {
+		q.Set("types", strings.Join(types, ","))
+	}
+	if len(addresses) > 0 {
+		q.Set("address", strings.Join(addresses, ","))
+	}
+	req := &request{method: http.MethodGet, path: EVENTS_PATH + "?" + q.Encode(), idempotent: true, stream: true}
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &EventStream{resp.Body, bufio.NewScanner(resp.Body)}, nil
+}
+
+// Next returns the next event, io.EOF once the node ended the stream
+func (s *EventStream) Next() (*Event, error) {
+	var data []string
+	for s.lines.Scan() {
+		line := s.lines.Text()
+		switch {
+		case line == "" && len(data) > 0:
+			var e Event
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &e); err != nil {
+				return nil, err
+			}
+			return &e, nil
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// comments, event names (the type is in the data) and retry delays
+	}
+	if err := s.lines.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
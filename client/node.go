@@ -0,0 +1,295 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"moviecoin/api"
+	"moviecoin/blockchain"
+	"moviecoin/miner"
+	"moviecoin/p2p"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Block is a block of the chain with its height and hash, hex encoded
+type Block struct {
+	Height int               `json:"height"`
+	Hash   string            `json:"hash"`
+	Block  *blockchain.Block `json:"block"`
+}
+
+// Chain is a page of blocks answered by Blocks and NextBlocks
+type Chain struct {
+	Height int      `json:"height"`
+	Blocks []*Block `json:"blocks"`
+	// empty when the page ends at the tip
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Tip is the answer of Tip
+type Tip struct {
+	Height       int    `json:"height"`
+	Hash         string `json:"hash"`
+	PreviousHash string `json:"previous_hash"`
+	Timestamp    int64  `json:"timestamp"`
+}
+
+// BlockTransactions is the answer of BlockTransactions
+type BlockTransactions struct {
+	Height       int    `json:"height"`
+	Hash         string `json:"hash"`
+	Count        int    `json:"count"`
+	Transactions []struct {
+		TxID             string  `json:"txid"`
+		SenderAddress    string  `json:"sender_address"`
+		RecipientAddress string  `json:"recipient_address"`
+		Amount           float32 `json:"amount"`
+	} `json:"transactions"`
+}
+
+// TransactionStatus is the answer of Transaction
+type TransactionStatus struct {
+	TxID             string  `json:"txid"`
+	SenderAddress    string  `json:"sender_address"`
+	RecipientAddress string  `json:"recipient_address"`
+	Amount           float32 `json:"amount"`
+	// zero while the transaction is in the pool
+	Confirmations int    `json:"confirmations"`
+	BlockHash     string `json:"block_hash,omitempty"`
+	Height        *int   `json:"height,omitempty"`
+}
+
+// Health is the answer of Ready
+type Health struct {
+	Status       string `json:"status"`
+	Height       int    `json:"height"`
+	TargetHeight int    `json:"target_height"`
+	Syncing      bool   `json:"syncing"`
+	Peers        int    `json:"peers"`
+}
+
+// Peers is the answer of Peers
+type Peers struct {
+	Peers     []p2p.PeerInfo       `json:"peers"`
+	Addresses []string             `json:"addresses"`
+	Bans      map[string]time.Time `json:"bans"`
+}
+
+func get(path string) *request {
+	return &request{method: http.MethodGet, path: api.PREFIX + path, idempotent: true}
+}
+
+// Ready returns the health of the first node whose chain caught up with its
+// peers. A node still synchronizing fails with a 503 *api.Error. Readiness
+// is a snapshot: the nodes are asked once, without retries.
+func (c *Client) Ready(ctx context.Context) (*Health, error) {
+	req := &request{method: http.MethodGet, path: "/readyz", idempotent: true}
+	err := ErrNoNodes
+	for _, node := range c.Nodes() {
+		var resp *http.Response
+		resp, err = c.attempt(ctx, node, req, nil)
+		if err != nil {
+			continue
+		}
+		defer resp.Body.Close()
+		var health Health
+		if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+			return nil, &NodeError{node, fmt.Errorf("%s %s answer: %v", req.method, req.path, err)}
+		}
+		return &health, nil
+	}
+	return nil, err
+}
+
+// Tip returns the last block of the chain
+func (c *Client) Tip(ctx context.Context) (*Tip, error) {
+	var tip Tip
+	if err := c.call(ctx, get("/tip"), &tip); err != nil {
+		return nil, err
+	}
+	return &tip, nil
+}
+
+// Blocks returns up to limit blocks from the height from, zero limit is the
+// default one of the server
+func (c *Client) Blocks(ctx context.Context, from int, limit int) (*Chain, error) {
+	q := url.Values{"from": {strconv.Itoa(from)}}
+	return c.blocks(ctx, q, limit)
+}
+
+// NextBlocks returns up to limit blocks after the page of cursor, it fails
+// with a conflict when the chain was reorganized in between
+func (c *Client) NextBlocks(ctx context.Context, cursor string, limit int) (*Chain, error) {
+	return c.blocks(ctx, url.Values{"cursor": {cursor}}, limit)
+}
+
+func (c *Client) blocks(ctx context.Context, q url.Values, limit int) (*Chain, error) {
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var chain Chain
+	if err := c.call(ctx, get("/blocks?"+q.Encode()), &chain); err != nil {
+		return nil, err
+	}
+	return &chain, nil
+}
+
+// Block returns the block at height
+func (c *Client) Block(ctx context.Context, height int) (*Block, error) {
+	var b Block
+	if err := c.call(ctx, get(fmt.Sprintf("/blocks/%d", height)), &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// BlockByHash returns the block with a hex encoded hash
+func (c *Client) BlockByHash(ctx context.Context, hash string) (*Block, error) {
+	var b Block
+	if err := c.call(ctx, get("/blocks/hash/"+url.PathEscape(hash)), &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// BlockTransactions returns the transactions of the block at height
+func (c *Client) BlockTransactions(ctx context.Context, height int) (*BlockTransactions, error) {
+	var b BlockTransactions
+	if err := c.call(ctx, get(fmt.Sprintf("/blocks/%d/transactions", height)), &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Transactions returns the transactions waiting in the pool
+func (c *Client) Transactions(ctx context.Context) ([]*blockchain.Transaction, error) {
+	var resp struct {
+		Transactions []*blockchain.Transaction `json:"transactions"`
+	}
+	if err := c.call(ctx, get("/transactions"), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Transactions, nil
+}
+
+// SendTransaction submits a signed transaction and returns its hash
+func (c *Client) SendTransaction(ctx context.Context, t *blockchain.TransactionRequest) (string, error) {
+	var resp struct {
+		Hash string `json:"hash"`
+	}
+	req := &request{method: http.MethodPost, path: api.PREFIX + "/transactions", body: t}
+	if err := c.call(ctx, req, &resp); err != nil {
+		return "", err
+	}
+	return resp.Hash, nil
+}
+
+// Transaction returns the transaction txid, pending or confirmed
+func (c *Client) Transaction(ctx context.Context, txid string) (*TransactionStatus, error) {
+	var status TransactionStatus
+	if err := c.call(ctx, get("/transactions/"+url.PathEscape(txid)), &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ClearTransactions empties the transaction pool (admin)
+func (c *Client) ClearTransactions(ctx context.Context) error {
+	req := &request{method: http.MethodDelete, path: api.PREFIX + "/transactions", admin: true, idempotent: true}
+	return c.call(ctx, req, nil)
+}
+
+// Balance returns the amount owned by address in the chain
+func (c *Client) Balance(ctx context.Context, address string) (float32, error) {
+	var resp struct {
+		Balance float32 `json:"balance"`
+	}
+	if err := c.call(ctx, get("/addresses/"+url.PathEscape(address)+"/balance"), &resp); err != nil {
+		return 0, err
+	}
+	return resp.Balance, nil
+}
+
+// MiningTemplate returns work for an external miner paying the reward to
+// payoutAddress, to the address of the node when empty
+func (c *Client) MiningTemplate(ctx context.Context, payoutAddress string) (*miner.Work, error) {
+	path := "/mining/template"
+	if payoutAddress != "" {
+		path += "?address=" + url.QueryEscape(payoutAddress)
+	}
+	var w miner.Work
+	if err := c.call(ctx, get(path), &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// SubmitBlock submits the solution of a mining template and returns the hash
+// of the block
+func (c *Client) SubmitBlock(ctx context.Context, ws *miner.WorkSubmission) (string, error) {
+	var resp struct {
+		Hash string `json:"hash"`
+	}
+	req := &request{method: http.MethodPost, path: api.PREFIX + "/blocks", body: ws}
+	if err := c.call(ctx, req, &resp); err != nil {
+		return "", err
+	}
+	return resp.Hash, nil
+}
+
+// Generate mines blocks immediately on a regtest node (admin) and returns
+// their hashes
+func (c *Client) Generate(ctx context.Context, blocks int) ([]string, error) {
+	var resp struct {
+		Blocks []string `json:"blocks"`
+	}
+	req := &request{method: http.MethodPost, path: fmt.Sprintf("%s/generate?blocks=%d", api.PREFIX, blocks), admin: true}
+	if err := c.call(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Blocks, nil
+}
+
+// Peers returns the connected peers, the known addresses and the bans
+// (admin)
+func (c *Client) Peers(ctx context.Context) (*Peers, error) {
+	req := get("/peers")
+	req.admin = true
+	var peers Peers
+	if err := c.call(ctx, req, &peers); err != nil {
+		return nil, err
+	}
+	return &peers, nil
+}
+
+// MiningStatus returns the state of the miner of the node (admin)
+func (c *Client) MiningStatus(ctx context.Context) (*miner.Status, error) {
+	return c.mining(ctx, &request{method: http.MethodGet, path: "/admin/mining/status", admin: true, idempotent: true})
+}
+
+// StartMining starts the miner of the node (admin). The schedule of the
+// configuration of the node applies unless mode is set; intervalSec is the
+// interval of the "interval" mode, the configured one when 0.
+func (c *Client) StartMining(ctx context.Context, mode string, intervalSec int) (*miner.Status, error) {
+	body := struct {
+		Mode        string `json:"mode,omitempty"`
+		IntervalSec int    `json:"interval_sec,omitempty"`
+	}{mode, intervalSec}
+	return c.mining(ctx, &request{method: http.MethodPost, path: "/admin/mining/start", body: &body, admin: true, idempotent: true})
+}
+
+// StopMining stops the miner of the node (admin)
+func (c *Client) StopMining(ctx context.Context) (*miner.Status, error) {
+	return c.mining(ctx, &request{method: http.MethodPost, path: "/admin/mining/stop", admin: true, idempotent: true})
+}
+
+func (c *Client) mining(ctx context.Context, req *request) (*miner.Status, error) {
+	var status miner.Status
+	if err := c.call(ctx, req, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
@@ -1,14 +1,30 @@
 package comm
 
-import "net"
+import (
+	"fmt"
+	"net"
+)
 
-func NewMulticast(address string) (*net.UDPConn, error) {
-	addr, err := net.ResolveUDPAddr("udp4", address)
+// NewMulticast dials the multicast group at address, IPv4 or IPv6. When
+// iface is set, datagrams leave through that interface.
+func NewMulticast(address string, iface string) (*net.UDPConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
 	if err != nil {
 		return nil, err
 	}
+	network := udpNetwork(addr)
+	var laddr *net.UDPAddr
+	if iface != "" {
+		if laddr, err = interfaceAddr(iface, network == "udp6"); err != nil {
+			return nil, err
+		}
+		// scoped IPv6 groups (ff02::/16...) need the zone
+		if network == "udp6" && addr.Zone == "" {
+			addr.Zone = iface
+		}
+	}
 
-	conn, err := net.DialUDP("udp4", nil, addr)
+	conn, err := net.DialUDP(network, laddr, addr)
 	if err != nil {
 		return nil, err
 	}
@@ -16,3 +32,39 @@ func NewMulticast(address string) (*net.UDPConn, error) {
 	return conn, nil
 
 }
+
+func udpNetwork(addr *net.UDPAddr) string {
+	if addr.IP.To4() != nil {
+		return "udp4"
+	}
+	return "udp6"
+}
+
+// interfaceAddr is an address of the interface in the requested family.
+// Binding to it makes the kernel send multicast through the interface.
+func interfaceAddr(name string, ipv6 bool) (*net.UDPAddr, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || (ipnet.IP.To4() == nil) != ipv6 {
+			continue
+		}
+		laddr := &net.UDPAddr{IP: ipnet.IP}
+		if ipv6 && ipnet.IP.IsLinkLocalUnicast() {
+			laddr.Zone = ifi.Name
+		}
+		return laddr, nil
+	}
+	family := "IPv4"
+	if ipv6 {
+		family = "IPv6"
+	}
+	return nil, fmt.Errorf("interface %s has no %s address", name, family)
+}
@@ -9,13 +9,22 @@ const (
 	maxDatagramSize = 8192
 )
 
-func MulticastListen(address string, handler func(*net.UDPAddr, int, []byte)) {
-	addr, err := net.ResolveUDPAddr("udp4", address)
+// MulticastListen joins the multicast group at address, IPv4 or IPv6, on
+// iface or the system default interface when empty, and hands every
+// datagram received to handler
+func MulticastListen(address string, iface string, handler func(*net.UDPAddr, int, []byte)) {
+	addr, err := net.ResolveUDPAddr("udp", address)
 	if err != nil {
 		log.Fatal(err)
 	}
+	var ifi *net.Interface
+	if iface != "" {
+		if ifi, err = net.InterfaceByName(iface); err != nil {
+			log.Fatal(err)
+		}
+	}
 	log.Printf("ListenMulticastUDP %s", addr)
-	conn, err := net.ListenMulticastUDP("udp4", nil, addr)
+	conn, err := net.ListenMulticastUDP(udpNetwork(addr), ifi, addr)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -28,7 +37,6 @@ func MulticastListen(address string, handler func(*net.UDPAddr, int, []byte)) {
 		if err != nil {
 			log.Fatal("ReadFromUDP failed:", err)
 		}
-		log.Printf("Received from %s %d bytes", src, numBytes)
 		handler(src, numBytes, buffer)
 	}
 }
@@ -0,0 +1,480 @@
+package config
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"moviecoin/miner"
+	"moviecoin/params"
+	"moviecoin/security"
+	"moviecoin/wallet"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Storage backends a node may be configured with
+const (
+	STORAGE_MEMORY   = "memory"
+	STORAGE_POSTGRES = "postgres"
+	STORAGE_MONGODB  = "mongodb"
+)
+
+// storageBackends are the backends each server can run, the chain server
+// keeps its chain in memory until the database backends are wired in
+var storageBackends = map[Server][]string{
+	CHAIN_SERVER: {STORAGE_MEMORY},
+}
+
+const (
+	CONFIG_ENV_PREFIX = "MOVIECOIN_"
+	DEFAULT_DATA_DIR  = ".moviecoin"
+	// The miner key passphrase is only ever read from the environment so
+	// that it never ends up in a configuration file or a config dump
+	MINER_PASSPHRASE_ENV = CONFIG_ENV_PREFIX + "MINER_PASSPHRASE"
+	MINER_KEY_FILE       = "miner.key"
+	POOL_PASSPHRASE_ENV  = CONFIG_ENV_PREFIX + "POOL_PASSPHRASE"
+	POOL_KEY_FILE        = "pool.key"
+	P2P_PORT_OFFSET      = 1000
+	PEERS_FILE           = "peers.json"
+	NODE_KEY_FILE        = "node.key"
+
+	// WALLET_PASSPHRASE_ENV encrypts the wallets of the command line tool
+	WALLET_PASSPHRASE_ENV = CONFIG_ENV_PREFIX + "WALLET_PASSPHRASE"
+	WALLETS_DIR           = "wallets"
+)
+
+// Pool payout schemes
+const (
+	PAYOUT_PROPORTIONAL = "proportional"
+	PAYOUT_PPLNS        = "pplns"
+)
+
+// Config holds the settings of both the chain server and the wallet server.
+// Values are layered: defaults, then the configuration file, then
+// MOVIECOIN_* environment variables and finally command line flags.
+type Config struct {
+	Network string        `json:"network"`
+	DataDir string        `json:"data_dir"`
+	Chain   ChainConfig   `json:"chain"`
+	P2P     P2PConfig     `json:"p2p"`
+	Wallet  WalletConfig  `json:"wallet"`
+	Mining  MiningConfig  `json:"mining"`
+	Pool    PoolConfig    `json:"pool"`
+	CLI     CLIConfig     `json:"cli"`
+	Admin   AdminConfig   `json:"admin"`
+	Storage StorageConfig `json:"storage"`
+	Log     LogConfig     `json:"log"`
+}
+
+type ChainConfig struct {
+	Port uint16 `json:"port"`
+	// MulticastAddress overrides the discovery group of the network, IPv4
+	// or IPv6 such as [ff02::4d4f]:9999
+	MulticastAddress string `json:"multicast_address"`
+	// MulticastInterface is the network interface used for discovery, the
+	// system default one when empty
+	MulticastInterface string    `json:"multicast_interface"`
+	TLS                TLSConfig `json:"tls"`
+	// GRPCPort serves the gRPC API, with the TLS files of the chain server
+	// when set. Disabled when 0.
+	GRPCPort uint16 `json:"grpc_port"`
+}
+
+// TLSConfig serves HTTPS instead of HTTP when both files are set
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+func (t TLSConfig) validate(section string) []string {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return []string{section + ".tls needs both cert_file and key_file"}
+	}
+	return nil
+}
+
+// P2PConfig drives the peer to peer protocol between chain servers
+type P2PConfig struct {
+	// Port defaults to the chain port + P2P_PORT_OFFSET when 0
+	Port uint16 `json:"port"`
+	// Peers are host:port peer to peer addresses kept connected
+	Peers []string `json:"peers"`
+	// Seeds are host:port addresses dialed to learn about other nodes, they
+	// are not redialed once enough peers are connected
+	Seeds []string `json:"seeds"`
+	// Zero means the p2p package defaults
+	MaxInbound     int `json:"max_inbound"`
+	TargetOutbound int `json:"target_outbound"`
+	BanSec         int `json:"ban_sec"`
+	// AllowedNodes, when not empty, makes the network permissioned: only
+	// these node IDs may connect
+	AllowedNodes []string `json:"allowed_nodes"`
+}
+
+type WalletConfig struct {
+	Port     uint16    `json:"port"`
+	Node     string    `json:"node"`
+	NodePort uint16    `json:"node_port"`
+	TLS      TLSConfig `json:"tls"`
+	// NodeTLS talks to the node over HTTPS, trusting NodeCA (PEM) when set
+	// or else the system certificate authorities
+	NodeTLS bool   `json:"node_tls"`
+	NodeCA  string `json:"node_ca"`
+	// FallbackNodes are host:port chain servers called when the node
+	// fails, over the same scheme
+	FallbackNodes []string `json:"fallback_nodes"`
+}
+
+type MiningConfig struct {
+	Enabled bool `json:"enabled"`
+	Threads int  `json:"threads"`
+	// Address receives the mining rewards. When empty, the node uses the
+	// encrypted wallet stored in KeyFile, creating it on first start.
+	Address string `json:"address"`
+	KeyFile string `json:"key_file"`
+	// Mode is either "interval", mining every IntervalSec (0 means the
+	// network default), or "continuous", mining as soon as transactions arrive
+	Mode        string `json:"mode"`
+	IntervalSec int    `json:"interval_sec"`
+}
+
+// AdminConfig protects the administration endpoints (mining control...).
+// Without a token they only answer requests coming from the loopback interface.
+type AdminConfig struct {
+	Token string `json:"token"`
+}
+
+// PoolConfig drives the mining pool server. Workers only have to find shares
+// meeting ShareDifficulty; block rewards are redistributed according to Scheme.
+type PoolConfig struct {
+	Port            uint16  `json:"port"`
+	Node            string  `json:"node"`
+	NodePort        uint16  `json:"node_port"`
+	ShareDifficulty int     `json:"share_difficulty"`
+	Scheme          string  `json:"scheme"`
+	Window          int     `json:"window"` // number of shares paid by PPLNS
+	Fee             float32 `json:"fee"`    // fraction of the reward kept by the pool
+	KeyFile         string  `json:"key_file"`
+	NodeTLS         bool    `json:"node_tls"` // see WalletConfig
+	NodeCA          string  `json:"node_ca"`
+}
+
+// CLIConfig points the command line tool at the chain servers
+type CLIConfig struct {
+	// Nodes are base URLs such as http://localhost:5000, the next ones are
+	// called when the first fails
+	Nodes []string `json:"nodes"`
+	// NodeCA is trusted in addition to the system certificate authorities
+	// for the https nodes
+	NodeCA string `json:"node_ca"`
+}
+
+type StorageConfig struct {
+	Backend string `json:"backend"`
+	URI     string `json:"uri"`
+}
+
+type LogConfig struct {
+	Level string `json:"level"`
+	File  string `json:"file"`
+}
+
+func Default() *Config {
+	return &Config{
+		Network: params.Mainnet.Name,
+		DataDir: defaultDataDir(),
+		Chain: ChainConfig{
+			Port: 5000,
+		},
+		Wallet: WalletConfig{
+			Port:     8080,
+			Node:     "localhost",
+			NodePort: 5000,
+		},
+		Mining: MiningConfig{
+			Enabled: true,
+			Threads: 1,
+			Mode:    miner.MODE_INTERVAL,
+		},
+		Pool: PoolConfig{
+			Port:            7000,
+			Node:            "localhost",
+			NodePort:        5000,
+			ShareDifficulty: 1,
+			Scheme:          PAYOUT_PPLNS,
+			Window:          1000,
+			Fee:             0.01,
+		},
+		CLI: CLIConfig{
+			Nodes: []string{"http://localhost:5000"},
+		},
+		Storage: StorageConfig{
+			Backend: STORAGE_MEMORY,
+		},
+		Log: LogConfig{
+			Level: LOG_INFO,
+		},
+	}
+}
+
+func defaultDataDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return DEFAULT_DATA_DIR
+	}
+	return filepath.Join(home, DEFAULT_DATA_DIR)
+}
+
+// LoadFile overlays the JSON configuration file at path on top of c.
+// Only the keys present in the file are changed; unknown keys are an error.
+func (c *Config) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Params returns the parameters of the configured network
+func (c *Config) Params() *params.Network {
+	n, err := params.Lookup(c.Network)
+	if err != nil {
+		// Validate guarantees the network exists
+		panic(err)
+	}
+	return n
+}
+
+// NetworkDataDir is the directory holding the files of the configured
+// network, so that mainnet and testnet data never mix
+func (c *Config) NetworkDataDir() string {
+	return filepath.Join(c.DataDir, c.Network)
+}
+
+// P2PPort is the port accepting peer to peer connections
+func (c *Config) P2PPort() uint16 {
+	if c.P2P.Port != 0 {
+		return c.P2P.Port
+	}
+	return c.Chain.Port + P2P_PORT_OFFSET
+}
+
+// NodeKeyFile is the path of the key identifying the node
+func (c *Config) NodeKeyFile() string {
+	return filepath.Join(c.NetworkDataDir(), NODE_KEY_FILE)
+}
+
+// MulticastAddress is the discovery group: the configured one or else the
+// one of the network
+func (c *Config) MulticastAddress() string {
+	if c.Chain.MulticastAddress != "" {
+		return c.Chain.MulticastAddress
+	}
+	if network, err := params.Lookup(c.Network); err == nil {
+		return network.MulticastAddress
+	}
+	return ""
+}
+
+// PeersFile is the path of the peer address book
+func (c *Config) PeersFile() string {
+	return filepath.Join(c.NetworkDataDir(), PEERS_FILE)
+}
+
+// MinerKeyFile is the path of the encrypted miner wallet
+func (c *Config) MinerKeyFile() string {
+	if c.Mining.KeyFile != "" {
+		return c.Mining.KeyFile
+	}
+	return filepath.Join(c.NetworkDataDir(), MINER_KEY_FILE)
+}
+
+// PoolKeyFile is the path of the encrypted pool wallet paying the workers
+func (c *Config) PoolKeyFile() string {
+	if c.Pool.KeyFile != "" {
+		return c.Pool.KeyFile
+	}
+	return filepath.Join(c.NetworkDataDir(), POOL_KEY_FILE)
+}
+
+// WalletsDir is the directory of the encrypted wallets of the command line
+// tool, one NAME.key file per wallet
+func (c *Config) WalletsDir() string {
+	return filepath.Join(c.NetworkDataDir(), WALLETS_DIR)
+}
+
+// Validate checks the configuration, and that server can run the storage
+// backend when it keeps a chain
+func (c *Config) Validate(server Server) error {
+	var errs []string
+	network, err := params.Lookup(c.Network)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	if network != nil && c.Mining.Address != "" {
+		if err := wallet.ValidateAddress(c.Mining.Address, network); err != nil {
+			errs = append(errs, "mining.address: "+err.Error())
+		}
+	}
+	if c.DataDir == "" {
+		errs = append(errs, "data_dir must not be empty")
+	}
+	if c.Chain.Port == 0 {
+		errs = append(errs, "chain.port must not be 0")
+	}
+	if c.Chain.MulticastAddress != "" {
+		host, _, err := net.SplitHostPort(c.Chain.MulticastAddress)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsMulticast() {
+			errs = append(errs, fmt.Sprintf("chain.multicast_address: %q is not a multicast host:port address", c.Chain.MulticastAddress))
+		}
+	}
+	for _, p := range c.P2P.Peers {
+		if !strings.Contains(p, ":") {
+			errs = append(errs, fmt.Sprintf("p2p.peers: %q is not a host:port address", p))
+		}
+	}
+	for _, s := range c.P2P.Seeds {
+		if !strings.Contains(s, ":") {
+			errs = append(errs, fmt.Sprintf("p2p.seeds: %q is not a host:port address", s))
+		}
+	}
+	if c.P2P.MaxInbound < 0 {
+		errs = append(errs, "p2p.max_inbound must not be negative")
+	}
+	if c.P2P.TargetOutbound < 0 {
+		errs = append(errs, "p2p.target_outbound must not be negative")
+	}
+	if c.P2P.BanSec < 0 {
+		errs = append(errs, "p2p.ban_sec must not be negative")
+	}
+	for _, id := range c.P2P.AllowedNodes {
+		if b, err := hex.DecodeString(id); err != nil || len(b) != security.NODE_ID_SIZE {
+			errs = append(errs, fmt.Sprintf("p2p.allowed_nodes: %q is not a node ID", id))
+		}
+	}
+	errs = append(errs, c.Chain.TLS.validate("chain")...)
+	errs = append(errs, c.Wallet.TLS.validate("wallet")...)
+	if c.Wallet.NodeCA != "" && !c.Wallet.NodeTLS {
+		errs = append(errs, "wallet.node_ca requires wallet.node_tls")
+	}
+	if c.Pool.NodeCA != "" && !c.Pool.NodeTLS {
+		errs = append(errs, "pool.node_ca requires pool.node_tls")
+	}
+	if c.P2P.Port == 0 && c.Chain.Port > 65535-P2P_PORT_OFFSET {
+		errs = append(errs, fmt.Sprintf("p2p.port must be set when chain.port exceeds %d", 65535-P2P_PORT_OFFSET))
+	} else if c.Chain.Port != 0 && c.P2PPort() == c.Chain.Port {
+		errs = append(errs, "p2p.port must differ from chain.port")
+	}
+	if c.Chain.GRPCPort != 0 && (c.Chain.GRPCPort == c.Chain.Port || c.Chain.GRPCPort == c.P2PPort()) {
+		errs = append(errs, "chain.grpc_port must differ from chain.port and p2p.port")
+	}
+	if c.Wallet.Port == 0 {
+		errs = append(errs, "wallet.port must not be 0")
+	}
+	if c.Wallet.Node == "" {
+		errs = append(errs, "wallet.node must not be empty")
+	}
+	if c.Wallet.NodePort == 0 {
+		errs = append(errs, "wallet.node_port must not be 0")
+	}
+	for _, n := range c.Wallet.FallbackNodes {
+		if !strings.Contains(n, ":") {
+			errs = append(errs, fmt.Sprintf("wallet.fallback_nodes: %q is not a host:port address", n))
+		}
+	}
+	if len(c.CLI.Nodes) == 0 {
+		errs = append(errs, "cli.nodes must not be empty")
+	}
+	for _, n := range c.CLI.Nodes {
+		if u, err := url.Parse(n); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("cli.nodes: %q is not an http(s)://host:port URL", n))
+		}
+	}
+	if c.Mining.Threads < 1 {
+		errs = append(errs, "mining.threads must be at least 1")
+	}
+	if c.Mining.Mode != miner.MODE_INTERVAL && c.Mining.Mode != miner.MODE_CONTINUOUS {
+		errs = append(errs, fmt.Sprintf("mining.mode %q is not one of %s, %s",
+			c.Mining.Mode, miner.MODE_INTERVAL, miner.MODE_CONTINUOUS))
+	}
+	if c.Mining.IntervalSec < 0 {
+		errs = append(errs, "mining.interval_sec must not be negative")
+	}
+	if c.Pool.Port == 0 || c.Pool.NodePort == 0 {
+		errs = append(errs, "pool.port and pool.node_port must not be 0")
+	}
+	if c.Pool.ShareDifficulty < 1 {
+		errs = append(errs, "pool.share_difficulty must be at least 1")
+	} else if network != nil && c.Pool.ShareDifficulty > network.Difficulty {
+		errs = append(errs, fmt.Sprintf("pool.share_difficulty must not exceed the %s difficulty (%d)",
+			network.Name, network.Difficulty))
+	}
+	switch c.Pool.Scheme {
+	case PAYOUT_PROPORTIONAL:
+	case PAYOUT_PPLNS:
+		if c.Pool.Window < 1 {
+			errs = append(errs, "pool.window must be at least 1 with the pplns scheme")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("pool.scheme %q is not one of %s, %s",
+			c.Pool.Scheme, PAYOUT_PROPORTIONAL, PAYOUT_PPLNS))
+	}
+	if c.Pool.Fee < 0 || c.Pool.Fee >= 1 {
+		errs = append(errs, "pool.fee must be in [0, 1)")
+	}
+	switch c.Storage.Backend {
+	case STORAGE_MEMORY:
+	case STORAGE_POSTGRES, STORAGE_MONGODB:
+		if c.Storage.URI == "" {
+			errs = append(errs, fmt.Sprintf("storage.uri is required by the %s backend", c.Storage.Backend))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("storage.backend %q is not one of %s, %s, %s",
+			c.Storage.Backend, STORAGE_MEMORY, STORAGE_POSTGRES, STORAGE_MONGODB))
+	}
+	if backends, ok := storageBackends[server]; ok && !slices.Contains(backends, c.Storage.Backend) {
+		errs = append(errs, fmt.Sprintf("storage.backend %q is not supported by this server yet, only %s",
+			c.Storage.Backend, strings.Join(backends, ", ")))
+	}
+	if _, ok := logLevels[c.Log.Level]; !ok {
+		errs = append(errs, fmt.Sprintf("log.level %q is not one of debug, info, warn, error", c.Log.Level))
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// MiningInterval is the configured interval between mining rounds
+func (c *Config) MiningInterval() time.Duration {
+	if c.Mining.IntervalSec > 0 {
+		return time.Duration(c.Mining.IntervalSec) * time.Second
+	}
+	return time.Duration(c.Params().MiningTimerSec) * time.Second
+}
+
+// Dump renders the effective configuration as indented JSON, secrets masked
+func (c *Config) Dump() []byte {
+	masked := *c
+	if masked.Admin.Token != "" {
+		masked.Admin.Token = "********"
+	}
+	m, _ := json.MarshalIndent(&masked, "", "  ")
+	return append(m, '\n')
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "moviecoin.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	if err := Default().Validate(CHAIN_SERVER); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLayering(t *testing.T) {
+	path := writeFile(t, `{"network": "testnet", "chain": {"port": 6000}, "mining": {"threads": 2}}`)
+	t.Setenv("MOVIECOIN_CHAIN_PORT", "7000")
+	t.Setenv("MOVIECOIN_MINING_THREADS", "3")
+
+	cfg, err := Load(CHAIN_SERVER, "test", []string{"-config", path, "-mining_threads=4", "-mining=false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Network != "testnet" {
+		t.Errorf("network %q, file value expected", cfg.Network)
+	}
+	if cfg.Chain.Port != 7000 {
+		t.Errorf("port %d, environment should override the file", cfg.Chain.Port)
+	}
+	if cfg.Mining.Threads != 4 {
+		t.Errorf("threads %d, flag should override the environment", cfg.Mining.Threads)
+	}
+	if cfg.Mining.Enabled {
+		t.Error("mining should be disabled by the flag")
+	}
+	if cfg.P2PPort() != 8000 {
+		t.Errorf("p2p port %d, chain port + %d expected", cfg.P2PPort(), P2P_PORT_OFFSET)
+	}
+	if cfg.Storage.Backend != STORAGE_MEMORY {
+		t.Errorf("storage %q, default expected", cfg.Storage.Backend)
+	}
+}
+
+func TestServerFlags(t *testing.T) {
+	cfg, err := Load(WALLET_SERVER, "test", []string{"-port", "9090", "-node_port", "5555"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Wallet.Port != 9090 || cfg.Wallet.NodePort != 5555 {
+		t.Errorf("wallet flags not applied: %+v", cfg.Wallet)
+	}
+	if cfg.Chain.Port != Default().Chain.Port {
+		t.Error("wallet -port must not change the chain server port")
+	}
+	if _, err := Load(WALLET_SERVER, "test", []string{"-mining_threads", "2"}); err == nil {
+		t.Error("chain server flags must not be accepted by the wallet server")
+	}
+}
+
+func TestLoadArgs(t *testing.T) {
+	cfg, rest, err := LoadArgs(CLI, "test", []string{"-node", "https://a:5000, http://b:5000", "send", "-amount", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cfg.CLI.Nodes, " ") != "https://a:5000 http://b:5000" {
+		t.Errorf("nodes %v", cfg.CLI.Nodes)
+	}
+	if strings.Join(rest, " ") != "send -amount 1" {
+		t.Errorf("command %v", rest)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	cases := map[string]string{
+		"network":   `{"network": "simnet"}`,
+		"threads":   `{"mining": {"threads": 0}}`,
+		"storage":   `{"storage": {"backend": "sqlite"}}`,
+		"uri":       `{"storage": {"backend": "postgres"}}`,
+		"chain_db":  `{"storage": {"backend": "postgres", "uri": "postgres://localhost/moviecoin"}}`,
+		"log":       `{"log": {"level": "chatty"}}`,
+		"unknown":   `{"minning": {"threads": 2}}`,
+		"p2p_peers": `{"p2p": {"peers": ["localhost"]}}`,
+		"p2p_port":  `{"chain": {"port": 5000}, "p2p": {"port": 5000}}`,
+		"p2p_wrap":  `{"chain": {"port": 65000}}`,
+		"p2p_ban":   `{"p2p": {"ban_sec": -1}}`,
+		"p2p_seeds": `{"p2p": {"seeds": ["seed.example.com"]}}`,
+		"multicast": `{"chain": {"multicast_address": "10.0.0.1:9999"}}`,
+		"address":   `{"mining": {"address": "MOVIECOIN BLOCKCHAIN"}}`,
+		"allowed":   `{"p2p": {"allowed_nodes": ["not a node ID"]}}`,
+		"tls":       `{"chain": {"tls": {"cert_file": "cert.pem"}}}`,
+		"node_ca":   `{"wallet": {"node_ca": "ca.pem"}}`,
+		"grpc_port": `{"chain": {"port": 5000, "grpc_port": 6000}}`,
+		"fallback":  `{"wallet": {"fallback_nodes": ["localhost"]}}`,
+		"cli_nodes": `{"cli": {"nodes": ["localhost:5000"]}}`,
+	}
+	for name, content := range cases {
+		if _, err := Load(CHAIN_SERVER, "test", []string{"-config", writeFile(t, content)}); err == nil {
+			t.Errorf("%s: invalid configuration accepted", name)
+		}
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	dump, rest := ParseCommand([]string{"config", "dump", "-port", "1"})
+	if !dump || strings.Join(rest, " ") != "-port 1" {
+		t.Errorf("config dump not recognized: %v %v", dump, rest)
+	}
+	dump, rest = ParseCommand([]string{"-port", "1"})
+	if dump || len(rest) != 2 {
+		t.Errorf("plain flags mistaken for a command: %v %v", dump, rest)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	flags, prefix, out := log.Flags(), log.Prefix(), log.Writer()
+	defer func() {
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+		log.SetOutput(out)
+	}()
+	for _, f := range []int{0, log.LstdFlags, log.LstdFlags | log.Lmicroseconds | log.Lshortfile | log.Lmsgprefix} {
+		var b strings.Builder
+		log.SetFlags(f)
+		log.SetPrefix("Blockchain: ")
+		log.SetOutput(&levelWriter{&b, logLevels[LOG_WARN]})
+		log.Println("ERROR: kept")
+		log.Println("WARN: kept")
+		log.Println("DEBUG: dropped")
+		log.Println("peer sent WARN: dropped")
+		log.Println("address ERROR dropped")
+		if got := strings.Count(b.String(), "kept"); got != 2 || strings.Contains(b.String(), "dropped") {
+			t.Errorf("flags %d: logged\n%s", f, b.String())
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Server selects the options exposed by a binary
+type Server int
+
+const (
+	CHAIN_SERVER Server = 1 << iota
+	WALLET_SERVER
+	POOL_SERVER
+	CLI
+)
+
+// option ties a configuration value to its environment variable and flag
+type option struct {
+	flag    string
+	env     string
+	usage   string
+	servers Server
+	isBool  bool
+	get     func(c *Config) string
+	set     func(c *Config, v string) error
+}
+
+var options = []option{
+	{"network", "NETWORK", "Network to join: mainnet, testnet or regtest", CHAIN_SERVER | WALLET_SERVER | POOL_SERVER | CLI, false,
+		func(c *Config) string { return c.Network },
+		func(c *Config, v string) error { c.Network = v; return nil }},
+	{"datadir", "DATADIR", "Directory holding keys and node data", CHAIN_SERVER | WALLET_SERVER | POOL_SERVER | CLI, false,
+		func(c *Config) string { return c.DataDir },
+		func(c *Config, v string) error { c.DataDir = v; return nil }},
+	{"port", "CHAIN_PORT", "TCP Port Number for Blockchain Server", CHAIN_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(int(c.Chain.Port)) },
+		func(c *Config, v string) error { return setPort(&c.Chain.Port, v) }},
+	{"multicast_address", "MULTICAST_ADDRESS", "Multicast group host:port for node discovery, IPv4 or IPv6 (default network one)", CHAIN_SERVER, false,
+		func(c *Config) string { return c.Chain.MulticastAddress },
+		func(c *Config, v string) error { c.Chain.MulticastAddress = v; return nil }},
+	{"multicast_interface", "MULTICAST_INTERFACE", "Network interface for node discovery (default system one)", CHAIN_SERVER, false,
+		func(c *Config) string { return c.Chain.MulticastInterface },
+		func(c *Config, v string) error { c.Chain.MulticastInterface = v; return nil }},
+	{"grpc_port", "CHAIN_GRPC_PORT", "TCP Port Number for the gRPC API (disabled when 0)", CHAIN_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(int(c.Chain.GRPCPort)) },
+		func(c *Config, v string) error { return setPort(&c.Chain.GRPCPort, v) }},
+	{"p2p_port", "P2P_PORT", "TCP Port Number for peer to peer connections (default chain port + 1000)", CHAIN_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(int(c.P2P.Port)) },
+		func(c *Config, v string) error { return setPort(&c.P2P.Port, v) }},
+	{"p2p_peers", "P2P_PEERS", "Comma separated host:port list of peer to peer nodes to connect to", CHAIN_SERVER, false,
+		func(c *Config) string { return strings.Join(c.P2P.Peers, ",") },
+		func(c *Config, v string) error { c.P2P.Peers = splitList(v); return nil }},
+	{"p2p_seeds", "P2P_SEEDS", "Comma separated host:port list of seed nodes to learn peer addresses from", CHAIN_SERVER, false,
+		func(c *Config) string { return strings.Join(c.P2P.Seeds, ",") },
+		func(c *Config, v string) error { c.P2P.Seeds = splitList(v); return nil }},
+	{"p2p_allowed_nodes", "P2P_ALLOWED_NODES", "Comma separated node IDs allowed to connect, any when empty", CHAIN_SERVER, false,
+		func(c *Config) string { return strings.Join(c.P2P.AllowedNodes, ",") },
+		func(c *Config, v string) error { c.P2P.AllowedNodes = splitList(v); return nil }},
+	{"tls_cert", "CHAIN_TLS_CERT", "PEM certificate to serve HTTPS", CHAIN_SERVER, false,
+		func(c *Config) string { return c.Chain.TLS.CertFile },
+		func(c *Config, v string) error { c.Chain.TLS.CertFile = v; return nil }},
+	{"tls_key", "CHAIN_TLS_KEY", "PEM private key of the HTTPS certificate", CHAIN_SERVER, false,
+		func(c *Config) string { return c.Chain.TLS.KeyFile },
+		func(c *Config, v string) error { c.Chain.TLS.KeyFile = v; return nil }},
+	{"p2p_max_inbound", "P2P_MAX_INBOUND", "Maximum number of inbound peers (default 32)", CHAIN_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(c.P2P.MaxInbound) },
+		func(c *Config, v string) error { return setInt(&c.P2P.MaxInbound, v) }},
+	{"p2p_outbound", "P2P_TARGET_OUTBOUND", "Number of outbound peers to maintain (default 8)", CHAIN_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(c.P2P.TargetOutbound) },
+		func(c *Config, v string) error { return setInt(&c.P2P.TargetOutbound, v) }},
+	{"p2p_ban_sec", "P2P_BAN_SEC", "Seconds a misbehaving peer stays banned (default 86400)", CHAIN_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(c.P2P.BanSec) },
+		func(c *Config, v string) error { return setInt(&c.P2P.BanSec, v) }},
+	{"mining", "MINING_ENABLED", "Mine blocks on this node", CHAIN_SERVER, true,
+		func(c *Config) string { return strconv.FormatBool(c.Mining.Enabled) },
+		func(c *Config, v string) error { return setBool(&c.Mining.Enabled, v) }},
+	{"mining_threads", "MINING_THREADS", "Number of proof of work worker threads", CHAIN_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(c.Mining.Threads) },
+		func(c *Config, v string) error { return setInt(&c.Mining.Threads, v) }},
+	{"mining_address", "MINING_ADDRESS", "Wallet address receiving the mining rewards", CHAIN_SERVER, false,
+		func(c *Config) string { return c.Mining.Address },
+		func(c *Config, v string) error { c.Mining.Address = v; return nil }},
+	{"mining_mode", "MINING_MODE", "Mining schedule: interval or continuous", CHAIN_SERVER, false,
+		func(c *Config) string { return c.Mining.Mode },
+		func(c *Config, v string) error { c.Mining.Mode = v; return nil }},
+	{"mining_interval", "MINING_INTERVAL_SEC", "Seconds between interval mining rounds, 0 for the network default", CHAIN_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(c.Mining.IntervalSec) },
+		func(c *Config, v string) error { return setInt(&c.Mining.IntervalSec, v) }},
+	{"admin_token", "ADMIN_TOKEN", "Bearer token required by the admin endpoints", CHAIN_SERVER | CLI, false,
+		func(c *Config) string { return "" },
+		func(c *Config, v string) error { c.Admin.Token = v; return nil }},
+	{"mining_key_file", "MINING_KEY_FILE", "Encrypted miner wallet used when no mining address is set", CHAIN_SERVER, false,
+		func(c *Config) string { return c.Mining.KeyFile },
+		func(c *Config, v string) error { c.Mining.KeyFile = v; return nil }},
+	{"storage", "STORAGE_BACKEND", "Storage backend: memory, postgres or mongodb", CHAIN_SERVER, false,
+		func(c *Config) string { return c.Storage.Backend },
+		func(c *Config, v string) error { c.Storage.Backend = v; return nil }},
+	{"storage_uri", "STORAGE_URI", "Connection string of the storage backend", CHAIN_SERVER, false,
+		func(c *Config) string { return c.Storage.URI },
+		func(c *Config, v string) error { c.Storage.URI = v; return nil }},
+	{"port", "WALLET_PORT", "TCP Port Number for Wallet Server", WALLET_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(int(c.Wallet.Port)) },
+		func(c *Config, v string) error { return setPort(&c.Wallet.Port, v) }},
+	{"node", "WALLET_NODE", "Blockchain Node", WALLET_SERVER, false,
+		func(c *Config) string { return c.Wallet.Node },
+		func(c *Config, v string) error { c.Wallet.Node = v; return nil }},
+	{"node_port", "WALLET_NODE_PORT", "Blockchain Node Port", WALLET_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(int(c.Wallet.NodePort)) },
+		func(c *Config, v string) error { return setPort(&c.Wallet.NodePort, v) }},
+	{"tls_cert", "WALLET_TLS_CERT", "PEM certificate to serve HTTPS", WALLET_SERVER, false,
+		func(c *Config) string { return c.Wallet.TLS.CertFile },
+		func(c *Config, v string) error { c.Wallet.TLS.CertFile = v; return nil }},
+	{"tls_key", "WALLET_TLS_KEY", "PEM private key of the HTTPS certificate", WALLET_SERVER, false,
+		func(c *Config) string { return c.Wallet.TLS.KeyFile },
+		func(c *Config, v string) error { c.Wallet.TLS.KeyFile = v; return nil }},
+	{"node_tls", "WALLET_NODE_TLS", "Connect to the node over HTTPS", WALLET_SERVER, true,
+		func(c *Config) string { return strconv.FormatBool(c.Wallet.NodeTLS) },
+		func(c *Config, v string) error { return setBool(&c.Wallet.NodeTLS, v) }},
+	{"node_ca", "WALLET_NODE_CA", "PEM certificate authority of the node (default system ones)", WALLET_SERVER, false,
+		func(c *Config) string { return c.Wallet.NodeCA },
+		func(c *Config, v string) error { c.Wallet.NodeCA = v; return nil }},
+	{"fallback_nodes", "WALLET_FALLBACK_NODES", "Comma separated host:port list of nodes called when the node fails", WALLET_SERVER, false,
+		func(c *Config) string { return strings.Join(c.Wallet.FallbackNodes, ",") },
+		func(c *Config, v string) error { c.Wallet.FallbackNodes = splitList(v); return nil }},
+	{"port", "POOL_PORT", "TCP Port Number for Pool Server", POOL_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(int(c.Pool.Port)) },
+		func(c *Config, v string) error { return setPort(&c.Pool.Port, v) }},
+	{"node", "POOL_NODE", "Blockchain Node", POOL_SERVER, false,
+		func(c *Config) string { return c.Pool.Node },
+		func(c *Config, v string) error { c.Pool.Node = v; return nil }},
+	{"node_port", "POOL_NODE_PORT", "Blockchain Node Port", POOL_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(int(c.Pool.NodePort)) },
+		func(c *Config, v string) error { return setPort(&c.Pool.NodePort, v) }},
+	{"node_tls", "POOL_NODE_TLS", "Connect to the node over HTTPS", POOL_SERVER, true,
+		func(c *Config) string { return strconv.FormatBool(c.Pool.NodeTLS) },
+		func(c *Config, v string) error { return setBool(&c.Pool.NodeTLS, v) }},
+	{"node_ca", "POOL_NODE_CA", "PEM certificate authority of the node (default system ones)", POOL_SERVER, false,
+		func(c *Config) string { return c.Pool.NodeCA },
+		func(c *Config, v string) error { c.Pool.NodeCA = v; return nil }},
+	{"share_difficulty", "POOL_SHARE_DIFFICULTY", "Leading hex zeros required by a share", POOL_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(c.Pool.ShareDifficulty) },
+		func(c *Config, v string) error { return setInt(&c.Pool.ShareDifficulty, v) }},
+	{"scheme", "POOL_SCHEME", "Payout scheme: pplns or proportional", POOL_SERVER, false,
+		func(c *Config) string { return c.Pool.Scheme },
+		func(c *Config, v string) error { c.Pool.Scheme = v; return nil }},
+	{"window", "POOL_WINDOW", "Number of last shares paid by the pplns scheme", POOL_SERVER, false,
+		func(c *Config) string { return strconv.Itoa(c.Pool.Window) },
+		func(c *Config, v string) error { return setInt(&c.Pool.Window, v) }},
+	{"fee", "POOL_FEE", "Fraction of the block reward kept by the pool", POOL_SERVER, false,
+		func(c *Config) string { return strconv.FormatFloat(float64(c.Pool.Fee), 'f', -1, 32) },
+		func(c *Config, v string) error { return setFloat32(&c.Pool.Fee, v) }},
+	{"pool_key_file", "POOL_KEY_FILE", "Encrypted wallet paying the pool workers", POOL_SERVER, false,
+		func(c *Config) string { return c.Pool.KeyFile },
+		func(c *Config, v string) error { c.Pool.KeyFile = v; return nil }},
+	{"node", "CLI_NODES", "Comma separated base URLs of the nodes, the next ones called when the first fails", CLI, false,
+		func(c *Config) string { return strings.Join(c.CLI.Nodes, ",") },
+		func(c *Config, v string) error { c.CLI.Nodes = splitList(v); return nil }},
+	{"node_ca", "CLI_NODE_CA", "PEM certificate authority of the https nodes (default system ones)", CLI, false,
+		func(c *Config) string { return c.CLI.NodeCA },
+		func(c *Config, v string) error { c.CLI.NodeCA = v; return nil }},
+	{"log_level", "LOG_LEVEL", "Log level: debug, info, warn or error", CHAIN_SERVER | WALLET_SERVER | POOL_SERVER, false,
+		func(c *Config) string { return c.Log.Level },
+		func(c *Config, v string) error { c.Log.Level = v; return nil }},
+	{"log_file", "LOG_FILE", "Append logs to this file instead of stderr", CHAIN_SERVER | WALLET_SERVER | POOL_SERVER, false,
+		func(c *Config) string { return c.Log.File },
+		func(c *Config, v string) error { c.Log.File = v; return nil }},
+}
+
+// flagValue records the raw command line value, it is applied to the
+// configuration only once the file and the environment have been loaded
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (f *flagValue) String() string     { return f.value }
+func (f *flagValue) Set(v string) error { f.value = v; return nil }
+func (f *flagValue) IsBoolFlag() bool   { return f.isBool }
+
+// Load builds the configuration of server out of, in increasing order of
+// precedence: the defaults, the file named by -config (or MOVIECOIN_CONFIG),
+// the MOVIECOIN_* environment variables and the flags found in args.
+func Load(server Server, name string, args []string) (*Config, error) {
+	cfg, _, err := LoadArgs(server, name, args)
+	return cfg, err
+}
+
+// LoadArgs is Load also returning the arguments following the flags, the
+// command of the command line tool
+func LoadArgs(server Server, name string, args []string) (*Config, []string, error) {
+	defaults := Default()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(CONFIG_ENV_PREFIX+"CONFIG"), "Path of a JSON configuration file")
+	byFlag := make(map[string]option)
+	for _, o := range options {
+		if o.servers&server == 0 {
+			continue
+		}
+		byFlag[o.flag] = o
+		usage := fmt.Sprintf("%s (env %s%s)", o.usage, CONFIG_ENV_PREFIX, o.env)
+		fs.Var(&flagValue{value: o.get(defaults), isBool: o.isBool}, o.flag, usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := defaults
+	if *configFile != "" {
+		if err := cfg.LoadFile(*configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, o := range byFlag {
+		v, ok := os.LookupEnv(CONFIG_ENV_PREFIX + o.env)
+		if !ok {
+			continue
+		}
+		if err := o.set(cfg, v); err != nil {
+			return nil, nil, fmt.Errorf("environment variable %s%s: %v", CONFIG_ENV_PREFIX, o.env, err)
+		}
+	}
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		o, ok := byFlag[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		if e := o.set(cfg, f.Value.String()); e != nil {
+			err = fmt.Errorf("flag -%s: %v", f.Name, e)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cfg.Validate(server); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+func setPort(p *uint16, v string) error {
+	n, err := strconv.ParseUint(v, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", v)
+	}
+	*p = uint16(n)
+	return nil
+}
+
+func setInt(p *int, v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", v)
+	}
+	*p = n
+	return nil
+}
+
+func setFloat32(p *float32, v string) error {
+	f, err := strconv.ParseFloat(v, 32)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", v)
+	}
+	*p = float32(f)
+	return nil
+}
+
+func setBool(p *bool, v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", v)
+	}
+	*p = b
+	return nil
+}
+
+func splitList(v string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// ParseCommand recognizes the "config dump" command in front of the flags.
+// It reports whether the command was given and returns the remaining args.
+func ParseCommand(args []string) (dump bool, rest []string) {
+	if len(args) >= 2 && args[0] == "config" && args[1] == "dump" {
+		return true, args[2:]
+	}
+	return false, args
+}
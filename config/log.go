@@ -0,0 +1,95 @@
+package config
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+)
+
+const (
+	LOG_DEBUG = "debug"
+	LOG_INFO  = "info"
+	LOG_WARN  = "warn"
+	LOG_ERROR = "error"
+)
+
+var logLevels = map[string]int{
+	LOG_DEBUG: 0,
+	LOG_INFO:  1,
+	LOG_WARN:  2,
+	LOG_ERROR: 3,
+}
+
+// levelWriter drops log lines below the configured level. Lines are
+// classified by the marker starting the message ("ERROR:", "WARN:",
+// "DEBUG:"); anything else is informational.
+type levelWriter struct {
+	out   io.Writer
+	level int
+}
+
+var levelMarkers = []struct {
+	marker []byte
+	level  string
+}{
+	{[]byte("ERROR:"), LOG_ERROR},
+	{[]byte("WARN:"), LOG_WARN},
+	{[]byte("DEBUG:"), LOG_DEBUG},
+}
+
+func lineLevel(p []byte) int {
+	message := logMessage(p)
+	for _, m := range levelMarkers {
+		if bytes.HasPrefix(message, m.marker) {
+			return logLevels[m.level]
+		}
+	}
+	return logLevels[LOG_INFO]
+}
+
+// logMessage strips the header the standard logger writes before the
+// message: its prefix, the date, the time and the file, as set by its flags
+func logMessage(p []byte) []byte {
+	flags, prefix := log.Flags(), []byte(log.Prefix())
+	if flags&log.Lmsgprefix == 0 {
+		p = bytes.TrimPrefix(p, prefix)
+	}
+	if flags&log.Ldate != 0 {
+		_, p, _ = bytes.Cut(p, []byte(" "))
+	}
+	if flags&(log.Ltime|log.Lmicroseconds) != 0 {
+		_, p, _ = bytes.Cut(p, []byte(" "))
+	}
+	if flags&(log.Lshortfile|log.Llongfile) != 0 {
+		_, p, _ = bytes.Cut(p, []byte(": "))
+	}
+	if flags&log.Lmsgprefix != 0 {
+		p = bytes.TrimPrefix(p, prefix)
+	}
+	return p
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	if lineLevel(p) < w.level {
+		// pretend the line was written, log.Logger treats short writes as errors
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+// SetupLogging points the standard logger at the configured file and level.
+// The returned closer releases the log file, if any.
+func (l LogConfig) SetupLogging() (io.Closer, error) {
+	var out io.Writer = os.Stderr
+	var closer io.Closer = io.NopCloser(nil)
+	if l.File != "" {
+		f, err := os.OpenFile(l.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		out, closer = f, f
+	}
+	log.SetOutput(&levelWriter{out, logLevels[l.Level]})
+	return closer, nil
+}
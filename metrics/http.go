@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTP counts the requests of a server and times them. The handler label is
+// the pattern of the http.ServeMux which served the request, "/api/v1/" for
+// every route of the JSON API, so that the paths of the clients cannot grow
+// the number of series.
+type HTTP struct {
+	requests *Counter
+	duration *Histogram
+}
+
+func NewHTTP(r *Registry) *HTTP {
+	return &HTTP{
+		requests: r.NewCounter("http_requests_total", "HTTP requests served.", "handler", "method", "code"),
+		duration: r.NewHistogram("http_request_duration_seconds", "Time spent serving HTTP requests, streams until they end.",
+			DURATION_BUCKETS, "handler", "method"),
+	}
+}
+
+// Instrument wraps a http.ServeMux
+func (h *HTTP) Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, req)
+		handler := req.Pattern
+		if handler == "" {
+			handler = "none"
+		}
+		method := req.Method
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+			http.MethodDelete, http.MethodOptions:
+		default:
+			method = "other"
+		}
+		code := rw.status
+		if code == 0 {
+			code = http.StatusOK
+		}
+		h.requests.Inc(handler, method, strconv.Itoa(code))
+		h.duration.ObserveDuration(start, handler, method)
+	})
+}
+
+// responseWriter records the status code. It keeps the Flush of the event
+// streams and the Hijack of the WebSocket upgrades working.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("metrics: the connection cannot be hijacked")
+	}
+	if rw.status == 0 {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
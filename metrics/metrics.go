@@ -0,0 +1,265 @@
+// Package metrics exports counters, gauges and histograms in the text format
+// of Prometheus, so that the servers can be scraped without pulling in the
+// Prometheus client.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CONTENT_TYPE of the text exposition format
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// DURATION_BUCKETS are the upper bounds, in seconds, of the histograms of
+// durations: from a block check to a slow HTTP request
+var DURATION_BUCKETS = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5}
+
+// Types of the metric families
+const (
+	TYPE_COUNTER   = "counter"
+	TYPE_GAUGE     = "gauge"
+	TYPE_HISTOGRAM = "histogram"
+)
+
+// Registry holds the metrics of a server, their names prefixed with its
+// namespace. It is safe for concurrent use.
+type Registry struct {
+	namespace string
+	mux       sync.Mutex
+	families  []*family
+}
+
+func NewRegistry(namespace string) *Registry {
+	return &Registry{namespace: namespace}
+}
+
+// family is a metric and its series, one per combination of label values
+type family struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+	// gauges read when written out, without labels
+	fn func() float64
+
+	mux    sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+	// histograms only: counts per bucket, not cumulated
+	counts []uint64
+	count  uint64
+}
+
+func (r *Registry) register(f *family) *family {
+	if r.namespace != "" {
+		f.name = r.namespace + "_" + f.name
+	}
+	f.series = make(map[string]*series)
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, other := range r.families {
+		if other.name == f.name {
+			panic("metrics: " + f.name + " registered twice")
+		}
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+// get returns the series of the label values, created on first use
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if f.typ == TYPE_HISTOGRAM {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter only goes up, from zero when the server starts
+type Counter struct{ f *family }
+
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{r.register(&family{name: name, help: help, typ: TYPE_COUNTER, labels: labels})}
+}
+
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("metrics: " + c.f.name + " decreased")
+	}
+	c.f.mux.Lock()
+	defer c.f.mux.Unlock()
+	c.f.get(values).value += v
+}
+
+// Gauge is a value which goes up and down
+type Gauge struct{ f *family }
+
+func (r *Registry) NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(&family{name: name, help: help, typ: TYPE_GAUGE, labels: labels})}
+}
+
+func (g *Gauge) Set(v float64, values ...string) {
+	g.f.mux.Lock()
+	defer g.f.mux.Unlock()
+	g.f.get(values).value = v
+}
+
+// NewGaugeFunc registers a gauge read from fn whenever the metrics are
+// written out, for the values the server already keeps
+func (r *Registry) NewGaugeFunc(name string, help string, fn func() float64) {
+	r.register(&family{name: name, help: help, typ: TYPE_GAUGE, fn: fn})
+}
+
+// Histogram counts observations in buckets of increasing upper bounds
+type Histogram struct{ f *family }
+
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{r.register(&family{name: name, help: help, typ: TYPE_HISTOGRAM, labels: labels, buckets: buckets})}
+}
+
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.f.mux.Lock()
+	defer h.f.mux.Unlock()
+	s := h.f.get(values)
+	if i := sort.SearchFloat64s(h.f.buckets, v); i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.count++
+	s.value += v
+}
+
+// ObserveDuration observes the seconds elapsed since start
+func (h *Histogram) ObserveDuration(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+// WriteTo writes the metrics out in the text format, the series of a
+// family sorted by label values
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mux.Lock()
+	families := append([]*family(nil), r.families...)
+	r.mux.Unlock()
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (f *family) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escape(f.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	if f.fn != nil {
+		fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+		return
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.typ != TYPE_HISTOGRAM {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelSet(s.values, ""), formatFloat(s.value))
+			continue
+		}
+		var cumulated uint64
+		for i, bound := range f.buckets {
+			cumulated += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelSet(s.values, formatFloat(bound)), cumulated)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelSet(s.values, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labelSet(s.values, ""), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labelSet(s.values, ""), s.count)
+	}
+}
+
+// labelSet formats {name="value",...}, with the le label of the histogram
+// buckets when le is not empty
+func (f *family) labelSet(values []string, le string) string {
+	var pairs []string
+	for i, name := range f.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escape(values[i], true)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf(`le="%s"`, le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string, quote bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quote {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// ServeHTTP answers the scrapes of Prometheus
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	r.WriteTo(w)
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry("test")
+	c := r.NewCounter("requests_total", "Requests.", "code")
+	c.Inc("200")
+	c.Add(2, "200")
+	c.Inc(`5"0\0`)
+	r.NewGaugeFunc("height", "Height\nof the chain.", func() float64 { return 42 })
+	h := r.NewHistogram("latency_seconds", "Latency.", []float64{1, .125})
+	h.Observe(.0625)
+	h.Observe(.125)
+	h.Observe(3)
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 3
+test_requests_total{code="5\"0\\0"} 1
+# HELP test_height Height\nof the chain.
+# TYPE test_height gauge
+test_height 42
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.125"} 2
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 3.1875
+test_latency_seconds_count 3
+`
+	if b.String() != expected {
+		t.Errorf("metrics\n%s\nexpected\n%s", b.String(), expected)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry("")
+	g := r.NewGauge("peers", "Peers.")
+	for _, f := range []func(){
+		func() { r.NewCounter("peers", "Again.") },
+		func() { g.Set(1, "extra") },
+		func() { r.NewCounter("total", "Total.").Add(-1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	r := NewRegistry("test")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blocks/", func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("Flusher lost")
+		}
+		if _, ok := w.(http.Hijacker); !ok {
+			t.Error("Hijacker lost")
+		}
+		if req.URL.Path == "/blocks/missing" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	handler := NewHTTP(r).Instrument(mux)
+	for _, path := range []string{"/blocks/1", "/blocks/2", "/blocks/missing", "/other"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/blocks/1", nil))
+
+	var b strings.Builder
+	r.WriteTo(&b)
+	for _, line := range []string{
+		`test_http_requests_total{handler="/blocks/",method="GET",code="200"} 2`,
+		`test_http_requests_total{handler="/blocks/",method="GET",code="404"} 1`,
+		`test_http_requests_total{handler="/blocks/",method="other",code="200"} 1`,
+		`test_http_requests_total{handler="none",method="GET",code="404"} 1`,
+		`test_http_request_duration_seconds_count{handler="/blocks/",method="GET"} 3`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing %s in\n%s", line, b.String())
+		}
+	}
+}
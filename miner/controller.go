@@ -0,0 +1,172 @@
+package miner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"moviecoin/blockchain"
+	"sync"
+	"time"
+)
+
+// Mining schedules
+const (
+	// MODE_INTERVAL mines the pending transactions every interval
+	MODE_INTERVAL = "interval"
+	// MODE_CONTINUOUS mines as soon as there are pending transactions
+	MODE_CONTINUOUS = "continuous"
+)
+
+type Schedule struct {
+	Mode     string        `json:"mode"`
+	Interval time.Duration `json:"-"`
+}
+
+func (s Schedule) Validate() error {
+	switch s.Mode {
+	case MODE_CONTINUOUS:
+	case MODE_INTERVAL:
+		if s.Interval <= 0 {
+			return fmt.Errorf("interval mining needs a positive interval")
+		}
+	default:
+		return fmt.Errorf("mining mode %q is not one of %s, %s", s.Mode, MODE_INTERVAL, MODE_CONTINUOUS)
+	}
+	return nil
+}
+
+type Status struct {
+	Running     bool       `json:"running"`
+	Mode        string     `json:"mode"`
+	IntervalSec float64    `json:"interval_sec"`
+	Threads     int        `json:"threads"`
+	HashRate    float64    `json:"hash_rate"`
+	CurrentJob  *JobStatus `json:"current_job"`
+	BlocksFound int        `json:"blocks_found"`
+	LastBlock   string     `json:"last_block"`
+}
+
+// Controller runs a miner on a blockchain according to a schedule. Start and
+// Stop are idempotent: a single mining loop runs at any time.
+type Controller struct {
+	miner *Miner
+	bc    *blockchain.Blockchain
+
+	mux      sync.Mutex
+	schedule Schedule
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewController(m *Miner, bc *blockchain.Blockchain, schedule Schedule) *Controller {
+	return &Controller{miner: m, bc: bc, schedule: schedule}
+}
+
+func (c *Controller) Miner() *Miner {
+	return c.miner
+}
+
+// Start launches the mining loop. Starting a running controller only
+// changes its schedule when a different one is given.
+func (c *Controller) Start(schedule Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	if c.bc.MinerAddress() == "" {
+		return ErrNoPayoutAddress
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.cancel != nil {
+		if c.schedule == schedule {
+			return nil
+		}
+		c.stop()
+	}
+	c.schedule = schedule
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel, c.done = cancel, make(chan struct{})
+	go c.loop(ctx, schedule, c.done)
+	log.Printf("Mining started (%s)", schedule.Mode)
+	return nil
+}
+
+// Stop aborts the current job and waits for the mining loop to exit
+func (c *Controller) Stop() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.cancel != nil {
+		c.stop()
+		log.Println("Mining stopped")
+	}
+}
+
+// stop must be called with c.mux held
+func (c *Controller) stop() {
+	c.cancel()
+	<-c.done
+	c.cancel, c.done = nil, nil
+}
+
+func (c *Controller) Running() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.cancel != nil
+}
+
+func (c *Controller) Status() *Status {
+	c.mux.Lock()
+	running, schedule := c.cancel != nil, c.schedule
+	c.mux.Unlock()
+	blocks, last := c.miner.BlocksFound()
+	return &Status{
+		Running:     running,
+		Mode:        schedule.Mode,
+		IntervalSec: schedule.Interval.Seconds(),
+		Threads:     c.miner.Threads(),
+		HashRate:    c.miner.HashRate(),
+		CurrentJob:  c.miner.CurrentJob(),
+		BlocksFound: blocks,
+		LastBlock:   last,
+	}
+}
+
+func (c *Controller) loop(ctx context.Context, schedule Schedule, done chan struct{}) {
+	defer close(done)
+	for c.wait(ctx, schedule) {
+		// Transaction pool must contain transactions in order to mine
+		if len(c.bc.TransactionPool()) == 0 {
+			if schedule.Mode == MODE_INTERVAL {
+				log.Println(":( Nothing to mine ... Taking a nap (zzz.zz.z)")
+			}
+			continue
+		}
+		if _, err := c.miner.MineBlock(ctx, c.bc); err != nil && ctx.Err() == nil {
+			log.Printf("ERROR: mining failed: %v", err)
+		}
+	}
+}
+
+// wait blocks until the next mining round. It returns false once ctx is done.
+func (c *Controller) wait(ctx context.Context, schedule Schedule) bool {
+	if schedule.Mode == MODE_CONTINUOUS {
+		changed := c.bc.Changed()
+		if len(c.bc.TransactionPool()) > 0 {
+			return ctx.Err() == nil
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+			return true
+		}
+	}
+	timer := time.NewTimer(schedule.Interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
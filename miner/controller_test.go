@@ -0,0 +1,74 @@
+package miner
+
+import (
+	"moviecoin/blockchain"
+	"moviecoin/params"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestControllerContinuous(t *testing.T) {
+	bc := blockchain.NewBlockchain(minerAddress, params.Regtest)
+	fund(t, bc)
+	c := NewController(NewMiner(2), bc, Schedule{Mode: MODE_CONTINUOUS})
+	continuous := Schedule{Mode: MODE_CONTINUOUS}
+	if err := c.Start(continuous); err != nil {
+		t.Fatal(err)
+	}
+	// starting again is a no-op
+	if err := c.Start(continuous); err != nil {
+		t.Fatal(err)
+	}
+	pay(t, bc)
+	waitFor(t, "the transaction to be mined", func() bool { return bc.Height() == 2 })
+	// no transactions, no blocks
+	time.Sleep(20 * time.Millisecond)
+	if bc.Height() != 2 {
+		t.Fatalf("height %d, empty blocks mined", bc.Height())
+	}
+	status := c.Status()
+	if !status.Running || status.BlocksFound != 1 || status.Mode != MODE_CONTINUOUS {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	c.Stop()
+	c.Stop()
+	if c.Running() {
+		t.Fatal("controller still running after Stop")
+	}
+	pay(t, bc)
+	time.Sleep(20 * time.Millisecond)
+	if bc.Height() != 2 {
+		t.Fatal("stopped controller kept mining")
+	}
+}
+
+func TestControllerReschedule(t *testing.T) {
+	bc := blockchain.NewBlockchain(minerAddress, params.Regtest)
+	fund(t, bc)
+	c := NewController(NewMiner(1), bc, Schedule{Mode: MODE_INTERVAL, Interval: time.Hour})
+	if err := c.Start(Schedule{Mode: MODE_INTERVAL, Interval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	pay(t, bc)
+	if err := c.Start(Schedule{Mode: MODE_INTERVAL, Interval: 10 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the new schedule to mine", func() bool { return bc.Height() == 2 })
+	if got := c.Status().IntervalSec; got != 0.01 {
+		t.Fatalf("interval %v, expected the new schedule", got)
+	}
+	c.Stop()
+	if err := c.Start(Schedule{Mode: "sometimes"}); err == nil {
+		t.Fatal("invalid schedule accepted")
+	}
+}
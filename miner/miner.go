@@ -0,0 +1,179 @@
+package miner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"log"
+	"math"
+	"moviecoin/blockchain"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	MAX_NONCE = math.MaxUint32
+	// workers check for cancellation every HASH_BATCH hashes
+	HASH_BATCH = 1 << 12
+)
+
+var ErrNonceSpaceExhausted = errors.New("nonce and extra nonce spaces exhausted")
+
+// ErrNoPayoutAddress refuses to mine blocks whose reward would be lost
+var ErrNoPayoutAddress = errors.New("no address to pay the mining rewards to")
+
+// Miner searches proofs of work with a pool of worker goroutines. Each
+// worker tries every threads-th nonce; when the whole nonce space has been
+// tried the extra nonce is incremented and the search starts over.
+type Miner struct {
+	threads  int
+	maxNonce uint32
+
+	hashes      uint64 // hashes computed by the current job, updated atomically
+	mux         sync.Mutex
+	started     time.Time
+	rate        float64 // hashes per second of the last finished job
+	running     bool
+	job         *JobStatus
+	blocksFound int
+	lastBlock   string
+}
+
+// JobStatus describes the block being mined
+type JobStatus struct {
+	Height       int       `json:"height"`
+	PreviousHash string    `json:"previous_hash"`
+	Transactions int       `json:"transactions"`
+	Started      time.Time `json:"started"`
+}
+
+func NewMiner(threads int) *Miner {
+	if threads < 1 {
+		threads = 1
+	}
+	return &Miner{threads: threads, maxNonce: MAX_NONCE}
+}
+
+func (m *Miner) Threads() int {
+	return m.threads
+}
+
+// HashRate reports the hashes per second of the running job, or of the last
+// one when idle
+func (m *Miner) HashRate() float64 {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if !m.running {
+		return m.rate
+	}
+	return hashRate(atomic.LoadUint64(&m.hashes), time.Since(m.started))
+}
+
+// CurrentJob returns the block being mined, nil when idle
+func (m *Miner) CurrentJob() *JobStatus {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.job
+}
+
+// BlocksFound returns the number of blocks this miner added to the chain and
+// the hash of the last one
+func (m *Miner) BlocksFound() (int, string) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.blocksFound, m.lastBlock
+}
+
+func hashRate(hashes uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(hashes) / elapsed.Seconds()
+}
+
+// Solve looks for nonces giving b a hash with difficulty leading hex zeros and
+// records them into b. It returns ctx.Err() when the job is cancelled.
+func (m *Miner) Solve(ctx context.Context, b *blockchain.Block, difficulty int) error {
+	m.mux.Lock()
+	m.running, m.started = true, time.Now()
+	atomic.StoreUint64(&m.hashes, 0)
+	m.mux.Unlock()
+	defer func() {
+		m.mux.Lock()
+		m.running = false
+		m.rate = hashRate(atomic.LoadUint64(&m.hashes), time.Since(m.started))
+		m.mux.Unlock()
+	}()
+
+	header := b.Header()
+	for extraNonce := header.ExtraNonce; ; extraNonce++ {
+		header.ExtraNonce = extraNonce
+		nonce, found := m.search(ctx, header, difficulty)
+		if found {
+			b.SetNonces(nonce, extraNonce)
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if extraNonce == math.MaxUint32 {
+			return ErrNonceSpaceExhausted
+		}
+		log.Printf("Nonce space exhausted, rolling extra nonce over to %d", extraNonce+1)
+	}
+}
+
+// search spreads the nonce space of header over the workers
+func (m *Miner) search(ctx context.Context, header *blockchain.Header, difficulty int) (uint32, bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		solution uint32
+		found    bool
+	)
+	buf := header.Bytes()
+	for i := 0; i < m.threads; i++ {
+		wg.Add(1)
+		go func(start uint32) {
+			defer wg.Done()
+			if nonce, ok := m.work(ctx, buf, start, difficulty); ok {
+				once.Do(func() {
+					solution, found = nonce, true
+					// stop the other workers
+					cancel()
+				})
+			}
+		}(uint32(i))
+	}
+	wg.Wait()
+	return solution, found
+}
+
+// work tries nonces start, start+threads, ... up to maxNonce
+func (m *Miner) work(ctx context.Context, header []byte, start uint32, difficulty int) (uint32, bool) {
+	buf := make([]byte, len(header))
+	copy(buf, header)
+	step := uint64(m.threads)
+	var count uint64
+	for nonce := uint64(start); nonce <= uint64(m.maxNonce); nonce += step {
+		binary.BigEndian.PutUint32(buf[blockchain.HEADER_SIZE-4:], uint32(nonce))
+		if blockchain.MeetsDifficulty(sha256.Sum256(buf), difficulty) {
+			atomic.AddUint64(&m.hashes, count+1)
+			return uint32(nonce), true
+		}
+		count++
+		if count == HASH_BATCH {
+			atomic.AddUint64(&m.hashes, count)
+			count = 0
+			if ctx.Err() != nil {
+				return 0, false
+			}
+		}
+	}
+	atomic.AddUint64(&m.hashes, count)
+	return 0, false
+}
@@ -0,0 +1,127 @@
+package miner
+
+import (
+	"context"
+	"moviecoin/blockchain"
+	"moviecoin/params"
+	"moviecoin/wallet"
+	"testing"
+	"time"
+)
+
+const minerAddress = "miner"
+
+// fund mines a block paying the reward to minerAddress
+func fund(t *testing.T, bc *blockchain.Blockchain) {
+	if _, err := NewMiner(1).Generate(bc, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pay has minerAddress pay a coin to alice
+func pay(t *testing.T, bc *blockchain.Blockchain) {
+	w := wallet.NewWallet(bc.Network())
+	tx := wallet.NewTransaction(w.PrivateKey(), w.PublicKey(), minerAddress, "alice", 1)
+	if !bc.AddTransaction(minerAddress, "alice", 1, w.PublicKey(), tx.GenerateSignature()) {
+		t.Fatal("payment refused")
+	}
+}
+
+func TestSolve(t *testing.T) {
+	bc := blockchain.NewBlockchain(minerAddress, params.Regtest)
+	for _, threads := range []int{1, 4} {
+		m := NewMiner(threads)
+		b, _ := bc.NewBlockTemplate(minerAddress)
+		if err := m.Solve(context.Background(), b, 3); err != nil {
+			t.Fatal(err)
+		}
+		if !blockchain.ValidProof(b.Header(), 3) {
+			t.Fatalf("%d threads: solution does not meet the difficulty", threads)
+		}
+		if m.HashRate() <= 0 {
+			t.Errorf("%d threads: no hash rate reported", threads)
+		}
+	}
+}
+
+func TestSolveCancel(t *testing.T) {
+	bc := blockchain.NewBlockchain(minerAddress, params.Regtest)
+	b, _ := bc.NewBlockTemplate(minerAddress)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// 64 hex zeros can not be found
+	if err := NewMiner(2).Solve(ctx, b, 64); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, expected the job to be cancelled", err)
+	}
+}
+
+func TestExtraNonceRollover(t *testing.T) {
+	bc := blockchain.NewBlockchain(minerAddress, params.Regtest)
+	m := NewMiner(2)
+	// a tiny nonce space forces the search to roll the extra nonce over
+	m.maxNonce = 3
+	b, _ := bc.NewBlockTemplate(minerAddress)
+	if err := m.Solve(context.Background(), b, 2); err != nil {
+		t.Fatal(err)
+	}
+	if b.Nonce() > 3 {
+		t.Fatalf("nonce %d out of the nonce space", b.Nonce())
+	}
+	if b.ExtraNonce() == 0 {
+		t.Skip("solution found without rolling over, extremely unlikely")
+	}
+	if !blockchain.ValidProof(b.Header(), 2) {
+		t.Fatal("solution does not meet the difficulty")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	bc := blockchain.NewBlockchain(minerAddress, params.Regtest)
+	blocks, err := NewMiner(2).Generate(bc, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 5 || len(bc.Chain()) != 6 {
+		t.Fatalf("generated %d blocks, chain length %d", len(blocks), len(bc.Chain()))
+	}
+	if !bc.ValidChain(bc.Chain()) {
+		t.Fatal("generated chain does not validate")
+	}
+	if got, want := bc.CalculateTotalAmount(minerAddress), 5*params.Regtest.Reward; got != want {
+		t.Fatalf("miner balance %v, expected %v", got, want)
+	}
+}
+
+func TestNoPayoutAddress(t *testing.T) {
+	bc := blockchain.NewBlockchain("", params.Regtest)
+	if _, err := NewMiner(1).Generate(bc, 1); err != ErrNoPayoutAddress {
+		t.Fatalf("generate: got %v, expected %v", err, ErrNoPayoutAddress)
+	}
+	c := NewController(NewMiner(1), bc, Schedule{Mode: MODE_CONTINUOUS})
+	if err := c.Start(Schedule{Mode: MODE_CONTINUOUS}); err != ErrNoPayoutAddress || c.Running() {
+		t.Fatalf("start: got %v, expected %v", err, ErrNoPayoutAddress)
+	}
+	if bc.Height() != 0 {
+		t.Fatalf("height %d, blocks mined without a payout address", bc.Height())
+	}
+}
+
+func TestMineBlockRestartsOnNewTransactions(t *testing.T) {
+	bc := blockchain.NewBlockchain(minerAddress, params.Regtest)
+	fund(t, bc)
+	m := NewMiner(1)
+	done := make(chan *blockchain.Block)
+	go func() {
+		b, _ := m.MineBlock(context.Background(), bc)
+		done <- b
+	}()
+	pay(t, bc)
+	b := <-done
+	// regtest blocks are found almost instantly, so the transaction may or
+	// may not have made it into the block; the pool must be consistent
+	included := len(b.Transactions()) == 2
+	pending := len(bc.TransactionPool()) == 1
+	if included == pending {
+		t.Fatalf("transaction both included and pending (or neither): %v %v", included, pending)
+	}
+}
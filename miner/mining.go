@@ -0,0 +1,81 @@
+package miner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"moviecoin/blockchain"
+	"time"
+)
+
+// MineBlock mines one block on top of bc and adds it to the chain. The work in
+// progress is dropped and restarted from a fresh template whenever the chain
+// tip changes or new transactions arrive.
+func (m *Miner) MineBlock(ctx context.Context, bc *blockchain.Blockchain) (*blockchain.Block, error) {
+	if bc.MinerAddress() == "" {
+		return nil, ErrNoPayoutAddress
+	}
+	defer m.setJob(nil)
+	for {
+		height := bc.Height() + 1
+		b, changed := bc.NewBlockTemplate(bc.MinerAddress())
+		m.setJob(&JobStatus{
+			Height:       height,
+			PreviousHash: fmt.Sprintf("%x", b.PreviousHash()),
+			Transactions: len(b.Transactions()),
+			Started:      time.Now(),
+		})
+		jobCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-changed:
+				cancel()
+			case <-jobCtx.Done():
+			}
+		}()
+		err := m.Solve(jobCtx, b, bc.Network().Difficulty)
+		cancel()
+		if err == nil {
+			if err := bc.AddBlock(b); err != nil {
+				// a competing block got in first
+				log.Printf("Mined block discarded: %v", err)
+				continue
+			}
+			log.Printf("Mining is done. New block created. (%.0f hash/s)", m.HashRate())
+			m.mux.Lock()
+			m.blocksFound++
+			m.lastBlock = fmt.Sprintf("%x", b.Hash())
+			m.mux.Unlock()
+			bc.AnnounceBlock(b)
+			return b, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != context.Canceled {
+			return nil, err
+		}
+		log.Println("Chain changed, restarting the mining job")
+	}
+}
+
+func (m *Miner) setJob(job *JobStatus) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.job = job
+}
+
+// Generate mines n blocks right away, whether or not there are pending
+// transactions. It is meant for networks generating blocks on demand (regtest)
+// where tests need a predictable chain.
+func (m *Miner) Generate(bc *blockchain.Blockchain, n int) ([]*blockchain.Block, error) {
+	blocks := make([]*blockchain.Block, 0, n)
+	for i := 0; i < n; i++ {
+		b, err := m.MineBlock(context.Background(), bc)
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
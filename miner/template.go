@@ -0,0 +1,156 @@
+package miner
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"moviecoin/blockchain"
+	"strings"
+	"sync"
+)
+
+// MAX_TEMPLATES bounds the number of templates kept for work submission
+const MAX_TEMPLATES = 128
+
+var ErrUnknownTemplate = errors.New("unknown or outdated block template")
+
+// Template is a block handed out to external miners. They search nonces over
+// its header and submit the solution back with the template ID.
+type Template struct {
+	ID         string
+	Height     int
+	Difficulty int
+	Block      *blockchain.Block
+}
+
+// Target renders the difficulty as the highest acceptable block hash
+func Target(difficulty int) string {
+	if difficulty > 64 {
+		difficulty = 64
+	}
+	return strings.Repeat("0", difficulty) + strings.Repeat("f", 64-difficulty)
+}
+
+// Work is the JSON form of a template, as fetched by external miners
+type Work struct {
+	ID           string                    `json:"id"`
+	Height       int                       `json:"height"`
+	Difficulty   int                       `json:"difficulty"`
+	Target       string                    `json:"target"`
+	Timestamp    int64                     `json:"timestamp"`
+	PreviousHash string                    `json:"previous_hash"`
+	MerkleRoot   string                    `json:"merkle_root"`
+	ExtraNonce   uint32                    `json:"extra_nonce"`
+	Header       string                    `json:"header"`
+	Transactions []*blockchain.Transaction `json:"transactions"`
+}
+
+func (t *Template) Work() *Work {
+	header := t.Block.Header()
+	return &Work{
+		ID:           t.ID,
+		Height:       t.Height,
+		Difficulty:   t.Difficulty,
+		Target:       Target(t.Difficulty),
+		Timestamp:    header.Timestamp,
+		PreviousHash: fmt.Sprintf("%x", header.PreviousHash),
+		MerkleRoot:   fmt.Sprintf("%x", header.MerkleRoot),
+		ExtraNonce:   header.ExtraNonce,
+		// miners overwrite the last 8 bytes: extra nonce then nonce, see blockchain.Header
+		Header:       hex.EncodeToString(header.Bytes()),
+		Transactions: t.Block.Transactions(),
+	}
+}
+
+func (t *Template) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Work())
+}
+
+// WorkSubmission is the solution of a template found by an external miner
+type WorkSubmission struct {
+	TemplateID *string `json:"template_id"`
+	Nonce      *uint32 `json:"nonce"`
+	ExtraNonce *uint32 `json:"extra_nonce"`
+}
+
+func (ws *WorkSubmission) Validate() bool {
+	if ws.TemplateID == nil ||
+		ws.Nonce == nil ||
+		ws.ExtraNonce == nil {
+		return false
+	}
+	return true
+}
+
+// TemplateStore remembers the templates handed out to external miners until
+// the chain tip moves past them
+type TemplateStore struct {
+	mux       sync.Mutex
+	templates map[string]*Template
+	order     []string
+	next      uint64
+}
+
+func NewTemplateStore() *TemplateStore {
+	return &TemplateStore{templates: make(map[string]*Template)}
+}
+
+// NewTemplate builds a template extending the tip of bc and paying the
+// mining reward to payoutAddress
+func (s *TemplateStore) NewTemplate(bc *blockchain.Blockchain, payoutAddress string) *Template {
+	b, height := bc.NewHeightTemplate(payoutAddress)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	tip := b.PreviousHash()
+	s.prune(tip)
+	s.next++
+	t := &Template{
+		ID:         fmt.Sprintf("%x-%d", tip[:4], s.next),
+		Height:     height,
+		Difficulty: bc.Network().Difficulty,
+		Block:      b,
+	}
+	s.templates[t.ID] = t
+	s.order = append(s.order, t.ID)
+	return t
+}
+
+// prune drops the templates not extending tip and the oldest ones beyond
+// MAX_TEMPLATES. Callers must hold s.mux
+func (s *TemplateStore) prune(tip [32]byte) {
+	order := s.order[:0]
+	for _, id := range s.order {
+		t := s.templates[id]
+		if t.Block.PreviousHash() != tip {
+			delete(s.templates, id)
+			continue
+		}
+		order = append(order, id)
+	}
+	for len(order) >= MAX_TEMPLATES {
+		delete(s.templates, order[0])
+		order = order[1:]
+	}
+	s.order = order
+}
+
+// Submit applies the nonces of a solution to its template and adds the
+// resulting block to bc. Blocks from the same template may be submitted
+// several times, only the first valid one extends the chain.
+func (s *TemplateStore) Submit(bc *blockchain.Blockchain, ws *WorkSubmission) (*blockchain.Block, error) {
+	s.mux.Lock()
+	t, ok := s.templates[*ws.TemplateID]
+	s.mux.Unlock()
+	if !ok {
+		return nil, ErrUnknownTemplate
+	}
+	b := t.Block.WithNonces(*ws.Nonce, *ws.ExtraNonce)
+	if err := bc.AddBlock(b); err != nil {
+		return nil, err
+	}
+	s.mux.Lock()
+	s.prune(b.Hash())
+	s.mux.Unlock()
+	return b, nil
+}
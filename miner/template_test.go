@@ -0,0 +1,90 @@
+package miner
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"moviecoin/blockchain"
+	"moviecoin/params"
+	"testing"
+)
+
+// solveExternally plays an external miner: it only uses the template JSON
+func solveExternally(t *testing.T, tmpl *Template) *WorkSubmission {
+	m, _ := tmpl.MarshalJSON()
+	var work struct {
+		ID         string `json:"id"`
+		Difficulty int    `json:"difficulty"`
+		Header     string `json:"header"`
+	}
+	if err := json.Unmarshal(m, &work); err != nil {
+		t.Fatal(err)
+	}
+	header, _ := hex.DecodeString(work.Header)
+	if len(header) != blockchain.HEADER_SIZE {
+		t.Fatalf("header of %d bytes", len(header))
+	}
+	// rebuild the block from the template to reuse the in process solver
+	b := tmpl.Block.WithNonces(0, 0)
+	if err := NewMiner(2).Solve(context.Background(), b, work.Difficulty); err != nil {
+		t.Fatal(err)
+	}
+	nonce, extraNonce := b.Nonce(), b.ExtraNonce()
+	return &WorkSubmission{&work.ID, &nonce, &extraNonce}
+}
+
+func TestSubmitTemplate(t *testing.T) {
+	bc := blockchain.NewBlockchain(minerAddress, params.Regtest)
+	store := NewTemplateStore()
+	tmpl := store.NewTemplate(bc, "pool")
+	if tmpl.Height != 1 {
+		t.Fatalf("template height %d, expected 1", tmpl.Height)
+	}
+	ws := solveExternally(t, tmpl)
+	b, err := store.Submit(bc, ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc.LastBlock() != b {
+		t.Fatal("submitted block is not the chain tip")
+	}
+	if bc.CalculateTotalAmount("pool") != params.Regtest.Reward {
+		t.Fatal("reward not paid to the template payout address")
+	}
+	if _, err := store.Submit(bc, ws); err != ErrUnknownTemplate {
+		t.Fatalf("resubmission: got %v, expected %v", err, ErrUnknownTemplate)
+	}
+}
+
+func TestSubmitRejects(t *testing.T) {
+	bc := blockchain.NewBlockchain(minerAddress, params.Regtest)
+	store := NewTemplateStore()
+	tmpl := store.NewTemplate(bc, "pool")
+	ws := solveExternally(t, tmpl)
+
+	bad := *ws.Nonce + 1
+	for blockchain.ValidProof(tmpl.Block.WithNonces(bad, *ws.ExtraNonce).Header(), tmpl.Difficulty) {
+		bad++
+	}
+	if _, err := store.Submit(bc, &WorkSubmission{ws.TemplateID, &bad, ws.ExtraNonce}); err != blockchain.ErrInvalidProof {
+		t.Fatalf("bad nonce: got %v, expected %v", err, blockchain.ErrInvalidProof)
+	}
+
+	// the tip moves on before the solution is submitted
+	if _, err := NewMiner(1).Generate(bc, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Submit(bc, ws); err != blockchain.ErrStaleBlock {
+		t.Fatalf("stale template: got %v, expected %v", err, blockchain.ErrStaleBlock)
+	}
+	store.NewTemplate(bc, "pool")
+	if _, err := store.Submit(bc, ws); err != ErrUnknownTemplate {
+		t.Fatalf("pruned template: got %v, expected %v", err, ErrUnknownTemplate)
+	}
+}
+
+func TestTarget(t *testing.T) {
+	if got := Target(3); got[:4] != "000f" || len(got) != 64 {
+		t.Fatalf("Target(3) = %s", got)
+	}
+}
@@ -0,0 +1,143 @@
+// moviecoin-cli manages local wallets and queries or controls a chain server
+// from the command line. The wallets are encrypted key files of the data
+// directory; transactions are signed locally and only the signature is sent
+// to the node.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"moviecoin/client"
+	"moviecoin/config"
+	"moviecoin/params"
+	"moviecoin/security"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+const (
+	ERROR_EXIT_CODE = 1
+)
+
+func init() {
+	log.SetFlags(0)
+	log.SetPrefix("moviecoin-cli: ")
+}
+
+// cli runs the commands against the nodes of the configuration
+type cli struct {
+	cfg     *config.Config
+	network *params.Network
+	node    *client.Client
+	// in provides the private keys imported, out receives the results
+	in  io.Reader
+	out io.Writer
+}
+
+type command struct {
+	name  string
+	args  string
+	usage string
+	run   func(c *cli, ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"wallet", "create|import|list [-name NAME]", "Create a wallet, import a hex private key read from stdin or list the wallets", (*cli).wallet},
+	{"balance", "ADDRESS|WALLET", "Balance of an address or of a wallet", (*cli).balance},
+	{"send", "-from WALLET -to ADDRESS -amount AMOUNT", "Sign a payment with a wallet and submit it", (*cli).send},
+	{"tx", "TXID", "Status of a transaction", (*cli).transaction},
+	{"block", "HEIGHT|HASH", "Block at a height or with a hash", (*cli).block},
+	{"chain", "[-n COUNT]", "Height of the chain and its last blocks", (*cli).chain},
+	{"peers", "", "Connected peers, known addresses and bans (admin)", (*cli).peers},
+	{"mining", "status|start|stop [-mode MODE] [-interval SEC]", "State of the miner of the node, start or stop it (admin)", (*cli).mining},
+	{"generate", "[COUNT]", "Mine blocks immediately on a regtest node (admin)", (*cli).generate},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: moviecoin-cli [flags] COMMAND [arguments]\n\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\n    \t%s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.usage)
+	}
+	fmt.Fprintln(w, "\nThe wallets are encrypted with", config.WALLET_PASSPHRASE_ENV+". Run moviecoin-cli -h for the flags.")
+}
+
+// newNodeClient calls the configured nodes, over HTTPS for the https ones
+func newNodeClient(cfg *config.Config) (*client.Client, error) {
+	useTLS := false
+	for _, node := range cfg.CLI.Nodes {
+		if u, err := url.Parse(node); err == nil && u.Scheme == "https" {
+			useTLS = true
+		}
+	}
+	httpClient, err := security.NewHTTPClient(useTLS, cfg.CLI.NodeCA, 0)
+	if err != nil {
+		return nil, err
+	}
+	node := client.NewClient(cfg.CLI.Nodes...)
+	node.HTTPClient = httpClient
+	node.AdminToken = cfg.Admin.Token
+	return node, nil
+}
+
+// run executes the command named by args[0]
+func (c *cli) run(ctx context.Context, args []string) error {
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(c, ctx, args[1:])
+		}
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// parseFlags parses the flags of a command taking no other argument
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s: unexpected arguments %s", fs.Name(), strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+func (c *cli) printJSON(v interface{}) error {
+	m, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.out, "%s\n", m)
+	return err
+}
+
+func main() {
+	cfg, args, err := config.LoadArgs(config.CLI, "moviecoin-cli", os.Args[1:])
+	if err == flag.ErrHelp {
+		usage(os.Stderr)
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(args) == 0 {
+		usage(os.Stderr)
+		os.Exit(ERROR_EXIT_CODE)
+	}
+	node, err := newNodeClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := &cli{cfg: cfg, network: cfg.Params(), node: node, in: os.Stdin, out: os.Stdout}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := c.run(ctx, args); err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		log.Fatal(err)
+	}
+}
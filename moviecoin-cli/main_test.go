@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"moviecoin/api"
+	"moviecoin/blockchain"
+	"moviecoin/client"
+	"moviecoin/config"
+	"moviecoin/params"
+	"moviecoin/wallet"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestCLI(t *testing.T, node string) (*cli, *bytes.Buffer) {
+	cfg := config.Default()
+	cfg.Network, cfg.DataDir = params.Regtest.Name, t.TempDir()
+	out := &bytes.Buffer{}
+	return &cli{cfg: cfg, network: params.Regtest, node: client.NewClient(node), out: out}, out
+}
+
+func TestWallets(t *testing.T) {
+	c, out := newTestCLI(t, "")
+	ctx := context.Background()
+	if err := c.run(ctx, []string{"wallet", "create"}); err == nil {
+		t.Fatal("wallet saved without a passphrase")
+	}
+	t.Setenv(config.WALLET_PASSPHRASE_ENV, "correct horse")
+	if err := c.run(ctx, []string{"wallet", "create"}); err != nil {
+		t.Fatal(err)
+	}
+	created := strings.TrimSpace(out.String())
+	if err := c.run(ctx, []string{"wallet", "create"}); err == nil {
+		t.Error("existing wallet overwritten")
+	}
+	if err := c.run(ctx, []string{"wallet", "create", "-name", "../escape"}); err == nil {
+		t.Error("wallet saved out of the wallets directory")
+	}
+
+	imported := wallet.NewWallet(params.Regtest)
+	c.in = strings.NewReader(imported.PrivateKeyStr() + "\n")
+	if err := c.run(ctx, []string{"wallet", "import", "-name", "savings"}); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := c.run(ctx, []string{"wallet", "list"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("default\t%s\nsavings\t%s\n", created, imported.WalletAddress())
+	if out.String() != expected {
+		t.Errorf("wallets %q, expected %q", out, expected)
+	}
+}
+
+func TestSend(t *testing.T) {
+	t.Setenv(config.WALLET_PASSPHRASE_ENV, "correct horse")
+	recipient := wallet.NewWallet(params.Regtest).WalletAddress()
+	var sent blockchain.TransactionRequest
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case api.PREFIX + "/transactions":
+			json.NewDecoder(req.Body).Decode(&sent)
+			api.WriteJSON(w, http.StatusCreated, map[string]string{"hash": "ab"})
+		case api.PREFIX + "/addresses/" + recipient + "/balance":
+			api.WriteJSON(w, http.StatusOK, map[string]interface{}{"address": recipient, "balance": 2.5})
+		default:
+			api.WriteError(w, api.NotFound("no route"))
+		}
+	}))
+	defer node.Close()
+	c, out := newTestCLI(t, node.URL)
+	ctx := context.Background()
+	if err := c.run(ctx, []string{"wallet", "create", "-name", "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	sender := strings.TrimSpace(out.String())
+
+	out.Reset()
+	if err := c.run(ctx, []string{"send", "-from", "alice", "-to", recipient, "-amount", "1.5"}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "ab\n" {
+		t.Errorf("txid %q", out)
+	}
+	if *sent.SenderAddress != sender || *sent.ReceiverAddress != recipient || *sent.Amount != 1.5 {
+		t.Fatalf("payment sent %+v", sent)
+	}
+	publicKey, signature, err := sent.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := blockchain.NewTransaction(sender, recipient, 1.5).Hash()
+	if !ecdsa.Verify(publicKey, hash[:], signature.R, signature.S) {
+		t.Error("payment not signed by the wallet")
+	}
+
+	out.Reset()
+	if err := c.run(ctx, []string{"balance", recipient}); err != nil || out.String() != "2.5\n" {
+		t.Errorf("balance %q: %v", out, err)
+	}
+	if err := c.run(ctx, []string{"balance", "bob"}); err == nil {
+		t.Error("balance of an unknown wallet")
+	}
+	if err := c.run(ctx, []string{"send", "-from", "alice", "-to", recipient}); err == nil {
+		t.Error("payment without an amount")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"moviecoin/client"
+	"moviecoin/miner"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const DEFAULT_CHAIN_BLOCKS = 10
+
+func (c *cli) transaction(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("tx: one txid expected")
+	}
+	status, err := c.node.Transaction(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return c.printJSON(status)
+}
+
+func (c *cli) block(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("block: one height or hash expected")
+	}
+	var b *client.Block
+	var err error
+	if len(args[0]) == 64 {
+		b, err = c.node.BlockByHash(ctx, args[0])
+	} else if height, convErr := strconv.Atoi(args[0]); convErr == nil && height >= 0 {
+		b, err = c.node.Block(ctx, height)
+	} else {
+		return fmt.Errorf("block: invalid height or hash %q", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	return c.printJSON(b)
+}
+
+// chain prints the height of the chain and a line per block for the last
+// ones, the tip first
+func (c *cli) chain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("chain", flag.ContinueOnError)
+	count := fs.Int("n", DEFAULT_CHAIN_BLOCKS, "Number of blocks listed")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *count < 1 {
+		return errors.New("chain: -n must be positive")
+	}
+	tip, err := c.node.Tip(ctx)
+	if err != nil {
+		return err
+	}
+	// pages of the default size of the node follow each other with cursors,
+	// so that a reorganization while listing fails instead of mixing branches
+	var blocks []*client.Block
+	chain, err := c.node.Blocks(ctx, max(0, tip.Height-*count+1), 0)
+	for err == nil {
+		blocks = append(blocks, chain.Blocks...)
+		if len(blocks) >= *count || chain.NextCursor == "" {
+			break
+		}
+		chain, err = c.node.NextBlocks(ctx, chain.NextCursor, 0)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "height %d\n", chain.Height)
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	for i := len(blocks) - 1; i >= 0 && i >= len(blocks)-*count; i-- {
+		b := blocks[i]
+		timestamp := time.Unix(0, b.Block.Header().Timestamp).UTC().Format(time.RFC3339)
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d transactions\n", b.Height, b.Hash, timestamp, len(b.Block.Transactions()))
+	}
+	return tw.Flush()
+}
+
+func (c *cli) peers(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errors.New("peers: no argument expected")
+	}
+	peers, err := c.node.Peers(ctx)
+	if err != nil {
+		return err
+	}
+	return c.printJSON(peers)
+}
+
+func (c *cli) mining(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("mining: status, start or stop expected")
+	}
+	fs := flag.NewFlagSet("mining "+args[0], flag.ContinueOnError)
+	var mode *string
+	var interval *int
+	if args[0] == "start" {
+		mode = fs.String("mode", "", "Mining schedule: interval or continuous (default configured one)")
+		interval = fs.Int("interval", 0, "Seconds between interval mining rounds (default configured one)")
+	}
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	var status *miner.Status
+	var err error
+	switch args[0] {
+	case "status":
+		status, err = c.node.MiningStatus(ctx)
+	case "start":
+		status, err = c.node.StartMining(ctx, *mode, *interval)
+	case "stop":
+		status, err = c.node.StopMining(ctx)
+	default:
+		return fmt.Errorf("mining: unknown command %q", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	return c.printJSON(status)
+}
+
+func (c *cli) generate(ctx context.Context, args []string) error {
+	count := 1
+	if len(args) > 1 {
+		return errors.New("generate: at most one count expected")
+	} else if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("generate: invalid count %q", args[0])
+		}
+		count = n
+	}
+	hashes, err := c.node.Generate(ctx, count)
+	if err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		fmt.Fprintln(c.out, hash)
+	}
+	return nil
+}
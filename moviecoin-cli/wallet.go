@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"moviecoin/blockchain"
+	"moviecoin/config"
+	"moviecoin/wallet"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DEFAULT_WALLET = "default"
+	WALLET_EXT     = ".key"
+)
+
+// walletFile is the path of the key file of the wallet name
+func (c *cli) walletFile(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") || filepath.Base(name) != name {
+		return "", fmt.Errorf("invalid wallet name %q", name)
+	}
+	return filepath.Join(c.cfg.WalletsDir(), name+WALLET_EXT), nil
+}
+
+func passphrase() (string, error) {
+	p := os.Getenv(config.WALLET_PASSPHRASE_ENV)
+	if p == "" {
+		return "", fmt.Errorf("%s must be set, it encrypts the private keys of the wallets", config.WALLET_PASSPHRASE_ENV)
+	}
+	return p, nil
+}
+
+// wallet creates, imports or lists the wallets of the network
+func (c *cli) wallet(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("wallet: create, import or list expected")
+	}
+	fs := flag.NewFlagSet("wallet "+args[0], flag.ContinueOnError)
+	name := fs.String("name", DEFAULT_WALLET, "Name of the wallet")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	switch args[0] {
+	case "create":
+		return c.saveWallet(*name, wallet.NewWallet(c.network))
+	case "import":
+		line, err := bufio.NewReader(c.in).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("wallet import: no private key on stdin: %v", err)
+		}
+		w, err := wallet.WalletFromPrivateKey(strings.TrimSpace(line), c.network)
+		if err != nil {
+			return fmt.Errorf("wallet import: %v", err)
+		}
+		return c.saveWallet(*name, w)
+	case "list":
+		return c.listWallets()
+	}
+	return fmt.Errorf("wallet: unknown command %q", args[0])
+}
+
+// saveWallet writes a new wallet and prints its address, existing wallets
+// are never overwritten
+func (c *cli) saveWallet(name string, w *wallet.Wallet) error {
+	path, err := c.walletFile(name)
+	if err != nil {
+		return err
+	}
+	p, err := passphrase()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("wallet %s already exists: %s", name, path)
+	}
+	if err := w.Save(path, p, c.network); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, w.WalletAddress())
+	return nil
+}
+
+func (c *cli) listWallets() error {
+	entries, err := os.ReadDir(c.cfg.WalletsDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != WALLET_EXT {
+			continue
+		}
+		address, err := wallet.ReadAddress(filepath.Join(c.cfg.WalletsDir(), e.Name()), c.network)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "%s\t%s\n", strings.TrimSuffix(e.Name(), WALLET_EXT), address)
+	}
+	return nil
+}
+
+// address resolves an address or the name of a wallet
+func (c *cli) address(s string) (string, error) {
+	if wallet.ValidateAddress(s, c.network) == nil {
+		return s, nil
+	}
+	path, err := c.walletFile(s)
+	if err != nil {
+		return "", fmt.Errorf("%q is neither an address nor a wallet", s)
+	}
+	address, err := wallet.ReadAddress(path, c.network)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%q is neither an address nor a wallet", s)
+	}
+	return address, err
+}
+
+func (c *cli) balance(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("balance: one address or wallet expected")
+	}
+	address, err := c.address(args[0])
+	if err != nil {
+		return err
+	}
+	balance, err := c.node.Balance(ctx, address)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, balance)
+	return nil
+}
+
+// send signs a payment with the private key of a wallet, which never leaves
+// the machine, and prints its txid
+func (c *cli) send(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	from := fs.String("from", DEFAULT_WALLET, "Wallet paying")
+	to := fs.String("to", "", "Address or wallet paid")
+	amount := fs.Float64("amount", 0, "Amount paid")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *amount <= 0 {
+		return errors.New("send: -amount must be positive")
+	}
+	recipient, err := c.address(*to)
+	if err != nil {
+		return fmt.Errorf("send: -to: %v", err)
+	}
+	path, err := c.walletFile(*from)
+	if err != nil {
+		return err
+	}
+	p, err := passphrase()
+	if err != nil {
+		return err
+	}
+	w, err := wallet.Load(path, p, c.network)
+	if err != nil {
+		return err
+	}
+
+	sender, publicKey, value := w.WalletAddress(), w.PublicKeyStr(), float32(*amount)
+	signature := wallet.NewTransaction(w.PrivateKey(), w.PublicKey(), sender, recipient, value).GenerateSignature().String()
+	txid, err := c.node.SendTransaction(ctx, &blockchain.TransactionRequest{
+		SenderAddress:   &sender,
+		ReceiverAddress: &recipient,
+		SenderPublicKey: &publicKey,
+		Amount:          &value,
+		Signature:       &signature,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, txid)
+	return nil
+}
@@ -0,0 +1,37 @@
+package netsync
+
+// hashSet remembers up to limit hashes, forgetting the oldest first. It is
+// how nodes suppress duplicates: an item seen recently is neither requested
+// nor relayed again.
+type hashSet struct {
+	limit  int
+	hashes map[[32]byte]struct{}
+	order  [][32]byte
+}
+
+func newHashSet(limit int) *hashSet {
+	return &hashSet{limit: limit, hashes: make(map[[32]byte]struct{})}
+}
+
+func (s *hashSet) Has(hash [32]byte) bool {
+	_, ok := s.hashes[hash]
+	return ok
+}
+
+// Add inserts hash and tells whether it was new
+func (s *hashSet) Add(hash [32]byte) bool {
+	if s.Has(hash) {
+		return false
+	}
+	if len(s.order) >= s.limit {
+		delete(s.hashes, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.hashes[hash] = struct{}{}
+	s.order = append(s.order, hash)
+	return true
+}
+
+func (s *hashSet) Len() int {
+	return len(s.order)
+}
@@ -0,0 +1,357 @@
+package netsync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"moviecoin/blockchain"
+	"moviecoin/p2p"
+	"sync"
+	"time"
+)
+
+const (
+	MAX_KNOWN_INVENTORY      = 20000
+	MAX_PEER_KNOWN_INVENTORY = 5000
+	MAX_RELAY_TRANSACTIONS   = 5000
+	// Blocks received before their parent wait in the orphan pool
+	MAX_ORPHANS = 100
+	// An item requested from a peer which did not deliver it in time may be
+	// requested from another peer announcing it
+	REQUEST_TIMEOUT = 30 * time.Second
+)
+
+var ErrMalformedTransaction = errors.New("malformed transaction")
+
+// Manager gossips blocks and transactions with the peers. New items are
+// announced by hash with an inv message, peers request the ones they miss
+// with getdata and relay what they accepted to their own peers. Items seen
+// recently are never requested nor relayed twice.
+type Manager struct {
+	bc     *blockchain.Blockchain
+	server *p2p.Server
+	clock  p2p.Clock
+
+	mux       sync.Mutex
+	known     *hashSet
+	peerKnown map[*p2p.Peer]*hashSet
+	// heights announced by the peers, lowered to what their headers prove
+	claims    map[*p2p.Peer]int
+	requested map[[32]byte]time.Time
+	// signed transactions waiting in the pool, served to peers asking for them
+	txs map[[32]byte]*blockchain.TransactionRequest
+	// orphan blocks by previous hash
+	orphans    map[[32]byte]*blockchain.Block
+	duplicates int
+	// blocks served to peers
+	served int
+
+	sync     *syncState
+	lastSync time.Time
+	quit     chan struct{}
+}
+
+func NewManager(bc *blockchain.Blockchain) *Manager {
+	return &Manager{
+		bc:        bc,
+		clock:     p2p.RealClock{},
+		known:     newHashSet(MAX_KNOWN_INVENTORY),
+		peerKnown: make(map[*p2p.Peer]*hashSet),
+		claims:    make(map[*p2p.Peer]int),
+		requested: make(map[[32]byte]time.Time),
+		txs:       make(map[[32]byte]*blockchain.TransactionRequest),
+		orphans:   make(map[[32]byte]*blockchain.Block),
+		quit:      make(chan struct{}),
+	}
+}
+
+// SetServer gives the manager the peers to talk to, and their clock. It
+// must be called before the server starts.
+func (m *Manager) SetServer(s *p2p.Server) {
+	m.server = s
+	m.clock = s.Clock()
+}
+
+func (m *Manager) OnConnect(p *p2p.Peer) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.peerKnown[p] = newHashSet(MAX_PEER_KNOWN_INVENTORY)
+	m.claims[p] = int(p.Version().BestHeight)
+	if m.claims[p] > m.bc.Height() {
+		m.startSync(p)
+	}
+}
+
+func (m *Manager) OnDisconnect(p *p2p.Peer) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	delete(m.peerKnown, p)
+	if m.sync != nil && m.sync.peer == p {
+		m.abortSync("sync peer disconnected")
+	}
+	delete(m.claims, p)
+}
+
+func (m *Manager) OnMessage(p *p2p.Peer, msg p2p.Message) {
+	switch msg := msg.(type) {
+	case *p2p.MsgInv:
+		m.handleInv(p, msg)
+	case *p2p.MsgGetData:
+		m.handleGetData(p, msg)
+	case *p2p.MsgNotFound:
+		m.mux.Lock()
+		for _, iv := range msg.Items {
+			delete(m.requested, iv.Hash)
+		}
+		m.mux.Unlock()
+	case *p2p.MsgGetHeaders:
+		m.handleGetHeaders(p, msg)
+	case *p2p.MsgHeaders:
+		m.handleHeaders(p, msg)
+	case *p2p.MsgBlock:
+		if !m.syncBlock(p, msg.Block) {
+			m.handleBlock(p, msg.Block)
+		}
+	case *p2p.MsgTx:
+		m.handleTx(p, msg.Transaction)
+	default:
+		log.Printf("DEBUG: peer %v: unhandled %s", p, msg.Command())
+	}
+}
+
+// RelayBlock announces a block accepted locally
+func (m *Manager) RelayBlock(b *blockchain.Block) {
+	hash := b.Hash()
+	m.mux.Lock()
+	m.known.Add(hash)
+	m.pruneTransactions()
+	m.mux.Unlock()
+	m.relay(p2p.InvVect{Type: p2p.INV_BLOCK, Hash: hash}, nil)
+}
+
+// RelayTransaction announces a transaction accepted locally
+func (m *Manager) RelayTransaction(tr *blockchain.TransactionRequest) {
+	hash := tr.Hash()
+	m.mux.Lock()
+	m.known.Add(hash)
+	m.addTransaction(hash, tr)
+	m.mux.Unlock()
+	m.relay(p2p.InvVect{Type: p2p.INV_TX, Hash: hash}, nil)
+}
+
+// relay sends an inv for iv to the peers but from which may not know it yet
+func (m *Manager) relay(iv p2p.InvVect, from *p2p.Peer) {
+	if m.server == nil {
+		return
+	}
+	for _, p := range m.server.Peers() {
+		if p == from || !m.markPeerKnown(p, iv.Hash) {
+			continue
+		}
+		p.Send(&p2p.MsgInv{Items: []p2p.InvVect{iv}})
+	}
+}
+
+// markPeerKnown records that p has the item and tells whether it did not
+// know it before
+func (m *Manager) markPeerKnown(p *p2p.Peer, hash [32]byte) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	known, ok := m.peerKnown[p]
+	if !ok {
+		return false
+	}
+	return known.Add(hash)
+}
+
+func (m *Manager) handleInv(p *p2p.Peer, msg *p2p.MsgInv) {
+	var wanted []p2p.InvVect
+	now := m.clock.Now()
+	for _, iv := range msg.Items {
+		m.markPeerKnown(p, iv.Hash)
+		if iv.Type != p2p.INV_BLOCK && iv.Type != p2p.INV_TX {
+			continue
+		}
+		if iv.Type == p2p.INV_BLOCK && m.bc.HasBlock(iv.Hash) {
+			continue
+		}
+		m.mux.Lock()
+		requested, pending := m.requested[iv.Hash]
+		if m.sync != nil {
+			// the sync requests the blocks it needs itself
+			if _, syncing := m.sync.index[iv.Hash]; syncing {
+				m.mux.Unlock()
+				continue
+			}
+		}
+		if !m.known.Has(iv.Hash) && (!pending || now.Sub(requested) > REQUEST_TIMEOUT) {
+			m.requested[iv.Hash] = now
+			wanted = append(wanted, iv)
+		}
+		m.mux.Unlock()
+	}
+	if len(wanted) > 0 {
+		p.Send(&p2p.MsgGetData{Items: wanted})
+	}
+}
+
+func (m *Manager) handleGetData(p *p2p.Peer, msg *p2p.MsgGetData) {
+	var missing []p2p.InvVect
+	for _, iv := range msg.Items {
+		switch iv.Type {
+		case p2p.INV_BLOCK:
+			if b := m.bc.BlockByHash(iv.Hash); b != nil {
+				m.mux.Lock()
+				m.served++
+				m.mux.Unlock()
+				p.Send(&p2p.MsgBlock{Block: b})
+				continue
+			}
+		case p2p.INV_TX:
+			m.mux.Lock()
+			tr, ok := m.txs[iv.Hash]
+			m.mux.Unlock()
+			if ok {
+				p.Send(&p2p.MsgTx{Transaction: tr})
+				continue
+			}
+		}
+		missing = append(missing, iv)
+	}
+	if len(missing) > 0 {
+		p.Send(&p2p.MsgNotFound{Items: missing})
+	}
+}
+
+// seen marks an item received from p and tells whether it is new
+func (m *Manager) seen(p *p2p.Peer, hash [32]byte) bool {
+	m.markPeerKnown(p, hash)
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	delete(m.requested, hash)
+	if !m.known.Add(hash) {
+		m.duplicates++
+		return false
+	}
+	return true
+}
+
+func (m *Manager) handleBlock(p *p2p.Peer, b *blockchain.Block) {
+	hash := b.Hash()
+	if !m.seen(p, hash) {
+		return
+	}
+	m.acceptBlock(p, b)
+}
+
+// acceptBlock adds a block received from p to the chain and relays it,
+// followed by the orphans it is the parent of
+func (m *Manager) acceptBlock(p *p2p.Peer, b *blockchain.Block) {
+	for orphan := false; b != nil; orphan = true {
+		hash := b.Hash()
+		switch err := m.bc.AddBlock(b); {
+		case err == nil:
+			log.Printf("Block %x received from peer %v", hash, p)
+			m.mux.Lock()
+			m.pruneTransactions()
+			m.mux.Unlock()
+			m.relay(p2p.InvVect{Type: p2p.INV_BLOCK, Hash: hash}, p)
+		case errors.Is(err, blockchain.ErrStaleBlock):
+			if !m.bc.HasBlock(b.PreviousHash()) {
+				// we may have missed more than the parent, catch up with the peer
+				m.addOrphan(b)
+				m.mux.Lock()
+				m.startSync(p)
+				m.mux.Unlock()
+			}
+			return
+		default:
+			log.Printf("WARN: block %x from peer %v rejected: %v", hash, p, err)
+			if !orphan {
+				// orphans may have come from another peer
+				p.Misbehaving(p2p.SCORE_INVALID_BLOCK, "invalid block")
+			}
+			return
+		}
+		m.mux.Lock()
+		b = m.orphans[hash]
+		delete(m.orphans, hash)
+		m.mux.Unlock()
+	}
+}
+
+// addOrphan keeps a block whose parent we do not have yet, most likely
+// because it overtook its parent on another connection
+func (m *Manager) addOrphan(b *blockchain.Block) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if len(m.orphans) >= MAX_ORPHANS {
+		for prev := range m.orphans {
+			delete(m.orphans, prev)
+			break
+		}
+	}
+	m.orphans[b.PreviousHash()] = b
+	log.Printf("Block %x waits for its parent %x", b.Hash(), b.PreviousHash())
+}
+
+func (m *Manager) handleTx(p *p2p.Peer, tr *blockchain.TransactionRequest) {
+	hash := tr.Hash()
+	if !m.seen(p, hash) {
+		return
+	}
+	if err := m.acceptTransaction(tr); err != nil {
+		log.Printf("WARN: transaction %x from peer %v rejected: %v", hash, p, err)
+		// a transaction may be valid on the peer's chain, not a malformed one
+		if errors.Is(err, ErrMalformedTransaction) {
+			p.Misbehaving(p2p.SCORE_INVALID_TX, err.Error())
+		}
+		return
+	}
+	m.mux.Lock()
+	m.addTransaction(hash, tr)
+	m.mux.Unlock()
+	m.relay(p2p.InvVect{Type: p2p.INV_TX, Hash: hash}, p)
+}
+
+// acceptTransaction verifies a transaction received from a peer and adds
+// it to the pool
+func (m *Manager) acceptTransaction(tr *blockchain.TransactionRequest) error {
+	if *tr.SenderAddress == blockchain.MINING_SENDER {
+		return fmt.Errorf("%w: mining rewards are only created by miners", ErrMalformedTransaction)
+	}
+	publicKey, signature, err := tr.Keys()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedTransaction, err)
+	}
+	if !m.bc.AddTransaction(*tr.SenderAddress, *tr.ReceiverAddress, *tr.Amount, publicKey, signature) {
+		return fmt.Errorf("invalid transaction")
+	}
+	return nil
+}
+
+// addTransaction keeps a signed transaction to serve it to peers. Callers
+// must hold m.mux.
+func (m *Manager) addTransaction(hash [32]byte, tr *blockchain.TransactionRequest) {
+	if len(m.txs) >= MAX_RELAY_TRANSACTIONS {
+		return
+	}
+	m.txs[hash] = tr
+}
+
+// pruneTransactions forgets the transactions which left the pool, most
+// likely because they were included in a block. Callers must hold m.mux.
+func (m *Manager) pruneTransactions() {
+	pending := make(map[blockchain.Transaction]int)
+	for _, t := range m.bc.TransactionPool() {
+		pending[*t]++
+	}
+	for hash, tr := range m.txs {
+		t := *blockchain.NewTransaction(*tr.SenderAddress, *tr.ReceiverAddress, *tr.Amount)
+		if pending[t] > 0 {
+			pending[t]--
+			continue
+		}
+		delete(m.txs, hash)
+	}
+}
@@ -0,0 +1,324 @@
+package netsync
+
+import (
+	"math"
+	"moviecoin/blockchain"
+	"moviecoin/p2p"
+	"moviecoin/params"
+	"moviecoin/wallet"
+	"testing"
+	"time"
+)
+
+type node struct {
+	bc      *blockchain.Blockchain
+	manager *Manager
+	server  *p2p.Server
+}
+
+func newNode(t *testing.T, minerAddress string) *node {
+	bc := blockchain.NewBlockchain(minerAddress, params.Regtest)
+	n := &node{bc: bc, manager: NewManager(bc)}
+	n.server = p2p.NewServer(p2p.Config{Network: params.Regtest, Chain: bc, Handler: n.manager,
+		ListenAddr: "127.0.0.1:0"})
+	n.manager.SetServer(n.server)
+	bc.SetRelay(n.manager)
+	if err := n.server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	n.manager.Start()
+	t.Cleanup(n.server.Stop)
+	t.Cleanup(n.manager.Stop)
+	return n
+}
+
+func connect(t *testing.T, from, to *node) {
+	if _, err := from.server.Connect(to.server.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mine solves a block on top of the chain of n and announces it
+func mine(t *testing.T, n *node) *blockchain.Block {
+	b, _ := n.bc.NewBlockTemplate(n.bc.MinerAddress())
+	for nonce := uint32(0); !blockchain.ValidProof(b.Header(), n.bc.Network().Difficulty); nonce++ {
+		b.SetNonces(nonce, 0)
+	}
+	if err := n.bc.AddBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	n.bc.AnnounceBlock(b)
+	return b
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBlockGossip(t *testing.T) {
+	a, b, c := newNode(t, "a"), newNode(t, "b"), newNode(t, "c")
+	connect(t, a, b)
+	connect(t, b, c)
+	connect(t, c, a)
+
+	for i := 1; i <= 3; i++ {
+		tip := mine(t, a).Hash()
+		for _, n := range []*node{b, c} {
+			waitFor(t, "block propagation", func() bool { return n.bc.HasBlock(tip) })
+		}
+	}
+	for name, n := range map[string]*node{"a": a, "b": b, "c": c} {
+		if n.bc.Height() != 3 {
+			t.Errorf("%s: height %d", name, n.bc.Height())
+		}
+		n.manager.mux.Lock()
+		if n.manager.duplicates != 0 {
+			t.Errorf("%s: %d blocks downloaded twice", name, n.manager.duplicates)
+		}
+		n.manager.mux.Unlock()
+	}
+}
+
+func TestOrphanBlocks(t *testing.T) {
+	a, b := newNode(t, "a"), newNode(t, "b")
+	first, second := mine(t, a), mine(t, a)
+	connect(t, b, a)
+	p := b.server.Peers()[0]
+
+	// the child overtakes its parent
+	b.manager.handleBlock(p, second)
+	if b.bc.Height() != 0 {
+		t.Fatal("orphan block added to the chain")
+	}
+	b.manager.handleBlock(p, first)
+	if b.bc.Height() != 2 || b.bc.LastBlock().Hash() != second.Hash() {
+		t.Errorf("orphan not connected after its parent, height %d", b.bc.Height())
+	}
+}
+
+func TestTransactionGossip(t *testing.T) {
+	payer := wallet.NewWallet(params.Regtest)
+	a, b, c := newNode(t, payer.WalletAddress()), newNode(t, "b"), newNode(t, "c")
+	connect(t, a, b)
+	connect(t, b, c)
+	tip := mine(t, a).Hash()
+	waitFor(t, "block propagation", func() bool { return c.bc.HasBlock(tip) })
+
+	recipient := wallet.NewWallet(params.Regtest).WalletAddress()
+	tx := wallet.NewTransaction(payer.PrivateKey(), payer.PublicKey(), payer.WalletAddress(), recipient, 0.5)
+	if !a.bc.CreateTransaction(payer.WalletAddress(), recipient, 0.5, payer.PublicKey(), tx.GenerateSignature()) {
+		t.Fatal("transaction rejected")
+	}
+	waitFor(t, "transaction propagation", func() bool { return len(c.bc.TransactionPool()) == 1 })
+
+	// once mined by c, the transaction leaves every pool
+	tip = mine(t, c).Hash()
+	waitFor(t, "block propagation", func() bool { return a.bc.HasBlock(tip) })
+	if len(a.bc.TransactionPool()) != 0 || len(b.bc.TransactionPool()) != 0 {
+		t.Error("mined transaction still pending")
+	}
+	a.manager.mux.Lock()
+	if len(a.manager.txs) != 0 {
+		t.Error("mined transaction still relayed")
+	}
+	a.manager.mux.Unlock()
+	if a.bc.CalculateTotalAmount(recipient) != 0.5 {
+		t.Errorf("recipient balance %v", a.bc.CalculateTotalAmount(recipient))
+	}
+}
+
+func TestRejectedTransactions(t *testing.T) {
+	n := newNode(t, "a")
+	reward, short, amount := blockchain.MINING_SENDER, "04ab", float32(1)
+	valid := make([]byte, 128)
+	for i := range valid {
+		valid[i] = 'a'
+	}
+	key := string(valid)
+	cases := map[string]*blockchain.TransactionRequest{
+		"reward":    {SenderAddress: &reward, ReceiverAddress: &short, SenderPublicKey: &key, Signature: &key, Amount: &amount},
+		"malformed": {SenderAddress: &short, ReceiverAddress: &short, SenderPublicKey: &short, Signature: &short, Amount: &amount},
+		"off curve": {SenderAddress: &short, ReceiverAddress: &short, SenderPublicKey: &key, Signature: &key, Amount: &amount},
+	}
+	for name, tr := range cases {
+		if err := n.manager.acceptTransaction(tr); err == nil {
+			t.Errorf("%s transaction accepted", name)
+		}
+	}
+	if len(n.bc.TransactionPool()) != 0 {
+		t.Error("rejected transactions added to the pool")
+	}
+}
+
+func TestInitialSync(t *testing.T) {
+	a := newNode(t, "a")
+	for i := 0; i < 25; i++ {
+		mine(t, a)
+	}
+	b := newNode(t, "b")
+	if !b.manager.Status().Synced() {
+		t.Error("node without peers not synced")
+	}
+	connect(t, b, a)
+	waitFor(t, "initial sync", func() bool { return b.bc.Height() == 25 })
+	if b.bc.LastBlock().Hash() != a.bc.LastBlock().Hash() {
+		t.Fatal("synchronized to another tip")
+	}
+	waitFor(t, "synced status", func() bool { return b.manager.Status().Synced() })
+	if status := b.manager.Status(); status.TargetHeight != 25 {
+		t.Errorf("status %+v", status)
+	}
+	if score := b.server.Peers()[0].BanScore(); score != 0 {
+		t.Errorf("honest peer penalized, ban score %d", score)
+	}
+
+	// c downloads the blocks from both a and b
+	c := newNode(t, "c")
+	c.manager.mux.Lock()
+	connect(t, a, c)
+	connect(t, b, c)
+	waitFor(t, "inbound peers", func() bool { return len(c.server.Peers()) == 2 })
+	c.manager.mux.Unlock()
+	waitFor(t, "parallel sync", func() bool { return c.bc.Height() == 25 })
+	for name, n := range map[string]*node{"a": a, "b": b} {
+		n.manager.mux.Lock()
+		if n.manager.served == 0 {
+			t.Errorf("no block downloaded from %s", name)
+		}
+		n.manager.mux.Unlock()
+	}
+}
+
+func TestSyncReorganizes(t *testing.T) {
+	a, b := newNode(t, "a"), newNode(t, "b")
+	for i := 0; i < 2; i++ {
+		mine(t, a)
+	}
+	// b shares two blocks with a and forks, then a mines a longer branch
+	if err := b.bc.ReplaceFrom(0, a.bc.Chain()[1:]); err != nil {
+		t.Fatal(err)
+	}
+	common := a.bc.LastBlock().Hash()
+	mine(t, b)
+	for i := 0; i < 3; i++ {
+		mine(t, a)
+	}
+	tip := a.bc.LastBlock().Hash()
+	connect(t, b, a)
+	waitFor(t, "reorganization", func() bool { return b.bc.HeightOf(tip) == 5 })
+	if b.bc.Height() != 5 || b.bc.Chain()[2].Hash() != common {
+		t.Error("reorganization did not resume from the common ancestor")
+	}
+}
+
+func TestRejectsInvalidHeaders(t *testing.T) {
+	a, b := newNode(t, "a"), newNode(t, "b")
+	for i := 0; i < 3; i++ {
+		mine(t, a)
+	}
+	var headers []*blockchain.Header
+	for _, blk := range a.bc.Chain()[1:] {
+		headers = append(headers, blk.Header())
+	}
+	if err := b.manager.addHeaders(newSyncState(nil, time.Now()), headers); err != nil {
+		t.Fatalf("valid headers rejected: %v", err)
+	}
+	if err := b.manager.addHeaders(newSyncState(nil, time.Now()), headers[1:]); err != ErrHeadersDisconnected {
+		t.Errorf("disconnected headers: %v", err)
+	}
+	if err := b.manager.addHeaders(newSyncState(nil, time.Now()), []*blockchain.Header{headers[0], headers[2]}); err != ErrHeadersNotChained {
+		t.Errorf("gap in the headers: %v", err)
+	}
+	forged := *headers[0]
+	for blockchain.ValidProof(&forged, params.Regtest.Difficulty) {
+		forged.Nonce++
+	}
+	if err := b.manager.addHeaders(newSyncState(nil, time.Now()), []*blockchain.Header{&forged}); err == nil {
+		t.Error("header without proof of work accepted")
+	}
+}
+
+func TestInvalidBlockBansPeer(t *testing.T) {
+	a, b := newNode(t, "a"), newNode(t, "b")
+	connect(t, b, a)
+	p := b.server.Peers()[0]
+
+	blk, _ := a.bc.NewBlockTemplate("a")
+	for blockchain.ValidProof(blk.Header(), params.Regtest.Difficulty) {
+		blk.SetNonces(blk.Header().Nonce+1, 0)
+	}
+	b.manager.handleBlock(p, blk)
+	if b.bc.Height() != 0 {
+		t.Fatal("block without proof of work added")
+	}
+	waitFor(t, "ban", func() bool { return b.server.Banned(p.Host()) && len(b.server.Peers()) == 0 })
+}
+
+func TestForgedBlocksBanPeer(t *testing.T) {
+	reward := params.Regtest.Reward
+	cases := map[string][]*blockchain.Transaction{
+		"minted": {blockchain.NewTransaction(blockchain.MINING_SENDER, "a", 1000*reward)},
+		"overspent": {blockchain.NewTransaction("b", "a", 5*reward),
+			blockchain.NewTransaction(blockchain.MINING_SENDER, "a", reward)},
+	}
+	for name, transactions := range cases {
+		a, b := newNode(t, "a"), newNode(t, "b")
+		mine(t, b)
+		connect(t, b, a)
+		p := b.server.Peers()[0]
+
+		blk := blockchain.NewBlock(0, b.bc.LastBlock().Hash(), transactions)
+		for nonce := uint32(0); !blockchain.ValidProof(blk.Header(), params.Regtest.Difficulty); nonce++ {
+			blk.SetNonces(nonce, 0)
+		}
+		b.manager.handleBlock(p, blk)
+		if b.bc.Height() != 1 {
+			t.Fatalf("%s: forged block added", name)
+		}
+		waitFor(t, name+" ban", func() bool { return b.server.Banned(p.Host()) && len(b.server.Peers()) == 0 })
+	}
+}
+
+// claimedHeight announces a height the chain does not have
+type claimedHeight struct {
+	*blockchain.Blockchain
+	height int
+}
+
+func (c claimedHeight) Height() int { return c.height }
+
+func TestFalseHeightIsDropped(t *testing.T) {
+	a, b := newNode(t, "a"), newNode(t, "b")
+	mine(t, a)
+	// the liar has the block of a and claims many more
+	bc := blockchain.NewBlockchain("liar", params.Regtest)
+	if err := bc.AddBlock(a.bc.LastBlock()); err != nil {
+		t.Fatal(err)
+	}
+	liar := &node{bc: bc, manager: NewManager(bc)}
+	liar.server = p2p.NewServer(p2p.Config{Network: params.Regtest, Chain: claimedHeight{bc, math.MaxUint32},
+		Handler: liar.manager, ListenAddr: "127.0.0.1:0"})
+	liar.manager.SetServer(liar.server)
+	if err := liar.server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(liar.server.Stop)
+
+	connect(t, b, liar)
+	p := b.server.Peers()[0]
+	waitFor(t, "false height penalty", func() bool { return p.BanScore() == p2p.SCORE_FALSE_HEIGHT })
+	if b.bc.Height() != 1 {
+		t.Errorf("height %d, the block of the liar was not synchronized", b.bc.Height())
+	}
+	waitFor(t, "synced status", func() bool { return b.manager.Status().Synced() })
+	if status := b.manager.Status(); status.TargetHeight != 1 {
+		t.Errorf("status %+v", status)
+	}
+
+}
@@ -0,0 +1,433 @@
+package netsync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"moviecoin/blockchain"
+	"moviecoin/p2p"
+	"sort"
+	"time"
+)
+
+const (
+	// Blocks requested from a single peer at once while synchronizing
+	BLOCKS_PER_PEER      = 16
+	SYNC_REQUEST_TIMEOUT = 15 * time.Second
+	// A sync peer making no progress for SYNC_STALL_TIMEOUT is given up
+	SYNC_STALL_TIMEOUT = 30 * time.Second
+	SYNC_INTERVAL      = blockchain.BLOCKCHAIN_NEIGHBOR_SYNC_TIME_SEC * time.Second
+	SYNC_TICK          = time.Second
+)
+
+var (
+	ErrHeadersDisconnected = errors.New("headers do not connect to our chain")
+	ErrHeadersNotChained   = errors.New("headers are not consecutive")
+)
+
+type blockRequest struct {
+	peer *p2p.Peer
+	sent time.Time
+}
+
+// syncState tracks a headers-first synchronization. Headers are downloaded
+// from the sync peer and checked first, the block bodies are then requested
+// from every peer which may have them.
+type syncState struct {
+	peer *p2p.Peer
+	// ancestor is the height of the last block we share with the peer, the
+	// headers follow it
+	ancestor int
+	headers  []*blockchain.Header
+	hashes   [][32]byte
+	index    map[[32]byte]int
+	started  bool     // the first batch of headers was received
+	last     [32]byte // hash of the last header received
+	bodies   map[int]*blockchain.Block
+	inflight map[[32]byte]*blockRequest
+	next     int // index of the next header to connect
+	fetching bool
+	updated  time.Time
+}
+
+func newSyncState(p *p2p.Peer, now time.Time) *syncState {
+	s := &syncState{peer: p}
+	s.reset(now)
+	return s
+}
+
+func (s *syncState) reset(now time.Time) {
+	s.headers = nil
+	s.hashes = nil
+	s.started = false
+	s.index = make(map[[32]byte]int)
+	s.bodies = make(map[int]*blockchain.Block)
+	s.inflight = make(map[[32]byte]*blockRequest)
+	s.next = 0
+	s.fetching = false
+	s.updated = now
+}
+
+// Start runs the synchronization loop, which retries stalled requests and
+// periodically asks a peer for blocks we may have missed
+func (m *Manager) Start() {
+	go m.syncLoop()
+}
+
+func (m *Manager) Stop() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	select {
+	case <-m.quit:
+	default:
+		close(m.quit)
+	}
+}
+
+// Status is the progress of the node towards the chain of its peers
+type Status struct {
+	// Syncing is set while blocks announced by the headers of a peer are
+	// being downloaded
+	Syncing bool
+	Height  int
+	// TargetHeight is the greatest height announced by the connected peers
+	// when they connected, unless their headers proved otherwise, or by the
+	// headers being synchronized
+	TargetHeight int
+}
+
+// Synced tells whether the chain caught up with its peers. A node without
+// peers is synced.
+func (s Status) Synced() bool {
+	return !s.Syncing && s.Height >= s.TargetHeight
+}
+
+func (m *Manager) Status() Status {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	status := Status{Height: m.bc.Height()}
+	status.TargetHeight = status.Height
+	for _, height := range m.claims {
+		status.TargetHeight = max(status.TargetHeight, height)
+	}
+	if s := m.sync; s != nil && len(s.headers) > 0 {
+		status.Syncing = true
+		status.TargetHeight = max(status.TargetHeight, s.ancestor+len(s.headers))
+	}
+	return status
+}
+
+func (m *Manager) syncLoop() {
+	ticker := m.clock.NewTicker(SYNC_TICK)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			m.mux.Lock()
+			m.checkSync()
+			m.mux.Unlock()
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+// checkSync starts a sync every SYNC_INTERVAL, or at once with a peer
+// announcing a longer chain, and watches the one in progress. Callers must
+// hold m.mux.
+func (m *Manager) checkSync() {
+	now := m.clock.Now()
+	s := m.sync
+	if s == nil {
+		if m.server == nil {
+			return
+		}
+		if p := m.longerPeer(); p != nil {
+			m.startSync(p)
+			return
+		}
+		if now.Sub(m.lastSync) < SYNC_INTERVAL {
+			return
+		}
+		if peers := m.server.Peers(); len(peers) > 0 {
+			m.startSync(peers[rand.Intn(len(peers))])
+		}
+		return
+	}
+	if disconnected(s.peer) {
+		m.abortSync("sync peer disconnected")
+		return
+	}
+	if now.Sub(s.updated) > SYNC_STALL_TIMEOUT {
+		m.abortSync("sync peer stalled")
+		return
+	}
+	if s.fetching {
+		for hash, req := range s.inflight {
+			if disconnected(req.peer) || now.Sub(req.sent) > SYNC_REQUEST_TIMEOUT {
+				delete(s.inflight, hash)
+			}
+		}
+		m.requestBodies()
+	}
+}
+
+// longerPeer returns a peer announcing a chain longer than ours, if any
+func (m *Manager) longerPeer() *p2p.Peer {
+	for _, p := range m.server.Peers() {
+		if m.claims[p] > m.bc.Height() {
+			return p
+		}
+	}
+	return nil
+}
+
+func disconnected(p *p2p.Peer) bool {
+	select {
+	case <-p.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// startSync asks p for the headers following our chain, unless a sync is
+// already running. Callers must hold m.mux.
+func (m *Manager) startSync(p *p2p.Peer) {
+	if m.sync != nil {
+		return
+	}
+	m.sync = newSyncState(p, m.clock.Now())
+	m.lastSync = m.clock.Now()
+	p.Send(&p2p.MsgGetHeaders{Locator: m.bc.Locator()})
+}
+
+// abortSync gives up the sync. The height announced by the peer is not
+// believed any longer, the peer did not prove it.
+func (m *Manager) abortSync(reason string) {
+	log.Printf("WARN: sync with peer %v aborted: %s", m.sync.peer, reason)
+	if claim, ok := m.claims[m.sync.peer]; ok {
+		m.claims[m.sync.peer] = min(claim, m.bc.Height())
+	}
+	m.sync = nil
+}
+
+// proveHeight lowers the height announced by p to the one its headers end
+// at, penalizing the peer if it announced more
+func (m *Manager) proveHeight(p *p2p.Peer, height int) {
+	if claim, ok := m.claims[p]; ok && claim > height {
+		m.claims[p] = height
+		p.Misbehaving(p2p.SCORE_FALSE_HEIGHT, fmt.Sprintf("announced height %d, its headers end at %d", claim, height))
+	}
+}
+
+func (m *Manager) finishSync(reason string) {
+	log.Printf("DEBUG: sync with peer %v done: %s", m.sync.peer, reason)
+	m.sync = nil
+}
+
+func (m *Manager) handleGetHeaders(p *p2p.Peer, msg *p2p.MsgGetHeaders) {
+	headers := m.bc.HeadersAfter(msg.Locator, msg.Stop, p2p.MAX_HEADERS)
+	p.Send(&p2p.MsgHeaders{Headers: headers})
+}
+
+func (m *Manager) handleHeaders(p *p2p.Peer, msg *p2p.MsgHeaders) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	s := m.sync
+	if s == nil || s.peer != p || s.fetching {
+		p.Misbehaving(p2p.SCORE_UNSOLICITED, "unsolicited headers")
+		return
+	}
+	s.updated = m.clock.Now()
+	if len(msg.Headers) == 0 {
+		if !s.started {
+			// the tip of the peer is in our chain
+			m.proveHeight(p, m.bc.Height())
+			m.finishSync("up to date")
+		} else {
+			m.fetchBodies()
+		}
+		return
+	}
+	if err := m.addHeaders(s, msg.Headers); err != nil {
+		m.abortSync(err.Error())
+		p.Misbehaving(p2p.SCORE_INVALID_HEADERS, err.Error())
+		return
+	}
+	if len(msg.Headers) == p2p.MAX_HEADERS {
+		p.Send(&p2p.MsgGetHeaders{Locator: [][32]byte{s.last}})
+		return
+	}
+	m.fetchBodies()
+}
+
+// addHeaders checks that headers follow the ones already received, or our
+// chain for the first batch, and meet the proof of work
+func (m *Manager) addHeaders(s *syncState, headers []*blockchain.Header) error {
+	prev := s.last
+	if !s.started {
+		prev = headers[0].PreviousHash
+		s.ancestor = m.bc.HeightOf(prev)
+		if s.ancestor < 0 {
+			return ErrHeadersDisconnected
+		}
+		s.started = true
+	}
+	difficulty := m.bc.Network().Difficulty
+	for _, h := range headers {
+		if h.PreviousHash != prev {
+			return ErrHeadersNotChained
+		}
+		if !blockchain.ValidProof(h, difficulty) {
+			return fmt.Errorf("header %x does not meet the proof of work", h.Hash())
+		}
+		prev = h.Hash()
+		s.last = prev
+		// skip the blocks we have, the locator may be coarser than the fork
+		if len(s.headers) == 0 && m.bc.HeightOf(prev) == s.ancestor+1 {
+			s.ancestor++
+			continue
+		}
+		s.index[prev] = len(s.headers)
+		s.headers = append(s.headers, h)
+		s.hashes = append(s.hashes, prev)
+	}
+	return nil
+}
+
+// fetchBodies starts downloading the blocks once all the headers are known
+func (m *Manager) fetchBodies() {
+	s := m.sync
+	if s.ancestor+len(s.headers) <= m.bc.Height() {
+		m.proveHeight(s.peer, s.ancestor+len(s.headers))
+		m.finishSync("peer chain is not longer")
+		return
+	}
+	log.Printf("Synchronizing %d blocks above height %d from peer %v", len(s.headers), s.ancestor, s.peer)
+	s.fetching = true
+	m.requestBodies()
+}
+
+// syncPeers lists the peers to download blocks from: the sync peer first,
+// then the peers which announced a chain above the common ancestor
+func (m *Manager) syncPeers() []*p2p.Peer {
+	s := m.sync
+	peers := []*p2p.Peer{s.peer}
+	others := m.server.Peers()
+	sort.Slice(others, func(i, j int) bool { return others[i].Addr() < others[j].Addr() })
+	for _, p := range others {
+		if p != s.peer && m.claims[p] > s.ancestor {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// requestBodies spreads the missing blocks over the sync peers, round
+// robin, keeping at most BLOCKS_PER_PEER requests in flight per peer
+func (m *Manager) requestBodies() {
+	s := m.sync
+	peers := m.syncPeers()
+	load := make(map[*p2p.Peer]int)
+	for _, req := range s.inflight {
+		load[req.peer]++
+	}
+	batches := make(map[*p2p.Peer][]p2p.InvVect)
+	now := m.clock.Now()
+	turn := 0
+	for i := s.next; i < len(s.headers); i++ {
+		hash := s.hashes[i]
+		if s.bodies[i] != nil || s.inflight[hash] != nil {
+			continue
+		}
+		var chosen *p2p.Peer
+		for tries := 0; tries < len(peers) && chosen == nil; tries++ {
+			p := peers[turn%len(peers)]
+			turn++
+			if load[p] < BLOCKS_PER_PEER {
+				chosen = p
+			}
+		}
+		if chosen == nil {
+			break
+		}
+		load[chosen]++
+		s.inflight[hash] = &blockRequest{peer: chosen, sent: now}
+		batches[chosen] = append(batches[chosen], p2p.InvVect{Type: p2p.INV_BLOCK, Hash: hash})
+	}
+	for p, items := range batches {
+		p.Send(&p2p.MsgGetData{Items: items})
+	}
+}
+
+// syncBlock takes the blocks requested by the sync. It tells whether b was
+// one of them.
+func (m *Manager) syncBlock(p *p2p.Peer, b *blockchain.Block) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	s := m.sync
+	if s == nil {
+		return false
+	}
+	hash := b.Hash()
+	i, ok := s.index[hash]
+	if !ok {
+		return false
+	}
+	delete(s.inflight, hash)
+	if i >= s.next && s.bodies[i] == nil {
+		s.bodies[i] = b
+		s.updated = m.clock.Now()
+	}
+	m.known.Add(hash)
+	m.connectBodies()
+	if m.sync != nil && m.sync.fetching {
+		m.requestBodies()
+	}
+	return true
+}
+
+// connectBodies adds the downloaded blocks to the chain. Blocks extending our
+// tip are added as they arrive; blocks forking from it replace our chain at
+// once, when all of them are there.
+func (m *Manager) connectBodies() {
+	s := m.sync
+	for s.next < len(s.headers) && s.bodies[s.next] != nil && m.bc.Height() == s.ancestor+s.next {
+		err := m.bc.AddBlock(s.bodies[s.next])
+		if errors.Is(err, blockchain.ErrStaleBlock) {
+			break // our tip just moved
+		}
+		if err != nil {
+			m.abortSync(err.Error())
+			return
+		}
+		delete(s.bodies, s.next)
+		s.next++
+	}
+	if s.next < len(s.headers) && len(s.bodies) == len(s.headers)-s.next {
+		blocks := make([]*blockchain.Block, 0, len(s.bodies))
+		for i := s.next; i < len(s.headers); i++ {
+			blocks = append(blocks, s.bodies[i])
+		}
+		switch err := m.bc.ReplaceFrom(s.ancestor+s.next, blocks); {
+		case errors.Is(err, blockchain.ErrShorterChain):
+			m.finishSync("our chain grew longer")
+			return
+		case err != nil:
+			m.abortSync(err.Error())
+			return
+		}
+		log.Printf("Chain reorganized from height %d", s.ancestor+s.next)
+		s.next = len(s.headers)
+	}
+	if s.next < len(s.headers) {
+		return
+	}
+	m.pruneTransactions()
+	log.Printf("Synchronized up to height %d with peer %v", m.bc.Height(), s.peer)
+	// the peer may have found more blocks meanwhile
+	s.reset(m.clock.Now())
+	s.peer.Send(&p2p.MsgGetHeaders{Locator: m.bc.Locator()})
+}
@@ -0,0 +1,320 @@
+package p2p
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	DEFAULT_MAX_INBOUND     = 32
+	DEFAULT_TARGET_OUTBOUND = 8
+	CONNECT_INTERVAL        = 20 * time.Second
+	// Addresses failing MAX_ADDRESS_FAILURES dials in a row are forgotten,
+	// unless they are persistent
+	MAX_ADDRESS_FAILURES = 5
+	// Size of the address book, addresses learned from peers are ignored
+	// once it is full
+	MAX_KNOWN_ADDRESSES = 2000
+)
+
+// knownAddress is an address the server may dial to reach its outbound target
+type knownAddress struct {
+	Addr string `json:"addr"`
+	// Persistent addresses are configured: they are always dialed, whatever
+	// the outbound target, and never forgotten
+	Persistent  bool      `json:"-"`
+	LastSeen    time.Time `json:"last_seen"` // last time a peer reached it
+	LastAttempt time.Time `json:"last_attempt"`
+	LastSuccess time.Time `json:"last_success"`
+	Failures    int       `json:"failures"`
+}
+
+// AddAddress registers an address to dial. Adding a known address again
+// only makes it persistent if requested.
+func (s *Server) AddAddress(addr string, persistent bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if a, ok := s.addrs[addr]; ok {
+		a.Persistent = a.Persistent || persistent
+		return
+	}
+	s.addrs[addr] = &knownAddress{Addr: addr, Persistent: persistent}
+	s.addrsChanged = true
+}
+
+// LearnAddress adds a host:port found outside of the peers, by multicast
+// discovery, like the addresses the peers share
+func (s *Server) LearnAddress(addr string) {
+	host, port, err := net.SplitHostPort(addr)
+	n, _ := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return
+	}
+	s.learnAddress(NetAddress{Host: host, Port: uint16(n), LastSeen: s.clock.Now().Unix()})
+}
+
+// learnAddress adds an address shared by a peer to the address book. Only
+// IP addresses are accepted, peers cannot make us resolve names.
+func (s *Server) learnAddress(na NetAddress) {
+	ip := net.ParseIP(na.Host)
+	if ip == nil || ip.IsUnspecified() || ip.IsMulticast() || na.Port == 0 {
+		return
+	}
+	addr := na.String()
+	seen := time.Unix(na.LastSeen, 0)
+	if seen.After(s.clock.Now()) {
+		seen = s.clock.Now()
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.self[addr] {
+		return
+	}
+	if a, ok := s.addrs[addr]; ok {
+		if seen.After(a.LastSeen) {
+			a.LastSeen = seen
+		}
+		return
+	}
+	if len(s.addrs) >= MAX_KNOWN_ADDRESSES {
+		return
+	}
+	s.addrs[addr] = &knownAddress{Addr: addr, LastSeen: seen}
+	s.addrsChanged = true
+}
+
+// handleGetAddr answers a getaddr with the addresses we reached, most
+// recent first. A peer is answered once per connection.
+func (s *Server) handleGetAddr(p *Peer) {
+	p.mux.Lock()
+	answered := p.addrSent
+	p.addrSent = true
+	p.mux.Unlock()
+	if answered {
+		return
+	}
+	var shared []NetAddress
+	for _, a := range s.Addresses() {
+		if a.LastSuccess.IsZero() || a.Addr == p.ListenAddr() {
+			continue
+		}
+		host, port, err := net.SplitHostPort(a.Addr)
+		n, _ := strconv.ParseUint(port, 10, 16)
+		if err != nil || net.ParseIP(host) == nil || n == 0 {
+			continue
+		}
+		shared = append(shared, NetAddress{Host: host, Port: uint16(n), LastSeen: a.LastSuccess.Unix()})
+	}
+	sort.Slice(shared, func(i, j int) bool { return shared[i].LastSeen > shared[j].LastSeen })
+	if len(shared) > MAX_ADDR_ITEMS {
+		shared = shared[:MAX_ADDR_ITEMS]
+	}
+	p.Send(&MsgAddr{Addresses: shared})
+}
+
+func (s *Server) handleAddr(p *Peer, msg *MsgAddr) {
+	for _, na := range msg.Addresses {
+		s.learnAddress(na)
+	}
+	log.Printf("DEBUG: peer %v shared %d addresses", p, len(msg.Addresses))
+}
+
+// Addresses lists the known addresses
+func (s *Server) Addresses() []knownAddress {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	addrs := make([]knownAddress, 0, len(s.addrs))
+	for _, a := range s.addrs {
+		addrs = append(addrs, *a)
+	}
+	return addrs
+}
+
+func (s *Server) maxInbound() int {
+	if s.config.MaxInbound > 0 {
+		return s.config.MaxInbound
+	}
+	return DEFAULT_MAX_INBOUND
+}
+
+func (s *Server) targetOutbound() int {
+	if s.config.TargetOutbound > 0 {
+		return s.config.TargetOutbound
+	}
+	return DEFAULT_TARGET_OUTBOUND
+}
+
+func (s *Server) connectInterval() time.Duration {
+	if s.config.ConnectInterval > 0 {
+		return s.config.ConnectInterval
+	}
+	return CONNECT_INTERVAL
+}
+
+// countPeers returns the number of inbound and outbound peers
+func (s *Server) countPeers() (inbound int, outbound int) {
+	for _, p := range s.Peers() {
+		if p.inbound {
+			inbound++
+		} else {
+			outbound++
+		}
+	}
+	return inbound, outbound
+}
+
+func (s *Server) connectLoop() {
+	for {
+		s.connectAddresses()
+		s.saveChangedAddresses()
+		select {
+		case <-s.clock.After(s.connectInterval()):
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// connectAddresses dials the persistent addresses which are not connected,
+// then other known addresses until the outbound target is reached. An
+// address failing repeatedly is retried less and less often.
+func (s *Server) connectAddresses() {
+	_, outbound := s.countPeers()
+	now := s.clock.Now()
+	for _, a := range s.candidates() {
+		if !a.Persistent && outbound >= s.targetOutbound() {
+			continue
+		}
+		if s.Connected(a.Addr) || s.Banned(hostOf(a.Addr)) ||
+			now.Sub(a.LastAttempt) < time.Duration(a.Failures)*s.connectInterval() {
+			continue
+		}
+		_, err := s.Connect(a.Addr)
+		s.dialed(a.Addr, err)
+		if err != nil {
+			log.Printf("WARN: peer %s: %v", a.Addr, err)
+			continue
+		}
+		outbound++
+	}
+}
+
+// candidates sorts the known addresses: persistent ones first, then the
+// ones failing the least
+func (s *Server) candidates() []knownAddress {
+	addrs := s.Addresses()
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].Persistent != addrs[j].Persistent {
+			return addrs[i].Persistent
+		}
+		if addrs[i].Failures != addrs[j].Failures {
+			return addrs[i].Failures < addrs[j].Failures
+		}
+		return addrs[i].Addr < addrs[j].Addr
+	})
+	return addrs
+}
+
+// dialed records the outcome of a dial, forgetting dead addresses
+func (s *Server) dialed(addr string, err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	a, ok := s.addrs[addr]
+	if !ok {
+		return
+	}
+	s.addrsChanged = true
+	a.LastAttempt = s.clock.Now()
+	if err == nil {
+		a.LastSuccess = a.LastAttempt
+		a.Failures = 0
+		return
+	}
+	if errors.Is(err, ErrSelfConnection) {
+		// our own address, shared back by a peer
+		s.self[addr] = true
+		delete(s.addrs, addr)
+		return
+	}
+	a.Failures++
+	if !a.Persistent && a.Failures >= MAX_ADDRESS_FAILURES {
+		delete(s.addrs, addr)
+		log.Printf("Forgetting peer address %s after %d failures", addr, a.Failures)
+	}
+}
+
+// addressBook is the file format of the address book
+type addressBook struct {
+	Addresses []knownAddress `json:"addresses"`
+}
+
+// LoadAddresses reads the address book saved by SaveAddresses, so that a
+// restarted node finds its peers again. A missing file is not an error.
+func (s *Server) LoadAddresses() error {
+	m, err := os.ReadFile(s.config.AddressFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var book addressBook
+	if err := json.Unmarshal(m, &book); err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i := range book.Addresses {
+		a := book.Addresses[i]
+		if _, ok := s.addrs[a.Addr]; ok || len(s.addrs) >= MAX_KNOWN_ADDRESSES {
+			continue
+		}
+		s.addrs[a.Addr] = &a
+	}
+	return nil
+}
+
+// SaveAddresses writes the address book, configured addresses excepted
+func (s *Server) SaveAddresses() error {
+	s.mux.Lock()
+	book := addressBook{Addresses: make([]knownAddress, 0, len(s.addrs))}
+	for _, a := range s.addrs {
+		if !a.Persistent {
+			book.Addresses = append(book.Addresses, *a)
+		}
+	}
+	s.addrsChanged = false
+	s.mux.Unlock()
+	sort.Slice(book.Addresses, func(i, j int) bool { return book.Addresses[i].Addr < book.Addresses[j].Addr })
+	m, _ := json.MarshalIndent(&book, "", "  ")
+	path := s.config.AddressFile
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// write then rename, a crash never leaves a truncated book behind
+	if err := os.WriteFile(path+".tmp", m, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// saveChangedAddresses saves the address book when it changed since the
+// last save
+func (s *Server) saveChangedAddresses() {
+	s.mux.Lock()
+	changed := s.addrsChanged
+	s.mux.Unlock()
+	if s.config.AddressFile == "" || !changed {
+		return
+	}
+	if err := s.SaveAddresses(); err != nil {
+		log.Printf("ERROR: saving peer addresses: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package p2p
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"moviecoin/security"
+)
+
+// Peers authenticate each other during the handshake: each side sends a
+// random challenge and an ephemeral session key in its version message, and
+// answers the challenge of the other side with an auth message signed by its
+// node key. The signature covers both challenges, both session keys and the
+// network magic, so it cannot be replayed on another connection, and the
+// session it authenticates is encrypted with keys only the two signers can
+// derive, see session.go.
+
+var (
+	ErrAuthFailed = errors.New("peer authentication failed")
+	ErrNotAllowed = errors.New("node is not allowed to connect")
+)
+
+const authDomain = "moviecoin peer auth"
+
+// handshakeKeys are the challenges and the session keys sent in the version
+// messages of a connection, by the peer and by ourselves
+type handshakeKeys struct {
+	challenge, ownChallenge   [32]byte
+	sessionKey, ownSessionKey [32]byte
+}
+
+// theirs is the same handshake seen from the peer
+func (k handshakeKeys) theirs() handshakeKeys {
+	return handshakeKeys{k.ownChallenge, k.challenge, k.ownSessionKey, k.sessionKey}
+}
+
+// authPayload is what the node which sent the own values signs
+func authPayload(magic uint32, k handshakeKeys) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(authDomain)
+	binary.Write(&buf, binary.BigEndian, magic)
+	buf.Write(k.challenge[:])
+	buf.Write(k.ownChallenge[:])
+	buf.Write(k.sessionKey[:])
+	buf.Write(k.ownSessionKey[:])
+	return buf.Bytes()
+}
+
+// authMessage answers the challenge of the peer
+func (s *Server) authMessage(k handshakeKeys) (*MsgAuth, error) {
+	sig, err := s.key.Sign(authPayload(s.config.Network.Magic, k))
+	if err != nil {
+		return nil, err
+	}
+	m := &MsgAuth{Signature: sig}
+	pub := s.key.PublicKey()
+	pub.X.FillBytes(m.PublicKey[:32])
+	pub.Y.FillBytes(m.PublicKey[32:])
+	return m, nil
+}
+
+// checkAuth verifies the answer of the peer to our challenge and returns
+// the peer node ID
+func (s *Server) checkAuth(m *MsgAuth, k handshakeKeys) (string, error) {
+	publicKey, err := security.PublicKeyFromHex(hex.EncodeToString(m.PublicKey[:]))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrAuthFailed, err)
+	}
+	if !security.VerifySignature(publicKey, authPayload(s.config.Network.Magic, k.theirs()), m.Signature) {
+		return "", fmt.Errorf("%w: bad signature", ErrAuthFailed)
+	}
+	id := security.NodeID(publicKey)
+	if id == s.key.ID() {
+		return "", ErrSelfConnection
+	}
+	if len(s.allowed) > 0 && !s.allowed[id] {
+		return "", fmt.Errorf("%w: %s", ErrNotAllowed, id)
+	}
+	return id, nil
+}
+
+// NodeID identifies this node to its peers
+func (s *Server) NodeID() string {
+	return s.key.ID()
+}
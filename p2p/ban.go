@@ -0,0 +1,109 @@
+package p2p
+
+import (
+	"log"
+	"net"
+	"time"
+)
+
+// Peers accumulate a ban score when they misbehave and are banned for the
+// configured period once it reaches BAN_THRESHOLD. Scores are per connection,
+// bans are per host.
+const (
+	BAN_THRESHOLD        = 100
+	DEFAULT_BAN_DURATION = 24 * time.Hour
+
+	SCORE_INVALID_BLOCK   = 100
+	SCORE_INVALID_HEADERS = 50
+	// the headers of the peer end below the height it announced
+	SCORE_FALSE_HEIGHT = 50
+	SCORE_MALFORMED    = 25
+	SCORE_INVALID_TX   = 10
+	SCORE_UNSOLICITED  = 5
+)
+
+// Misbehaving adds score to the ban score of the peer, banning and
+// disconnecting it when the score reaches BAN_THRESHOLD
+func (p *Peer) Misbehaving(score int, reason string) {
+	p.mux.Lock()
+	p.banScore += score
+	total := p.banScore
+	p.mux.Unlock()
+	log.Printf("WARN: peer %v misbehaving (+%d = %d): %s", p, score, total, reason)
+	if total >= BAN_THRESHOLD {
+		p.server.Ban(p.host, p.server.banDuration())
+		p.Disconnect()
+	}
+}
+
+func (p *Peer) BanScore() int {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.banScore
+}
+
+func (s *Server) banDuration() time.Duration {
+	if s.config.BanDuration > 0 {
+		return s.config.BanDuration
+	}
+	return DEFAULT_BAN_DURATION
+}
+
+// Ban refuses connections from and to host for d, disconnecting the peers
+// already connected from there
+func (s *Server) Ban(host string, d time.Duration) {
+	s.mux.Lock()
+	s.bans[host] = s.clock.Now().Add(d)
+	s.mux.Unlock()
+	log.Printf("WARN: host %s banned until %v", host, s.clock.Now().Add(d).Format(time.RFC3339))
+	for _, p := range s.Peers() {
+		if p.host == host {
+			p.Disconnect()
+		}
+	}
+}
+
+// Unban lifts the ban of host and tells whether there was one
+func (s *Server) Unban(host string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	_, ok := s.bans[host]
+	delete(s.bans, host)
+	return ok
+}
+
+func (s *Server) Banned(host string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	until, ok := s.bans[host]
+	if ok && s.clock.Now().After(until) {
+		delete(s.bans, host)
+		return false
+	}
+	return ok
+}
+
+// Bans lists the banned hosts with the end of their ban
+func (s *Server) Bans() map[string]time.Time {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	bans := make(map[string]time.Time)
+	now := s.clock.Now()
+	for host, until := range s.bans {
+		if now.After(until) {
+			delete(s.bans, host)
+			continue
+		}
+		bans[host] = until
+	}
+	return bans
+}
+
+// hostOf returns the host part of a host:port address
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
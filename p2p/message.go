@@ -0,0 +1,590 @@
+package p2p
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"moviecoin/blockchain"
+	"net"
+	"strconv"
+)
+
+// Protocol versions spoken by this node. Peers announcing a version below
+// MIN_PROTOCOL_VERSION are disconnected during the handshake. Version 2
+// authenticates the peers with their node key, version 3 encrypts the
+// session with keys bound to that authentication.
+const (
+	PROTOCOL_VERSION     uint32 = 3
+	MIN_PROTOCOL_VERSION uint32 = 3
+)
+
+const (
+	CMD_VERSION    = "version"
+	CMD_VERACK     = "verack"
+	CMD_AUTH       = "auth"
+	CMD_PING       = "ping"
+	CMD_PONG       = "pong"
+	CMD_INV        = "inv"
+	CMD_GETDATA    = "getdata"
+	CMD_NOTFOUND   = "notfound"
+	CMD_GETHEADERS = "getheaders"
+	CMD_HEADERS    = "headers"
+	CMD_BLOCK      = "block"
+	CMD_TX         = "tx"
+	CMD_GETADDR    = "getaddr"
+	CMD_ADDR       = "addr"
+)
+
+// Limits on the number of items in a single message
+const (
+	MAX_INV_ITEMS      = 50000
+	MAX_HEADERS        = 2000
+	MAX_LOCATOR_HASHES = 500
+	MAX_BLOCK_TXS      = 100000
+	MAX_USER_AGENT     = 256
+	MAX_ADDR_ITEMS     = 1000
+	MAX_SIGNATURE_SIZE = 128
+)
+
+// Inventory types
+const (
+	INV_TX    uint32 = 1
+	INV_BLOCK uint32 = 2
+)
+
+// Message is a payload carried by a frame
+type Message interface {
+	Command() string
+	Encode(w io.Writer) error
+	Decode(r *bytes.Reader) error
+}
+
+func makeEmptyMessage(command string) (Message, error) {
+	switch command {
+	case CMD_VERSION:
+		return &MsgVersion{}, nil
+	case CMD_VERACK:
+		return &MsgVerAck{}, nil
+	case CMD_AUTH:
+		return &MsgAuth{}, nil
+	case CMD_PING:
+		return &MsgPing{}, nil
+	case CMD_PONG:
+		return &MsgPong{}, nil
+	case CMD_INV:
+		return &MsgInv{}, nil
+	case CMD_GETDATA:
+		return &MsgGetData{}, nil
+	case CMD_NOTFOUND:
+		return &MsgNotFound{}, nil
+	case CMD_GETHEADERS:
+		return &MsgGetHeaders{}, nil
+	case CMD_HEADERS:
+		return &MsgHeaders{}, nil
+	case CMD_BLOCK:
+		return &MsgBlock{}, nil
+	case CMD_TX:
+		return &MsgTx{}, nil
+	case CMD_GETADDR:
+		return &MsgGetAddr{}, nil
+	case CMD_ADDR:
+		return &MsgAddr{}, nil
+	}
+	return nil, fmt.Errorf("unknown command %q", command)
+}
+
+// MsgVersion opens the handshake. Both sides send one and answer the
+// other's with a verack once they checked it is compatible.
+type MsgVersion struct {
+	ProtocolVersion uint32
+	ChainID         uint32
+	GenesisHash     [32]byte
+	BestHeight      uint32
+	// Nonce is random per node, it detects connections to ourselves
+	Nonce uint64
+	// Challenge is random per connection, the peer signs it to prove its
+	// identity
+	Challenge [32]byte
+	// SessionKey is the ephemeral X25519 key of the sender for this
+	// connection
+	SessionKey [32]byte
+	Timestamp  int64
+	ListenPort uint16
+	UserAgent  string
+}
+
+func (m *MsgVersion) Command() string { return CMD_VERSION }
+
+func (m *MsgVersion) Encode(w io.Writer) error {
+	for _, v := range []uint32{m.ProtocolVersion, m.ChainID} {
+		if err := writeUint32(w, v); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write(m.GenesisHash[:]); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.BestHeight); err != nil {
+		return err
+	}
+	if err := writeUint64(w, m.Nonce); err != nil {
+		return err
+	}
+	if _, err := w.Write(m.Challenge[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(m.SessionKey[:]); err != nil {
+		return err
+	}
+	if err := writeUint64(w, uint64(m.Timestamp)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.ListenPort); err != nil {
+		return err
+	}
+	if len(m.UserAgent) > MAX_USER_AGENT {
+		return errors.New("user agent too long")
+	}
+	return writeString(w, m.UserAgent)
+}
+
+func (m *MsgVersion) Decode(r *bytes.Reader) (err error) {
+	if m.ProtocolVersion, err = readUint32(r); err != nil {
+		return err
+	}
+	if m.ChainID, err = readUint32(r); err != nil {
+		return err
+	}
+	if m.GenesisHash, err = readHash(r); err != nil {
+		return err
+	}
+	if m.BestHeight, err = readUint32(r); err != nil {
+		return err
+	}
+	if m.Nonce, err = readUint64(r); err != nil {
+		return err
+	}
+	if m.Challenge, err = readHash(r); err != nil {
+		return err
+	}
+	if m.SessionKey, err = readHash(r); err != nil {
+		return err
+	}
+	timestamp, err := readUint64(r)
+	if err != nil {
+		return err
+	}
+	m.Timestamp = int64(timestamp)
+	if m.ListenPort, err = readUint16(r); err != nil {
+		return err
+	}
+	if m.UserAgent, err = readString(r); err != nil {
+		return err
+	}
+	if len(m.UserAgent) > MAX_USER_AGENT {
+		return errors.New("user agent too long")
+	}
+	return nil
+}
+
+// MsgVerAck accepts the version of the peer
+type MsgVerAck struct{}
+
+func (m *MsgVerAck) Command() string              { return CMD_VERACK }
+func (m *MsgVerAck) Encode(w io.Writer) error     { return nil }
+func (m *MsgVerAck) Decode(r *bytes.Reader) error { return nil }
+
+// MsgAuth proves that the sender owns the node key of its node ID, see
+// Server.checkAuth
+type MsgAuth struct {
+	PublicKey [64]byte // X and Y
+	Signature []byte   // ASN.1 ECDSA signature
+}
+
+func (m *MsgAuth) Command() string { return CMD_AUTH }
+
+func (m *MsgAuth) Encode(w io.Writer) error {
+	if len(m.Signature) > MAX_SIGNATURE_SIZE {
+		return errors.New("signature too long")
+	}
+	if _, err := w.Write(m.PublicKey[:]); err != nil {
+		return err
+	}
+	if err := writeVarInt(w, uint64(len(m.Signature))); err != nil {
+		return err
+	}
+	_, err := w.Write(m.Signature)
+	return err
+}
+
+func (m *MsgAuth) Decode(r *bytes.Reader) error {
+	if _, err := io.ReadFull(r, m.PublicKey[:]); err != nil {
+		return err
+	}
+	n, err := readVarInt(r, MAX_SIGNATURE_SIZE)
+	if err != nil {
+		return err
+	}
+	m.Signature = make([]byte, n)
+	_, err = io.ReadFull(r, m.Signature)
+	return err
+}
+
+// MsgPing keeps idle connections alive and measures the latency, the peer
+// answers with a pong carrying the same nonce
+type MsgPing struct {
+	Nonce uint64
+}
+
+func (m *MsgPing) Command() string          { return CMD_PING }
+func (m *MsgPing) Encode(w io.Writer) error { return writeUint64(w, m.Nonce) }
+func (m *MsgPing) Decode(r *bytes.Reader) (err error) {
+	m.Nonce, err = readUint64(r)
+	return err
+}
+
+type MsgPong struct {
+	Nonce uint64
+}
+
+func (m *MsgPong) Command() string          { return CMD_PONG }
+func (m *MsgPong) Encode(w io.Writer) error { return writeUint64(w, m.Nonce) }
+func (m *MsgPong) Decode(r *bytes.Reader) (err error) {
+	m.Nonce, err = readUint64(r)
+	return err
+}
+
+// InvVect names a block or a transaction by its hash
+type InvVect struct {
+	Type uint32
+	Hash [32]byte
+}
+
+type invList []InvVect
+
+func (l invList) encode(w io.Writer) error {
+	if len(l) > MAX_INV_ITEMS {
+		return fmt.Errorf("%d inventory items exceed %d", len(l), MAX_INV_ITEMS)
+	}
+	if err := writeVarInt(w, uint64(len(l))); err != nil {
+		return err
+	}
+	for _, iv := range l {
+		if err := writeUint32(w, iv.Type); err != nil {
+			return err
+		}
+		if _, err := w.Write(iv.Hash[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeInvList(r *bytes.Reader) (invList, error) {
+	n, err := readVarInt(r, MAX_INV_ITEMS)
+	if err != nil {
+		return nil, err
+	}
+	l := make(invList, n)
+	for i := range l {
+		if l[i].Type, err = readUint32(r); err != nil {
+			return nil, err
+		}
+		if l[i].Hash, err = readHash(r); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// MsgInv announces blocks or transactions the sender has
+type MsgInv struct {
+	Items []InvVect
+}
+
+func (m *MsgInv) Command() string          { return CMD_INV }
+func (m *MsgInv) Encode(w io.Writer) error { return invList(m.Items).encode(w) }
+func (m *MsgInv) Decode(r *bytes.Reader) (err error) {
+	m.Items, err = decodeInvList(r)
+	return err
+}
+
+// MsgGetData requests the announced items the receiver does not have yet
+type MsgGetData struct {
+	Items []InvVect
+}
+
+func (m *MsgGetData) Command() string          { return CMD_GETDATA }
+func (m *MsgGetData) Encode(w io.Writer) error { return invList(m.Items).encode(w) }
+func (m *MsgGetData) Decode(r *bytes.Reader) (err error) {
+	m.Items, err = decodeInvList(r)
+	return err
+}
+
+// MsgNotFound answers the getdata items the sender does not know about
+type MsgNotFound struct {
+	Items []InvVect
+}
+
+func (m *MsgNotFound) Command() string          { return CMD_NOTFOUND }
+func (m *MsgNotFound) Encode(w io.Writer) error { return invList(m.Items).encode(w) }
+func (m *MsgNotFound) Decode(r *bytes.Reader) (err error) {
+	m.Items, err = decodeInvList(r)
+	return err
+}
+
+// MsgGetHeaders asks for the headers following the first locator hash the
+// receiver knows, up to Stop (zero for as many as allowed)
+type MsgGetHeaders struct {
+	Locator [][32]byte
+	Stop    [32]byte
+}
+
+func (m *MsgGetHeaders) Command() string { return CMD_GETHEADERS }
+
+func (m *MsgGetHeaders) Encode(w io.Writer) error {
+	if len(m.Locator) > MAX_LOCATOR_HASHES {
+		return fmt.Errorf("%d locator hashes exceed %d", len(m.Locator), MAX_LOCATOR_HASHES)
+	}
+	if err := writeVarInt(w, uint64(len(m.Locator))); err != nil {
+		return err
+	}
+	for _, h := range m.Locator {
+		if _, err := w.Write(h[:]); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(m.Stop[:])
+	return err
+}
+
+func (m *MsgGetHeaders) Decode(r *bytes.Reader) error {
+	n, err := readVarInt(r, MAX_LOCATOR_HASHES)
+	if err != nil {
+		return err
+	}
+	m.Locator = make([][32]byte, n)
+	for i := range m.Locator {
+		if m.Locator[i], err = readHash(r); err != nil {
+			return err
+		}
+	}
+	m.Stop, err = readHash(r)
+	return err
+}
+
+// MsgHeaders carries consecutive block headers
+type MsgHeaders struct {
+	Headers []*blockchain.Header
+}
+
+func (m *MsgHeaders) Command() string { return CMD_HEADERS }
+
+func (m *MsgHeaders) Encode(w io.Writer) error {
+	if len(m.Headers) > MAX_HEADERS {
+		return fmt.Errorf("%d headers exceed %d", len(m.Headers), MAX_HEADERS)
+	}
+	if err := writeVarInt(w, uint64(len(m.Headers))); err != nil {
+		return err
+	}
+	for _, h := range m.Headers {
+		if _, err := w.Write(h.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MsgHeaders) Decode(r *bytes.Reader) error {
+	n, err := readVarInt(r, MAX_HEADERS)
+	if err != nil {
+		return err
+	}
+	m.Headers = make([]*blockchain.Header, n)
+	buf := make([]byte, blockchain.HEADER_SIZE)
+	for i := range m.Headers {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		if m.Headers[i], err = blockchain.HeaderFromBytes(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MsgBlock carries a full block: its header followed by the transactions
+type MsgBlock struct {
+	Block *blockchain.Block
+}
+
+func (m *MsgBlock) Command() string { return CMD_BLOCK }
+
+func (m *MsgBlock) Encode(w io.Writer) error {
+	if _, err := w.Write(m.Block.Header().Bytes()); err != nil {
+		return err
+	}
+	txs := m.Block.Transactions()
+	if err := writeVarInt(w, uint64(len(txs))); err != nil {
+		return err
+	}
+	for _, t := range txs {
+		if err := writeString(w, t.Sender()); err != nil {
+			return err
+		}
+		if err := writeString(w, t.Receiver()); err != nil {
+			return err
+		}
+		if err := writeFloat32(w, t.Amount()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MsgBlock) Decode(r *bytes.Reader) error {
+	buf := make([]byte, blockchain.HEADER_SIZE)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	h, err := blockchain.HeaderFromBytes(buf)
+	if err != nil {
+		return err
+	}
+	n, err := readVarInt(r, MAX_BLOCK_TXS)
+	if err != nil {
+		return err
+	}
+	txs := make([]*blockchain.Transaction, n)
+	for i := range txs {
+		sender, err := readString(r)
+		if err != nil {
+			return err
+		}
+		receiver, err := readString(r)
+		if err != nil {
+			return err
+		}
+		amount, err := readFloat32(r)
+		if err != nil {
+			return err
+		}
+		txs[i] = blockchain.NewTransaction(sender, receiver, amount)
+	}
+	m.Block, err = blockchain.NewBlockFromHeader(h, txs)
+	return err
+}
+
+// MsgTx relays a signed transaction which is not in a block yet
+type MsgTx struct {
+	Transaction *blockchain.TransactionRequest
+}
+
+func (m *MsgTx) Command() string { return CMD_TX }
+
+func (m *MsgTx) Encode(w io.Writer) error {
+	t := m.Transaction
+	if !t.Validate() {
+		return errors.New("incomplete transaction")
+	}
+	for _, s := range []string{*t.SenderAddress, *t.ReceiverAddress, *t.SenderPublicKey, *t.Signature} {
+		if err := writeString(w, s); err != nil {
+			return err
+		}
+	}
+	return writeFloat32(w, *t.Amount)
+}
+
+func (m *MsgTx) Decode(r *bytes.Reader) error {
+	var fields [4]string
+	for i := range fields {
+		s, err := readString(r)
+		if err != nil {
+			return err
+		}
+		fields[i] = s
+	}
+	amount, err := readFloat32(r)
+	if err != nil {
+		return err
+	}
+	m.Transaction = &blockchain.TransactionRequest{
+		SenderAddress:   &fields[0],
+		ReceiverAddress: &fields[1],
+		SenderPublicKey: &fields[2],
+		Signature:       &fields[3],
+		Amount:          &amount,
+	}
+	return nil
+}
+
+// MsgGetAddr asks the peer for the addresses of the nodes it knows
+type MsgGetAddr struct{}
+
+func (m *MsgGetAddr) Command() string              { return CMD_GETADDR }
+func (m *MsgGetAddr) Encode(w io.Writer) error     { return nil }
+func (m *MsgGetAddr) Decode(r *bytes.Reader) error { return nil }
+
+// NetAddress is the peer to peer address of a node, with the last time the
+// sender reached it
+type NetAddress struct {
+	Host     string
+	Port     uint16
+	LastSeen int64 // unix seconds
+}
+
+func (a NetAddress) String() string {
+	return net.JoinHostPort(a.Host, strconv.Itoa(int(a.Port)))
+}
+
+// MsgAddr shares node addresses, in answer to getaddr
+type MsgAddr struct {
+	Addresses []NetAddress
+}
+
+func (m *MsgAddr) Command() string { return CMD_ADDR }
+
+func (m *MsgAddr) Encode(w io.Writer) error {
+	if len(m.Addresses) > MAX_ADDR_ITEMS {
+		return fmt.Errorf("%d addresses exceed %d", len(m.Addresses), MAX_ADDR_ITEMS)
+	}
+	if err := writeVarInt(w, uint64(len(m.Addresses))); err != nil {
+		return err
+	}
+	for _, a := range m.Addresses {
+		if err := writeString(w, a.Host); err != nil {
+			return err
+		}
+		if err := writeUint16(w, a.Port); err != nil {
+			return err
+		}
+		if err := writeUint64(w, uint64(a.LastSeen)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MsgAddr) Decode(r *bytes.Reader) error {
+	n, err := readVarInt(r, MAX_ADDR_ITEMS)
+	if err != nil {
+		return err
+	}
+	m.Addresses = make([]NetAddress, n)
+	for i := range m.Addresses {
+		a := &m.Addresses[i]
+		if a.Host, err = readString(r); err != nil {
+			return err
+		}
+		if a.Port, err = readUint16(r); err != nil {
+			return err
+		}
+		lastSeen, err := readUint64(r)
+		if err != nil {
+			return err
+		}
+		a.LastSeen = int64(lastSeen)
+	}
+	return nil
+}
@@ -0,0 +1,496 @@
+package p2p
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"moviecoin/blockchain"
+	"moviecoin/params"
+	"moviecoin/security"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeChain struct {
+	genesis [32]byte
+	height  int
+}
+
+func (c *fakeChain) GenesisHash() [32]byte { return c.genesis }
+func (c *fakeChain) Height() int           { return c.height }
+
+type recorder struct {
+	messages chan Message
+}
+
+func newRecorder() *recorder {
+	return &recorder{messages: make(chan Message, 16)}
+}
+
+func (r *recorder) OnConnect(p *Peer)              {}
+func (r *recorder) OnDisconnect(p *Peer)           {}
+func (r *recorder) OnMessage(p *Peer, msg Message) { r.messages <- msg }
+
+func newTestServer(t *testing.T, network *params.Network, chain Chain, handler Handler) *Server {
+	return startTestServer(t, Config{Network: network, Chain: chain, Handler: handler})
+}
+
+func startTestServer(t *testing.T, cfg Config) *Server {
+	cfg.ListenAddr = "127.0.0.1:0"
+	cfg.PingInterval = 50 * time.Millisecond
+	s := NewServer(cfg)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	return s
+}
+
+func testBlock() *blockchain.Block {
+	txs := []*blockchain.Transaction{
+		blockchain.NewTransaction("alice", "bob", 1.5),
+		blockchain.NewTransaction(blockchain.MINING_SENDER, "carol", 1),
+	}
+	b := blockchain.NewBlock(42, [32]byte{1, 2, 3}, txs)
+	b.SetNonces(42, 7)
+	return b
+}
+
+func roundTrip(t *testing.T, msg Message) Message {
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, params.Testnet.Magic, msg); err != nil {
+		t.Fatalf("%s: %v", msg.Command(), err)
+	}
+	decoded, err := ReadMessage(&buf, params.Testnet.Magic)
+	if err != nil {
+		t.Fatalf("%s: %v", msg.Command(), err)
+	}
+	return decoded
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	sender, receiver, key, sig := "alice", "bob", "04ab", "cd"
+	amount := float32(2.25)
+	b := testBlock()
+	messages := []Message{
+		&MsgVersion{ProtocolVersion: PROTOCOL_VERSION, ChainID: 2, GenesisHash: [32]byte{9}, BestHeight: 12,
+			Nonce: 77, Challenge: [32]byte{4, 2}, SessionKey: [32]byte{5}, Timestamp: time.Now().UnixNano(), ListenPort: 6000, UserAgent: USER_AGENT},
+		&MsgVerAck{},
+		&MsgAuth{PublicKey: [64]byte{1, 2}, Signature: []byte{3, 4, 5}},
+		&MsgPing{Nonce: 5},
+		&MsgPong{Nonce: 5},
+		&MsgInv{Items: []InvVect{{INV_BLOCK, [32]byte{1}}, {INV_TX, [32]byte{2}}}},
+		&MsgGetData{Items: []InvVect{{INV_BLOCK, [32]byte{3}}}},
+		&MsgNotFound{Items: []InvVect{}},
+		&MsgGetAddr{},
+		&MsgAddr{Addresses: []NetAddress{{"10.0.0.1", 6555, 1700000000}, {"::1", 7000, 0}}},
+		&MsgGetHeaders{Locator: [][32]byte{{4}, {5}}, Stop: [32]byte{6}},
+		&MsgHeaders{Headers: []*blockchain.Header{b.Header()}},
+		&MsgTx{Transaction: &blockchain.TransactionRequest{SenderAddress: &sender, ReceiverAddress: &receiver,
+			SenderPublicKey: &key, Signature: &sig, Amount: &amount}},
+	}
+	for _, msg := range messages {
+		if decoded := roundTrip(t, msg); !reflect.DeepEqual(decoded, msg) {
+			t.Errorf("%s: decoded %+v, sent %+v", msg.Command(), decoded, msg)
+		}
+	}
+
+	decoded := roundTrip(t, &MsgBlock{Block: b}).(*MsgBlock)
+	if decoded.Block.Hash() != b.Hash() {
+		t.Errorf("block hash changed in transit")
+	}
+	if len(decoded.Block.Transactions()) != 2 || decoded.Block.Transactions()[0].Amount() != 1.5 {
+		t.Errorf("block transactions changed in transit")
+	}
+}
+
+func TestReadMessageRejects(t *testing.T) {
+	var buf bytes.Buffer
+	WriteMessage(&buf, params.Testnet.Magic, &MsgPing{Nonce: 1})
+	frame := buf.Bytes()
+
+	if _, err := ReadMessage(bytes.NewReader(frame), params.Mainnet.Magic); err != ErrWrongMagic {
+		t.Errorf("wrong magic: %v", err)
+	}
+	corrupted := append([]byte(nil), frame...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	if _, err := ReadMessage(bytes.NewReader(corrupted), params.Testnet.Magic); !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("corrupted payload: %v", err)
+	}
+	unknown := append([]byte(nil), frame...)
+	copy(unknown[4:16], "bogus\x00\x00\x00\x00\x00\x00\x00")
+	if _, err := ReadMessage(bytes.NewReader(unknown), params.Testnet.Magic); err == nil {
+		t.Errorf("unknown command accepted")
+	}
+
+	// a block whose transactions do not match the merkle root
+	var payload bytes.Buffer
+	(&MsgBlock{Block: testBlock()}).Encode(&payload)
+	raw := payload.Bytes()
+	raw[len(raw)-1] ^= 0xff
+	if err := (&MsgBlock{}).Decode(bytes.NewReader(raw)); err == nil {
+		t.Errorf("tampered block accepted")
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	chain := &fakeChain{genesis: [32]byte{1}, height: 10}
+	handler := newRecorder()
+	a := newTestServer(t, params.Testnet, chain, handler)
+	b := newTestServer(t, params.Testnet, &fakeChain{genesis: [32]byte{1}, height: 3}, newRecorder())
+
+	p, err := b.Connect(a.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version().BestHeight != 10 || p.Inbound() {
+		t.Errorf("unexpected peer %v, height %d", p, p.Version().BestHeight)
+	}
+	if err := p.Send(&MsgInv{Items: []InvVect{{INV_BLOCK, [32]byte{7}}}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-handler.messages:
+		if inv, ok := msg.(*MsgInv); !ok || inv.Items[0].Hash != [32]byte{7} {
+			t.Errorf("received %+v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("inv not delivered")
+	}
+
+	// keepalive pings measure the latency
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Latency() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no pong received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(a.Peers()) != 1 || !a.Peers()[0].Inbound() {
+		t.Errorf("inbound peer not registered")
+	}
+	p.Disconnect()
+	deadline = time.Now().Add(5 * time.Second)
+	for len(a.Peers()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("disconnected peer still registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandshakeRejects(t *testing.T) {
+	chain := &fakeChain{genesis: [32]byte{1}}
+	a := newTestServer(t, params.Testnet, chain, nil)
+
+	other := newTestServer(t, params.Testnet, &fakeChain{genesis: [32]byte{2}}, nil)
+	if _, err := other.Connect(a.Addr().String()); !errors.Is(err, ErrWrongGenesis) {
+		t.Errorf("foreign genesis: %v", err)
+	}
+	mainnet := newTestServer(t, params.Mainnet, chain, nil)
+	if _, err := mainnet.Connect(a.Addr().String()); err == nil {
+		t.Errorf("mainnet node connected to testnet")
+	}
+	if _, err := a.Connect(a.Addr().String()); !errors.Is(err, ErrSelfConnection) {
+		t.Errorf("self connection: %v", err)
+	}
+
+	// a node speaking an older protocol
+	conn, err := net.Dial("tcp", a.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	old := &MsgVersion{ProtocolVersion: MIN_PROTOCOL_VERSION - 1, ChainID: params.Testnet.ChainID, GenesisHash: chain.genesis}
+	WriteMessage(conn, params.Testnet.Magic, old)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := ReadMessage(conn, params.Testnet.Magic); err != nil {
+		t.Fatal(err) // our version
+	}
+	if msg, err := ReadMessage(conn, params.Testnet.Magic); err == nil {
+		t.Errorf("old protocol answered with %s", msg.Command())
+	}
+	if len(a.Peers()) != 0 {
+		t.Errorf("rejected peers registered: %v", a.Peers())
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMisbehavingPeerBanned(t *testing.T) {
+	chain := &fakeChain{genesis: [32]byte{1}}
+	a := newTestServer(t, params.Testnet, chain, nil)
+	b := newTestServer(t, params.Testnet, chain, nil)
+	p, err := b.Connect(a.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "inbound peer", func() bool { return len(a.Peers()) == 1 })
+	inbound := a.Peers()[0]
+
+	var buf bytes.Buffer
+	WriteMessage(&buf, params.Testnet.Magic, &MsgPing{Nonce: 1})
+	corrupted := buf.Bytes()
+	corrupted[len(corrupted)-1] ^= 0xff
+	p.conn.Write(corrupted)
+	waitFor(t, "ban score", func() bool { return inbound.BanScore() == SCORE_MALFORMED })
+	if len(a.Peers()) != 1 {
+		t.Fatal("peer dropped for a single malformed message")
+	}
+	for i := 1; i < BAN_THRESHOLD/SCORE_MALFORMED; i++ {
+		p.conn.Write(corrupted)
+	}
+	waitFor(t, "ban", func() bool { return a.Banned("127.0.0.1") && len(a.Peers()) == 0 })
+	if _, err := b.Connect(a.Addr().String()); err == nil {
+		t.Error("banned host reconnected")
+	}
+	if _, err := a.Connect(b.Addr().String()); !errors.Is(err, ErrBanned) {
+		t.Errorf("banned host dialed: %v", err)
+	}
+
+	if !a.Unban("127.0.0.1") || a.Banned("127.0.0.1") {
+		t.Fatal("ban not lifted")
+	}
+	if _, err := b.Connect(a.Addr().String()); err != nil {
+		t.Errorf("unbanned host refused: %v", err)
+	}
+	a.Ban("127.0.0.1", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if a.Banned("127.0.0.1") || len(a.Bans()) != 0 {
+		t.Error("ban did not expire")
+	}
+}
+
+func TestInboundLimit(t *testing.T) {
+	chain := &fakeChain{genesis: [32]byte{1}}
+	a := startTestServer(t, Config{Network: params.Testnet, Chain: chain, MaxInbound: 1})
+	b := newTestServer(t, params.Testnet, chain, nil)
+	c := newTestServer(t, params.Testnet, chain, nil)
+	if _, err := b.Connect(a.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "inbound peer", func() bool { return len(a.Peers()) == 1 })
+	if _, err := c.Connect(a.Addr().String()); err == nil {
+		t.Error("inbound peer accepted over the limit")
+	}
+	if info := a.PeerInfo(); len(info) != 1 || !info[0].Inbound || info[0].UserAgent != USER_AGENT {
+		t.Errorf("peer info %+v", info)
+	}
+}
+
+func TestOutboundTarget(t *testing.T) {
+	chain := &fakeChain{genesis: [32]byte{1}}
+	a := startTestServer(t, Config{Network: params.Testnet, Chain: chain, TargetOutbound: 2,
+		ConnectInterval: 20 * time.Millisecond})
+	b := newTestServer(t, params.Testnet, chain, nil)
+	c := newTestServer(t, params.Testnet, chain, nil)
+	d := newTestServer(t, params.Testnet, chain, nil)
+	a.AddAddress(b.Addr().String(), false)
+	a.AddAddress(c.Addr().String(), false)
+	a.AddAddress(d.Addr().String(), true)
+	waitFor(t, "outbound peers", func() bool { return len(a.Peers()) == 2 })
+	time.Sleep(100 * time.Millisecond)
+	if len(a.Peers()) != 2 || !a.Connected(d.Addr().String()) {
+		t.Errorf("expected the persistent peer and one other, connected to %v", a.Peers())
+	}
+
+	// the persistent peer is redialed when it drops
+	for _, p := range a.Peers() {
+		if p.Addr() == d.Addr().String() {
+			p.Disconnect()
+		}
+	}
+	waitFor(t, "reconnection", func() bool { return a.Connected(d.Addr().String()) })
+}
+
+func TestDeadAddressesForgotten(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := l.Addr().String()
+	l.Close()
+	persistent := "127.0.0.1:1"
+
+	a := startTestServer(t, Config{Network: params.Testnet, Chain: &fakeChain{}, ConnectInterval: 5 * time.Millisecond})
+	a.AddAddress(dead, false)
+	a.AddAddress(persistent, true)
+	waitFor(t, "dead address expiry", func() bool { return len(a.Addresses()) == 1 })
+	if addrs := a.Addresses(); addrs[0].Addr != persistent || addrs[0].Failures == 0 {
+		t.Errorf("known addresses %+v", addrs)
+	}
+}
+
+func TestAddressExchange(t *testing.T) {
+	chain := &fakeChain{genesis: [32]byte{1}}
+	a := startTestServer(t, Config{Network: params.Testnet, Chain: chain, ConnectInterval: 20 * time.Millisecond})
+	b := startTestServer(t, Config{Network: params.Testnet, Chain: chain, ConnectInterval: 20 * time.Millisecond})
+	c := newTestServer(t, params.Testnet, chain, nil)
+	b.AddAddress(c.Addr().String(), true)
+	waitFor(t, "b connected to c", func() bool { return b.Connected(c.Addr().String()) })
+
+	// a only knows b, b tells it about c
+	a.AddAddress(b.Addr().String(), true)
+	waitFor(t, "a connected to c", func() bool { return a.Connected(c.Addr().String()) })
+
+	// names and unspecified addresses shared by peers are ignored
+	a.learnAddress(NetAddress{Host: "seed.example.com", Port: 6555})
+	a.learnAddress(NetAddress{Host: "0.0.0.0", Port: 6555})
+	a.learnAddress(NetAddress{Host: "10.0.0.1"})
+	if n := len(a.Addresses()); n != 2 {
+		t.Errorf("%d known addresses: %+v", n, a.Addresses())
+	}
+	// so are the ones discovered over multicast
+	a.LearnAddress("seed.example.com:6555")
+	a.LearnAddress("10.0.0.1:6555")
+	if n := len(a.Addresses()); n != 3 {
+		t.Errorf("%d known addresses: %+v", n, a.Addresses())
+	}
+}
+
+func TestAddressBookPersisted(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "testnet", "peers.json")
+	cfg := Config{Network: params.Testnet, Chain: &fakeChain{}, AddressFile: file, ConnectInterval: time.Hour}
+	a := NewServer(cfg)
+	a.AddAddress("10.0.0.1:6555", false)
+	a.AddAddress("10.0.0.2:6555", true)
+	if err := a.SaveAddresses(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewServer(cfg)
+	if err := restarted.LoadAddresses(); err != nil {
+		t.Fatal(err)
+	}
+	if addrs := restarted.Addresses(); len(addrs) != 1 || addrs[0].Addr != "10.0.0.1:6555" || addrs[0].Persistent {
+		t.Errorf("loaded addresses %+v", addrs)
+	}
+	if err := NewServer(Config{AddressFile: filepath.Join(t.TempDir(), "none.json")}).LoadAddresses(); err != nil {
+		t.Errorf("missing address book: %v", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	chain := &fakeChain{genesis: [32]byte{1}}
+	key, _ := security.NewNodeKey()
+	b := startTestServer(t, Config{Network: params.Testnet, Chain: chain, NodeKey: key})
+	a := startTestServer(t, Config{Network: params.Testnet, Chain: chain, AllowedNodes: []string{key.ID()}})
+
+	p, err := b.Connect(a.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.NodeID() != a.NodeID() {
+		t.Errorf("peer authenticated as %s instead of %s", p.NodeID(), a.NodeID())
+	}
+	waitFor(t, "inbound peer", func() bool { return len(a.Peers()) == 1 })
+	if id := a.PeerInfo()[0].NodeID; id != key.ID() {
+		t.Errorf("inbound peer authenticated as %s", id)
+	}
+
+	// a only lets b in
+	c := newTestServer(t, params.Testnet, chain, nil)
+	if _, err := c.Connect(a.Addr().String()); err == nil {
+		t.Error("node outside the allow list connected")
+	}
+	if _, err := a.Connect(c.Addr().String()); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("dialed a node outside the allow list: %v", err)
+	}
+
+	// an auth message replayed from another connection
+	conn, err := net.Dial("tcp", c.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var challenge [32]byte
+	WriteMessage(conn, params.Testnet.Magic, b.versionMessage(challenge, [32]byte{9}))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := ReadMessage(conn, params.Testnet.Magic); err != nil {
+		t.Fatal(err)
+	}
+	replayed, _ := b.authMessage(handshakeKeys{challenge: [32]byte{7}, ownChallenge: challenge, ownSessionKey: [32]byte{9}})
+	WriteMessage(conn, params.Testnet.Magic, replayed)
+	if _, err := ReadMessage(conn, params.Testnet.Magic); err != nil {
+		t.Fatal(err) // the auth of c
+	}
+	if msg, err := ReadMessage(conn, params.Testnet.Magic); err == nil {
+		t.Errorf("replayed auth answered with %s", msg.Command())
+	}
+}
+
+// relayHandshake connects to a and b and passes the version and auth
+// messages of each to the other, with the session key sent to b replaced
+// by forged when set. It returns the connection to b.
+func relayHandshake(t *testing.T, a, b *Server, forged *[32]byte) net.Conn {
+	magic := params.Testnet.Magic
+	var conns [2]net.Conn
+	var versions [2]*MsgVersion
+	for i, s := range []*Server{a, b} {
+		conn, err := net.Dial("tcp", s.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		msg, err := ReadMessage(conn, magic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i], versions[i] = conn, msg.(*MsgVersion)
+	}
+	if forged != nil {
+		versions[0].SessionKey = *forged
+	}
+	WriteMessage(conns[0], magic, versions[1])
+	WriteMessage(conns[1], magic, versions[0])
+	var auths [2]Message
+	for i, conn := range conns {
+		msg, err := ReadMessage(conn, magic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		auths[i] = msg
+	}
+	WriteMessage(conns[0], magic, auths[1])
+	WriteMessage(conns[1], magic, auths[0])
+	return conns[1]
+}
+
+func TestRelayedHandshake(t *testing.T) {
+	chain := &fakeChain{genesis: [32]byte{1}}
+	key, _ := security.NewNodeKey()
+	a := startTestServer(t, Config{Network: params.Testnet, Chain: chain, NodeKey: key})
+	b := startTestServer(t, Config{Network: params.Testnet, Chain: chain, AllowedNodes: []string{key.ID()}})
+
+	// the relay speaks as a with its own session key
+	relayKey, _ := newSessionKey()
+	var forged [32]byte
+	copy(forged[:], relayKey.PublicKey().Bytes())
+	conn := relayHandshake(t, a, b, &forged)
+	if msg, err := ReadMessage(conn, params.Testnet.Magic); err == nil {
+		t.Errorf("forged session key answered with %s", msg.Command())
+	}
+
+	// the relay keeps the keys of a, but cannot seal the records
+	conn = relayHandshake(t, a, b, nil)
+	WriteMessage(conn, params.Testnet.Magic, &MsgVerAck{})
+	if _, err := io.Copy(io.Discard, conn); errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("relayed session not dropped")
+	}
+	if len(b.Peers()) != 0 {
+		t.Error("relay connected as a")
+	}
+}
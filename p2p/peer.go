@@ -0,0 +1,313 @@
+package p2p
+
+import (
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	HANDSHAKE_TIMEOUT = 10 * time.Second
+	PING_INTERVAL     = 2 * time.Minute
+	// A peer sending nothing, not even a pong, for IDLE_TIMEOUT is dropped
+	IDLE_TIMEOUT    = 5 * time.Minute
+	WRITE_TIMEOUT   = 30 * time.Second
+	SEND_QUEUE_SIZE = 256
+)
+
+var (
+	ErrIncompatibleVersion = errors.New("incompatible protocol version")
+	ErrWrongChain          = errors.New("peer is on another chain")
+	ErrWrongGenesis        = errors.New("peer has another genesis block")
+	ErrSelfConnection      = errors.New("connected to ourselves")
+	ErrPeerDisconnected    = errors.New("peer disconnected")
+)
+
+// Peer is a connection to another node which completed the handshake
+type Peer struct {
+	conn    net.Conn
+	addr    string
+	host    string // remote host of the connection, the unit of bans
+	inbound bool
+	server  *Server
+	version *MsgVersion
+	nodeID  string
+
+	sendQueue chan Message
+	quit      chan struct{}
+	closeOnce sync.Once
+
+	mux       sync.Mutex
+	connected time.Time
+	lastSeen  time.Time
+	latency   time.Duration
+	pingNonce uint64
+	pingSent  time.Time
+	banScore  int
+	addrSent  bool
+}
+
+func newPeer(s *Server, conn net.Conn, addr string, inbound bool) *Peer {
+	return &Peer{
+		conn:      conn,
+		addr:      addr,
+		host:      hostOf(conn.RemoteAddr().String()),
+		inbound:   inbound,
+		server:    s,
+		sendQueue: make(chan Message, SEND_QUEUE_SIZE),
+		quit:      make(chan struct{}),
+	}
+}
+
+// Addr is the address we dialed for outbound peers, the remote address
+// of the connection for inbound ones
+func (p *Peer) Addr() string {
+	return p.addr
+}
+
+// ListenAddr is the address the peer accepts connections on, empty for an
+// inbound peer which does not listen
+func (p *Peer) ListenAddr() string {
+	if !p.inbound {
+		return p.addr
+	}
+	if p.version == nil || p.version.ListenPort == 0 {
+		return ""
+	}
+	return net.JoinHostPort(p.host, strconv.Itoa(int(p.version.ListenPort)))
+}
+
+// Host is the remote host of the connection
+func (p *Peer) Host() string {
+	return p.host
+}
+
+func (p *Peer) Inbound() bool {
+	return p.inbound
+}
+
+// Version is the version message the peer sent during the handshake
+func (p *Peer) Version() *MsgVersion {
+	return p.version
+}
+
+func (p *Peer) LastSeen() time.Time {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.lastSeen
+}
+
+// Latency is the round trip time of the last answered ping
+func (p *Peer) Latency() time.Duration {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.latency
+}
+
+func (p *Peer) String() string {
+	direction := "outbound"
+	if p.inbound {
+		direction = "inbound"
+	}
+	return fmt.Sprintf("%s (%s)", p.addr, direction)
+}
+
+// NodeID is the authenticated ID of the peer node
+func (p *Peer) NodeID() string {
+	return p.nodeID
+}
+
+// handshake exchanges version messages with the remote node: both sides
+// send their version first, answer the challenge of the other with an auth
+// message and, once both are checked, acknowledge the other's over the
+// encrypted session
+func (p *Peer) handshake() error {
+	magic := p.server.config.Network.Magic
+	p.conn.SetDeadline(p.server.clock.Now().Add(HANDSHAKE_TIMEOUT))
+	defer p.conn.SetDeadline(time.Time{})
+
+	var keys handshakeKeys
+	if _, err := crand.Read(keys.ownChallenge[:]); err != nil {
+		return err
+	}
+	sessionKey, err := newSessionKey()
+	if err != nil {
+		return err
+	}
+	copy(keys.ownSessionKey[:], sessionKey.PublicKey().Bytes())
+	if err := WriteMessage(p.conn, magic, p.server.versionMessage(keys.ownChallenge, keys.ownSessionKey)); err != nil {
+		return err
+	}
+	msg, err := ReadMessage(p.conn, magic)
+	if err != nil {
+		return err
+	}
+	version, ok := msg.(*MsgVersion)
+	if !ok {
+		return fmt.Errorf("expected %s, received %s", CMD_VERSION, msg.Command())
+	}
+	if err := p.server.checkVersion(version); err != nil {
+		return err
+	}
+	p.version = version
+	keys.challenge, keys.sessionKey = version.Challenge, version.SessionKey
+	auth, err := p.server.authMessage(keys)
+	if err != nil {
+		return err
+	}
+	if err := WriteMessage(p.conn, magic, auth); err != nil {
+		return err
+	}
+	msg, err = ReadMessage(p.conn, magic)
+	if err != nil {
+		return err
+	}
+	theirAuth, ok := msg.(*MsgAuth)
+	if !ok {
+		return fmt.Errorf("expected %s, received %s", CMD_AUTH, msg.Command())
+	}
+	if p.nodeID, err = p.server.checkAuth(theirAuth, keys); err != nil {
+		return err
+	}
+	session, err := newSessionConn(p.conn, sessionKey, keys.sessionKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAuthFailed, err)
+	}
+	p.conn = session
+	if err := WriteMessage(p.conn, magic, &MsgVerAck{}); err != nil {
+		return err
+	}
+	msg, err = ReadMessage(p.conn, magic)
+	if err != nil {
+		return err
+	}
+	if _, ok := msg.(*MsgVerAck); !ok {
+		return fmt.Errorf("expected %s, received %s", CMD_VERACK, msg.Command())
+	}
+	now := p.server.clock.Now()
+	p.connected = now
+	p.lastSeen = now
+	return nil
+}
+
+func (p *Peer) start() {
+	go p.readLoop()
+	go p.writeLoop()
+	go p.pingLoop()
+}
+
+// Send queues msg for the peer. It fails once the peer is disconnected.
+func (p *Peer) Send(msg Message) error {
+	select {
+	case p.sendQueue <- msg:
+		return nil
+	case <-p.quit:
+		return ErrPeerDisconnected
+	}
+}
+
+// Disconnect closes the connection, it is safe to call more than once
+func (p *Peer) Disconnect() {
+	p.closeOnce.Do(func() {
+		close(p.quit)
+		p.conn.Close()
+	})
+}
+
+// Done is closed when the peer disconnects
+func (p *Peer) Done() <-chan struct{} {
+	return p.quit
+}
+
+func (p *Peer) readLoop() {
+	defer p.server.removePeer(p)
+	magic := p.server.config.Network.Magic
+	for {
+		p.conn.SetReadDeadline(p.server.clock.Now().Add(p.server.idleTimeout()))
+		msg, err := ReadMessage(p.conn, magic)
+		var msgErr *MessageError
+		if errors.As(err, &msgErr) {
+			// the frame was consumed, the stream is still in sync
+			p.Misbehaving(SCORE_MALFORMED, msgErr.Error())
+			continue
+		}
+		if errors.Is(err, ErrWrongMagic) || errors.Is(err, ErrPayloadLimit) {
+			p.Misbehaving(BAN_THRESHOLD, err.Error())
+		}
+		if err != nil {
+			select {
+			case <-p.quit:
+			default:
+				log.Printf("peer %v: %v", p, err)
+			}
+			p.Disconnect()
+			return
+		}
+		p.mux.Lock()
+		p.lastSeen = p.server.clock.Now()
+		p.mux.Unlock()
+
+		switch m := msg.(type) {
+		case *MsgPing:
+			p.Send(&MsgPong{Nonce: m.Nonce})
+		case *MsgPong:
+			p.mux.Lock()
+			if m.Nonce == p.pingNonce && !p.pingSent.IsZero() {
+				p.latency = p.server.clock.Now().Sub(p.pingSent)
+				p.pingSent = time.Time{}
+			}
+			p.mux.Unlock()
+		case *MsgGetAddr:
+			p.server.handleGetAddr(p)
+		case *MsgAddr:
+			p.server.handleAddr(p, m)
+		case *MsgVersion, *MsgVerAck, *MsgAuth:
+			log.Printf("WARN: peer %v: duplicate %s", p, msg.Command())
+		default:
+			if p.server.config.Handler != nil {
+				p.server.config.Handler.OnMessage(p, msg)
+			}
+		}
+	}
+}
+
+func (p *Peer) writeLoop() {
+	magic := p.server.config.Network.Magic
+	for {
+		select {
+		case msg := <-p.sendQueue:
+			p.conn.SetWriteDeadline(p.server.clock.Now().Add(WRITE_TIMEOUT))
+			if err := WriteMessage(p.conn, magic, msg); err != nil {
+				log.Printf("peer %v: %v", p, err)
+				p.Disconnect()
+				return
+			}
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+func (p *Peer) pingLoop() {
+	ticker := p.server.clock.NewTicker(p.server.pingInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			nonce := rand.Uint64()
+			p.mux.Lock()
+			p.pingNonce = nonce
+			p.pingSent = p.server.clock.Now()
+			p.mux.Unlock()
+			p.Send(&MsgPing{Nonce: nonce})
+		case <-p.quit:
+			return
+		}
+	}
+}
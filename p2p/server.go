@@ -0,0 +1,367 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"moviecoin/params"
+	"moviecoin/security"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const USER_AGENT = "moviecoin:0.1"
+
+var (
+	ErrBanned       = errors.New("host is banned")
+	ErrTooManyPeers = errors.New("too many inbound peers")
+)
+
+// Chain is the view of the local blockchain announced in the handshake
+type Chain interface {
+	GenesisHash() [32]byte
+	Height() int
+}
+
+// Handler receives the messages of connected peers, except the handshake
+// and keepalive ones which are handled by the peer itself
+type Handler interface {
+	OnConnect(p *Peer)
+	OnMessage(p *Peer, msg Message)
+	OnDisconnect(p *Peer)
+}
+
+type Config struct {
+	Network *params.Network
+	Chain   Chain
+	Handler Handler
+	// ListenAddr is the host:port accepting inbound peers, empty for none.
+	// ListenPort is announced to peers so they can connect back.
+	ListenAddr string
+	ListenPort uint16
+	// Zero means PING_INTERVAL and IDLE_TIMEOUT
+	PingInterval time.Duration
+	IdleTimeout  time.Duration
+	// Zero means DEFAULT_MAX_INBOUND, DEFAULT_TARGET_OUTBOUND,
+	// CONNECT_INTERVAL and DEFAULT_BAN_DURATION
+	MaxInbound      int
+	TargetOutbound  int
+	ConnectInterval time.Duration
+	BanDuration     time.Duration
+	// AddressFile persists the address book across restarts, empty for none
+	AddressFile string
+	// NodeKey authenticates the node to its peers, a throw-away key is
+	// generated when nil
+	NodeKey *security.NodeKey
+	// AllowedNodes, when not empty, are the only node IDs allowed to
+	// connect, in either direction
+	AllowedNodes []string
+	// Nil means TCPTransport and RealClock
+	Transport Transport
+	Clock     Clock
+}
+
+// Server accepts inbound peers, dials outbound ones and tracks both
+type Server struct {
+	config   Config
+	nonce    uint64
+	key      *security.NodeKey
+	allowed  map[string]bool
+	listener net.Listener
+	clock    Clock
+
+	mux   sync.Mutex
+	peers map[*Peer]struct{}
+	bans  map[string]time.Time
+	addrs map[string]*knownAddress
+	// addresses which turned out to be ours
+	self         map[string]bool
+	addrsChanged bool
+	quit         chan struct{}
+}
+
+func NewServer(cfg Config) *Server {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	key := cfg.NodeKey
+	if key == nil {
+		var err error
+		if key, err = security.NewNodeKey(); err != nil {
+			panic(err)
+		}
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = TCPTransport{}
+	}
+	clock := cfg.Clock
+	if clock == nil {
+		clock = RealClock{}
+	}
+	allowed := make(map[string]bool)
+	for _, id := range cfg.AllowedNodes {
+		allowed[id] = true
+	}
+	return &Server{
+		config:  cfg,
+		nonce:   binary.BigEndian.Uint64(buf[:]),
+		key:     key,
+		allowed: allowed,
+		clock:   clock,
+		peers:   make(map[*Peer]struct{}),
+		bans:    make(map[string]time.Time),
+		addrs:   make(map[string]*knownAddress),
+		self:    make(map[string]bool),
+		quit:    make(chan struct{}),
+	}
+}
+
+func (s *Server) pingInterval() time.Duration {
+	if s.config.PingInterval > 0 {
+		return s.config.PingInterval
+	}
+	return PING_INTERVAL
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.config.IdleTimeout > 0 {
+		return s.config.IdleTimeout
+	}
+	return IDLE_TIMEOUT
+}
+
+// Start listens for inbound peers when a listen address is configured and
+// starts dialing the known addresses
+func (s *Server) Start() error {
+	if s.config.AddressFile != "" {
+		if err := s.LoadAddresses(); err != nil {
+			log.Printf("WARN: peer addresses: %v", err)
+		}
+	}
+	if s.config.ListenAddr != "" {
+		l, err := s.config.Transport.Listen(s.config.ListenAddr)
+		if err != nil {
+			return err
+		}
+		s.listener = l
+		go s.acceptLoop()
+		log.Printf("P2P listening on %v", l.Addr())
+	}
+	go s.connectLoop()
+	return nil
+}
+
+// Clock is the time source of the server
+func (s *Server) Clock() Clock {
+	return s.clock
+}
+
+// Addr is the address the server listens on, nil before Start
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (s *Server) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		if err := s.acceptable(conn.RemoteAddr().String()); err != nil {
+			log.Printf("WARN: inbound peer %v refused: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
+		go func() {
+			if _, err := s.AddConn(conn, conn.RemoteAddr().String(), true); err != nil {
+				log.Printf("WARN: inbound peer %v: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// acceptable tells why an inbound connection from addr is refused, if it is
+func (s *Server) acceptable(addr string) error {
+	if s.Banned(hostOf(addr)) {
+		return ErrBanned
+	}
+	if inbound, _ := s.countPeers(); inbound >= s.maxInbound() {
+		return ErrTooManyPeers
+	}
+	return nil
+}
+
+// Stop closes the listener and disconnects every peer
+func (s *Server) Stop() {
+	s.mux.Lock()
+	select {
+	case <-s.quit:
+	default:
+		close(s.quit)
+	}
+	s.mux.Unlock()
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for _, p := range s.Peers() {
+		p.Disconnect()
+	}
+	s.saveChangedAddresses()
+}
+
+// Connect dials addr and performs the handshake
+func (s *Server) Connect(addr string) (*Peer, error) {
+	if s.Banned(hostOf(addr)) {
+		return nil, ErrBanned
+	}
+	conn, err := s.config.Transport.Dial(addr, HANDSHAKE_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+	return s.AddConn(conn, addr, false)
+}
+
+// AddConn runs the handshake on an established connection and starts
+// serving the peer. The connection is closed when the handshake fails.
+func (s *Server) AddConn(conn net.Conn, addr string, inbound bool) (*Peer, error) {
+	p := newPeer(s, conn, addr, inbound)
+	if err := p.handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.mux.Lock()
+	s.peers[p] = struct{}{}
+	s.mux.Unlock()
+	log.Printf("Connected to peer %v, height %d", p, p.version.BestHeight)
+	p.start()
+	if inbound {
+		// the node may accept connections too
+		if p.version.ListenPort != 0 {
+			s.learnAddress(NetAddress{Host: p.host, Port: p.version.ListenPort, LastSeen: s.clock.Now().Unix()})
+		}
+	} else {
+		p.Send(&MsgGetAddr{})
+	}
+	if s.config.Handler != nil {
+		s.config.Handler.OnConnect(p)
+	}
+	return p, nil
+}
+
+func (s *Server) removePeer(p *Peer) {
+	s.mux.Lock()
+	_, ok := s.peers[p]
+	delete(s.peers, p)
+	s.mux.Unlock()
+	if ok {
+		log.Printf("Disconnected from peer %v", p)
+		if s.config.Handler != nil {
+			s.config.Handler.OnDisconnect(p)
+		}
+	}
+}
+
+func (s *Server) Peers() []*Peer {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	peers := make([]*Peer, 0, len(s.peers))
+	for p := range s.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// PeerInfo describes a connected peer for the admin API
+type PeerInfo struct {
+	Addr            string    `json:"addr"`
+	Inbound         bool      `json:"inbound"`
+	UserAgent       string    `json:"user_agent"`
+	ProtocolVersion uint32    `json:"protocol_version"`
+	BestHeight      uint32    `json:"best_height"`
+	Connected       time.Time `json:"connected"`
+	LastSeen        time.Time `json:"last_seen"`
+	NodeID          string    `json:"node_id"`
+	LatencyMs       int64     `json:"latency_ms"`
+	BanScore        int       `json:"ban_score"`
+}
+
+// PeerInfo lists the connected peers sorted by address
+func (s *Server) PeerInfo() []PeerInfo {
+	peers := s.Peers()
+	infos := make([]PeerInfo, 0, len(peers))
+	for _, p := range peers {
+		p.mux.Lock()
+		infos = append(infos, PeerInfo{
+			Addr:            p.addr,
+			Inbound:         p.inbound,
+			UserAgent:       p.version.UserAgent,
+			ProtocolVersion: p.version.ProtocolVersion,
+			BestHeight:      p.version.BestHeight,
+			Connected:       p.connected,
+			LastSeen:        p.lastSeen,
+			NodeID:          p.nodeID,
+			LatencyMs:       p.latency.Milliseconds(),
+			BanScore:        p.banScore,
+		})
+		p.mux.Unlock()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Addr < infos[j].Addr })
+	return infos
+}
+
+// Connected tells whether the node listening at addr is connected, through
+// an inbound or an outbound connection
+func (s *Server) Connected(addr string) bool {
+	for _, p := range s.Peers() {
+		if p.ListenAddr() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Broadcast sends msg to every peer but except, which may be nil
+func (s *Server) Broadcast(msg Message, except *Peer) {
+	for _, p := range s.Peers() {
+		if p != except {
+			p.Send(msg)
+		}
+	}
+}
+
+func (s *Server) versionMessage(challenge [32]byte, sessionKey [32]byte) *MsgVersion {
+	return &MsgVersion{
+		ProtocolVersion: PROTOCOL_VERSION,
+		ChainID:         s.config.Network.ChainID,
+		GenesisHash:     s.config.Chain.GenesisHash(),
+		BestHeight:      uint32(s.config.Chain.Height()),
+		Nonce:           s.nonce,
+		Challenge:       challenge,
+		SessionKey:      sessionKey,
+		Timestamp:       s.clock.Now().UnixNano(),
+		ListenPort:      s.config.ListenPort,
+		UserAgent:       USER_AGENT,
+	}
+}
+
+func (s *Server) checkVersion(v *MsgVersion) error {
+	switch {
+	case v.ProtocolVersion < MIN_PROTOCOL_VERSION:
+		return fmt.Errorf("%w %d", ErrIncompatibleVersion, v.ProtocolVersion)
+	case v.ChainID != s.config.Network.ChainID:
+		return fmt.Errorf("%w %d", ErrWrongChain, v.ChainID)
+	case v.GenesisHash != s.config.Chain.GenesisHash():
+		return fmt.Errorf("%w %x", ErrWrongGenesis, v.GenesisHash)
+	case v.Nonce == s.nonce:
+		return ErrSelfConnection
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package p2p
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// Once authenticated, peers talk over an encrypted session. Each side sends
+// an ephemeral X25519 key in its version message and signs both keys in its
+// auth message, so a node relaying the handshake between two others cannot
+// agree on the session with either of them. Each direction has its own
+// AES-GCM key, derived from the shared secret and the two ephemeral keys,
+// and counts its records for the nonces.
+
+const sessionDomain = "moviecoin session"
+
+// MAX_RECORD_SIZE bounds the encrypted records, which carry one frame each
+const MAX_RECORD_SIZE = FRAME_HEADER_SIZE + MAX_PAYLOAD_SIZE + 16
+
+var ErrSessionRecord = errors.New("session record failed authentication")
+
+func newSessionKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(crand.Reader)
+}
+
+// sessionConn seals every Write on conn into a record: length (4) followed
+// by the ciphertext
+type sessionConn struct {
+	net.Conn
+	send     cipher.AEAD
+	recv     cipher.AEAD
+	writeMux sync.Mutex
+	sent     uint64
+	received uint64
+	pending  []byte // decrypted bytes not read yet
+}
+
+// newSessionConn agrees on the session keys with the peer which sent the
+// ephemeral key theirs
+func newSessionConn(conn net.Conn, private *ecdh.PrivateKey, theirs [32]byte) (*sessionConn, error) {
+	remote, err := ecdh.X25519().NewPublicKey(theirs[:])
+	if err != nil {
+		return nil, err
+	}
+	secret, err := private.ECDH(remote)
+	if err != nil {
+		return nil, err
+	}
+	own := private.PublicKey().Bytes()
+	send, err := sessionCipher(secret, own, theirs[:])
+	if err != nil {
+		return nil, err
+	}
+	recv, err := sessionCipher(secret, theirs[:], own)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionConn{Conn: conn, send: send, recv: recv}, nil
+}
+
+// sessionCipher keys the records from the sender to the receiver
+func sessionCipher(secret []byte, sender []byte, receiver []byte) (cipher.AEAD, error) {
+	h := sha256.New()
+	h.Write([]byte(sessionDomain))
+	h.Write(secret)
+	h.Write(sender)
+	h.Write(receiver)
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func recordNonce(counter uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+func (c *sessionConn) Write(b []byte) (int, error) {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	if len(b)+c.send.Overhead() > MAX_RECORD_SIZE {
+		return 0, ErrPayloadLimit
+	}
+	record := c.send.Seal(make([]byte, 4, 4+len(b)+c.send.Overhead()), recordNonce(c.sent), b, nil)
+	binary.BigEndian.PutUint32(record[:4], uint32(len(record)-4))
+	c.sent++
+	if _, err := c.Conn.Write(record); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *sessionConn) Read(b []byte) (int, error) {
+	if len(c.pending) == 0 {
+		var length [4]byte
+		if _, err := io.ReadFull(c.Conn, length[:]); err != nil {
+			return 0, err
+		}
+		n := binary.BigEndian.Uint32(length[:])
+		if n > MAX_RECORD_SIZE {
+			return 0, ErrPayloadLimit
+		}
+		record := make([]byte, n)
+		if _, err := io.ReadFull(c.Conn, record); err != nil {
+			return 0, err
+		}
+		plain, err := c.recv.Open(record[:0], recordNonce(c.received), record, nil)
+		if err != nil {
+			return 0, ErrSessionRecord
+		}
+		c.received++
+		c.pending = plain
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
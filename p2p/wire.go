@@ -0,0 +1,215 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Every message travels in a frame:
+//
+//	magic (4) | command (12, NUL padded) | length (4) | checksum (4) | payload
+//
+// All integers are big-endian. The magic identifies the network so that a
+// testnet node never talks to a mainnet one by mistake, the checksum is the
+// first four bytes of the double sha256 of the payload.
+const (
+	FRAME_HEADER_SIZE = 24
+	COMMAND_SIZE      = 12
+	MAX_PAYLOAD_SIZE  = 32 * 1024 * 1024
+	MAX_STRING_SIZE   = 4096
+)
+
+var (
+	ErrWrongMagic   = errors.New("message for another network")
+	ErrBadChecksum  = errors.New("message checksum mismatch")
+	ErrPayloadLimit = errors.New("message payload too large")
+)
+
+// MessageError reports a frame which was read entirely but could not be
+// decoded. Unlike framing errors, it leaves the connection usable.
+type MessageError struct {
+	Command string
+	Err     error
+}
+
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Command, e.Err)
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+type frameHeader struct {
+	magic    uint32
+	command  string
+	length   uint32
+	checksum [4]byte
+}
+
+func checksum(payload []byte) [4]byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	var c [4]byte
+	copy(c[:], second[:4])
+	return c
+}
+
+// WriteMessage frames msg and writes it to w in a single call
+func WriteMessage(w io.Writer, magic uint32, msg Message) error {
+	var payload bytes.Buffer
+	if err := msg.Encode(&payload); err != nil {
+		return err
+	}
+	if payload.Len() > MAX_PAYLOAD_SIZE {
+		return ErrPayloadLimit
+	}
+	command := msg.Command()
+	if len(command) > COMMAND_SIZE {
+		return fmt.Errorf("command %q too long", command)
+	}
+	frame := make([]byte, FRAME_HEADER_SIZE, FRAME_HEADER_SIZE+payload.Len())
+	binary.BigEndian.PutUint32(frame[0:4], magic)
+	copy(frame[4:16], command)
+	binary.BigEndian.PutUint32(frame[16:20], uint32(payload.Len()))
+	sum := checksum(payload.Bytes())
+	copy(frame[20:24], sum[:])
+	frame = append(frame, payload.Bytes()...)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadMessage reads the next frame from r and decodes its payload
+func ReadMessage(r io.Reader, magic uint32) (Message, error) {
+	var buf [FRAME_HEADER_SIZE]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	h := frameHeader{
+		magic:   binary.BigEndian.Uint32(buf[0:4]),
+		command: string(bytes.TrimRight(buf[4:16], "\x00")),
+		length:  binary.BigEndian.Uint32(buf[16:20]),
+	}
+	copy(h.checksum[:], buf[20:24])
+	if h.magic != magic {
+		return nil, ErrWrongMagic
+	}
+	if h.length > MAX_PAYLOAD_SIZE {
+		return nil, ErrPayloadLimit
+	}
+	payload := make([]byte, h.length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if checksum(payload) != h.checksum {
+		return nil, &MessageError{h.command, ErrBadChecksum}
+	}
+	msg, err := makeEmptyMessage(h.command)
+	if err != nil {
+		return nil, &MessageError{h.command, err}
+	}
+	pr := bytes.NewReader(payload)
+	if err := msg.Decode(pr); err != nil {
+		return nil, &MessageError{h.command, err}
+	}
+	if pr.Len() != 0 {
+		return nil, &MessageError{h.command, fmt.Errorf("%d trailing bytes", pr.Len())}
+	}
+	return msg, nil
+}
+
+// Primitive encoders shared by the messages. Variable length values are
+// prefixed with their length as an unsigned varint.
+
+func writeUint16(w io.Writer, v uint16) error {
+	return binary.Write(w, binary.BigEndian, v)
+}
+
+func writeUint32(w io.Writer, v uint32) error {
+	return binary.Write(w, binary.BigEndian, v)
+}
+
+func writeUint64(w io.Writer, v uint64) error {
+	return binary.Write(w, binary.BigEndian, v)
+}
+
+func writeFloat32(w io.Writer, v float32) error {
+	return writeUint32(w, math.Float32bits(v))
+}
+
+func writeVarInt(w io.Writer, v uint64) error {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	_, err := w.Write(buf[:n])
+	return err
+}
+
+func writeString(w io.Writer, s string) error {
+	if len(s) > MAX_STRING_SIZE {
+		return fmt.Errorf("string of %d bytes exceeds %d", len(s), MAX_STRING_SIZE)
+	}
+	if err := writeVarInt(w, uint64(len(s))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+func readUint16(r io.Reader) (uint16, error) {
+	var v uint16
+	err := binary.Read(r, binary.BigEndian, &v)
+	return v, err
+}
+
+func readUint32(r io.Reader) (uint32, error) {
+	var v uint32
+	err := binary.Read(r, binary.BigEndian, &v)
+	return v, err
+}
+
+func readUint64(r io.Reader) (uint64, error) {
+	var v uint64
+	err := binary.Read(r, binary.BigEndian, &v)
+	return v, err
+}
+
+func readFloat32(r io.Reader) (float32, error) {
+	v, err := readUint32(r)
+	return math.Float32frombits(v), err
+}
+
+// readVarInt reads a length and rejects values above max, so that a peer
+// cannot make us allocate arbitrary amounts of memory
+func readVarInt(r *bytes.Reader, max uint64) (uint64, error) {
+	v, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, err
+	}
+	if v > max {
+		return 0, fmt.Errorf("count %d exceeds %d", v, max)
+	}
+	return v, nil
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	n, err := readVarInt(r, MAX_STRING_SIZE)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func readHash(r io.Reader) ([32]byte, error) {
+	var h [32]byte
+	_, err := io.ReadFull(r, h[:])
+	return h, err
+}
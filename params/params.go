@@ -0,0 +1,89 @@
+package params
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Network groups every parameter that differs between Moviecoin networks.
+// Nodes and wallets must agree on all of them in order to interoperate.
+type Network struct {
+	Name             string
+	ChainID          uint32
+	Magic            uint32  // first bytes of every peer to peer message
+	Difficulty       int     // leading hex zeros required in a block's proof of work
+	Reward           float32 // coins paid to the miner of a block
+	MiningTimerSec   int     // interval between mining rounds
+	MulticastAddress string  // UDP group used for neighbor discovery
+	AddressVersion   byte    // version byte prepended to wallet addresses
+	GenesisTimestamp int64   // fixed so every node derives the same genesis block
+	// GenerateOnDemand disables the periodic miner. Blocks are only created
+	// when explicitly requested, which keeps tests fast and deterministic.
+	GenerateOnDemand bool
+}
+
+var Mainnet = &Network{
+	Name:             "mainnet",
+	ChainID:          1,
+	Magic:            0x4d4f5601, // "MOV" 1
+	Difficulty:       3,
+	Reward:           1.0,
+	MiningTimerSec:   30,
+	MulticastAddress: "239.0.0.0:9999",
+	AddressVersion:   0x00,
+	GenesisTimestamp: 1661990400000000000, // 2022-09-01 00:00:00 UTC
+}
+
+var Testnet = &Network{
+	Name:             "testnet",
+	ChainID:          2,
+	Magic:            0x4d4f5602,
+	Difficulty:       2,
+	Reward:           1.0,
+	MiningTimerSec:   10,
+	MulticastAddress: "239.0.0.1:9999",
+	AddressVersion:   0x6f,
+	GenesisTimestamp: 1662076800000000000, // 2022-09-02 00:00:00 UTC
+}
+
+var Regtest = &Network{
+	Name:             "regtest",
+	ChainID:          3,
+	Magic:            0x4d4f5603,
+	Difficulty:       1,
+	Reward:           1.0,
+	MiningTimerSec:   1,
+	MulticastAddress: "239.0.0.2:9999",
+	AddressVersion:   0x6f,
+	GenesisTimestamp: 0,
+	GenerateOnDemand: true,
+}
+
+var networks = map[string]*Network{
+	Mainnet.Name: Mainnet,
+	Testnet.Name: Testnet,
+	Regtest.Name: Regtest,
+}
+
+// Lookup returns the network registered under name.
+func Lookup(name string) (*Network, error) {
+	n, ok := networks[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown network %q (available: %v)", name, Names())
+	}
+	return n, nil
+}
+
+// Names lists the known network names in alphabetical order.
+func Names() []string {
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (n *Network) String() string {
+	return n.Name
+}
@@ -0,0 +1,39 @@
+package params
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	for _, name := range Names() {
+		n, err := Lookup(name)
+		if err != nil {
+			t.Fatalf("Lookup(%q): %v", name, err)
+		}
+		if n.Name != name {
+			t.Errorf("Lookup(%q) returned network %q", name, n.Name)
+		}
+	}
+	if _, err := Lookup("simnet"); err == nil {
+		t.Error("Lookup of an unknown network must fail")
+	}
+}
+
+func TestNetworksAreDistinct(t *testing.T) {
+	ids := make(map[uint32]string)
+	magics := make(map[uint32]string)
+	groups := make(map[string]string)
+	for _, name := range Names() {
+		n, _ := Lookup(name)
+		if other, ok := ids[n.ChainID]; ok {
+			t.Errorf("%s and %s share chain id %d", name, other, n.ChainID)
+		}
+		if other, ok := groups[n.MulticastAddress]; ok {
+			t.Errorf("%s and %s share multicast group %s", name, other, n.MulticastAddress)
+		}
+		if other, ok := magics[n.Magic]; ok {
+			t.Errorf("%s and %s share magic %x", name, other, n.Magic)
+		}
+		ids[n.ChainID] = name
+		magics[n.Magic] = name
+		groups[n.MulticastAddress] = name
+	}
+}
@@ -0,0 +1,56 @@
+package pool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTPPool is the JobSource of workers mining for a remote pool server
+type HTTPPool struct {
+	gateway string
+	client  *http.Client
+}
+
+func NewHTTPPool(gateway string) *HTTPPool {
+	return &HTTPPool{gateway, &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (hp *HTTPPool) CurrentJob() (*Job, error) {
+	resp, err := hp.client.Get(hp.gateway + "/pool/job")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET /pool/job: %s", resp.Status)
+	}
+	var job Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (hp *HTTPPool) SubmitShare(s *Share) (bool, error) {
+	m, _ := json.Marshal(s)
+	resp, err := hp.client.Post(hp.gateway+"/pool/share", "application/json", bytes.NewBuffer(m))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	var status struct {
+		Message string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&status)
+	switch {
+	case resp.StatusCode != http.StatusOK:
+		return false, errors.New(status.Message)
+	case status.Message == SHARE_BLOCK:
+		return true, nil
+	}
+	return false, nil
+}
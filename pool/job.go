@@ -0,0 +1,92 @@
+package pool
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"moviecoin/blockchain"
+	"moviecoin/miner"
+	"time"
+)
+
+// Job is the work handed to pool workers: a node block template whose
+// shares only need to meet the pool's (lower) share difficulty
+type Job struct {
+	ID              string `json:"job_id"`
+	Height          int    `json:"height"`
+	PreviousHash    string `json:"previous_hash"`
+	Header          string `json:"header"`
+	Difficulty      int    `json:"difficulty"`
+	ShareDifficulty int    `json:"share_difficulty"`
+	ShareTarget     string `json:"share_target"`
+
+	header  []byte
+	created time.Time
+}
+
+func newJob(w *miner.Work, shareDifficulty int) (*Job, error) {
+	header, err := hex.DecodeString(w.Header)
+	if err != nil || len(header) != blockchain.HEADER_SIZE {
+		return nil, errors.New("malformed template header")
+	}
+	return &Job{
+		ID:              w.ID,
+		Height:          w.Height,
+		PreviousHash:    w.PreviousHash,
+		Header:          w.Header,
+		Difficulty:      w.Difficulty,
+		ShareDifficulty: shareDifficulty,
+		ShareTarget:     miner.Target(shareDifficulty),
+		header:          header,
+		created:         time.Now(),
+	}, nil
+}
+
+// UnmarshalJSON decodes the header once, workers hash it for every nonce
+func (j *Job) UnmarshalJSON(data []byte) error {
+	type job Job
+	if err := json.Unmarshal(data, (*job)(j)); err != nil {
+		return err
+	}
+	header, err := hex.DecodeString(j.Header)
+	if err != nil || len(header) != blockchain.HEADER_SIZE {
+		return errors.New("malformed job header")
+	}
+	j.header = header
+	return nil
+}
+
+// Hash computes the block hash of the job header carrying the given nonces
+func (j *Job) Hash(nonce uint32, extraNonce uint32) [32]byte {
+	return HeaderHash(j.header, nonce, extraNonce)
+}
+
+// HeaderHash hashes a serialized blockchain.Header after writing the nonces
+// into its last 8 bytes
+func HeaderHash(header []byte, nonce uint32, extraNonce uint32) [32]byte {
+	buf := make([]byte, blockchain.HEADER_SIZE)
+	copy(buf, header)
+	binary.BigEndian.PutUint32(buf[blockchain.HEADER_SIZE-8:], extraNonce)
+	binary.BigEndian.PutUint32(buf[blockchain.HEADER_SIZE-4:], nonce)
+	return sha256.Sum256(buf)
+}
+
+// Share is a solution meeting the share difficulty of a job
+type Share struct {
+	Worker     *string `json:"worker"`
+	JobID      *string `json:"job_id"`
+	Nonce      *uint32 `json:"nonce"`
+	ExtraNonce *uint32 `json:"extra_nonce"`
+}
+
+func (s *Share) Validate() bool {
+	if s.Worker == nil ||
+		s.JobID == nil ||
+		s.Nonce == nil ||
+		s.ExtraNonce == nil {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package pool
+
+import (
+	"math"
+	"moviecoin/config"
+	"sort"
+)
+
+// Ledger records the accepted shares, oldest first. With the proportional
+// scheme it holds the shares of the current round; with PPLNS it holds the
+// last window shares, whatever round they were found in.
+type Ledger struct {
+	shares []string // worker of every share
+	window int      // 0 keeps the whole round
+}
+
+func NewLedger(scheme string, window int) *Ledger {
+	if scheme == config.PAYOUT_PROPORTIONAL {
+		window = 0
+	}
+	return &Ledger{window: window}
+}
+
+func (l *Ledger) Add(worker string) {
+	l.shares = append(l.shares, worker)
+	if l.window > 0 && len(l.shares) > l.window {
+		l.shares = l.shares[len(l.shares)-l.window:]
+	}
+}
+
+// Weights counts the shares of every worker eligible for the next reward
+func (l *Ledger) Weights() map[string]int {
+	weights := make(map[string]int)
+	for _, worker := range l.shares {
+		weights[worker]++
+	}
+	return weights
+}
+
+// EndRound is called when the pool finds a block. Proportional rounds start
+// from scratch while PPLNS keeps sliding its window.
+func (l *Ledger) EndRound() {
+	if l.window == 0 {
+		l.shares = nil
+	}
+}
+
+func (l *Ledger) Len() int {
+	return len(l.shares)
+}
+
+// Split divides amount among the workers in proportion to their weights.
+// The shares are rounded down and the last worker, in the order of the
+// addresses, gets the remainder: the payouts never add up to more than
+// amount, which the pool could not pay.
+func Split(amount float32, weights map[string]int) map[string]float32 {
+	total := 0
+	workers := make([]string, 0, len(weights))
+	for worker, w := range weights {
+		total += w
+		workers = append(workers, worker)
+	}
+	payouts := make(map[string]float32)
+	if total == 0 {
+		return payouts
+	}
+	sort.Strings(workers)
+	last := workers[len(workers)-1]
+	var paid float32
+	for _, worker := range workers[:len(workers)-1] {
+		exact := float64(amount) * float64(weights[worker]) / float64(total)
+		share := float32(exact)
+		if float64(share) > exact {
+			share = math.Nextafter32(share, 0)
+		}
+		payouts[worker] = share
+		paid += share
+	}
+	remainder := amount - paid
+	for remainder > 0 && paid+remainder > amount {
+		remainder = math.Nextafter32(remainder, 0)
+	}
+	payouts[last] = max(remainder, 0)
+	return payouts
+}
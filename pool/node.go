@@ -0,0 +1,38 @@
+package pool
+
+import (
+	"context"
+	"moviecoin/blockchain"
+	"moviecoin/client"
+	"moviecoin/miner"
+)
+
+// Node is the chain server the pool mines for
+type Node interface {
+	GetWork(payoutAddress string) (*miner.Work, error)
+	SubmitWork(ws *miner.WorkSubmission) error
+	SendTransaction(tr *blockchain.TransactionRequest) error
+}
+
+// HTTPNode talks to chain servers over their JSON API
+type HTTPNode struct {
+	client *client.Client
+}
+
+func NewHTTPNode(c *client.Client) *HTTPNode {
+	return &HTTPNode{c}
+}
+
+func (n *HTTPNode) GetWork(payoutAddress string) (*miner.Work, error) {
+	return n.client.MiningTemplate(context.Background(), payoutAddress)
+}
+
+func (n *HTTPNode) SubmitWork(ws *miner.WorkSubmission) error {
+	_, err := n.client.SubmitBlock(context.Background(), ws)
+	return err
+}
+
+func (n *HTTPNode) SendTransaction(tr *blockchain.TransactionRequest) error {
+	_, err := n.client.SendTransaction(context.Background(), tr)
+	return err
+}
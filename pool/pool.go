@@ -0,0 +1,257 @@
+package pool
+
+import (
+	"errors"
+	"log"
+	"moviecoin/blockchain"
+	"moviecoin/config"
+	"moviecoin/miner"
+	"moviecoin/params"
+	"moviecoin/wallet"
+	"sync"
+	"time"
+)
+
+const (
+	// jobs are refreshed so that workers pick up new transactions
+	JOB_REFRESH_SEC = 15
+	// shares of the last MAX_JOBS jobs on the current tip are accepted
+	MAX_JOBS = 16
+)
+
+// Share submission statuses returned by the pool server
+const (
+	SHARE_ACCEPTED = "accepted"
+	SHARE_BLOCK    = "block"
+)
+
+var (
+	ErrUnknownJob     = errors.New("unknown job")
+	ErrStaleShare     = errors.New("stale share: the job no longer extends the chain tip")
+	ErrDuplicateShare = errors.New("duplicate share")
+	ErrLowDifficulty  = errors.New("share does not meet the share difficulty")
+)
+
+type shareKey struct {
+	jobID      string
+	nonce      uint32
+	extraNonce uint32
+}
+
+type WorkerStats struct {
+	Shares    int       `json:"shares"`
+	Blocks    int       `json:"blocks"`
+	Paid      float32   `json:"paid"`
+	LastShare time.Time `json:"last_share"`
+}
+
+type Stats struct {
+	Address         string                  `json:"address"`
+	Scheme          string                  `json:"scheme"`
+	ShareDifficulty int                     `json:"share_difficulty"`
+	Height          int                     `json:"height"`
+	RoundShares     int                     `json:"round_shares"`
+	BlocksFound     int                     `json:"blocks_found"`
+	Workers         map[string]*WorkerStats `json:"workers"`
+}
+
+// Pool lets several miners cooperate: it hands out jobs built from node
+// templates paying the pool wallet, accepts shares meeting a lower difficulty
+// and redistributes every block reward it wins to the workers.
+type Pool struct {
+	node    Node
+	wallet  *wallet.Wallet
+	network *params.Network
+	config  config.PoolConfig
+
+	mux         sync.Mutex
+	job         *Job
+	jobs        map[string]*Job
+	seen        map[shareKey]bool
+	ledger      *Ledger
+	workers     map[string]*WorkerStats
+	blocksFound int
+}
+
+func NewPool(node Node, poolWallet *wallet.Wallet, network *params.Network, cfg config.PoolConfig) *Pool {
+	return &Pool{
+		node:    node,
+		wallet:  poolWallet,
+		network: network,
+		config:  cfg,
+		jobs:    make(map[string]*Job),
+		seen:    make(map[shareKey]bool),
+		ledger:  NewLedger(cfg.Scheme, cfg.Window),
+		workers: make(map[string]*WorkerStats),
+	}
+}
+
+func (p *Pool) Address() string {
+	return p.wallet.WalletAddress()
+}
+
+// CurrentJob returns the job workers should be mining, fetching a new
+// template from the node when the current one is too old
+func (p *Pool) CurrentJob() (*Job, error) {
+	p.mux.Lock()
+	job := p.job
+	p.mux.Unlock()
+	if job != nil && time.Since(job.created) < JOB_REFRESH_SEC*time.Second {
+		return job, nil
+	}
+	return p.refreshJob()
+}
+
+func (p *Pool) refreshJob() (*Job, error) {
+	work, err := p.node.GetWork(p.Address())
+	if err != nil {
+		return nil, err
+	}
+	job, err := newJob(work, p.config.ShareDifficulty)
+	if err != nil {
+		return nil, err
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.job == nil || p.job.PreviousHash != job.PreviousHash {
+		// the tip moved, shares of older jobs are stale
+		p.jobs = make(map[string]*Job)
+		p.seen = make(map[shareKey]bool)
+	} else if len(p.jobs) >= MAX_JOBS {
+		for id := range p.jobs {
+			if id != p.job.ID {
+				delete(p.jobs, id)
+			}
+		}
+	}
+	p.job = job
+	p.jobs[job.ID] = job
+	return job, nil
+}
+
+// SubmitShare credits a share to its worker. When the share also meets the
+// block difficulty it is submitted to the node, ending the round: the block
+// reward is then paid out to the workers.
+func (p *Pool) SubmitShare(s *Share) (blockFound bool, err error) {
+	if err := wallet.ValidateAddress(*s.Worker, p.network); err != nil {
+		return false, err
+	}
+	key := shareKey{*s.JobID, *s.Nonce, *s.ExtraNonce}
+	p.mux.Lock()
+	job, ok := p.jobs[*s.JobID]
+	if !ok {
+		p.mux.Unlock()
+		return false, ErrUnknownJob
+	}
+	if job.PreviousHash != p.job.PreviousHash {
+		p.mux.Unlock()
+		return false, ErrStaleShare
+	}
+	if p.seen[key] {
+		p.mux.Unlock()
+		return false, ErrDuplicateShare
+	}
+	hash := job.Hash(*s.Nonce, *s.ExtraNonce)
+	if !blockchain.MeetsDifficulty(hash, job.ShareDifficulty) {
+		p.mux.Unlock()
+		return false, ErrLowDifficulty
+	}
+	p.seen[key] = true
+	p.ledger.Add(*s.Worker)
+	stats := p.workerStats(*s.Worker)
+	stats.Shares++
+	stats.LastShare = time.Now()
+	p.mux.Unlock()
+
+	if !blockchain.MeetsDifficulty(hash, job.Difficulty) {
+		return false, nil
+	}
+	err = p.node.SubmitWork(&miner.WorkSubmission{
+		TemplateID: s.JobID,
+		Nonce:      s.Nonce,
+		ExtraNonce: s.ExtraNonce,
+	})
+	if err != nil {
+		// the share stays credited, only the block is lost
+		log.Printf("ERROR: block found by %s rejected by the node: %v", *s.Worker, err)
+		return false, nil
+	}
+	log.Printf("Block %x at height %d found by %s", hash, job.Height, *s.Worker)
+	p.endRound(*s.Worker)
+	if _, err := p.refreshJob(); err != nil {
+		log.Printf("ERROR: could not refresh the pool job: %v", err)
+	}
+	return true, nil
+}
+
+// endRound pays the workers eligible for the block reward
+func (p *Pool) endRound(finder string) {
+	p.mux.Lock()
+	weights := p.ledger.Weights()
+	p.ledger.EndRound()
+	p.blocksFound++
+	p.workerStats(finder).Blocks++
+	p.mux.Unlock()
+
+	amount := p.network.Reward * (1 - p.config.Fee)
+	for worker, share := range Split(amount, weights) {
+		if worker == p.Address() || share <= 0 {
+			continue
+		}
+		if err := p.pay(worker, share); err != nil {
+			log.Printf("ERROR: payout of %f to %s failed: %v", share, worker, err)
+			continue
+		}
+		p.mux.Lock()
+		p.workerStats(worker).Paid += share
+		p.mux.Unlock()
+	}
+}
+
+// pay sends a regular signed transaction from the pool wallet to worker
+func (p *Pool) pay(worker string, amount float32) error {
+	sender := p.Address()
+	publicKey := p.wallet.PublicKeyStr()
+	t := wallet.NewTransaction(p.wallet.PrivateKey(), p.wallet.PublicKey(), sender, worker, amount)
+	signature := t.GenerateSignature().String()
+	return p.node.SendTransaction(&blockchain.TransactionRequest{
+		SenderAddress:   &sender,
+		ReceiverAddress: &worker,
+		SenderPublicKey: &publicKey,
+		Amount:          &amount,
+		Signature:       &signature,
+	})
+}
+
+// workerStats returns the statistics of worker. Callers must hold p.mux
+func (p *Pool) workerStats(worker string) *WorkerStats {
+	stats, ok := p.workers[worker]
+	if !ok {
+		stats = new(WorkerStats)
+		p.workers[worker] = stats
+	}
+	return stats
+}
+
+func (p *Pool) Stats() *Stats {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	workers := make(map[string]*WorkerStats, len(p.workers))
+	for worker, stats := range p.workers {
+		copied := *stats
+		workers[worker] = &copied
+	}
+	height := 0
+	if p.job != nil {
+		height = p.job.Height
+	}
+	return &Stats{
+		Address:         p.Address(),
+		Scheme:          p.config.Scheme,
+		ShareDifficulty: p.config.ShareDifficulty,
+		Height:          height,
+		RoundShares:     p.ledger.Len(),
+		BlocksFound:     p.blocksFound,
+		Workers:         workers,
+	}
+}
@@ -0,0 +1,196 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"moviecoin/blockchain"
+	"moviecoin/config"
+	"moviecoin/miner"
+	"moviecoin/params"
+	"moviecoin/utils"
+	"moviecoin/wallet"
+	"testing"
+)
+
+// localNode serves templates straight from an in process blockchain
+type localNode struct {
+	bc        *blockchain.Blockchain
+	templates *miner.TemplateStore
+}
+
+func (n *localNode) GetWork(payoutAddress string) (*miner.Work, error) {
+	return n.templates.NewTemplate(n.bc, payoutAddress).Work(), nil
+}
+
+func (n *localNode) SubmitWork(ws *miner.WorkSubmission) error {
+	_, err := n.templates.Submit(n.bc, ws)
+	return err
+}
+
+func (n *localNode) SendTransaction(tr *blockchain.TransactionRequest) error {
+	publicKey := utils.PublicKeyFromString(*tr.SenderPublicKey)
+	signature := utils.SignatureFromString(*tr.Signature)
+	if !n.bc.AddTransaction(*tr.SenderAddress, *tr.ReceiverAddress, *tr.Amount, publicKey, signature) {
+		return blockchain.ErrInvalidProof
+	}
+	return nil
+}
+
+// testnet like network where shares are 16 times easier than blocks
+var poolnet = &params.Network{
+	Name:           "poolnet",
+	ChainID:        99,
+	Difficulty:     2,
+	Reward:         10,
+	MiningTimerSec: 1,
+	AddressVersion: 0x6f,
+}
+
+func newTestPool(t *testing.T, scheme string) (*Pool, *localNode) {
+	node := &localNode{blockchain.NewBlockchain("node", poolnet), miner.NewTemplateStore()}
+	cfg := config.Default().Pool
+	cfg.Scheme, cfg.Window, cfg.Fee = scheme, 100, 0.1
+	return NewPool(node, wallet.NewWallet(poolnet), poolnet, cfg), node
+}
+
+func TestLedger(t *testing.T) {
+	pplns := NewLedger(config.PAYOUT_PPLNS, 3)
+	proportional := NewLedger(config.PAYOUT_PROPORTIONAL, 3)
+	for _, worker := range []string{"a", "a", "b", "b", "b"} {
+		pplns.Add(worker)
+		proportional.Add(worker)
+	}
+	if w := pplns.Weights(); w["a"] != 0 || w["b"] != 3 {
+		t.Errorf("pplns must only count the last 3 shares: %v", w)
+	}
+	if w := proportional.Weights(); w["a"] != 2 || w["b"] != 3 {
+		t.Errorf("proportional must count the whole round: %v", w)
+	}
+	pplns.EndRound()
+	proportional.EndRound()
+	if pplns.Len() != 3 || proportional.Len() != 0 {
+		t.Errorf("after a round: pplns %d shares, proportional %d", pplns.Len(), proportional.Len())
+	}
+}
+
+func TestSplit(t *testing.T) {
+	payouts := Split(9, map[string]int{"a": 1, "b": 2})
+	if payouts["a"] != 3 || payouts["b"] != 6 {
+		t.Fatalf("unexpected split %v", payouts)
+	}
+	if len(Split(9, nil)) != 0 {
+		t.Fatal("no shares, no payouts")
+	}
+
+	// the float32 shares of these round up
+	for _, test := range []struct {
+		amount  float32
+		weights map[string]int
+	}{
+		{0.1, map[string]int{"a": 1, "b": 1, "c": 1}},
+		{1, map[string]int{"a": 2, "b": 4, "c": 1}},
+	} {
+		payouts := Split(test.amount, test.weights)
+		for _, order := range [][]string{{"a", "b", "c"}, {"c", "b", "a"}, {"b", "a", "c"}} {
+			var paid float32
+			for _, worker := range order {
+				if payouts[worker] < 0 {
+					t.Errorf("negative payout %v", payouts)
+				}
+				paid += payouts[worker]
+			}
+			if paid > test.amount || paid < test.amount*0.9999 {
+				t.Errorf("payouts %v add up to %v, for %v", payouts, paid, test.amount)
+			}
+		}
+	}
+}
+
+func TestShareValidation(t *testing.T) {
+	p, _ := newTestPool(t, config.PAYOUT_PPLNS)
+	worker := wallet.NewWallet(poolnet).WalletAddress()
+	job, err := p.CurrentJob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var good, bad uint32
+	// a share which does not solve the block, or the job would change
+	for ; !blockchain.MeetsDifficulty(job.Hash(good, 0), job.ShareDifficulty) ||
+		blockchain.MeetsDifficulty(job.Hash(good, 0), job.Difficulty); good++ {
+	}
+	for ; blockchain.MeetsDifficulty(job.Hash(bad, 0), job.ShareDifficulty); bad++ {
+	}
+	zero := uint32(0)
+	unknown := "nope"
+	invalid := "not an address"
+	cases := []struct {
+		share *Share
+		err   error
+	}{
+		{&Share{&worker, &job.ID, &bad, &zero}, ErrLowDifficulty},
+		{&Share{&worker, &unknown, &good, &zero}, ErrUnknownJob},
+		{&Share{&worker, &job.ID, &good, &zero}, nil},
+		{&Share{&worker, &job.ID, &good, &zero}, ErrDuplicateShare},
+	}
+	for i, c := range cases {
+		if _, err := p.SubmitShare(c.share); err != c.err {
+			t.Errorf("case %d: got %v, expected %v", i, err, c.err)
+		}
+	}
+	if _, err := p.SubmitShare(&Share{&invalid, &job.ID, &good, &zero}); err == nil {
+		t.Error("share from an invalid worker address accepted")
+	}
+}
+
+func TestRoundPayout(t *testing.T) {
+	p, node := newTestPool(t, config.PAYOUT_PROPORTIONAL)
+	alice := wallet.NewWallet(poolnet).WalletAddress()
+	bob := wallet.NewWallet(poolnet).WalletAddress()
+	workers := []*Worker{NewWorker(alice, p), NewWorker(bob, p)}
+mining:
+	for {
+		for _, w := range workers {
+			if p.Stats().BlocksFound > 0 {
+				break mining
+			}
+			job, err := p.CurrentJob()
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Work(context.Background(), job, 64)
+		}
+	}
+	stats := p.Stats()
+	if node.bc.CalculateTotalAmount(p.Address()) != poolnet.Reward {
+		t.Fatal("block reward not paid to the pool")
+	}
+	var paid float32
+	for _, worker := range []string{alice, bob} {
+		if s := stats.Workers[worker]; s != nil {
+			paid += s.Paid
+		}
+	}
+	if want := poolnet.Reward * 0.9; paid < want-0.001 || paid > want+0.001 {
+		t.Fatalf("paid %v to the workers, expected %v", paid, want)
+	}
+	// payouts are regular transactions waiting to be mined
+	if len(node.bc.TransactionPool()) == 0 {
+		t.Fatal("no payout transaction reached the node")
+	}
+	if stats.RoundShares != 0 {
+		t.Fatal("proportional round not reset")
+	}
+}
+
+func TestJobJSON(t *testing.T) {
+	p, _ := newTestPool(t, config.PAYOUT_PPLNS)
+	job, _ := p.CurrentJob()
+	m, _ := json.Marshal(job)
+	var decoded Job
+	if err := json.Unmarshal(m, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Hash(42, 7) != job.Hash(42, 7) {
+		t.Fatal("decoded job hashes differently")
+	}
+}
@@ -0,0 +1,72 @@
+package pool
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"moviecoin/blockchain"
+	"time"
+)
+
+// NONCES_PER_JOB is the number of nonces a worker tries before asking for a
+// fresh job
+const NONCES_PER_JOB = 1 << 20
+
+// JobSource is where a worker gets its jobs and sends its shares: the pool
+// itself or a client of the pool server
+type JobSource interface {
+	CurrentJob() (*Job, error)
+	SubmitShare(s *Share) (bool, error)
+}
+
+// Worker mines shares for a pool, paid to its wallet address
+type Worker struct {
+	address string
+	source  JobSource
+	random  *rand.Rand
+}
+
+func NewWorker(address string, source JobSource) *Worker {
+	return &Worker{address, source, rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Run mines until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := w.source.CurrentJob()
+		if err != nil {
+			log.Printf("ERROR: no job from the pool: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		w.Work(ctx, job, NONCES_PER_JOB)
+	}
+}
+
+// Work searches count nonces of job and submits every share found. Each
+// call picks a random extra nonce so that workers do not overlap.
+func (w *Worker) Work(ctx context.Context, job *Job, count int) {
+	extraNonce := w.random.Uint32()
+	for nonce := uint32(0); nonce < uint32(count); nonce++ {
+		if nonce%4096 == 0 && ctx.Err() != nil {
+			return
+		}
+		hash := job.Hash(nonce, extraNonce)
+		if !blockchain.MeetsDifficulty(hash, job.ShareDifficulty) {
+			continue
+		}
+		n, e := nonce, extraNonce
+		blockFound, err := w.source.SubmitShare(&Share{&w.address, &job.ID, &n, &e})
+		if err != nil {
+			log.Printf("Share rejected: %v", err)
+			// stale or unknown job, get a new one
+			return
+		}
+		if blockFound {
+			return
+		}
+	}
+}
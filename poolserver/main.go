@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"moviecoin/client"
+	"moviecoin/config"
+	"moviecoin/params"
+	"moviecoin/pool"
+	"moviecoin/security"
+	"moviecoin/wallet"
+	"os"
+	"sync"
+)
+
+func init() {
+	log.SetPrefix("Pool: ")
+}
+
+// runWorker mines shares for a pool server: poolserver worker -pool=... -address=...
+func runWorker(args []string) {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	gateway := fs.String("pool", "http://localhost:7000", "Pool server URL")
+	address := fs.String("address", "", "Wallet address receiving the payouts")
+	threads := fs.Int("threads", 1, "Number of worker threads")
+	fs.Parse(args)
+	if *address == "" {
+		log.Fatal("ERROR: -address is required")
+	}
+	source := pool.NewHTTPPool(*gateway)
+	var wg sync.WaitGroup
+	for i := 0; i < *threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.NewWorker(*address, source).Run(context.Background())
+		}()
+	}
+	wg.Wait()
+}
+
+// loadPoolWallet opens the encrypted pool wallet, creating it on first start
+func loadPoolWallet(cfg *config.Config, network *params.Network) (*wallet.Wallet, error) {
+	passphrase := os.Getenv(config.POOL_PASSPHRASE_ENV)
+	if passphrase == "" {
+		return nil, fmt.Errorf("%s must be set, the pool wallet holds the rewards of the workers",
+			config.POOL_PASSPHRASE_ENV)
+	}
+	path := cfg.PoolKeyFile()
+	poolWallet, err := wallet.Load(path, passphrase, network)
+	if errors.Is(err, fs.ErrNotExist) {
+		poolWallet = wallet.NewWallet(network)
+		if err := poolWallet.Save(path, passphrase, network); err != nil {
+			return nil, err
+		}
+		log.Printf("New pool wallet saved to %s", path)
+	} else if err != nil {
+		return nil, err
+	}
+	return poolWallet, nil
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		runWorker(os.Args[2:])
+		return
+	}
+	dump, args := config.ParseCommand(os.Args[1:])
+	cfg, err := config.Load(config.POOL_SERVER, "poolserver", args)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dump {
+		os.Stdout.Write(cfg.Dump())
+		return
+	}
+	logFile, err := cfg.Log.SetupLogging()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer logFile.Close()
+
+	network := cfg.Params()
+	poolWallet, err := loadPoolWallet(cfg, network)
+	if err != nil {
+		log.Fatalf("ERROR: pool wallet: %v", err)
+	}
+	scheme := "http"
+	if cfg.Pool.NodeTLS {
+		scheme = "https"
+	}
+	gateway := fmt.Sprintf("%s://%s:%d", scheme, cfg.Pool.Node, cfg.Pool.NodePort)
+	httpClient, err := security.NewHTTPClient(cfg.Pool.NodeTLS, cfg.Pool.NodeCA, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	node := client.NewClient(gateway)
+	node.HTTPClient = httpClient
+	p := pool.NewPool(pool.NewHTTPNode(node), poolWallet, network, cfg.Pool)
+	log.Printf("Pool address %s, mining for %s", p.Address(), gateway)
+	app := NewPoolServer(cfg.Pool.Port, p)
+	app.Run()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"moviecoin/pool"
+	"moviecoin/utils"
+	"net/http"
+	"strconv"
+)
+
+type PoolServer struct {
+	port uint16
+	pool *pool.Pool
+}
+
+func NewPoolServer(port uint16, p *pool.Pool) *PoolServer {
+	return &PoolServer{port, p}
+}
+
+func (ps *PoolServer) Port() uint16 {
+	return ps.port
+}
+
+func (ps *PoolServer) Job(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		job, err := ps.pool.CurrentJob()
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		m, _ := json.Marshal(job)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (ps *PoolServer) Share(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		decoder := json.NewDecoder(req.Body)
+		var s pool.Share
+		err := decoder.Decode(&s)
+		w.Header().Add("Content-Type", "application/json")
+		if err != nil || !s.Validate() {
+			log.Println("ERROR: malformed share")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		blockFound, err := ps.pool.SubmitShare(&s)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus(err.Error())))
+			return
+		}
+		if blockFound {
+			io.WriteString(w, string(utils.JsonStatus(pool.SHARE_BLOCK)))
+			return
+		}
+		io.WriteString(w, string(utils.JsonStatus(pool.SHARE_ACCEPTED)))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (ps *PoolServer) Stats(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(ps.pool.Stats())
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (ps *PoolServer) Run() {
+	http.HandleFunc("/pool/job", ps.Job)
+	http.HandleFunc("/pool/share", ps.Share)
+	http.HandleFunc("/pool/stats", ps.Stats)
+	log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(ps.Port())), nil))
+}
@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Params are the parameters of a call by name, the positional ones are named
+// after the parameters of the method
+type Params map[string]json.RawMessage
+
+func parseParams(raw json.RawMessage, names []string) (Params, error) {
+	params := make(Params)
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return params, nil
+	}
+	switch raw[0] {
+	case '[':
+		var positional []json.RawMessage
+		if err := json.Unmarshal(raw, &positional); err != nil {
+			return nil, InvalidParams(err.Error())
+		}
+		if len(positional) > len(names) {
+			return nil, InvalidParams(fmt.Sprintf("at most %d parameters expected", len(names)))
+		}
+		for i, p := range positional {
+			params[names[i]] = p
+		}
+	case '{':
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, InvalidParams(err.Error())
+		}
+		for name := range params {
+			if !contains(names, name) {
+				return nil, InvalidParams("unknown parameter " + name)
+			}
+		}
+	default:
+		return nil, InvalidParams("params must be an array or an object")
+	}
+	return params, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Get decodes the parameter name into v and tells whether it was given. A
+// null parameter counts as missing.
+func (p Params) Get(name string, v interface{}) (bool, error) {
+	raw, ok := p[name]
+	if !ok || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return true, InvalidParams(fmt.Sprintf("invalid %s: %v", name, err))
+	}
+	return true, nil
+}
+
+// Required decodes the parameter name into v, which must be given
+func (p Params) Required(name string, v interface{}) error {
+	found, err := p.Get(name, v)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return InvalidParams("missing " + name)
+	}
+	return nil
+}
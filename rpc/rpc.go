@@ -0,0 +1,252 @@
+// Package rpc serves JSON-RPC 2.0 over HTTP: single and batch requests,
+// notifications, positional or named parameters and the standard errors.
+// The chain server registers its methods on it.
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+)
+
+const (
+	VERSION = "2.0"
+	// requests with larger bodies are refused
+	MAX_BODY_SIZE = 1 << 20
+	// MAX_BATCH_SIZE is the largest number of calls in a batch
+	MAX_BATCH_SIZE = 100
+)
+
+// Error codes of the specification, the implementation defined ones are
+// between -32000 and -32099
+const (
+	CODE_PARSE_ERROR      = -32700
+	CODE_INVALID_REQUEST  = -32600
+	CODE_METHOD_NOT_FOUND = -32601
+	CODE_INVALID_PARAMS   = -32602
+	CODE_INTERNAL_ERROR   = -32603
+	CODE_UNAUTHORIZED     = -32001
+)
+
+// Error is the error member of a response
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func InvalidParams(message string) *Error {
+	return NewError(CODE_INVALID_PARAMS, message)
+}
+
+func Unauthorized() *Error {
+	return NewError(CODE_UNAUTHORIZED, "authorization required")
+}
+
+// Request is a call, a notification when ID is missing
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+func (r *Request) notification() bool {
+	return r.ID == nil
+}
+
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Handler runs a method. The error is the error member of the response when
+// it is an *Error, an internal error otherwise.
+type Handler func(req *http.Request, params Params) (interface{}, error)
+
+// Middleware wraps the handler of a method, to authorize it for instance
+type Middleware func(Handler) Handler
+
+type method struct {
+	params  []string
+	handler Handler
+}
+
+// Server dispatches the calls posted to it to the registered methods
+type Server struct {
+	methods map[string]*method
+}
+
+func NewServer() *Server {
+	return &Server{methods: make(map[string]*method)}
+}
+
+// Register adds the method name taking the parameters params, given by
+// position or by name
+func (s *Server) Register(name string, params []string, h Handler, middlewares ...Middleware) {
+	for _, m := range middlewares {
+		h = m(h)
+	}
+	s.methods[name] = &method{params: params, handler: h}
+}
+
+// Methods returns the names of the registered methods, sorted
+func (s *Server) Methods() []string {
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		log.Println("ERROR: Invalid HTTP Method")
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, MAX_BODY_SIZE))
+	if err != nil {
+		writeJSON(w, errorResponse(nil, NewError(CODE_PARSE_ERROR, err.Error())))
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		if resp := s.call(req, body); resp != nil {
+			writeJSON(w, resp)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		writeJSON(w, errorResponse(nil, NewError(CODE_PARSE_ERROR, err.Error())))
+		return
+	}
+	if len(batch) == 0 {
+		writeJSON(w, errorResponse(nil, NewError(CODE_INVALID_REQUEST, "empty batch")))
+		return
+	}
+	if len(batch) > MAX_BATCH_SIZE {
+		writeJSON(w, errorResponse(nil, NewError(CODE_INVALID_REQUEST,
+			fmt.Sprintf("more than %d calls in the batch", MAX_BATCH_SIZE))))
+		return
+	}
+	responses := make([]*Response, 0, len(batch))
+	for _, raw := range batch {
+		if resp := s.call(req, raw); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	// a batch of notifications has no response at all
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, responses)
+}
+
+// call runs one request, nil for notifications
+func (s *Server) call(req *http.Request, raw json.RawMessage) *Response {
+	var r Request
+	if err := json.Unmarshal(raw, &r); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) || len(raw) == 0 {
+			return errorResponse(nil, NewError(CODE_PARSE_ERROR, "invalid JSON"))
+		}
+		return errorResponse(nil, NewError(CODE_INVALID_REQUEST, err.Error()))
+	}
+	if r.JSONRPC != VERSION || r.Method == "" || !validID(r.ID) {
+		return errorResponse(validIDOrNull(r.ID), NewError(CODE_INVALID_REQUEST, "invalid JSON-RPC 2.0 request"))
+	}
+	result, err := s.run(req, &r)
+	if r.notification() {
+		if err != nil {
+			log.Printf("ERROR: notification %s: %v", r.Method, err)
+		}
+		return nil
+	}
+	if err != nil {
+		var e *Error
+		if !errors.As(err, &e) {
+			log.Printf("ERROR: %s: %v", r.Method, err)
+			e = NewError(CODE_INTERNAL_ERROR, "internal error")
+		}
+		return errorResponse(r.ID, e)
+	}
+	m, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("ERROR: %s: %v", r.Method, err)
+		return errorResponse(r.ID, NewError(CODE_INTERNAL_ERROR, "internal error"))
+	}
+	return &Response{JSONRPC: VERSION, Result: m, ID: r.ID}
+}
+
+func (s *Server) run(req *http.Request, r *Request) (interface{}, error) {
+	m, ok := s.methods[r.Method]
+	if !ok {
+		return nil, NewError(CODE_METHOD_NOT_FOUND, "method not found: "+r.Method)
+	}
+	params, err := parseParams(r.Params, m.params)
+	if err != nil {
+		return nil, err
+	}
+	return m.handler(req, params)
+}
+
+// validID tells whether id is absent or a string, a number or null
+func validID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	var v interface{}
+	if err := json.Unmarshal(id, &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case nil, string, float64:
+		return true
+	}
+	return false
+}
+
+func validIDOrNull(id json.RawMessage) json.RawMessage {
+	if id == nil || !validID(id) {
+		return nil
+	}
+	return id
+}
+
+func errorResponse(id json.RawMessage, e *Error) *Response {
+	return &Response{JSONRPC: VERSION, Error: e, ID: id}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	m, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(m)
+}
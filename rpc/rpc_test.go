@@ -0,0 +1,133 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer() *Server {
+	s := NewServer()
+	s.Register("add", []string{"a", "b"}, func(req *http.Request, params Params) (interface{}, error) {
+		var a, b int
+		if err := params.Required("a", &a); err != nil {
+			return nil, err
+		}
+		if _, err := params.Get("b", &b); err != nil {
+			return nil, err
+		}
+		return a + b, nil
+	})
+	s.Register("fail", nil, func(req *http.Request, params Params) (interface{}, error) {
+		return nil, errors.New("database on fire")
+	})
+	s.Register("secret", nil, func(req *http.Request, params Params) (interface{}, error) {
+		return "42", nil
+	}, func(h Handler) Handler {
+		return func(req *http.Request, params Params) (interface{}, error) {
+			if req.Header.Get("Authorization") == "" {
+				return nil, Unauthorized()
+			}
+			return h(req, params)
+		}
+	})
+	return s
+}
+
+func post(s *Server, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body)))
+	return w
+}
+
+func TestCall(t *testing.T) {
+	s := newTestServer()
+	tests := []struct {
+		name   string
+		body   string
+		result string
+		code   int
+		id     string
+	}{
+		{"positional", `{"jsonrpc":"2.0","method":"add","params":[1,2],"id":1}`, "3", 0, "1"},
+		{"named", `{"jsonrpc":"2.0","method":"add","params":{"a":5},"id":"x"}`, "5", 0, `"x"`},
+		{"missing", `{"jsonrpc":"2.0","method":"add","id":2}`, "", CODE_INVALID_PARAMS, "2"},
+		{"too many", `{"jsonrpc":"2.0","method":"add","params":[1,2,3],"id":3}`, "", CODE_INVALID_PARAMS, "3"},
+		{"unknown name", `{"jsonrpc":"2.0","method":"add","params":{"c":1},"id":4}`, "", CODE_INVALID_PARAMS, "4"},
+		{"type", `{"jsonrpc":"2.0","method":"add","params":["one"],"id":5}`, "", CODE_INVALID_PARAMS, "5"},
+		{"method", `{"jsonrpc":"2.0","method":"sub","id":6}`, "", CODE_METHOD_NOT_FOUND, "6"},
+		{"version", `{"jsonrpc":"1.0","method":"add","id":7}`, "", CODE_INVALID_REQUEST, "7"},
+		{"id", `{"jsonrpc":"2.0","method":"add","id":{}}`, "", CODE_INVALID_REQUEST, "null"},
+		{"parse", `{"jsonrpc":`, "", CODE_PARSE_ERROR, "null"},
+		{"internal", `{"jsonrpc":"2.0","method":"fail","id":8}`, "", CODE_INTERNAL_ERROR, "8"},
+		{"unauthorized", `{"jsonrpc":"2.0","method":"secret","id":9}`, "", CODE_UNAUTHORIZED, "9"},
+	}
+	for _, test := range tests {
+		w := post(s, test.body)
+		var resp Response
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Errorf("%s: %v: %s", test.name, err, w.Body)
+			continue
+		}
+		if string(resp.ID) != test.id && !(test.id == "null" && resp.ID == nil) {
+			t.Errorf("%s: id %s", test.name, resp.ID)
+		}
+		if test.code != 0 {
+			if resp.Error == nil || resp.Error.Code != test.code || resp.Result != nil {
+				t.Errorf("%s: expected error %d: %s", test.name, test.code, w.Body)
+			}
+			continue
+		}
+		if resp.Error != nil || string(resp.Result) != test.result {
+			t.Errorf("%s: %s", test.name, w.Body)
+		}
+	}
+	if w := post(s, `{"jsonrpc":"2.0","method":"add","params":[1]}`); w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("notification answered: %d %s", w.Code, w.Body)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rpc", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: %d", w.Code)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	s := newTestServer()
+	w := post(s, `[
+		{"jsonrpc":"2.0","method":"add","params":[1,1],"id":1},
+		{"jsonrpc":"2.0","method":"add","params":[2]},
+		{"jsonrpc":"2.0","method":"sub","id":2},
+		1,
+		{"jsonrpc":"2.0","method":"add","params":[3,3],"id":3}
+	]`)
+	var responses []Response
+	if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	if len(responses) != 4 {
+		t.Fatalf("%d responses: %s", len(responses), w.Body)
+	}
+	if string(responses[0].Result) != "2" || string(responses[3].Result) != "6" {
+		t.Errorf("results %s", w.Body)
+	}
+	if responses[1].Error.Code != CODE_METHOD_NOT_FOUND || responses[2].Error.Code != CODE_INVALID_REQUEST {
+		t.Errorf("errors %s", w.Body)
+	}
+
+	var single Response
+	json.Unmarshal(post(s, `[]`).Body.Bytes(), &single)
+	if single.Error == nil || single.Error.Code != CODE_INVALID_REQUEST {
+		t.Errorf("empty batch: %+v", single)
+	}
+	json.Unmarshal(post(s, `[{"jsonrpc":"2.0","method":"add"},`).Body.Bytes(), &single)
+	if single.Error == nil || single.Error.Code != CODE_PARSE_ERROR {
+		t.Errorf("malformed batch: %+v", single)
+	}
+	if w := post(s, `[{"jsonrpc":"2.0","method":"add","params":[1]}]`); w.Code != http.StatusNoContent {
+		t.Errorf("batch of notifications answered: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,128 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+)
+
+// Node IDs are the first NODE_ID_SIZE bytes of the sha256 of the node
+// public key, hex encoded
+const NODE_ID_SIZE = 20
+
+const nodeKeyPEMType = "EC PRIVATE KEY"
+
+// NodeKey is the identity of a node on the network. Unlike wallet keys it
+// holds no funds, so it is stored unencrypted and readable by the node only.
+type NodeKey struct {
+	private *ecdsa.PrivateKey
+}
+
+func NewNodeKey() (*NodeKey, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeKey{private: private}, nil
+}
+
+// LoadOrCreateNodeKey reads the node key at path, creating it on the first
+// start so that the node keeps its ID across restarts
+func LoadOrCreateNodeKey(path string) (*NodeKey, error) {
+	m, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		k, err := NewNodeKey()
+		if err != nil {
+			return nil, err
+		}
+		return k, k.Save(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(m)
+	if block == nil || block.Type != nodeKeyPEMType {
+		return nil, fmt.Errorf("%s: not a node key", path)
+	}
+	private, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if private.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s: node keys are P-256 keys", path)
+	}
+	return &NodeKey{private: private}, nil
+}
+
+func (k *NodeKey) Save(path string) error {
+	der, err := x509.MarshalECPrivateKey(k.private)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: nodeKeyPEMType, Bytes: der}), 0600)
+}
+
+func (k *NodeKey) PrivateKey() *ecdsa.PrivateKey {
+	return k.private
+}
+
+func (k *NodeKey) PublicKey() *ecdsa.PublicKey {
+	return &k.private.PublicKey
+}
+
+// PublicKeyHex encodes the public key as X and Y, 64 hex digits each, like
+// the wallet public keys
+func (k *NodeKey) PublicKeyHex() string {
+	return fmt.Sprintf("%064x%064x", k.private.X, k.private.Y)
+}
+
+func (k *NodeKey) ID() string {
+	return NodeID(k.PublicKey())
+}
+
+// Sign signs the sha256 of msg, the signature is ASN.1 encoded
+func (k *NodeKey) Sign(msg []byte) ([]byte, error) {
+	hash := sha256.Sum256(msg)
+	return ecdsa.SignASN1(rand.Reader, k.private, hash[:])
+}
+
+// NodeID derives the ID of the node owning publicKey
+func NodeID(publicKey *ecdsa.PublicKey) string {
+	var buf [64]byte
+	publicKey.X.FillBytes(buf[:32])
+	publicKey.Y.FillBytes(buf[32:])
+	hash := sha256.Sum256(buf[:])
+	return hex.EncodeToString(hash[:NODE_ID_SIZE])
+}
+
+// VerifySignature checks a signature made by NodeKey.Sign
+func VerifySignature(publicKey *ecdsa.PublicKey, msg []byte, signature []byte) bool {
+	hash := sha256.Sum256(msg)
+	return ecdsa.VerifyASN1(publicKey, hash[:], signature)
+}
+
+// PublicKeyFromHex decodes a key encoded by NodeKey.PublicKeyHex, checking
+// that it is a point of the curve
+func PublicKeyFromHex(s string) (*ecdsa.PublicKey, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 64 {
+		return nil, errors.New("malformed public key")
+	}
+	x, y := new(big.Int).SetBytes(b[:32]), new(big.Int).SetBytes(b[32:])
+	if !elliptic.P256().IsOnCurve(x, y) {
+		return nil, errors.New("public key is not on the curve")
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
@@ -0,0 +1,63 @@
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNodeKeyPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testnet", "node.key")
+	k, err := LoadOrCreateNodeKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("node key readable by others: %v", info.Mode())
+	}
+	again, err := LoadOrCreateNodeKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID() != k.ID() || len(k.ID()) != 2*NODE_ID_SIZE {
+		t.Errorf("node ID %s changed to %s", k.ID(), again.ID())
+	}
+
+	os.WriteFile(path, []byte("garbage"), 0600)
+	if _, err := LoadOrCreateNodeKey(path); err == nil {
+		t.Error("corrupted node key loaded")
+	}
+}
+
+func TestNodeKeySignature(t *testing.T) {
+	k, _ := NewNodeKey()
+	msg := []byte("announcement")
+	sig, err := k.Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := PublicKeyFromHex(k.PublicKeyHex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySignature(publicKey, msg, sig) {
+		t.Error("valid signature rejected")
+	}
+	if VerifySignature(publicKey, []byte("tampered"), sig) {
+		t.Error("signature of another message accepted")
+	}
+	other, _ := NewNodeKey()
+	if VerifySignature(other.PublicKey(), msg, sig) {
+		t.Error("signature accepted for another key")
+	}
+	if NodeID(publicKey) != k.ID() {
+		t.Error("node ID differs for the decoded key")
+	}
+	if _, err := PublicKeyFromHex(k.PublicKeyHex()[:126] + "00"); err == nil {
+		t.Error("point off the curve accepted")
+	}
+}
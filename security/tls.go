@@ -0,0 +1,51 @@
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ListenAndServe serves handler on addr over HTTPS when certFile and keyFile
+// are set, over plain HTTP otherwise
+func ListenAndServe(addr string, certFile string, keyFile string, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if certFile == "" && keyFile == "" {
+		return srv.ListenAndServe()
+	}
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	return srv.ListenAndServeTLS(certFile, keyFile)
+}
+
+// NewHTTPClient returns a client for a node served over HTTPS when useTLS is
+// set. It trusts the PEM certificates of caFile when set, the system
+// certificate authorities otherwise.
+func NewHTTPClient(useTLS bool, caFile string, timeout time.Duration) (*http.Client, error) {
+	client := &http.Client{Timeout: timeout}
+	if !useTLS {
+		return client, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		m, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(m) {
+			return nil, fmt.Errorf("%s: no PEM certificate", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client.Transport = transport
+	return client, nil
+}
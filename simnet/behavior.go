@@ -0,0 +1,43 @@
+package simnet
+
+import (
+	"moviecoin/blockchain"
+	"moviecoin/p2p"
+)
+
+// Behavior is an attack of a malicious node on one of its peers
+type Behavior func(n *Node, p *p2p.Peer)
+
+// InvalidBlocks sends blocks on top of the chain which fail the proof of
+// work
+func InvalidBlocks(n *Node, p *p2p.Peer) {
+	b, _ := n.Chain.NewBlockTemplate(n.Wallet.WalletAddress())
+	for nonce := uint32(0); blockchain.ValidProof(b.Header(), n.sim.params.Difficulty); nonce++ {
+		b.SetNonces(nonce, 0)
+	}
+	p.Send(&p2p.MsgBlock{Block: b})
+}
+
+// UnsolicitedHeaders sends the headers of the chain nobody asked for
+func UnsolicitedHeaders(n *Node, p *p2p.Peer) {
+	var headers []*blockchain.Header
+	for _, b := range n.Chain.Chain() {
+		headers = append(headers, b.Header())
+	}
+	p.Send(&p2p.MsgHeaders{Headers: headers})
+}
+
+// ForgedRewards sends transactions minting coins out of thin air, a new
+// one every time
+func ForgedRewards(n *Node, p *p2p.Peer) {
+	sender, receiver := blockchain.MINING_SENDER, n.Wallet.WalletAddress()
+	publicKey, signature := n.Wallet.PublicKeyStr(), "00"
+	amount := float32(n.sim.Clock.Now().Unix() % 1000000)
+	p.Send(&p2p.MsgTx{Transaction: &blockchain.TransactionRequest{
+		SenderAddress:   &sender,
+		ReceiverAddress: &receiver,
+		SenderPublicKey: &publicKey,
+		Amount:          &amount,
+		Signature:       &signature,
+	}})
+}
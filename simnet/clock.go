@@ -0,0 +1,104 @@
+package simnet
+
+import (
+	"moviecoin/p2p"
+	"sync"
+	"time"
+)
+
+// Clock is a virtual clock: time only passes when the simulator advances
+// it, firing the timers and tickers which expire on the way
+type Clock struct {
+	mux     sync.Mutex
+	now     time.Time
+	waiters map[*waiter]struct{}
+}
+
+type waiter struct {
+	at     time.Time
+	period time.Duration // tickers only
+	c      chan time.Time
+}
+
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start, waiters: make(map[*waiter]struct{})}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	return c.newWaiter(d, 0).c
+}
+
+func (c *Clock) NewTicker(d time.Duration) p2p.Ticker {
+	if d <= 0 {
+		panic("simnet: non-positive ticker interval")
+	}
+	return &ticker{c, c.newWaiter(d, d)}
+}
+
+func (c *Clock) newWaiter(d time.Duration, period time.Duration) *waiter {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	w := &waiter{at: c.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+		return w
+	}
+	c.waiters[w] = struct{}{}
+	return w
+}
+
+func (c *Clock) stop(w *waiter) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	delete(c.waiters, w)
+}
+
+// Advance moves the clock d forward. Like time.Ticker, a ticker missing
+// several ticks only delivers one.
+func (c *Clock) Advance(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.now = c.now.Add(d)
+	for w := range c.waiters {
+		if w.at.After(c.now) {
+			continue
+		}
+		select {
+		case w.c <- c.now:
+		default:
+		}
+		if w.period == 0 {
+			delete(c.waiters, w)
+			continue
+		}
+		for !w.at.After(c.now) {
+			w.at = w.at.Add(w.period)
+		}
+	}
+}
+
+// Timers returns the number of pending timers and tickers
+func (c *Clock) Timers() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.waiters)
+}
+
+type ticker struct {
+	clock *Clock
+	w     *waiter
+}
+
+func (t *ticker) C() <-chan time.Time {
+	return t.w.c
+}
+
+func (t *ticker) Stop() {
+	t.clock.stop(t.w)
+}
@@ -0,0 +1,403 @@
+package simnet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"moviecoin/p2p"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Ephemeral ports are given to dialing connections and to listeners on
+// port 0
+const FIRST_EPHEMERAL_PORT = 40000
+
+var (
+	ErrUnreachable       = errors.New("host unreachable")
+	ErrConnectionRefused = errors.New("connection refused")
+	ErrAddressInUse      = errors.New("address already in use")
+)
+
+// Link sets how messages travel between two hosts. Every write on a
+// connection is delivered after Latency plus up to Jitter, in order, or
+// lost with probability Loss. The p2p server writes a whole frame at once,
+// so a lost write is a lost message.
+type Link struct {
+	Latency time.Duration
+	Jitter  time.Duration
+	Loss    float64
+}
+
+// Network is an in-memory network between hosts identified by their IP
+// address, driven by a virtual clock. Links and partitions can change at
+// any time and apply to the connections already open.
+type Network struct {
+	clock *Clock
+
+	mux         sync.Mutex
+	rand        *rand.Rand
+	listeners   map[string]*listener
+	defaultLink Link
+	links       map[[2]string]Link
+	// group of every partitioned host, nil when the network is whole
+	groups   map[string]int
+	nextPort int
+	// messages lost because of the link or a partition
+	dropped int
+}
+
+// NewNetwork creates a network on clock, seed makes the message losses and
+// jitter reproducible
+func NewNetwork(clock *Clock, seed int64) *Network {
+	return &Network{
+		clock:     clock,
+		rand:      rand.New(rand.NewSource(seed)),
+		listeners: make(map[string]*listener),
+		links:     make(map[[2]string]Link),
+		nextPort:  FIRST_EPHEMERAL_PORT,
+	}
+}
+
+func (n *Network) Clock() *Clock {
+	return n.clock
+}
+
+// Transport connects from host
+func (n *Network) Transport(host string) p2p.Transport {
+	return &transport{n, host}
+}
+
+// SetDefaultLink applies l between the hosts without a link of their own
+func (n *Network) SetDefaultLink(l Link) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.defaultLink = l
+}
+
+// SetLink applies l between a and b, in both directions
+func (n *Network) SetLink(a string, b string, l Link) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.links[linkKey(a, b)] = l
+}
+
+func linkKey(a string, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// Partition splits the network: hosts in different groups cannot reach
+// each other, new connections fail and messages on open ones are lost.
+// Hosts in no group reach everybody.
+func (n *Network) Partition(groups ...[]string) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.groups = make(map[string]int)
+	for i, g := range groups {
+		for _, host := range g {
+			n.groups[host] = i
+		}
+	}
+}
+
+// Heal ends the partition
+func (n *Network) Heal() {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.groups = nil
+}
+
+// Dropped returns the number of messages lost so far
+func (n *Network) Dropped() int {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return n.dropped
+}
+
+func (n *Network) reachable(a string, b string) bool {
+	ga, oka := n.groups[a]
+	gb, okb := n.groups[b]
+	return !oka || !okb || ga == gb
+}
+
+// delay decides the fate of a message from a to b: dropped, or delivered
+// after the returned delay
+func (n *Network) delay(a string, b string) (time.Duration, bool) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	l, ok := n.links[linkKey(a, b)]
+	if !ok {
+		l = n.defaultLink
+	}
+	if !n.reachable(a, b) || (l.Loss > 0 && n.rand.Float64() < l.Loss) {
+		n.dropped++
+		return 0, false
+	}
+	d := l.Latency
+	if l.Jitter > 0 {
+		d += time.Duration(n.rand.Int63n(int64(l.Jitter)))
+	}
+	return d, true
+}
+
+type transport struct {
+	net  *Network
+	host string
+}
+
+func (t *transport) Listen(addr string) (net.Listener, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" || net.ParseIP(host).IsUnspecified() {
+		host = t.host
+	}
+	if host != t.host {
+		return nil, fmt.Errorf("listen %s: not an address of %s", addr, t.host)
+	}
+	t.net.mux.Lock()
+	defer t.net.mux.Unlock()
+	if port == "0" {
+		port = strconv.Itoa(t.net.nextPort)
+		t.net.nextPort++
+	}
+	addr = net.JoinHostPort(host, port)
+	if _, ok := t.net.listeners[addr]; ok {
+		return nil, fmt.Errorf("listen %s: %w", addr, ErrAddressInUse)
+	}
+	l := &listener{
+		net:    t.net,
+		addr:   simAddr(addr),
+		accept: make(chan *conn, 16),
+		closed: make(chan struct{}),
+	}
+	t.net.listeners[addr] = l
+	return l, nil
+}
+
+// Dial connects at once, the latency only applies to the messages
+func (t *transport) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	t.net.mux.Lock()
+	if !t.net.reachable(t.host, host) {
+		t.net.mux.Unlock()
+		return nil, fmt.Errorf("dial %s: %w", addr, ErrUnreachable)
+	}
+	l, ok := t.net.listeners[addr]
+	local := simAddr(net.JoinHostPort(t.host, strconv.Itoa(t.net.nextPort)))
+	t.net.nextPort++
+	t.net.mux.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("dial %s: %w", addr, ErrConnectionRefused)
+	}
+	a, b := newPipe(), newPipe()
+	dialer := &conn{net: t.net, local: local, remote: l.addr, in: a, out: b}
+	accepted := &conn{net: t.net, local: l.addr, remote: local, in: b, out: a}
+	select {
+	case l.accept <- accepted:
+		return dialer, nil
+	case <-l.closed:
+	default:
+	}
+	return nil, fmt.Errorf("dial %s: %w", addr, ErrConnectionRefused)
+}
+
+type simAddr string
+
+func (a simAddr) Network() string {
+	return "sim"
+}
+
+func (a simAddr) String() string {
+	return string(a)
+}
+
+type listener struct {
+	net    *Network
+	addr   simAddr
+	accept chan *conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accept:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *listener) Close() error {
+	l.once.Do(func() {
+		l.net.mux.Lock()
+		delete(l.net.listeners, string(l.addr))
+		l.net.mux.Unlock()
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *listener) Addr() net.Addr {
+	return l.addr
+}
+
+// pipe carries the data of one direction of a connection
+type pipe struct {
+	mux    sync.Mutex
+	chunks []chunk
+	// the writer closed its end: EOF once the chunks are read
+	eof bool
+	// the reader closed its end: writes fail
+	closed   bool
+	deadline time.Time
+	// changed is closed, then replaced, on every change of the pipe
+	changed chan struct{}
+}
+
+type chunk struct {
+	data []byte
+	at   time.Time // delivery time
+}
+
+func newPipe() *pipe {
+	return &pipe{changed: make(chan struct{})}
+}
+
+// notify wakes the reader up. Callers must hold p.mux.
+func (p *pipe) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+type conn struct {
+	net    *Network
+	local  simAddr
+	remote simAddr
+	in     *pipe
+	out    *pipe
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	p := c.in
+	for {
+		p.mux.Lock()
+		if p.closed {
+			p.mux.Unlock()
+			return 0, net.ErrClosed
+		}
+		now := c.net.clock.Now()
+		if len(p.chunks) > 0 && !p.chunks[0].at.After(now) {
+			n := copy(b, p.chunks[0].data)
+			if p.chunks[0].data = p.chunks[0].data[n:]; len(p.chunks[0].data) == 0 {
+				p.chunks = p.chunks[1:]
+			}
+			p.mux.Unlock()
+			return n, nil
+		}
+		if len(p.chunks) == 0 && p.eof {
+			p.mux.Unlock()
+			return 0, io.EOF
+		}
+		if !p.deadline.IsZero() && !now.Before(p.deadline) {
+			p.mux.Unlock()
+			return 0, os.ErrDeadlineExceeded
+		}
+		// sleep until the next chunk is due, the deadline or a change
+		var wake time.Time
+		if len(p.chunks) > 0 {
+			wake = p.chunks[0].at
+		}
+		if !p.deadline.IsZero() && (wake.IsZero() || p.deadline.Before(wake)) {
+			wake = p.deadline
+		}
+		changed := p.changed
+		p.mux.Unlock()
+		if wake.IsZero() {
+			<-changed
+			continue
+		}
+		w := c.net.clock.newWaiter(wake.Sub(now), 0)
+		select {
+		case <-changed:
+		case <-w.c:
+		}
+		c.net.clock.stop(w)
+	}
+}
+
+// Write never blocks: the data is queued for delivery, or silently lost
+func (c *conn) Write(b []byte) (int, error) {
+	p := c.out
+	d, ok := c.net.delay(hostOf(c.local), hostOf(c.remote))
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.eof || p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if !ok {
+		return len(b), nil
+	}
+	at := c.net.clock.Now().Add(d)
+	if n := len(p.chunks); n > 0 && p.chunks[n-1].at.After(at) {
+		// a stream stays in order whatever the jitter
+		at = p.chunks[n-1].at
+	}
+	p.chunks = append(p.chunks, chunk{append([]byte(nil), b...), at})
+	p.notify()
+	return len(b), nil
+}
+
+func (c *conn) Close() error {
+	c.in.mux.Lock()
+	c.in.closed = true
+	c.in.notify()
+	c.in.mux.Unlock()
+	c.out.mux.Lock()
+	c.out.eof = true
+	c.out.notify()
+	c.out.mux.Unlock()
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.in.mux.Lock()
+	defer c.in.mux.Unlock()
+	c.in.deadline = t
+	c.in.notify()
+	return nil
+}
+
+// SetWriteDeadline does nothing, writes never block
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func hostOf(addr simAddr) string {
+	host, _, _ := net.SplitHostPort(string(addr))
+	return host
+}
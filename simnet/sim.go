@@ -0,0 +1,202 @@
+package simnet
+
+import (
+	"fmt"
+	"moviecoin/blockchain"
+	"moviecoin/netsync"
+	"moviecoin/p2p"
+	"moviecoin/params"
+	"moviecoin/wallet"
+	"runtime"
+	"time"
+)
+
+// The simulator runs chain nodes in a single process, connected by an
+// in-memory network on a virtual clock. Nodes are the real netsync manager
+// and p2p server on a regtest chain, only their transport and clock are
+// simulated, so tests can run hours of network activity in seconds and
+// inject partitions, latency, losses and malicious peers.
+
+const (
+	P2P_PORT = 6000
+	// STEP is the virtual time the simulator advances at once
+	STEP = 100 * time.Millisecond
+	// the real time given to the nodes to react after each step
+	STEP_PAUSE = 200 * time.Microsecond
+	// MALICIOUS_INTERVAL separates the attacks of malicious nodes
+	MALICIOUS_INTERVAL = 5 * time.Second
+)
+
+// Node is a chain server reduced to its chain, sync manager and p2p server.
+// Mining rewards go to its wallet.
+type Node struct {
+	Host    string
+	Wallet  *wallet.Wallet
+	Chain   *blockchain.Blockchain
+	Manager *netsync.Manager
+	Server  *p2p.Server
+	sim     *Simulator
+	// nil for honest nodes
+	behavior Behavior
+}
+
+type Simulator struct {
+	Clock   *Clock
+	Network *Network
+	Nodes   []*Node
+	params  *params.Network
+	quit    chan struct{}
+}
+
+// New creates an empty simulation, seed makes the network reproducible
+func New(seed int64) *Simulator {
+	clock := NewClock(time.Now())
+	return &Simulator{
+		Clock:   clock,
+		Network: NewNetwork(clock, seed),
+		params:  params.Regtest,
+		quit:    make(chan struct{}),
+	}
+}
+
+// AddNode starts an honest node on the next host, 10.0.0.1 and up
+func (s *Simulator) AddNode() *Node {
+	return s.addNode(nil)
+}
+
+// AddMaliciousNode starts a node which follows the chain like the others
+// but applies behavior to each of its peers every MALICIOUS_INTERVAL
+func (s *Simulator) AddMaliciousNode(behavior Behavior) *Node {
+	n := s.addNode(behavior)
+	go n.attack()
+	return n
+}
+
+func (s *Simulator) addNode(behavior Behavior) *Node {
+	host := fmt.Sprintf("10.0.%d.%d", (len(s.Nodes)+1)/256, (len(s.Nodes)+1)%256)
+	w := wallet.NewWallet(s.params)
+	bc := blockchain.NewBlockchain(w.WalletAddress(), s.params)
+	n := &Node{Host: host, Wallet: w, Chain: bc, Manager: netsync.NewManager(bc), sim: s, behavior: behavior}
+	n.Server = p2p.NewServer(p2p.Config{
+		Network:    s.params,
+		Chain:      bc,
+		Handler:    n.Manager,
+		ListenAddr: n.Addr(),
+		ListenPort: P2P_PORT,
+		Transport:  s.Network.Transport(host),
+		Clock:      s.Clock,
+	})
+	n.Manager.SetServer(n.Server)
+	bc.SetRelay(n.Manager)
+	if err := n.Server.Start(); err != nil {
+		panic(err)
+	}
+	n.Manager.Start()
+	s.Nodes = append(s.Nodes, n)
+	return n
+}
+
+// Connect makes from dial to, and redial it whenever the connection drops
+func (s *Simulator) Connect(from *Node, to *Node) {
+	from.Server.AddAddress(to.Addr(), true)
+}
+
+func (s *Simulator) Stop() {
+	close(s.quit)
+	for _, n := range s.Nodes {
+		n.Manager.Stop()
+		n.Server.Stop()
+	}
+}
+
+// Run lets d of virtual time pass
+func (s *Simulator) Run(d time.Duration) {
+	for end := s.Clock.Now().Add(d); s.Clock.Now().Before(end); {
+		s.step()
+	}
+}
+
+// RunUntil runs until cond holds, for at most max of virtual time, and
+// tells whether cond held
+func (s *Simulator) RunUntil(max time.Duration, cond func() bool) bool {
+	for end := s.Clock.Now().Add(max); !cond(); s.step() {
+		if !s.Clock.Now().Before(end) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Simulator) step() {
+	s.Clock.Advance(STEP)
+	runtime.Gosched()
+	time.Sleep(STEP_PAUSE)
+}
+
+// Honest returns the nodes which are not malicious
+func (s *Simulator) Honest() []*Node {
+	var nodes []*Node
+	for _, n := range s.Nodes {
+		if n.behavior == nil {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// Converged tells whether the honest nodes agree on the chain tip
+func (s *Simulator) Converged() bool {
+	nodes := s.Honest()
+	for _, n := range nodes[1:] {
+		if n.Tip() != nodes[0].Tip() {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *Node) Addr() string {
+	return fmt.Sprintf("%s:%d", n.Host, P2P_PORT)
+}
+
+func (n *Node) Tip() [32]byte {
+	return n.Chain.LastBlock().Hash()
+}
+
+// Mine solves a block on top of the chain of n and announces it
+func (n *Node) Mine() *blockchain.Block {
+	b, _ := n.Chain.NewBlockTemplate(n.Wallet.WalletAddress())
+	for nonce := uint32(0); !blockchain.ValidProof(b.Header(), n.sim.params.Difficulty); nonce++ {
+		b.SetNonces(nonce, 0)
+	}
+	if err := n.Chain.AddBlock(b); err != nil {
+		panic(err)
+	}
+	n.Chain.AnnounceBlock(b)
+	return b
+}
+
+// Pay sends amount from the wallet w to recipient through n
+func (n *Node) Pay(w *wallet.Wallet, recipient string, amount float32) bool {
+	tx := wallet.NewTransaction(w.PrivateKey(), w.PublicKey(), w.WalletAddress(), recipient, amount)
+	return n.Chain.CreateTransaction(w.WalletAddress(), recipient, amount, w.PublicKey(), tx.GenerateSignature())
+}
+
+func (n *Node) Balance(address string) float32 {
+	return n.Chain.CalculateTotalAmount(address)
+}
+
+func (n *Node) attack() {
+	ticker := n.sim.Clock.NewTicker(MALICIOUS_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			for _, p := range n.Server.Peers() {
+				n.behavior(n, p)
+			}
+		case <-n.sim.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package simnet
+
+import (
+	"errors"
+	"io"
+	"moviecoin/params"
+	"moviecoin/wallet"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNetworkDelivery(t *testing.T) {
+	clock := NewClock(time.Now())
+	network := NewNetwork(clock, 1)
+	network.SetLink("10.0.0.1", "10.0.0.2", Link{Latency: time.Second})
+	l, err := network.Transport("10.0.0.2").Listen("0.0.0.0:6000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := network.Transport("10.0.0.2").Listen("10.0.0.2:6000"); !errors.Is(err, ErrAddressInUse) {
+		t.Errorf("listened twice: %v", err)
+	}
+	a, err := network.Transport("10.0.0.1").Dial("10.0.0.2:6000", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := l.Accept()
+	if host, _ := b.RemoteAddr().(simAddr); hostOf(host) != "10.0.0.1" {
+		t.Errorf("remote address %v", b.RemoteAddr())
+	}
+
+	a.Write([]byte("hello"))
+	read := make(chan string)
+	go func() {
+		buf := make([]byte, 16)
+		n, _ := b.Read(buf)
+		read <- string(buf[:n])
+	}()
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case <-read:
+		t.Fatal("message delivered before the latency")
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.Advance(500 * time.Millisecond)
+	if m := <-read; m != "hello" {
+		t.Errorf("read %q", m)
+	}
+
+	b.SetReadDeadline(clock.Now().Add(time.Second))
+	go func() {
+		_, err := b.Read(make([]byte, 16))
+		read <- err.Error()
+	}()
+	clock.Advance(time.Second)
+	if m := <-read; m != os.ErrDeadlineExceeded.Error() {
+		t.Errorf("read after the deadline: %s", m)
+	}
+
+	network.Partition([]string{"10.0.0.1"}, []string{"10.0.0.2"})
+	if _, err := network.Transport("10.0.0.1").Dial("10.0.0.2:6000", time.Second); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("dialed across the partition: %v", err)
+	}
+	a.Write([]byte("lost"))
+	network.Heal()
+	a.Write([]byte("bye"))
+	a.Close()
+	clock.Advance(time.Second)
+	b.SetReadDeadline(time.Time{})
+	if m, _ := io.ReadAll(b); string(m) != "bye" {
+		t.Errorf("read %q after the partition", m)
+	}
+	if network.Dropped() != 1 {
+		t.Errorf("%d messages dropped", network.Dropped())
+	}
+}
+
+// newMesh starts n honest nodes connected to each other
+func newMesh(t *testing.T, seed int64, n int) *Simulator {
+	s := New(seed)
+	t.Cleanup(s.Stop)
+	for i := 0; i < n; i++ {
+		s.AddNode()
+	}
+	for i, a := range s.Nodes {
+		for _, b := range s.Nodes[i+1:] {
+			s.Connect(a, b)
+		}
+	}
+	return s
+}
+
+func runUntilConverged(t *testing.T, s *Simulator, max time.Duration) {
+	t.Helper()
+	if !s.RunUntil(max, s.Converged) {
+		for _, n := range s.Honest() {
+			t.Logf("%s: height %d tip %x", n.Host, n.Chain.Height(), n.Tip())
+		}
+		t.Fatal("nodes did not converge")
+	}
+}
+
+func TestConvergence(t *testing.T) {
+	s := newMesh(t, 1, 5)
+	s.Run(time.Minute)
+	for i := 0; i < 10; i++ {
+		s.Nodes[i%len(s.Nodes)].Mine()
+		s.Run(5 * time.Second)
+	}
+	runUntilConverged(t, s, 5*time.Minute)
+	for _, n := range s.Nodes {
+		if n.Chain.Height() != 10 {
+			t.Errorf("%s: height %d", n.Host, n.Chain.Height())
+		}
+		for _, miner := range s.Nodes {
+			if b := n.Balance(miner.Wallet.WalletAddress()); b != 2*s.params.Reward {
+				t.Errorf("%s: balance of %s is %v", n.Host, miner.Host, b)
+			}
+		}
+	}
+}
+
+func TestPartitionHeals(t *testing.T) {
+	s := newMesh(t, 2, 4)
+	s.Run(time.Minute)
+	a, b := s.Nodes[:2], s.Nodes[2:]
+	s.Network.Partition([]string{a[0].Host, a[1].Host}, []string{b[0].Host, b[1].Host})
+	for i := 0; i < 2; i++ {
+		a[0].Mine()
+		s.Run(5 * time.Second)
+	}
+	for i := 0; i < 3; i++ {
+		b[1].Mine()
+		s.Run(5 * time.Second)
+	}
+	s.Run(time.Minute)
+	if a[1].Tip() != a[0].Tip() || b[0].Tip() != b[1].Tip() || a[0].Tip() == b[0].Tip() {
+		t.Fatal("the partition did not split the chain")
+	}
+
+	s.Network.Heal()
+	runUntilConverged(t, s, 10*time.Minute)
+	if h := a[0].Chain.Height(); h != 3 {
+		t.Errorf("converged on height %d, not the longest chain", h)
+	}
+	if amount := a[1].Balance(a[0].Wallet.WalletAddress()); amount != 0 {
+		t.Errorf("rewards of the abandoned fork still counted: %v", amount)
+	}
+}
+
+func TestLatencyAndLoss(t *testing.T) {
+	s := New(3)
+	t.Cleanup(s.Stop)
+	s.Network.SetDefaultLink(Link{Latency: 200 * time.Millisecond, Jitter: 300 * time.Millisecond, Loss: 0.05})
+	// a line: blocks have to cross every node
+	for i := 0; i < 5; i++ {
+		s.AddNode()
+		if i > 0 {
+			s.Connect(s.Nodes[i], s.Nodes[i-1])
+		}
+	}
+	s.Run(2 * time.Minute)
+	for i := 0; i < 8; i++ {
+		s.Nodes[(i*3)%len(s.Nodes)].Mine()
+		s.Run(10 * time.Second)
+	}
+	runUntilConverged(t, s, 30*time.Minute)
+	if s.Network.Dropped() == 0 {
+		t.Error("no message lost")
+	}
+}
+
+func TestTransactionsSettle(t *testing.T) {
+	s := newMesh(t, 4, 3)
+	s.Run(time.Minute)
+	payer, relay, miner := s.Nodes[0], s.Nodes[1], s.Nodes[2]
+	payer.Mine()
+	runUntilConverged(t, s, 5*time.Minute)
+
+	// the payer sends its coins through another node
+	recipient := wallet.NewWallet(params.Regtest).WalletAddress()
+	if !relay.Pay(payer.Wallet, recipient, 0.5) {
+		t.Fatal("payment rejected")
+	}
+	if !s.RunUntil(time.Minute, func() bool { return len(miner.Chain.TransactionPool()) == 1 }) {
+		t.Fatal("transaction not relayed to the miner")
+	}
+	miner.Mine()
+	runUntilConverged(t, s, 5*time.Minute)
+	for _, n := range s.Nodes {
+		if amount := n.Balance(recipient); amount != 0.5 {
+			t.Errorf("%s: recipient balance %v", n.Host, amount)
+		}
+		if len(n.Chain.TransactionPool()) != 0 {
+			t.Errorf("%s: transaction still in the pool", n.Host)
+		}
+	}
+}
+
+func TestMaliciousPeersBanned(t *testing.T) {
+	behaviors := map[string]Behavior{
+		"invalid blocks":      InvalidBlocks,
+		"unsolicited headers": UnsolicitedHeaders,
+		"forged rewards":      ForgedRewards,
+	}
+	for name, behavior := range behaviors {
+		t.Run(name, func(t *testing.T) {
+			s := newMesh(t, 5, 3)
+			evil := s.AddMaliciousNode(behavior)
+			for _, n := range s.Honest() {
+				s.Connect(evil, n)
+			}
+			s.Run(time.Minute)
+			for i := 0; i < 3; i++ {
+				s.Nodes[i].Mine()
+				s.Run(10 * time.Second)
+			}
+			banned := func() bool {
+				for _, n := range s.Honest() {
+					if !n.Server.Banned(evil.Host) {
+						return false
+					}
+				}
+				return true
+			}
+			if !s.RunUntil(10*time.Minute, banned) {
+				t.Fatal("malicious node not banned")
+			}
+			runUntilConverged(t, s, 5*time.Minute)
+			if h := s.Nodes[0].Chain.Height(); h != 3 {
+				t.Errorf("height %d", h)
+			}
+		})
+	}
+}
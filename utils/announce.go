@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"moviecoin/security"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Announcements older or further in the future than
+	// MAX_ANNOUNCEMENT_SKEW are dropped, which bounds replays
+	MAX_ANNOUNCEMENT_SKEW = 2 * time.Minute
+	// A source host may send ANNOUNCEMENT_BURST datagrams at once (several
+	// nodes may share a host), then one per ANNOUNCEMENT_MIN_INTERVAL. The
+	// datagrams over the limit are dropped before checking any signature.
+	ANNOUNCEMENT_BURST        = 4
+	ANNOUNCEMENT_MIN_INTERVAL = 5 * time.Second
+	// Number of sources and nodes tracked by the filter
+	MAX_ANNOUNCEMENT_SOURCES = 1024
+)
+
+var (
+	ErrAnnouncementMalformed   = errors.New("malformed announcement")
+	ErrAnnouncementSignature   = errors.New("invalid announcement signature")
+	ErrAnnouncementWrongChain  = errors.New("announcement for another chain")
+	ErrAnnouncementStale       = errors.New("stale announcement")
+	ErrAnnouncementReplayed    = errors.New("replayed announcement")
+	ErrAnnouncementRateLimited = errors.New("announcement rate limited")
+	ErrAnnouncementSelf        = errors.New("own announcement")
+	ErrAnnouncementAddress     = errors.New("announced address is not the source address")
+)
+
+// Announcement is the multicast datagram a node sends to make itself known
+// on the LAN, signed with its node key
+type Announcement struct {
+	NodeID    string `json:"node_id"`
+	ChainID   uint32 `json:"chain_id"`
+	Address   string `json:"address"`   // host:port of the chain server
+	Timestamp int64  `json:"timestamp"` // unix nanoseconds
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// NewAnnouncement builds the signed announcement of the node owning key,
+// reachable at address
+func NewAnnouncement(key *security.NodeKey, chainID uint32, address string, now time.Time) (*Announcement, error) {
+	a := &Announcement{
+		NodeID:    key.ID(),
+		ChainID:   chainID,
+		Address:   address,
+		Timestamp: now.UnixNano(),
+		PublicKey: key.PublicKeyHex(),
+	}
+	sig, err := key.Sign(a.signedBytes())
+	if err != nil {
+		return nil, err
+	}
+	a.Signature = hex.EncodeToString(sig)
+	return a, nil
+}
+
+// signedBytes is the announcement without its signature
+func (a *Announcement) signedBytes() []byte {
+	unsigned := *a
+	unsigned.Signature = ""
+	m, _ := json.Marshal(&unsigned)
+	return m
+}
+
+// Verify checks that the announcement is well formed and signed by the key
+// of the node it names
+func (a *Announcement) Verify() error {
+	host, port, err := net.SplitHostPort(a.Address)
+	if err != nil || net.ParseIP(host) == nil {
+		return fmt.Errorf("%w: address %q", ErrAnnouncementMalformed, a.Address)
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return fmt.Errorf("%w: address %q", ErrAnnouncementMalformed, a.Address)
+	}
+	publicKey, err := security.PublicKeyFromHex(a.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAnnouncementMalformed, err)
+	}
+	if security.NodeID(publicKey) != a.NodeID {
+		return fmt.Errorf("%w: node ID does not match the key", ErrAnnouncementSignature)
+	}
+	sig, err := hex.DecodeString(a.Signature)
+	if err != nil || !security.VerifySignature(publicKey, a.signedBytes(), sig) {
+		return ErrAnnouncementSignature
+	}
+	return nil
+}
+
+// Encode formats the datagram: the live node header followed by the JSON
+// announcement
+func (a *Announcement) Encode() []byte {
+	m, _ := json.Marshal(a)
+	return append([]byte(liveNodeHeader+"|"), m...)
+}
+
+func DecodeAnnouncement(b []byte) (*Announcement, error) {
+	body := bytes.TrimPrefix(b, []byte(liveNodeHeader+"|"))
+	if len(body) == len(b) {
+		return nil, fmt.Errorf("%w: unknown header", ErrAnnouncementMalformed)
+	}
+	var a Announcement
+	if err := json.Unmarshal(body, &a); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAnnouncementMalformed, err)
+	}
+	return &a, nil
+}
+
+// AnnouncementFilter validates the announcements received: they must be
+// signed, for our chain, recent, newer than the last one of the same node,
+// sent from the address they announce and not too often by the same host
+type AnnouncementFilter struct {
+	chainID uint32
+	self    string
+
+	mux     sync.Mutex
+	sources map[string]*sourceLimit
+	nodes   map[string]int64 // last timestamp per node ID
+}
+
+// sourceLimit is the token bucket of a source host
+type sourceLimit struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewAnnouncementFilter filters the announcements of chainID, the ones of
+// the node self (our own, looped back) are dropped
+func NewAnnouncementFilter(chainID uint32, self string) *AnnouncementFilter {
+	return &AnnouncementFilter{
+		chainID: chainID,
+		self:    self,
+		sources: make(map[string]*sourceLimit),
+		nodes:   make(map[string]int64),
+	}
+}
+
+// Accept decodes and validates the datagram b received from the host src.
+// Nodes may only announce the address they send from.
+func (f *AnnouncementFilter) Accept(src string, b []byte, now time.Time) (*Announcement, error) {
+	if !f.allow(src, now) {
+		return nil, ErrAnnouncementRateLimited
+	}
+	a, err := DecodeAnnouncement(b)
+	if err != nil {
+		return nil, err
+	}
+	if a.ChainID != f.chainID {
+		return nil, ErrAnnouncementWrongChain
+	}
+	if a.NodeID == f.self {
+		return nil, ErrAnnouncementSelf
+	}
+	skew := now.Sub(time.Unix(0, a.Timestamp))
+	if skew > MAX_ANNOUNCEMENT_SKEW || skew < -MAX_ANNOUNCEMENT_SKEW {
+		return nil, ErrAnnouncementStale
+	}
+	if err := a.Verify(); err != nil {
+		return nil, err
+	}
+	if host, _, _ := net.SplitHostPort(a.Address); !net.ParseIP(host).Equal(net.ParseIP(src)) {
+		return nil, fmt.Errorf("%w: %s from %s", ErrAnnouncementAddress, a.Address, src)
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if last, ok := f.nodes[a.NodeID]; ok && a.Timestamp <= last {
+		return nil, ErrAnnouncementReplayed
+	}
+	if len(f.nodes) >= MAX_ANNOUNCEMENT_SOURCES {
+		if f.expire(now); len(f.nodes) >= MAX_ANNOUNCEMENT_SOURCES {
+			return nil, ErrAnnouncementRateLimited
+		}
+	}
+	f.nodes[a.NodeID] = a.Timestamp
+	return a, nil
+}
+
+// allow applies the rate limit of the source host
+func (f *AnnouncementFilter) allow(src string, now time.Time) bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	l, ok := f.sources[src]
+	if !ok {
+		if len(f.sources) >= MAX_ANNOUNCEMENT_SOURCES {
+			if f.expire(now); len(f.sources) >= MAX_ANNOUNCEMENT_SOURCES {
+				return false
+			}
+		}
+		l = &sourceLimit{tokens: ANNOUNCEMENT_BURST, updated: now}
+		f.sources[src] = l
+	}
+	l.tokens += float64(now.Sub(l.updated)) / float64(ANNOUNCEMENT_MIN_INTERVAL)
+	if l.tokens > ANNOUNCEMENT_BURST {
+		l.tokens = ANNOUNCEMENT_BURST
+	}
+	l.updated = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// expire forgets the sources and nodes which cannot affect the filtering
+// anymore. Callers must hold f.mux.
+func (f *AnnouncementFilter) expire(now time.Time) {
+	for src, l := range f.sources {
+		// a full bucket is the same as no bucket
+		if now.Sub(l.updated) >= ANNOUNCEMENT_BURST*ANNOUNCEMENT_MIN_INTERVAL {
+			delete(f.sources, src)
+		}
+	}
+	for id, last := range f.nodes {
+		// stale timestamps are rejected anyway
+		if now.Sub(time.Unix(0, last)) > MAX_ANNOUNCEMENT_SKEW {
+			delete(f.nodes, id)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"errors"
+	"moviecoin/security"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestAnnouncement(t *testing.T, key *security.NodeKey, chainID uint32, now time.Time) []byte {
+	a, err := NewAnnouncement(key, chainID, "10.0.0.2:5000", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.Encode()
+}
+
+func TestAnnouncementValidation(t *testing.T) {
+	self, _ := security.NewNodeKey()
+	key, _ := security.NewNodeKey()
+	now := time.Now()
+	f := NewAnnouncementFilter(2, self.ID())
+
+	a, err := f.Accept("10.0.0.2", newTestAnnouncement(t, key, 2, now), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.NodeID != key.ID() || a.Address != "10.0.0.2:5000" {
+		t.Errorf("accepted %+v", a)
+	}
+
+	forged, _ := DecodeAnnouncement(newTestAnnouncement(t, key, 2, now.Add(time.Second)))
+	forged.Address = "10.0.0.66:5000"
+	impostor, _ := security.NewNodeKey()
+	stolen, _ := DecodeAnnouncement(newTestAnnouncement(t, impostor, 2, now.Add(time.Second)))
+	stolen.NodeID = key.ID()
+	elsewhere, _ := NewAnnouncement(key, 2, "10.0.0.66:5000", now.Add(time.Second))
+	cases := map[string]struct {
+		datagram []byte
+		err      error
+	}{
+		"legacy":      {[]byte("<LIVE NODE>|10.0.0.66:5000"), ErrAnnouncementMalformed},
+		"wrong chain": {newTestAnnouncement(t, key, 1, now), ErrAnnouncementWrongChain},
+		"own":         {newTestAnnouncement(t, self, 2, now), ErrAnnouncementSelf},
+		"stale":       {newTestAnnouncement(t, key, 2, now.Add(-time.Hour)), ErrAnnouncementStale},
+		"replayed":    {newTestAnnouncement(t, key, 2, now), ErrAnnouncementReplayed},
+		"tampered":    {forged.Encode(), ErrAnnouncementSignature},
+		"stolen ID":   {stolen.Encode(), ErrAnnouncementSignature},
+		"elsewhere":   {elsewhere.Encode(), ErrAnnouncementAddress},
+	}
+	for name, c := range cases {
+		// a fresh filter for each case, which accepted the first announcement,
+		// the rate limit is tested below
+		f := NewAnnouncementFilter(2, self.ID())
+		f.nodes[key.ID()] = now.UnixNano()
+		if _, err := f.Accept("10.0.0.2", c.datagram, now); !errors.Is(err, c.err) {
+			t.Errorf("%s: %v, expected %v", name, err, c.err)
+		}
+	}
+}
+
+func TestAnnouncementRateLimit(t *testing.T) {
+	f := NewAnnouncementFilter(2, "")
+	now := time.Now()
+	accepted := 0
+	for i := 0; i < 2*ANNOUNCEMENT_BURST; i++ {
+		key, _ := security.NewNodeKey()
+		if _, err := f.Accept("10.0.0.2", newTestAnnouncement(t, key, 2, now), now); err == nil {
+			accepted++
+		} else if !errors.Is(err, ErrAnnouncementRateLimited) {
+			t.Fatal(err)
+		}
+	}
+	if accepted != ANNOUNCEMENT_BURST {
+		t.Errorf("%d announcements accepted at once", accepted)
+	}
+	key, _ := security.NewNodeKey()
+	later := now.Add(ANNOUNCEMENT_MIN_INTERVAL)
+	if _, err := f.Accept("10.0.0.2", newTestAnnouncement(t, key, 2, later), later); err != nil {
+		t.Errorf("announcement refused after the interval: %v", err)
+	}
+	other, _ := security.NewNodeKey()
+	a, _ := NewAnnouncement(other, 2, "10.0.0.3:5000", now)
+	if _, err := f.Accept("10.0.0.3", a.Encode(), now); err != nil {
+		t.Errorf("other host refused: %v", err)
+	}
+}
+
+func TestDiscoveryFound(t *testing.T) {
+	self, _ := security.NewNodeKey()
+	key, _ := security.NewNodeKey()
+	d := NewDiscovery("239.0.0.1:9999", "", self, 2)
+	var found []string
+	d.found = func(a *Announcement) { found = append(found, a.Address) }
+	src := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 9999}
+	for _, datagram := range [][]byte{
+		newTestAnnouncement(t, key, 2, time.Now()),
+		newTestAnnouncement(t, key, 1, time.Now()),
+		newTestAnnouncement(t, self, 2, time.Now()),
+	} {
+		d.handle(src, len(datagram), datagram)
+	}
+	if len(found) != 1 || found[0] != "10.0.0.2:5000" {
+		t.Errorf("found %v", found)
+	}
+}
@@ -1,121 +1,79 @@
 package utils
 
 import (
-	"fmt"
+	"errors"
 	"log"
 	"moviecoin/comm"
+	"moviecoin/security"
 	"net"
-	"os"
-	"regexp"
-	"strings"
-	"sync"
+	"strconv"
 	"time"
 )
 
-func IsFoundHost(host string) bool {
-	_, err := net.DialTimeout("tcp", host, 1*time.Second)
-	if err != nil {
-		fmt.Printf("%s %v\n", host, err)
-		return false
-	}
-	return true
-}
-
-var PATTERN = regexp.MustCompile(`((25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?\.){3})(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)`)
-
-const (
-	defaultMulticastAddress = "239.0.0.0:9999"
-	liveNodeHeader          = "<LIVE NODE>"
-)
-
-type NeighborCache struct {
-	mux   sync.Mutex
-	cache map[string]bool
+const liveNodeHeader = "<LIVE NODE>"
+
+// Discovery announces the node on the LAN over multicast and hands the
+// announcements of the other nodes to found
+type Discovery struct {
+	multicastAddress string
+	iface            string
+	key              *security.NodeKey
+	chainID          uint32
+	filter           *AnnouncementFilter
+	found            func(a *Announcement)
 }
 
-var neighborCache *NeighborCache = &NeighborCache{cache: make(map[string]bool, 0)}
-
-func (n *NeighborCache) Update(address string) {
-	n.mux.Lock()
-	defer n.mux.Unlock()
-	_, ok := n.cache[address]
-	if !ok {
-		n.cache[address] = true
+// NewDiscovery uses the multicast group at multicastAddress (IPv4 or IPv6)
+// on the interface iface, the system default one when empty
+func NewDiscovery(multicastAddress string, iface string, key *security.NodeKey, chainID uint32) *Discovery {
+	return &Discovery{
+		multicastAddress: multicastAddress,
+		iface:            iface,
+		key:              key,
+		chainID:          chainID,
+		filter:           NewAnnouncementFilter(chainID, key.ID()),
 	}
 }
 
-func (n *NeighborCache) Reset() {
-	n.mux.Lock()
-	defer n.mux.Unlock()
-	n.cache = make(map[string]bool)
-}
-
-func MulticastHandler(src *net.UDPAddr, n int, b []byte) {
-	msg := string(b[:n])
-	log.Printf("Multicast message received: %s - %s [%d bytes]", src, msg, n)
-	tokens := strings.Split(msg, "|")
-	if tokens[0] == liveNodeHeader {
-		// @TODO: check for ip address correctness
-		neighborCache.Update(tokens[1])
+func (d *Discovery) handle(src *net.UDPAddr, n int, b []byte) {
+	a, err := d.filter.Accept(src.IP.String(), b[:n], time.Now())
+	switch {
+	case errors.Is(err, ErrAnnouncementSelf), errors.Is(err, ErrAnnouncementReplayed),
+		errors.Is(err, ErrAnnouncementRateLimited):
+		return
+	case err != nil:
+		log.Printf("WARN: multicast announcement from %s dropped: %v", src, err)
+		return
 	}
-	//log.Println(hex.Dump(b[:n]))
-}
-
-func RunListener() {
-	comm.MulticastListen(defaultMulticastAddress, MulticastHandler)
+	log.Printf("Node %s announced at %s", a.NodeID, a.Address)
+	d.found(a)
 }
 
-func ListenNeighbors() {
-	go RunListener()
+// Listen receives the announcements in the background and calls found with
+// the valid ones
+func (d *Discovery) Listen(found func(a *Announcement)) {
+	d.found = found
+	go comm.MulticastListen(d.multicastAddress, d.iface, d.handle)
 }
 
-func (n *NeighborCache) GetNeighborsFromCache() []string {
-	n.mux.Lock()
-	defer n.mux.Unlock()
-
-	neighbors := make([]string, 0)
-	for key := range n.cache {
-		neighbors = append(neighbors, key)
-	}
-	return neighbors
-}
-
-func NotifyNeighbors(myHost string, myPort uint16) {
-	address := fmt.Sprintf("%s:%d", myHost, myPort)
-	conn, err := comm.NewMulticast(defaultMulticastAddress)
+// Notify announces that the node is reachable on port at the address the
+// datagram leaves from, the only one the other nodes accept
+func (d *Discovery) Notify(port uint16) {
+	conn, err := comm.NewMulticast(d.multicastAddress, d.iface)
 	if err != nil {
-		log.Fatal(err)
-	}
-	message := fmt.Sprintf("%s|%s", liveNodeHeader, address)
-	// Multicast presence 3 times
-	for i := 0; i < 3; i++ {
-		log.Printf(" -> Notify neighbors about my presence: %s", address)
-		conn.Write([]byte(message))
+		log.Printf("ERROR: multicast: %v", err)
+		return
 	}
-	conn.Close()
-}
-
-func FindNeighbors() []string {
-	neighborsFromcCache := neighborCache.GetNeighborsFromCache()
-	neighbors := make([]string, 0)
-	if len(neighbors) > 0 {
-		for _, addr := range neighborsFromcCache {
-			if IsFoundHost(addr) {
-				neighbors = append(neighbors, addr)
-			}
-		}
-	}
-	return neighbors
-}
-
-func GetHost() string {
-	hostname, err := os.Hostname()
+	defer conn.Close()
+	host := conn.LocalAddr().(*net.UDPAddr).IP.String()
+	address := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	a, err := NewAnnouncement(d.key, d.chainID, address, time.Now())
 	if err != nil {
-		return "127.0.0.1"
+		log.Printf("ERROR: announcement: %v", err)
+		return
 	}
-	address, err := net.LookupHost(hostname)
-	if err != nil {
-		return "127.0.0.1"
+	log.Printf(" -> Notify neighbors about my presence: %s", address)
+	if _, err := conn.Write(a.Encode()); err != nil {
+		log.Printf("WARN: multicast: %v", err)
 	}
-	return address[0]
 }
@@ -0,0 +1,86 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"moviecoin/params"
+	"moviecoin/security"
+	"os"
+	"path/filepath"
+)
+
+// keyFile is the on-disk representation of a wallet. The private key is
+// AES-256 GCM encrypted with a key derived from a passphrase, see the
+// security package.
+type keyFile struct {
+	Network      string `json:"network"`
+	Address      string `json:"wallet_address"`
+	PublicKey    string `json:"public_key"`
+	EncryptedKey string `json:"encrypted_private_key"`
+}
+
+// Save writes the wallet to path with its private key encrypted by passphrase
+func (w *Wallet) Save(path string, passphrase string, network *params.Network) error {
+	if passphrase == "" {
+		return errors.New("refusing to save a private key without a passphrase")
+	}
+	encrypted, err := security.EncryptString(w.PrivateKeyStr(), passphrase)
+	if err != nil {
+		return err
+	}
+	m, _ := json.MarshalIndent(&keyFile{
+		Network:      network.Name,
+		Address:      w.WalletAddress(),
+		PublicKey:    w.PublicKeyStr(),
+		EncryptedKey: encrypted,
+	}, "", "  ")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, m, 0600)
+}
+
+// Load reads a wallet saved by Save and decrypts its private key
+func Load(path string, passphrase string, network *params.Network) (*Wallet, error) {
+	m, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kf keyFile
+	if err := json.Unmarshal(m, &kf); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if kf.Network != network.Name {
+		return nil, fmt.Errorf("%s: wallet belongs to %s, not %s", path, kf.Network, network.Name)
+	}
+	privateKey, err := security.DecryptString(kf.EncryptedKey, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: wrong passphrase or corrupted key", path)
+	}
+	w, err := WalletFromPrivateKey(privateKey, network)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if w.WalletAddress() != kf.Address {
+		return nil, fmt.Errorf("%s: key does not match address %s", path, kf.Address)
+	}
+	return w, nil
+}
+
+// ReadAddress returns the address of the wallet saved at path without
+// decrypting its private key
+func ReadAddress(path string, network *params.Network) (string, error) {
+	m, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var kf keyFile
+	if err := json.Unmarshal(m, &kf); err != nil {
+		return "", fmt.Errorf("%s: %v", path, err)
+	}
+	if kf.Network != network.Name {
+		return "", fmt.Errorf("%s: wallet belongs to %s, not %s", path, kf.Network, network.Name)
+	}
+	return kf.Address, nil
+}
@@ -1,12 +1,17 @@
 package wallet
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"moviecoin/params"
 	"moviecoin/utils"
 
 	"github.com/btcsuite/btcd/btcutil/base58"
@@ -19,16 +24,42 @@ type Wallet struct {
 	walletAddress string
 }
 
-func NewWallet() *Wallet {
+func NewWallet(network *params.Network) *Wallet {
 	// 1. Creating ECDSA private key (32 bytes) public key (64 bytes)
-	w := new(Wallet)
 	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return walletFromKey(privateKey, network)
+}
+
+// WalletFromPrivateKey rebuilds the wallet owning the hex encoded private key
+func WalletFromPrivateKey(privateKeyStr string, network *params.Network) (*Wallet, error) {
+	d, err := hex.DecodeString(privateKeyStr)
+	if err != nil || len(d) == 0 || len(d) > 32 {
+		return nil, errors.New("invalid private key")
+	}
+	privateKey := new(ecdsa.PrivateKey)
+	privateKey.Curve = elliptic.P256()
+	privateKey.D = new(big.Int).SetBytes(d)
+	if privateKey.D.Sign() == 0 || privateKey.D.Cmp(privateKey.Curve.Params().N) >= 0 {
+		return nil, errors.New("invalid private key")
+	}
+	privateKey.X, privateKey.Y = privateKey.Curve.ScalarBaseMult(privateKey.D.Bytes())
+	return walletFromKey(privateKey, network), nil
+}
+
+func walletFromKey(privateKey *ecdsa.PrivateKey, network *params.Network) *Wallet {
+	w := new(Wallet)
 	w.privateKey = privateKey
 	w.publicKey = &w.privateKey.PublicKey
+	w.walletAddress = Address(w.publicKey, network)
+	return w
+}
+
+// Address derives the wallet address of a public key on the given network
+func Address(publicKey *ecdsa.PublicKey, network *params.Network) string {
 	// 2. Perform SHA-256 hashing on the public key (32 bytes).
 	h2 := sha256.New()
-	h2.Write(w.publicKey.X.Bytes())
-	h2.Write(w.publicKey.Y.Bytes())
+	h2.Write(publicKey.X.Bytes())
+	h2.Write(publicKey.Y.Bytes())
 	digest2 := h2.Sum(nil)
 	// 3. Perform RIPEMD-160 hashing on the result of SHA-256 (20 bytes).
 	h3 := ripemd160.New()
@@ -36,26 +67,41 @@ func NewWallet() *Wallet {
 	digest3 := h3.Sum(nil)
 	// 4. Add version byte in front of RIPEMD-160 hash (0x00 for Main Network).
 	vd4 := make([]byte, 21)
-	vd4[0] = 0x00
+	vd4[0] = network.AddressVersion
 	copy(vd4[1:], digest3[:])
-	// 5. Perform SHA-256 hash on the extended RIPEMD-160 result.
-	h5 := sha256.New()
-	h5.Write(vd4)
-	digest5 := h5.Sum(nil)
-	// 6. Perform SHA-256 hash on the result of the previous SHA-256 hash.
-	h6 := sha256.New()
-	h6.Write(digest5)
-	digest6 := h6.Sum(nil)
-	// 7. Take the first 4 bytes of the second SHA-256 hash for checksum.
-	chsum := digest6[:4]
+	// 5-7. Double SHA-256 of the extended RIPEMD-160 result, first 4 bytes are the checksum.
+	chsum := checksum(vd4)
 	// 8. Add the 4 checksum bytes from 7 at the end of extended RIPEMD-160 hash from 4 (25 bytes).
 	dc8 := make([]byte, 25)
 	copy(dc8[:21], vd4[:])
 	copy(dc8[21:], chsum[:])
 	// 9. Convert the result from a byte string into base58.
-	address := base58.Encode(dc8)
-	w.walletAddress = address
-	return w
+	return base58.Encode(dc8)
+}
+
+func checksum(payload []byte) []byte {
+	// 5. Perform SHA-256 hash on the extended RIPEMD-160 result.
+	digest5 := sha256.Sum256(payload)
+	// 6. Perform SHA-256 hash on the result of the previous SHA-256 hash.
+	digest6 := sha256.Sum256(digest5[:])
+	// 7. Take the first 4 bytes of the second SHA-256 hash for checksum.
+	return digest6[:4]
+}
+
+// ValidateAddress checks the length, version byte and checksum of a wallet
+// address for the given network
+func ValidateAddress(address string, network *params.Network) error {
+	decoded := base58.Decode(address)
+	if len(decoded) != 25 {
+		return fmt.Errorf("invalid address %q: bad length", address)
+	}
+	if decoded[0] != network.AddressVersion {
+		return fmt.Errorf("invalid address %q: not a %s address", address, network.Name)
+	}
+	if !bytes.Equal(checksum(decoded[:21]), decoded[21:]) {
+		return fmt.Errorf("invalid address %q: bad checksum", address)
+	}
+	return nil
 }
 
 func (w *Wallet) PrivateKey() *ecdsa.PrivateKey {
@@ -110,10 +156,12 @@ func (t *Transaction) GenerateSignature() *utils.Signature {
 	return &utils.Signature{R: r, S: s}
 }
 
+// MarshalJSON must produce the same document as blockchain.Transaction, the
+// node verifies signatures against it
 func (t *Transaction) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Sender   string  `json:"sender_address"`
-		Receiver string  `json:"receiver_address"`
+		Receiver string  `json:"recipient_address"`
 		Amount   float32 `json:"amount"`
 	}{
 		Sender:   t.senderAddress,
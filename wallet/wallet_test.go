@@ -0,0 +1,94 @@
+package wallet
+
+import (
+	"encoding/json"
+	"moviecoin/blockchain"
+	"moviecoin/params"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateAddress(t *testing.T) {
+	w := NewWallet(params.Mainnet)
+	if err := ValidateAddress(w.WalletAddress(), params.Mainnet); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateAddress(w.WalletAddress(), params.Testnet); err == nil {
+		t.Error("a mainnet address must not validate on testnet")
+	}
+	tampered := []byte(w.WalletAddress())
+	if tampered[5] == 'a' {
+		tampered[5] = 'b'
+	} else {
+		tampered[5] = 'a'
+	}
+	if err := ValidateAddress(string(tampered), params.Mainnet); err == nil {
+		t.Error("an address with a bad checksum must not validate")
+	}
+	if err := ValidateAddress("MOVIECOIN BLOCKCHAIN", params.Mainnet); err == nil {
+		t.Error("free text must not validate")
+	}
+}
+
+func TestWalletFromPrivateKey(t *testing.T) {
+	w := NewWallet(params.Regtest)
+	restored, err := WalletFromPrivateKey(w.PrivateKeyStr(), params.Regtest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.WalletAddress() != w.WalletAddress() || restored.PublicKeyStr() != w.PublicKeyStr() {
+		t.Fatal("restored wallet differs from the original")
+	}
+	if _, err := WalletFromPrivateKey("not hex", params.Regtest); err == nil {
+		t.Error("invalid private key accepted")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "regtest", "miner.key")
+	w := NewWallet(params.Regtest)
+	if err := w.Save(path, "", params.Regtest); err == nil {
+		t.Fatal("a wallet must not be saved without a passphrase")
+	}
+	if err := w.Save(path, "correct horse", params.Regtest); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path, "correct horse", params.Regtest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.WalletAddress() != w.WalletAddress() {
+		t.Fatal("loaded wallet differs from the saved one")
+	}
+	if address, err := ReadAddress(path, params.Regtest); err != nil || address != w.WalletAddress() {
+		t.Errorf("address %q: %v", address, err)
+	}
+	if _, err := Load(path, "battery staple", params.Regtest); err == nil {
+		t.Error("wrong passphrase accepted")
+	}
+	if _, err := Load(path, "correct horse", params.Mainnet); err == nil {
+		t.Error("regtest wallet loaded on mainnet")
+	}
+}
+
+// TestSignatureVerifiesOnChain guards the encoding of Transaction: the node
+// verifies the signatures of the wallets against blockchain.Transaction
+func TestSignatureVerifiesOnChain(t *testing.T) {
+	w := NewWallet(params.Regtest)
+	recipient := NewWallet(params.Regtest).WalletAddress()
+	tx := NewTransaction(w.PrivateKey(), w.PublicKey(), w.WalletAddress(), recipient, 1.5)
+	ours, _ := json.Marshal(tx)
+	theirs, _ := json.Marshal(blockchain.NewTransaction(w.WalletAddress(), recipient, 1.5))
+	if string(ours) != string(theirs) {
+		t.Fatalf("wallet signs %s, the chain verifies %s", ours, theirs)
+	}
+
+	bc := blockchain.NewBlockchain("miner", params.Regtest)
+	signature := tx.GenerateSignature()
+	if !bc.VerifyTransactionSignature(w.PublicKey(), signature, blockchain.NewTransaction(w.WalletAddress(), recipient, 1.5)) {
+		t.Error("signature of the wallet rejected by the chain")
+	}
+	if bc.VerifyTransactionSignature(w.PublicKey(), signature, blockchain.NewTransaction(w.WalletAddress(), recipient, 15)) {
+		t.Error("signature accepted for another amount")
+	}
+}
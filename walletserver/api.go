@@ -0,0 +1,112 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"moviecoin/api"
+	"moviecoin/blockchain"
+	"moviecoin/wallet"
+	"net/http"
+)
+
+// openAPIDocument describes the routes of APIRouter, server_test checks it
+// against them
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// APIRouter serves the versioned JSON API under /api/v1. Balances and
+// transactions are forwarded to the blockchain node.
+func (ws *WalletServer) APIRouter() *api.Router {
+	r := api.NewRouter(api.PREFIX)
+	r.Handle(http.MethodGet, "/openapi.json", "OpenAPI document of the API", api.ServeDocument(openAPIDocument))
+	r.Handle(http.MethodPost, "/wallets", "Create a wallet", ws.apiCreateWallet)
+	r.Handle(http.MethodGet, "/wallets/{address}/balance", "Balance of a wallet", ws.apiBalance)
+	r.Handle(http.MethodPost, "/transactions", "Sign a transaction and submit it to the node", ws.apiCreateTransaction)
+	return r
+}
+
+// TransactionRequest is the body of POST /transactions. Unlike the legacy
+// wallet.TransactionRequest the amount is a number and the public key is
+// derived from the private key.
+type TransactionRequest struct {
+	SenderPrivateKey *string  `json:"sender_private_key"`
+	SenderAddress    *string  `json:"sender_address"`
+	ReceiverAddress  *string  `json:"receiver_address"`
+	Amount           *float32 `json:"amount"`
+}
+
+// nodeError passes the errors of the requests forwarded to the node through
+// to the client, failures of the node become a bad gateway
+func nodeError(err error) error {
+	var e *api.Error
+	if errors.As(err, &e) && e.Status < http.StatusInternalServerError {
+		return e
+	}
+	return api.BadGateway(err)
+}
+
+func (ws *WalletServer) apiCreateWallet(w http.ResponseWriter, req *http.Request) error {
+	api.WriteJSON(w, http.StatusCreated, wallet.NewWallet(ws.network))
+	return nil
+}
+
+func (ws *WalletServer) apiBalance(w http.ResponseWriter, req *http.Request) error {
+	address := api.Param(req, "address")
+	if err := wallet.ValidateAddress(address, ws.network); err != nil {
+		return api.BadRequest(err.Error())
+	}
+	balance, err := ws.node.Balance(req.Context(), address)
+	if err != nil {
+		return nodeError(err)
+	}
+	api.WriteJSON(w, http.StatusOK, struct {
+		Address string  `json:"address"`
+		Balance float32 `json:"balance"`
+	}{address, balance})
+	return nil
+}
+
+func (ws *WalletServer) apiCreateTransaction(w http.ResponseWriter, req *http.Request) error {
+	var t TransactionRequest
+	if err := api.DecodeJSON(w, req, &t); err != nil {
+		return err
+	}
+	v := api.Validation{}
+	v.Check(t.SenderPrivateKey != nil, "sender_private_key", "required")
+	v.Check(t.SenderAddress != nil, "sender_address", "required")
+	v.Check(t.ReceiverAddress != nil, "receiver_address", "required")
+	v.Check(t.Amount != nil, "amount", "required")
+	if err := v.Err(); err != nil {
+		return err
+	}
+	sender, err := wallet.WalletFromPrivateKey(*t.SenderPrivateKey, ws.network)
+	if err != nil {
+		v.Check(false, "sender_private_key", err.Error())
+	} else {
+		v.Check(sender.WalletAddress() == *t.SenderAddress, "sender_address", "not the address of the private key")
+	}
+	v.Check(wallet.ValidateAddress(*t.ReceiverAddress, ws.network) == nil, "receiver_address", "invalid address")
+	v.Check(*t.Amount > 0, "amount", "must be positive")
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	signature := wallet.NewTransaction(sender.PrivateKey(), sender.PublicKey(), *t.SenderAddress,
+		*t.ReceiverAddress, *t.Amount).GenerateSignature().String()
+	publicKey := sender.PublicKeyStr()
+	hash, err := ws.node.SendTransaction(req.Context(), &blockchain.TransactionRequest{
+		SenderAddress:   t.SenderAddress,
+		ReceiverAddress: t.ReceiverAddress,
+		SenderPublicKey: &publicKey,
+		Amount:          t.Amount,
+		Signature:       &signature,
+	})
+	if err != nil {
+		return nodeError(err)
+	}
+	api.WriteJSON(w, http.StatusCreated, struct {
+		Hash string `json:"hash"`
+	}{hash})
+	return nil
+}
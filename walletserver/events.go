@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"moviecoin/blockchain"
+	"moviecoin/client"
+	"moviecoin/wallet"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SSE_KEEPALIVE keeps idle event streams from being closed by proxies
+const SSE_KEEPALIVE = 30 * time.Second
+
+// balanceEvent is the data of the balance events sent to the browsers
+type balanceEvent struct {
+	Address string  `json:"address"`
+	Amount  float32 `json:"amount"`
+}
+
+// WalletEvents relays the balance of wallet_address to the browser as
+// Server-Sent Events: once on connection, then every time it changes. The
+// node is asked for the balance whenever it streams a block or a reorg
+// involving the address. The stream ends with the one of the node, the
+// browser reconnects then.
+func (ws *WalletServer) WalletEvents(w http.ResponseWriter, req *http.Request) {
+	url := strings.Split(req.RequestURI, " ")
+	log.Printf("[%s]%s", req.Method, url[0])
+	switch req.Method {
+	case http.MethodGet:
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			log.Println("ERROR: event stream needs a flushing ResponseWriter")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		address := req.URL.Query().Get("wallet_address")
+		if err := wallet.ValidateAddress(address, ws.network); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		stream, err := ws.node.Events(ctx, []string{blockchain.EVENT_BLOCK, blockchain.EVENT_REORG}, []string{address})
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer stream.Close()
+		events := make(chan *client.Event)
+		go func() {
+			defer close(events)
+			for {
+				e, err := stream.Next()
+				if err != nil {
+					return
+				}
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "retry: 3000\n\n")
+		var last *float32
+		relay := func() error {
+			amount, err := ws.node.Balance(ctx, address)
+			if err != nil {
+				return err
+			}
+			if last != nil && *last == amount {
+				return nil
+			}
+			last = &amount
+			m, _ := json.Marshal(&balanceEvent{address, amount})
+			if _, err := fmt.Fprintf(w, "event: balance\ndata: %s\n\n", m); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+		if err := relay(); err != nil {
+			log.Printf("ERROR: %v", err)
+			return
+		}
+		keepalive := time.NewTicker(SSE_KEEPALIVE)
+		defer keepalive.Stop()
+		for {
+			select {
+			case _, ok := <-events:
+				if !ok {
+					return
+				}
+				if err := relay(); err != nil {
+					log.Printf("ERROR: %v", err)
+					return
+				}
+			case <-keepalive.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-ctx.Done():
+				return
+			}
+		}
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
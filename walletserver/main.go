@@ -4,6 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"moviecoin/client"
+	"moviecoin/config"
+	"moviecoin/security"
 	"net"
 	"os"
 )
@@ -30,17 +33,33 @@ func isLocalAddr(addr string) bool {
 }
 
 func main() {
-	port := flag.Uint("port", 8080, "TCP Port Number for Wallet Server")
-	node := flag.String("node", "localhost", "Blockchain Node")
-	node_port := flag.Uint("node_port", 5000, "Blockchain Node Port")
-
-	flag.Parse()
+	dump, args := config.ParseCommand(os.Args[1:])
+	cfg, err := config.Load(config.WALLET_SERVER, "walletserver", args)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dump {
+		os.Stdout.Write(cfg.Dump())
+		return
+	}
+	logFile, err := cfg.Log.SetupLogging()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer logFile.Close()
 
+	node := cfg.Wallet.Node
 	node_addr := "http://"
-	if !isLocalAddr(*node) {
-		addrs, err := net.LookupHost(*node)
+	if cfg.Wallet.NodeTLS {
+		// the certificate names the host, keep it
+		node_addr = "https://" + node
+	} else if !isLocalAddr(node) {
+		addrs, err := net.LookupHost(node)
 		if err != nil {
-			log.Fatalf(fmt.Sprintf("Invalid blockchain node address: %s", err))
+			log.Fatalf("Invalid blockchain node address: %s", err)
 			os.Exit(ERROR_EXIT_CODE)
 		}
 
@@ -54,8 +73,23 @@ func main() {
 			break
 		}
 	} else {
-		node_addr += *node
+		node_addr += node
+	}
+	scheme := "http://"
+	if cfg.Wallet.NodeTLS {
+		scheme = "https://"
+	}
+	nodes := []string{fmt.Sprintf("%s:%d", node_addr, cfg.Wallet.NodePort)}
+	for _, fallback := range cfg.Wallet.FallbackNodes {
+		nodes = append(nodes, scheme+fallback)
+	}
+	// the client bounds every call, a client timeout would cut the event streams
+	httpClient, err := security.NewHTTPClient(cfg.Wallet.NodeTLS, cfg.Wallet.NodeCA, 0)
+	if err != nil {
+		log.Fatal(err)
 	}
-	app := NewWalletServer(uint16(*port), node_addr, uint16(*node_port))
+	nodeClient := client.NewClient(nodes...)
+	nodeClient.HTTPClient = httpClient
+	app := NewWalletServer(cfg.Wallet.Port, nodeClient, cfg.Params(), cfg.Wallet.TLS)
 	app.Run()
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"moviecoin/client"
+	"moviecoin/metrics"
+	"net/http"
+	"time"
+)
+
+const (
+	METRICS_PATH = "/metrics"
+	HEALTHZ_PATH = "/healthz"
+	READYZ_PATH  = "/readyz"
+	// the same namespace as the chain servers
+	METRICS_NAMESPACE = "moviecoin"
+	// the nodes are asked once per check, a slow one is as good as down
+	NODE_CHECK_TIMEOUT = 3 * time.Second
+)
+
+// walletMetrics are the requests served and the state of the nodes, as seen
+// by the last check
+type walletMetrics struct {
+	registry    *metrics.Registry
+	http        *metrics.HTTP
+	nodeUp      *metrics.Gauge
+	nodeSynced  *metrics.Gauge
+	chainHeight *metrics.Gauge
+}
+
+func newWalletMetrics() *walletMetrics {
+	r := metrics.NewRegistry(METRICS_NAMESPACE)
+	return &walletMetrics{
+		registry:    r,
+		http:        metrics.NewHTTP(r),
+		nodeUp:      r.NewGauge("node_up", "1 when a node answered the last check."),
+		nodeSynced:  r.NewGauge("node_synced", "1 when a node had caught up with its peers at the last check."),
+		chainHeight: r.NewGauge("chain_height", "Height of the chain of the node at the last check."),
+	}
+}
+
+// checkNode asks the nodes whether one of them is ready
+func (ws *WalletServer) checkNode(ctx context.Context) (*client.Health, error) {
+	ctx, cancel := context.WithTimeout(ctx, NODE_CHECK_TIMEOUT)
+	defer cancel()
+	health, err := ws.node.Ready(ctx)
+	up := err == nil || client.StatusCode(err) == http.StatusServiceUnavailable
+	ws.metrics.nodeUp.Set(boolValue(up))
+	ws.metrics.nodeSynced.Set(boolValue(err == nil))
+	if health != nil {
+		ws.metrics.chainHeight.Set(float64(health.Height))
+	}
+	return health, err
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Metrics checks the nodes, then answers the scrape
+func (ws *WalletServer) Metrics(w http.ResponseWriter, req *http.Request) {
+	if _, err := ws.checkNode(req.Context()); err != nil {
+		log.Printf("WARN: no node ready: %v", err)
+	}
+	ws.metrics.registry.ServeHTTP(w, req)
+}
+
+// Healthz answers as long as the server runs
+func (ws *WalletServer) Healthz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// Readyz answers 503 unless a node is ready: the wallets would otherwise
+// see the balances of an old chain
+func (ws *WalletServer) Readyz(w http.ResponseWriter, req *http.Request) {
+	resp := struct {
+		Status string         `json:"status"`
+		Node   *client.Health `json:"node,omitempty"`
+		Error  string         `json:"error,omitempty"`
+	}{Status: "ok"}
+	code := http.StatusOK
+	health, err := ws.checkNode(req.Context())
+	if err != nil {
+		resp.Status = "unavailable"
+		resp.Error = err.Error()
+		code = http.StatusServiceUnavailable
+	}
+	resp.Node = health
+	m, _ := json.Marshal(resp)
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(m)
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
 	"html/template"
 	"io"
 	"log"
+	"moviecoin/api"
 	"moviecoin/blockchain"
+	"moviecoin/client"
+	"moviecoin/config"
+	"moviecoin/params"
+	"moviecoin/security"
 	"moviecoin/utils"
 	"net/http"
 	"path"
@@ -22,21 +25,20 @@ const tempDir = "./templates"
 
 type WalletServer struct {
 	blockchain_node_port uint16
-	blockchain_node      string
+	node                 *client.Client // to the blockchain nodes
+	network              *params.Network
+	tls                  config.TLSConfig
+	metrics              *walletMetrics
 }
 
-func NewWalletServer(port uint16, gateway string, gateway_port uint16) *WalletServer {
-	return &WalletServer{port, gateway + fmt.Sprintf(":%d", gateway_port)}
+func NewWalletServer(port uint16, node *client.Client, network *params.Network, tls config.TLSConfig) *WalletServer {
+	return &WalletServer{port, node, network, tls, newWalletMetrics()}
 }
 
 func (ws *WalletServer) Port() uint16 {
 	return ws.blockchain_node_port
 }
 
-func (ws *WalletServer) Gateway() string {
-	return ws.blockchain_node
-}
-
 func (ws *WalletServer) Index(w http.ResponseWriter, req *http.Request) {
 	url := strings.Split(req.RequestURI, " ")
 	log.Printf("[%s]%s", req.Method, url[0])
@@ -44,7 +46,7 @@ func (ws *WalletServer) Index(w http.ResponseWriter, req *http.Request) {
 	case http.MethodGet:
 		t, err := template.ParseFiles(path.Join(tempDir, "index.html"))
 		if err != nil {
-			log.Printf("ERROR processing template: %s", err)
+			log.Printf("ERROR: processing template: %s", err)
 		}
 		t.Execute(w, "")
 	default:
@@ -58,7 +60,7 @@ func (ws *WalletServer) Wallet(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodPost:
 		w.Header().Add("Content-Type", "application/json")
-		myWallet := wallet.NewWallet()
+		myWallet := wallet.NewWallet(ws.network)
 		m, _ := myWallet.MarshalJSON()
 		io.WriteString(w, string(m[:]))
 	default:
@@ -114,15 +116,12 @@ func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Reque
 			Amount:          &value32,
 			Signature:       &signatureStr,
 		}
-		m, _ := json.Marshal(bt)
-		buf := bytes.NewBuffer(m)
-
-		resp, _ := http.Post(ws.Gateway()+"/transactions", "application/json", buf)
-		if resp.StatusCode == 201 {
-			io.WriteString(w, string(utils.JsonStatus("success")))
+		if _, err := ws.node.SendTransaction(req.Context(), bt); err != nil {
+			log.Printf("ERROR: %v", err)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
-		io.WriteString(w, string(utils.JsonStatus("fail")))
+		io.WriteString(w, string(utils.JsonStatus("success")))
 	default:
 		w.WriteHeader(http.StatusBadRequest)
 		log.Println("ERROR: Invalid HTTP Method")
@@ -135,43 +134,22 @@ func (ws *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		blockchainAddress := req.URL.Query().Get("wallet_address")
-		endpoint := fmt.Sprintf("%s/amount", ws.Gateway())
-
-		client := &http.Client{}
-		bcsReq, _ := http.NewRequest("GET", endpoint, nil)
-		q := bcsReq.URL.Query()
-		q.Add("blockchain_address", blockchainAddress)
-		bcsReq.URL.RawQuery = q.Encode()
+		amount, err := ws.node.Balance(req.Context(), blockchainAddress)
 
-		bcsResp, err := client.Do(bcsReq)
+		w.Header().Add("Content-Type", "application/json")
 		if err != nil {
 			log.Printf("ERROR: %v", err)
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
-
-		w.Header().Add("Content-Type", "application/json")
-		if bcsResp.StatusCode == 200 {
-			decoder := json.NewDecoder(bcsResp.Body)
-			var bar blockchain.AmountResponse
-			err := decoder.Decode(&bar)
-			if err != nil {
-				log.Printf("ERROR: %v", err)
-				io.WriteString(w, string(utils.JsonStatus("fail")))
-				return
-			}
-
-			m, _ := json.Marshal(struct {
-				Message string  `json:"message"`
-				Amount  float32 `json:"amount"`
-			}{
-				Message: "success",
-				Amount:  bar.Amount,
-			})
-			io.WriteString(w, string(m[:]))
-		} else {
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-		}
+		m, _ := json.Marshal(struct {
+			Message string  `json:"message"`
+			Amount  float32 `json:"amount"`
+		}{
+			Message: "success",
+			Amount:  amount,
+		})
+		io.WriteString(w, string(m[:]))
 	default:
 		log.Printf("ERROR: Invalid HTTP Method")
 		w.WriteHeader(http.StatusBadRequest)
@@ -210,7 +188,13 @@ func (ws *WalletServer) Run() {
 	http.HandleFunc("/", ws.Index)
 	http.HandleFunc("/wallet", ws.Wallet)
 	http.HandleFunc("/wallet/amount", ws.WalletAmount)
+	http.HandleFunc("/wallet/events", ws.WalletEvents)
 	http.HandleFunc("/transaction", ws.CreateTransaction)
 	http.HandleFunc("/templates/", ws.AssetServe)
-	log.Fatalf("%v", http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(ws.Port())), nil))
+	http.Handle(api.PREFIX+"/", ws.APIRouter())
+	http.HandleFunc(METRICS_PATH, ws.Metrics)
+	http.HandleFunc(HEALTHZ_PATH, ws.Healthz)
+	http.HandleFunc(READYZ_PATH, ws.Readyz)
+	log.Fatalf("%v", security.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(ws.Port())), ws.tls.CertFile, ws.tls.KeyFile,
+		ws.metrics.http.Instrument(http.DefaultServeMux)))
 }
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"moviecoin/api"
+	"moviecoin/client"
+	"moviecoin/config"
+	"moviecoin/params"
+	"moviecoin/wallet"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	ws := NewWalletServer(0, client.NewClient("http://localhost"), params.Regtest, config.TLSConfig{})
+	if err := api.CheckOpenAPI(openAPIDocument, ws.APIRouter()); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestAPITransaction checks the request sent to the node and that the errors
+// of the node are passed through
+func TestAPITransaction(t *testing.T) {
+	sender := wallet.NewWallet(params.Regtest)
+	recipient := wallet.NewWallet(params.Regtest).WalletAddress()
+	var funded bool
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != api.PREFIX+"/transactions" {
+			api.WriteError(w, api.NotFound(req.URL.Path))
+			return
+		}
+		var tr struct {
+			SenderAddress   string  `json:"sender_address"`
+			SenderPublicKey string  `json:"sender_public_key"`
+			Amount          float32 `json:"amount"`
+			Signature       string  `json:"signature"`
+		}
+		json.NewDecoder(req.Body).Decode(&tr)
+		if tr.SenderAddress != sender.WalletAddress() || tr.SenderPublicKey != sender.PublicKeyStr() ||
+			tr.Amount != 1.5 || len(tr.Signature) != 128 {
+			t.Errorf("node received %+v", tr)
+		}
+		if !funded {
+			api.WriteError(w, api.Rejected("insufficient funds"))
+			return
+		}
+		api.WriteJSON(w, http.StatusCreated, map[string]string{"hash": "00"})
+	}))
+	defer node.Close()
+	ws := NewWalletServer(0, client.NewClient(node.URL), params.Regtest, config.TLSConfig{})
+	router := ws.APIRouter()
+	post := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		m, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, api.PREFIX+"/transactions", strings.NewReader(string(m))))
+		return w
+	}
+	body := map[string]interface{}{
+		"sender_private_key": sender.PrivateKeyStr(),
+		"sender_address":     sender.WalletAddress(),
+		"receiver_address":   recipient,
+		"amount":             1.5,
+	}
+
+	if w := post(body); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), api.CODE_REJECTED) {
+		t.Errorf("node rejection: %d %s", w.Code, w.Body)
+	}
+	funded = true
+	if w := post(body); w.Code != http.StatusCreated {
+		t.Errorf("transaction: %d %s", w.Code, w.Body)
+	}
+	body["sender_address"] = recipient
+	if w := post(body); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), api.CODE_VALIDATION) {
+		t.Errorf("address of another key: %d %s", w.Code, w.Body)
+	}
+
+	node.Close()
+	body["sender_address"] = sender.WalletAddress()
+	if w := post(body); w.Code != http.StatusBadGateway {
+		t.Errorf("node down: %d %s", w.Code, w.Body)
+	}
+}
+
+// TestWalletEvents checks that a balance event is relayed on connection and
+// on the node events changing the balance only
+func TestWalletEvents(t *testing.T) {
+	address := wallet.NewWallet(params.Regtest).WalletAddress()
+	balances := []float32{0, 50, 50}
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case client.EVENTS_PATH:
+			if req.URL.Query().Get("address") != address {
+				t.Errorf("node events of %q", req.URL.Query().Get("address"))
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, ": keepalive\n\nevent: block\ndata: {}\n\nevent: block\ndata: {}\n\n")
+		case api.PREFIX + "/addresses/" + address + "/balance":
+			api.WriteJSON(w, http.StatusOK, map[string]interface{}{"address": address, "balance": balances[0]})
+			balances = balances[1:]
+		default:
+			api.WriteError(w, api.NotFound(req.URL.Path))
+		}
+	}))
+	defer node.Close()
+	ws := NewWalletServer(0, client.NewClient(node.URL), params.Regtest, config.TLSConfig{})
+
+	w := httptest.NewRecorder()
+	ws.WalletEvents(w, httptest.NewRequest(http.MethodGet, "/wallet/events?wallet_address="+address, nil))
+	if w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("%d %s", w.Code, w.Body)
+	}
+	want := "retry: 3000\n\n" +
+		"event: balance\ndata: {\"address\":\"" + address + "\",\"amount\":0}\n\n" +
+		"event: balance\ndata: {\"address\":\"" + address + "\",\"amount\":50}\n\n"
+	if w.Body.String() != want {
+		t.Errorf("got %q, expected %q", w.Body, want)
+	}
+	if len(balances) != 0 {
+		t.Errorf("%d balance requests left", len(balances))
+	}
+
+	w = httptest.NewRecorder()
+	ws.WalletEvents(w, httptest.NewRequest(http.MethodGet, "/wallet/events?wallet_address=nobody", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid address: %d", w.Code)
+	}
+}
+
+// TestReadyz follows the readiness of the node through the checks of the
+// wallet server
+func TestReadyz(t *testing.T) {
+	synced := false
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != READYZ_PATH {
+			api.WriteError(w, api.NotFound(req.URL.Path))
+			return
+		}
+		if !synced {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, `{"status":"syncing","height":3,"target_height":7,"syncing":true}`)
+			return
+		}
+		io.WriteString(w, `{"status":"ok","height":7,"target_height":7}`)
+	}))
+	ws := NewWalletServer(0, client.NewClient(node.URL), params.Regtest, config.TLSConfig{})
+	mux := http.NewServeMux()
+	mux.HandleFunc(METRICS_PATH, ws.Metrics)
+	mux.HandleFunc(READYZ_PATH, ws.Readyz)
+	handler := ws.metrics.http.Instrument(mux)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	expect := func(state string, lines ...string) {
+		t.Helper()
+		body := get(METRICS_PATH).Body.String()
+		for _, line := range lines {
+			if !strings.Contains(body, line+"\n") {
+				t.Errorf("%s: missing %s in\n%s", state, line, body)
+			}
+		}
+	}
+
+	if w := get(READYZ_PATH); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("syncing node: %d %s", w.Code, w.Body)
+	}
+	expect("syncing", "moviecoin_node_up 1", "moviecoin_node_synced 0")
+
+	synced = true
+	w := get(READYZ_PATH)
+	var ready struct {
+		Status string
+		Node   *client.Health
+	}
+	json.Unmarshal(w.Body.Bytes(), &ready)
+	if w.Code != http.StatusOK || ready.Status != "ok" || ready.Node == nil || ready.Node.Height != 7 {
+		t.Errorf("synced node: %d %s", w.Code, w.Body)
+	}
+	expect("synced", "moviecoin_node_up 1", "moviecoin_node_synced 1", "moviecoin_chain_height 7",
+		`moviecoin_http_requests_total{handler="/readyz",method="GET",code="503"} 1`,
+		`moviecoin_http_requests_total{handler="/readyz",method="GET",code="200"} 1`)
+
+	node.Close()
+	if w := get(READYZ_PATH); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("node down: %d %s", w.Code, w.Body)
+	}
+	expect("down", "moviecoin_node_up 0", "moviecoin_node_synced 0")
+}